@@ -0,0 +1,442 @@
+package agent
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math/rand"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Config — настройки агента на DNS сервере
+type Config struct {
+    PanelURL  string // адрес панели, пустой — только приём зон от панели (Listen)
+    Name      string // имя сервера в панели
+    Token     string
+    CertFile  string // клиентский сертификат для mTLS
+    KeyFile   string
+    CAFile    string // CA для проверки сертификата панели
+    ZoneDir   string
+    ConfPath  string
+    StateFile string
+
+    Interval time.Duration // пауза между синхронизациями
+    RetryMax time.Duration // наибольшая пауза после ошибок
+
+    CheckZoneCommand string // проверка файла зоны: <команда> <зона> <файл>
+    CheckConfCommand string // проверка zones.conf: <команда> <файл>
+    ReloadCommand    string // выполняется через sh -c
+    StatusCommand    string
+
+    Listen     string // адрес для приёма зон от панели (транспорт http)
+    ListenCert string
+    ListenKey  string
+
+    Version string
+}
+
+// zoneState — применённая зона
+type zoneState struct {
+    Serial int64  `json:"serial"`
+    Hash   string `json:"hash"`
+}
+
+// state хранится в StateFile, чтобы после перезапуска не скачивать всё заново
+type state struct {
+    Zones         map[string]zoneState `json:"zones"`
+    ConfHash      string               `json:"conf_hash"`
+    ReloadPending bool                 `json:"reload_pending"`
+}
+
+// Agent синхронизирует файлы зон сервера с панелью
+type Agent struct {
+    cfg    Config
+    client *http.Client
+
+    mu    sync.Mutex // синхронизация с панелью и приём зон не идут одновременно
+    state state
+}
+
+var zoneNameRe = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?$`)
+
+// validZoneName не пропускает имена, которые выходят за каталог зон
+func validZoneName(name string) bool {
+    return len(name) <= 253 && zoneNameRe.MatchString(name) && !strings.Contains(name, "..")
+}
+
+func New(cfg Config) (*Agent, error) {
+    if cfg.PanelURL == "" && cfg.Listen == "" {
+        return nil, errors.New("не задан ни адрес панели, ни адрес для приёма зон")
+    }
+    if cfg.ZoneDir == "" || cfg.ConfPath == "" {
+        return nil, errors.New("не заданы каталог зон и путь к zones.conf")
+    }
+    if cfg.Interval <= 0 {
+        cfg.Interval = 30 * time.Second
+    }
+    if cfg.RetryMax < cfg.Interval {
+        cfg.RetryMax = cfg.Interval
+    }
+    if cfg.StateFile == "" {
+        cfg.StateFile = filepath.Join(cfg.ZoneDir, ".dns-manager-agent.json")
+    }
+
+    tlsConfig := &tls.Config{}
+    if cfg.CertFile != "" || cfg.KeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("клиентский сертификат: %v", err)
+        }
+        tlsConfig.Certificates = []tls.Certificate{cert}
+    }
+    if cfg.CAFile != "" {
+        pem, err := os.ReadFile(cfg.CAFile)
+        if err != nil {
+            return nil, fmt.Errorf("CA панели: %v", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("CA панели: в %s нет сертификатов", cfg.CAFile)
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    a := &Agent{
+        cfg: cfg,
+        client: &http.Client{
+            Timeout:   30 * time.Second,
+            Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+        },
+    }
+    a.loadState()
+    return a, nil
+}
+
+// Run запускает приём зон и синхронизацию с панелью. Пока панель недоступна,
+// сервер продолжает обслуживать последние полученные зоны, а агент повторяет
+// попытки с растущей паузой. Как только связь появляется, сервер приводится
+// к состоянию из манифеста.
+func (a *Agent) Run() error {
+    errc := make(chan error, 1)
+    if a.cfg.Listen != "" {
+        go func() { errc <- a.serve() }()
+    }
+    if a.cfg.PanelURL == "" {
+        return <-errc
+    }
+
+    delay := a.cfg.Interval
+    for {
+        if err := a.SyncOnce(); err != nil {
+            log.Printf("Agent: sync failed: %v", err)
+            delay *= 2
+            if delay > a.cfg.RetryMax {
+                delay = a.cfg.RetryMax
+            }
+        } else {
+            delay = a.cfg.Interval
+        }
+
+        // Случайная добавка, чтобы серверы не приходили к панели одновременно
+        wait := delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+        select {
+        case err := <-errc:
+            return err
+        case <-time.After(wait):
+        }
+    }
+}
+
+// SyncOnce приводит файлы сервера к манифесту панели и отправляет отчёт
+func (a *Agent) SyncOnce() error {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    var manifest Manifest
+    if err := a.getJSON("/manifest", &manifest); err != nil {
+        return fmt.Errorf("манифест: %v", err)
+    }
+
+    var errs []string
+    changed := false
+    wanted := make(map[string]bool, len(manifest.Zones))
+
+    for _, zone := range manifest.Zones {
+        if !validZoneName(zone.Name) {
+            errs = append(errs, "некорректное имя зоны "+zone.Name)
+            continue
+        }
+        wanted[zone.Name] = true
+        current, ok := a.state.Zones[zone.Name]
+        if ok && current.Hash == zone.Hash && fileExists(a.zonePath(zone.Name)) {
+            continue
+        }
+        data, err := a.get("/zones/" + url.PathEscape(zone.Name))
+        if err != nil {
+            errs = append(errs, zone.Name+": "+err.Error())
+            continue
+        }
+        if err := a.writeZone(zone.Name, data); err != nil {
+            errs = append(errs, zone.Name+": "+err.Error())
+            continue
+        }
+        // Файл мог измениться между манифестом и загрузкой, тогда хеш не
+        // совпадёт и зона скачается ещё раз на следующем проходе
+        a.state.Zones[zone.Name] = zoneState{Serial: zone.Serial, Hash: hashData(data)}
+        changed = true
+    }
+
+    if manifest.ConfHash != a.state.ConfHash || !fileExists(a.cfg.ConfPath) {
+        data, err := a.get("/zones.conf")
+        if err == nil {
+            err = a.writeConf(data)
+        }
+        if err != nil {
+            errs = append(errs, "zones.conf: "+err.Error())
+        } else {
+            a.state.ConfHash = hashData(data)
+            changed = true
+        }
+    }
+
+    // Зоны удаляются после zones.conf, в котором их уже нет
+    for name := range a.state.Zones {
+        if wanted[name] {
+            continue
+        }
+        if err := removeFile(a.zonePath(name)); err != nil {
+            errs = append(errs, name+": "+err.Error())
+            continue
+        }
+        delete(a.state.Zones, name)
+        changed = true
+    }
+
+    if changed {
+        a.state.ReloadPending = true
+    }
+    if a.state.ReloadPending {
+        if err := runShell(a.cfg.ReloadCommand); err != nil {
+            errs = append(errs, "перезагрузка: "+err.Error())
+        } else {
+            a.state.ReloadPending = false
+        }
+    }
+    if err := a.saveState(); err != nil {
+        errs = append(errs, "состояние агента: "+err.Error())
+    }
+
+    syncErr := strings.Join(errs, "; ")
+    if err := a.report(syncErr); err != nil {
+        log.Printf("Agent: report failed: %v", err)
+    }
+    if syncErr != "" {
+        return errors.New(syncErr)
+    }
+    return nil
+}
+
+// report отправляет панели serial применённых зон и состояние сервера
+func (a *Agent) report(syncErr string) error {
+    report := Report{
+        Healthy:       true,
+        Error:         syncErr,
+        ConfHash:      a.state.ConfHash,
+        Zones:         make(map[string]int64, len(a.state.Zones)),
+        ReloadPending: a.state.ReloadPending,
+        Version:       a.cfg.Version,
+    }
+    for name, zone := range a.state.Zones {
+        report.Zones[name] = zone.Serial
+    }
+    if err := runShell(a.cfg.StatusCommand); err != nil {
+        report.Healthy = false
+        if report.Error == "" {
+            report.Error = "сервер не работает: " + err.Error()
+        }
+    }
+
+    data, err := json.Marshal(report)
+    if err != nil {
+        return err
+    }
+    _, err = a.do(http.MethodPost, "/report", bytes.NewReader(data))
+    return err
+}
+
+func (a *Agent) do(method, path string, body io.Reader) ([]byte, error) {
+    req, err := http.NewRequest(method, strings.TrimSuffix(a.cfg.PanelURL, "/")+APIPrefix+path, body)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set(ServerHeader, a.cfg.Name)
+    if a.cfg.Token != "" {
+        req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := a.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+    }
+    return data, nil
+}
+
+func (a *Agent) get(path string) ([]byte, error) {
+    return a.do(http.MethodGet, path, nil)
+}
+
+func (a *Agent) getJSON(path string, out interface{}) error {
+    data, err := a.get(path)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(data, out)
+}
+
+func (a *Agent) zonePath(name string) string {
+    return filepath.Join(a.cfg.ZoneDir, name+".zone")
+}
+
+// writeZone проверяет файл зоны и атомарно заменяет им старый
+func (a *Agent) writeZone(name string, data []byte) error {
+    path := a.zonePath(name)
+    return writeAtomic(path, data, 0644, func(tmp string) error {
+        if a.cfg.CheckZoneCommand == "" {
+            return nil
+        }
+        return runCommand(a.cfg.CheckZoneCommand, name, tmp)
+    })
+}
+
+// writeConf проверяет zones.conf и атомарно заменяет им старый. В файле
+// секреты TSIG ключей.
+func (a *Agent) writeConf(data []byte) error {
+    return writeAtomic(a.cfg.ConfPath, data, 0640, func(tmp string) error {
+        if a.cfg.CheckConfCommand == "" {
+            return nil
+        }
+        return runCommand(a.cfg.CheckConfCommand, tmp)
+    })
+}
+
+// writeAtomic пишет данные во временный файл рядом с целевым, проверяет его
+// и переименовывает. Сервер никогда не видит файл наполовину записанным.
+func writeAtomic(path string, data []byte, perm os.FileMode, check func(tmp string) error) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    if err := os.Chmod(tmp.Name(), perm); err != nil {
+        return err
+    }
+    if check != nil {
+        if err := check(tmp.Name()); err != nil {
+            return fmt.Errorf("проверка не пройдена: %v", err)
+        }
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// runCommand выполняет команду из конфига с дополнительными аргументами
+func runCommand(command string, args ...string) error {
+    fields := strings.Fields(command)
+    if len(fields) == 0 {
+        return nil
+    }
+    out, err := exec.Command(fields[0], append(fields[1:], args...)...).CombinedOutput()
+    if err != nil {
+        if output := strings.TrimSpace(string(out)); output != "" {
+            return fmt.Errorf("%v: %s", err, output)
+        }
+        return err
+    }
+    return nil
+}
+
+// runShell выполняет команду через sh -c, чтобы работали && и перенаправления
+func runShell(command string) error {
+    if strings.TrimSpace(command) == "" {
+        return nil
+    }
+    return runCommand("sh -c", command)
+}
+
+func (a *Agent) loadState() {
+    a.state = state{Zones: make(map[string]zoneState)}
+    data, err := os.ReadFile(a.cfg.StateFile)
+    if err != nil {
+        return
+    }
+    if err := json.Unmarshal(data, &a.state); err != nil {
+        log.Printf("Agent: state file %s is corrupted, starting from scratch: %v", a.cfg.StateFile, err)
+        a.state = state{}
+    }
+    if a.state.Zones == nil {
+        a.state.Zones = make(map[string]zoneState)
+    }
+}
+
+func (a *Agent) saveState() error {
+    data, err := json.MarshalIndent(a.state, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeAtomic(a.cfg.StateFile, data, 0600, nil)
+}
+
+func hashData(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// removeFile удаляет файл, отсутствие файла ошибкой не считается
+func removeFile(path string) error {
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func fileExists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
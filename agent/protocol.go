@@ -0,0 +1,43 @@
+package agent
+
+// Обмен агента с панелью. Агент запрашивает у панели:
+//
+//    GET  /agent/v1/manifest      список зон сервера и хеш zones.conf
+//    GET  /agent/v1/zones/{name}  файл зоны
+//    GET  /agent/v1/zones.conf    zones.conf с путями сервера
+//    POST /agent/v1/report        состояние сервера после синхронизации
+//
+// Агент представляется именем сервера в заголовке X-DNS-Server и токеном в
+// Authorization либо клиентским сертификатом, CN которого совпадает с именем.
+
+const (
+    // ServerHeader — заголовок с именем сервера из панели
+    ServerHeader = "X-DNS-Server"
+    APIPrefix    = "/agent/v1"
+)
+
+// ManifestZone — зона, которую сервер должен обслуживать
+type ManifestZone struct {
+    Name   string `json:"name"`
+    Serial int64  `json:"serial"`
+    Hash   string `json:"hash"` // sha256 файла зоны в hex
+}
+
+// Manifest — полное желаемое состояние сервера. Зоны, которых в нём нет,
+// агент удаляет.
+type Manifest struct {
+    ConfHash string         `json:"conf_hash"`
+    Zones    []ManifestZone `json:"zones"`
+}
+
+// Report — состояние сервера, которое агент отправляет панели. Пока
+// ReloadPending, файлы записаны, но сервер их ещё не загрузил, и панель
+// не считает их применёнными.
+type Report struct {
+    Healthy       bool             `json:"healthy"`
+    Error         string           `json:"error"`
+    ConfHash      string           `json:"conf_hash"`
+    Zones         map[string]int64 `json:"zones"` // serial записанных зон
+    ReloadPending bool             `json:"reload_pending"`
+    Version       string           `json:"version"`
+}
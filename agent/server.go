@@ -0,0 +1,144 @@
+package agent
+
+import (
+    "crypto/subtle"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// serve принимает зоны, которые панель отправляет сама (транспорт http):
+//
+//    PUT    /v1/zones/{name}
+//    DELETE /v1/zones/{name}
+//    PUT    /v1/zones.conf
+//    POST   /v1/reload
+//    GET    /v1/status
+func (a *Agent) serve() error {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/v1/zones.conf", a.handleConf)
+    mux.HandleFunc("/v1/zones/", a.handleZone)
+    mux.HandleFunc("/v1/reload", a.handleReload)
+    mux.HandleFunc("/v1/status", a.handleStatus)
+
+    srv := &http.Server{
+        Addr:         a.cfg.Listen,
+        Handler:      a.authorize(mux),
+        ReadTimeout:  30 * time.Second,
+        WriteTimeout: 60 * time.Second,
+    }
+    log.Printf("Agent: listening on %s", a.cfg.Listen)
+    if a.cfg.ListenCert != "" {
+        return srv.ListenAndServeTLS(a.cfg.ListenCert, a.cfg.ListenKey)
+    }
+    return srv.ListenAndServe()
+}
+
+// authorize пропускает только запросы с токеном сервера
+func (a *Agent) authorize(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if a.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.Token)) != 1 {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+    return io.ReadAll(io.LimitReader(r.Body, 64<<20))
+}
+
+func (a *Agent) handleZone(w http.ResponseWriter, r *http.Request) {
+    name := strings.TrimPrefix(r.URL.Path, "/v1/zones/")
+    if !validZoneName(name) {
+        http.Error(w, "некорректное имя зоны", http.StatusBadRequest)
+        return
+    }
+
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    switch r.Method {
+    case http.MethodPut:
+        data, err := readBody(r)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := a.writeZone(name, data); err != nil {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        a.state.Zones[name] = zoneState{Hash: hashData(data)}
+    case http.MethodDelete:
+        if err := removeFile(a.zonePath(name)); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        delete(a.state.Zones, name)
+    default:
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    a.state.ReloadPending = true
+    a.saveStateLogged()
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) handleConf(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPut {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    data, err := readBody(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if err := a.writeConf(data); err != nil {
+        http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+        return
+    }
+    a.state.ConfHash = hashData(data)
+    a.state.ReloadPending = true
+    a.saveStateLogged()
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) handleReload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if err := runShell(a.cfg.ReloadCommand); err != nil {
+        http.Error(w, err.Error(), http.StatusBadGateway)
+        return
+    }
+    a.state.ReloadPending = false
+    a.saveStateLogged()
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
+    if err := runShell(a.cfg.StatusCommand); err != nil {
+        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Agent) saveStateLogged() {
+    if err := a.saveState(); err != nil {
+        log.Printf("Agent: cannot save state: %v", err)
+    }
+}
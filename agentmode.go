@@ -0,0 +1,120 @@
+package main
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "flag"
+    "log"
+    "net/http"
+    "os"
+    "time"
+
+    "dns-manager/agent"
+    "dns-manager/handlers"
+    "dns-manager/models"
+
+    "github.com/gorilla/mux"
+    "github.com/spf13/viper"
+)
+
+// agentRoutes регистрирует API, через которое агенты забирают зоны
+func agentRoutes(r *mux.Router, db *models.DB) {
+    r.HandleFunc("/manifest", handlers.AgentManifestHandler(db)).Methods("GET")
+    r.HandleFunc("/zones.conf", handlers.AgentConfHandler(db)).Methods("GET")
+    r.HandleFunc("/zones/{name}", handlers.AgentZoneHandler(db)).Methods("GET")
+    r.HandleFunc("/report", handlers.AgentReportHandler(db)).Methods("POST")
+}
+
+// serveAgentAPI запускает отдельный порт для агентов, которые входят по
+// клиентскому сертификату
+func serveAgentAPI(addr string, db *models.DB) {
+    pem, err := os.ReadFile(viper.GetString("agent_api.client_ca"))
+    if err != nil {
+        log.Printf("Agent API: cannot read client CA: %v", err)
+        return
+    }
+    pool := x509.NewCertPool()
+    if !pool.AppendCertsFromPEM(pem) {
+        log.Printf("Agent API: no certificates in client CA")
+        return
+    }
+
+    router := mux.NewRouter()
+    agentRoutes(router.PathPrefix(agent.APIPrefix).Subrouter(), db)
+    srv := &http.Server{
+        Addr:         addr,
+        Handler:      router,
+        TLSConfig:    &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool},
+        WriteTimeout: 60 * time.Second,
+        ReadTimeout:  15 * time.Second,
+    }
+    log.Printf("Agent API starting on %s", addr)
+    log.Printf("Agent API stopped: %v", srv.ListenAndServeTLS(viper.GetString("agent_api.cert"), viper.GetString("agent_api.key")))
+}
+
+// runAgent — режим dns-manager agent. Настройки читаются из отдельного
+// файла, БД и конфиг панели агенту не нужны.
+func runAgent(args []string) {
+    flags := flag.NewFlagSet("agent", flag.ExitOnError)
+    configPath := flags.String("config", "/etc/dns-manager/agent.yaml", "файл настроек агента")
+    once := flags.Bool("once", false, "синхронизировать один раз и выйти")
+    flags.Parse(args)
+
+    v := viper.New()
+    v.SetConfigFile(*configPath)
+    v.SetDefault("panel_url", "")
+    v.SetDefault("name", "")
+    v.SetDefault("token", "")
+    v.SetDefault("tls.cert", "")
+    v.SetDefault("tls.key", "")
+    v.SetDefault("tls.ca", "")
+    v.SetDefault("zone_dir", "/etc/nsd/zones")
+    v.SetDefault("conf_path", "/etc/nsd/zones.conf")
+    v.SetDefault("state_file", "")
+    v.SetDefault("interval", 30)
+    v.SetDefault("retry_max", 600)
+    v.SetDefault("commands.checkzone", "nsd-checkzone")
+    v.SetDefault("commands.checkconf", "nsd-checkconf")
+    v.SetDefault("commands.reload", "nsd-control reconfig && nsd-control reload")
+    v.SetDefault("commands.status", "nsd-control status")
+    v.SetDefault("listen.addr", "")
+    v.SetDefault("listen.cert", "")
+    v.SetDefault("listen.key", "")
+    if err := v.ReadInConfig(); err != nil {
+        log.Fatal("Failed to load agent config:", err)
+    }
+
+    a, err := agent.New(agent.Config{
+        PanelURL:         v.GetString("panel_url"),
+        Name:             v.GetString("name"),
+        Token:            v.GetString("token"),
+        CertFile:         v.GetString("tls.cert"),
+        KeyFile:          v.GetString("tls.key"),
+        CAFile:           v.GetString("tls.ca"),
+        ZoneDir:          v.GetString("zone_dir"),
+        ConfPath:         v.GetString("conf_path"),
+        StateFile:        v.GetString("state_file"),
+        Interval:         time.Duration(v.GetInt("interval")) * time.Second,
+        RetryMax:         time.Duration(v.GetInt("retry_max")) * time.Second,
+        CheckZoneCommand: v.GetString("commands.checkzone"),
+        CheckConfCommand: v.GetString("commands.checkconf"),
+        ReloadCommand:    v.GetString("commands.reload"),
+        StatusCommand:    v.GetString("commands.status"),
+        Listen:           v.GetString("listen.addr"),
+        ListenCert:       v.GetString("listen.cert"),
+        ListenKey:        v.GetString("listen.key"),
+        Version:          Version,
+    })
+    if err != nil {
+        log.Fatal("Failed to start agent:", err)
+    }
+
+    log.Printf("DNS Manager agent v%s starting", Version)
+    if *once {
+        if err := a.SyncOnce(); err != nil {
+            log.Fatal("Sync failed:", err)
+        }
+        return
+    }
+    log.Fatal(a.Run())
+}
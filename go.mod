@@ -8,5 +8,6 @@ require (
     github.com/mattn/go-sqlite3 v1.14.22
     github.com/spf13/viper v1.18.2
     golang.org/x/crypto v0.21.0
+    golang.org/x/net v0.22.0
     gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
\ No newline at end of file
@@ -19,7 +19,7 @@ func GetSettingsHandler(store *sessions.CookieStore) http.HandlerFunc {
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapViewSettings) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -46,7 +46,7 @@ func UpdateSettingsHandler(store *sessions.CookieStore) http.HandlerFunc {
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapManageSettings) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -102,7 +102,7 @@ func GetLogsHandler(store *sessions.CookieStore) http.HandlerFunc {
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapViewLogs) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -141,7 +141,7 @@ func GetUserActivityHandler(db *models.DB, store *sessions.CookieStore) http.Han
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapViewUsers) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -180,7 +180,7 @@ func GetZoneFilesHandler(store *sessions.CookieStore) http.HandlerFunc {
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapViewZoneFiles) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -5,9 +5,20 @@ import (
     "log"
     "net/http"
 
+    "dns-manager/models"
+
     "github.com/gorilla/sessions"
 )
 
+// adminPageCapabilities — право, необходимое для просмотра страницы администрирования
+var adminPageCapabilities = map[string]models.Capability{
+    "users":         models.CapViewUsers,
+    "user_activity": models.CapViewUsers,
+    "settings":      models.CapViewSettings,
+    "logs":          models.CapViewLogs,
+    "zonefiles":     models.CapViewZoneFiles,
+}
+
 func AdminPageHandler(page string, store *sessions.CookieStore) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         session, _ := store.Get(r, "session")
@@ -43,7 +54,7 @@ func AdminPageHandler(page string, store *sessions.CookieStore) http.HandlerFunc
             return
         }
 
-        if role != "admin" {
+        if !models.RoleCan(role, adminPageCapabilities[page]) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -59,11 +70,15 @@ func AdminPageHandler(page string, store *sessions.CookieStore) http.HandlerFunc
         }
 
         data := struct {
-            Username string
-            UserRole string
+            Username         string
+            UserRole         string
+            Capabilities     map[string]bool
+            RoleCapabilities map[string]map[string]bool
         }{
-            Username: username,
-            UserRole: role,
+            Username:         username,
+            UserRole:         role,
+            Capabilities:     capabilitySet(role),
+            RoleCapabilities: roleCapabilitySets(),
         }
 
         w.Header().Set("Content-Type", "text/html; charset=utf-8")
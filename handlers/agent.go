@@ -0,0 +1,132 @@
+package handlers
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "dns-manager/agent"
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+)
+
+// agentServer определяет сервер, от имени которого пришёл агент: по
+// проверенному клиентскому сертификату (CN — имя сервера) или по имени в
+// заголовке X-DNS-Server и токену сервера
+func agentServer(db *models.DB, r *http.Request) *models.DNSServer {
+    var server *models.DNSServer
+    if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+        server, _ = models.GetDNSServerByName(db, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+        if server == nil {
+            return nil
+        }
+    } else {
+        token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        name := r.Header.Get(agent.ServerHeader)
+        if token == "" || name == "" {
+            return nil
+        }
+        server, _ = models.GetDNSServerByName(db, name)
+        if server == nil {
+            return nil
+        }
+        encrypted, err := models.GetDNSServerToken(db, server.ID)
+        if err != nil || encrypted == "" {
+            return nil
+        }
+        expected, err := services.DecryptSecret(encrypted)
+        if err != nil || subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+            return nil
+        }
+    }
+    if !server.Enabled || server.Transport != models.TransportPull {
+        return nil
+    }
+    return server
+}
+
+// AgentManifestHandler отдаёт агенту список зон сервера
+func AgentManifestHandler(db *models.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        server := agentServer(db, r)
+        if server == nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        manifest, err := services.AgentManifest(db, server)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(manifest)
+    }
+}
+
+// AgentZoneHandler отдаёт агенту файл зоны
+func AgentZoneHandler(db *models.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if agentServer(db, r) == nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        data, err := services.AgentZoneFile(db, mux.Vars(r)["name"])
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if data == nil {
+            http.Error(w, "Зона не найдена", http.StatusNotFound)
+            return
+        }
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.Write(data)
+    }
+}
+
+// AgentConfHandler отдаёт агенту zones.conf с путями его сервера
+func AgentConfHandler(db *models.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        server := agentServer(db, r)
+        if server == nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        data, err := services.ServerZonesConf(db, server)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.Write(data)
+    }
+}
+
+// AgentReportHandler принимает от агента состояние сервера и serial зон
+func AgentReportHandler(db *models.DB) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        server := agentServer(db, r)
+        if server == nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        var report agent.Report
+        if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&report); err != nil {
+            http.Error(w, "Ошибка чтения отчёта: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        if err := services.ApplyAgentReport(db, server, &report); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+    }
+}
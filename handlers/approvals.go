@@ -0,0 +1,583 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// submitPendingChange ставит изменение защищённой записи в очередь на согласование
+func submitPendingChange(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session, action string, record *models.Record) {
+    submitPendingChangeAt(db, w, r, session, action, record, nil)
+}
+
+// submitPendingChangeAt создаёт заявку на запланированное изменение: после
+// согласования оно не применяется сразу, а передаётся планировщику на runAt
+func submitPendingChangeAt(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session, action string, record *models.Record, runAt *time.Time) {
+    change, err := createPendingChange(db, r, session, action, record, runAt)
+    if err != nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Ошибка создания заявки: " + err.Error(),
+        })
+        return
+    }
+
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success":   true,
+        "pending":   true,
+        "change_id": change.ID,
+        "message":   "Запись защищена, изменение отправлено на согласование",
+    })
+}
+
+// createPendingChange сохраняет заявку от имени пользователя сессии и пишет её в журнал
+func createPendingChange(db *models.DB, r *http.Request, session *sessions.Session, action string, record *models.Record, runAt *time.Time) (*models.PendingChange, error) {
+    userID := session.Values["user_id"].(int64)
+    username := session.Values["username"].(string)
+
+    change := &models.PendingChange{
+        DomainID:        record.DomainID,
+        RecordID:        record.ID,
+        Action:          action,
+        Type:            record.Type,
+        Name:            record.Name,
+        Content:         record.Content,
+        Priority:        record.Priority,
+        TTL:             record.TTL,
+        RequestedBy:     userID,
+        RequestedByName: username,
+        RunAt:           runAt,
+    }
+    adminID, adminName, impersonating := impersonator(session)
+    if impersonating {
+        change.ImpersonatorID, change.ImpersonatorName = adminID, adminName
+    }
+
+    if err := models.CreatePendingChange(db, change); err != nil {
+        return nil, err
+    }
+
+    details := fmt.Sprintf("Заявка #%d (%s): %s %s → %s", change.ID, action, record.Type, record.Name, record.Content)
+    if runAt != nil {
+        details += ", выполнение запланировано на " + runAt.Format(time.RFC3339)
+    }
+    if impersonating {
+        details += fmt.Sprintf(" (подана администратором %s от имени %s)", adminName, username)
+        log.Printf("Pending change #%d submitted by %s (ID %d) on behalf of %s (ID %d)",
+            change.ID, adminName, adminID, username, userID)
+    }
+    logAction(db, session, r, "request_change", details)
+    return change, nil
+}
+
+func GetPendingChangesHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        status := r.URL.Query().Get("status")
+        changes, err := models.GetPendingChanges(db, userID, userRole, status, 200)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(changes)
+    }
+}
+
+func ApproveChangeHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return reviewChangeHandler(db, store, true)
+}
+
+func RejectChangeHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return reviewChangeHandler(db, store, false)
+}
+
+func reviewChangeHandler(db *models.DB, store *sessions.CookieStore, approve bool) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+        username := session.Values["username"].(string)
+
+        vars := mux.Vars(r)
+        id, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID заявки",
+            })
+            return
+        }
+
+        var data struct {
+            Comment string `json:"comment"`
+        }
+        json.NewDecoder(r.Body).Decode(&data)
+
+        change, err := models.GetPendingChangeByID(db, id)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка получения заявки: " + err.Error(),
+            })
+            return
+        }
+        if change == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Заявка не найдена",
+            })
+            return
+        }
+
+        ok, err := models.CanApproveChanges(db, userID, userRole, change.DomainID)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        // Своей считается и заявка, поданная от имени пользователя: иначе
+        // администратор мог бы подать её в этом режиме и согласовать сам.
+        // То же при согласовании от имени другого пользователя.
+        own := change.RequestedBy == userID || change.ImpersonatorID == userID
+        if adminID, _, impersonating := impersonator(session); impersonating {
+            own = own || change.RequestedBy == adminID || change.ImpersonatorID == adminID
+        }
+        if approve && own {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Нельзя согласовать собственную заявку",
+            })
+            return
+        }
+
+        status := models.ChangeRejected
+        if approve {
+            status = models.ChangeApproved
+        }
+
+        // Перевод из pending выполняется одним UPDATE, поэтому заявку нельзя рассмотреть дважды
+        claimed, err := models.ReviewPendingChange(db, id, status, userID, username, data.Comment)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка обновления заявки: " + err.Error(),
+            })
+            return
+        }
+        if !claimed {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Заявка уже рассмотрена",
+            })
+            return
+        }
+
+        if !approve {
+            details := fmt.Sprintf("Отклонена заявка #%d (%s %s): %s", id, change.Type, change.Name, data.Comment)
+            logAction(db, session, r, "reject_change", details)
+
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": true,
+                "message": "Заявка отклонена",
+            })
+            return
+        }
+
+        // Запланированное изменение после согласования ждёт своего времени
+        if change.RunAt != nil {
+            scheduleApprovedChange(db, w, r, session, change, data.Comment)
+            return
+        }
+
+        if err := services.ExecuteRecordChange(db, change.Action, change.Record()); err != nil {
+            models.MarkPendingChangeFailed(db, id, err.Error())
+            details := fmt.Sprintf("Заявка #%d одобрена, но не применена: %v", id, err)
+            logAction(db, session, r, "approve_change", details)
+
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка применения изменения: " + err.Error(),
+            })
+            return
+        }
+
+        details := fmt.Sprintf("Одобрена заявка #%d от %s (%s): %s %s → %s. %s",
+            id, change.RequestedByName, change.Action, change.Type, change.Name, change.Content, data.Comment)
+        logAction(db, session, r, "approve_change", strings.TrimSpace(details))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Изменение согласовано и применено",
+        })
+    }
+}
+
+// scheduleApprovedChange передаёт одобренную заявку планировщику. Если время
+// выполнения уже прошло, заявка не применяется: окно работ упущено.
+func scheduleApprovedChange(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session,
+    change *models.PendingChange, comment string) {
+
+    userID := session.Values["user_id"].(int64)
+    username := session.Values["username"].(string)
+
+    fail := func(message string) {
+        models.MarkPendingChangeFailed(db, change.ID, message)
+        logAction(db, session, r, "approve_change", fmt.Sprintf("Заявка #%d одобрена, но не запланирована: %s", change.ID, message))
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": message,
+        })
+    }
+
+    if !change.RunAt.After(time.Now()) {
+        fail("Время выполнения " + change.RunAt.Format(time.RFC3339) + " уже прошло, запланируйте изменение заново")
+        return
+    }
+
+    job := &models.ScheduledChange{
+        DomainID:       change.DomainID,
+        RecordID:       change.RecordID,
+        Action:         change.Action,
+        Type:           change.Type,
+        Name:           change.Name,
+        Content:        change.Content,
+        Priority:       change.Priority,
+        TTL:            change.TTL,
+        RunAt:          *change.RunAt,
+        CreatedBy:      change.RequestedBy,
+        CreatedByName:  change.RequestedByName,
+        ApprovedBy:     userID,
+        ApprovedByName: username,
+    }
+    if err := models.CreateScheduledChange(db, job); err != nil {
+        fail("Ошибка создания задания: " + err.Error())
+        return
+    }
+
+    details := fmt.Sprintf("Одобрена заявка #%d от %s (%s): %s %s → %s, задание #%d на %s. %s",
+        change.ID, change.RequestedByName, change.Action, change.Type, change.Name, change.Content,
+        job.ID, job.RunAt.Format(time.RFC3339), comment)
+    logAction(db, session, r, "approve_change", strings.TrimSpace(details))
+
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success": true,
+        "id":      job.ID,
+        "message": "Изменение согласовано и будет применено " + job.RunAt.Format(time.RFC3339),
+    })
+}
+
+func GetProtectionRulesHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            http.Error(w, "Invalid domain ID", http.StatusBadRequest)
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermRead)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if !ok {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        rules, err := models.GetProtectionRules(db, domainID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        approvers, err := models.GetDomainApprovers(db, domainID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":   true,
+            "rules":     rules,
+            "approvers": approvers,
+        })
+    }
+}
+
+func CreateProtectionRuleHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            RecordType string `json:"record_type"`
+            Name       string `json:"name"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        rule := &models.ProtectionRule{
+            DomainID:   domainID,
+            RecordType: strings.ToUpper(strings.TrimSpace(data.RecordType)),
+            Name:       strings.TrimSpace(data.Name),
+        }
+        if rule.RecordType == "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Не указан тип записи",
+            })
+            return
+        }
+        if rule.Name == "" {
+            rule.Name = "*"
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        // Имя правила сравнивается с именами записей, поэтому приводится к
+        // тому же виду: @ и полное имя — к вершине и относительному имени,
+        // IDN — к punycode. "*" означает все записи типа.
+        if rule.Name != "*" {
+            if rule.Name, err = services.PrepareRecordName(rule.Name, domain.Name); err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": err.Error(),
+                })
+                return
+            }
+        }
+
+        if err := models.CreateProtectionRule(db, rule); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания правила: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "create_protection_rule",
+            "Защита записей "+rule.RecordType+" "+rule.Name+" в домене "+domain.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      rule.ID,
+            "message": "Правило защиты добавлено",
+        })
+    }
+}
+
+func DeleteProtectionRuleHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        domainID, err1 := strconv.ParseInt(vars["id"], 10, 64)
+        ruleID, err2 := strconv.ParseInt(vars["rule_id"], 10, 64)
+        if err1 != nil || err2 != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID",
+            })
+            return
+        }
+
+        if err := models.DeleteProtectionRule(db, domainID, ruleID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления правила: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_protection_rule",
+            fmt.Sprintf("Удалено правило защиты #%d домена ID: %d", ruleID, domainID))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Правило защиты удалено",
+        })
+    }
+}
+
+func AddDomainApproverHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            UserID int64 `json:"user_id"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        user, err := models.GetUserByID(db, data.UserID)
+        if err != nil || user == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь не найден",
+            })
+            return
+        }
+
+        // Согласовывать изменения может только тот, кто сам может править домен
+        ok, err := models.CanAccessDomain(db, user.ID, string(user.Role), domainID, models.PermWrite)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "У пользователя " + user.Username + " нет прав на изменение домена",
+            })
+            return
+        }
+
+        if err := models.AddDomainApprover(db, domainID, user.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка назначения согласующего: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "add_approver",
+            fmt.Sprintf("Пользователь %s назначен согласующим домена ID: %d", user.Username, domainID))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Согласующий назначен",
+        })
+    }
+}
+
+func RemoveDomainApproverHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        domainID, err1 := strconv.ParseInt(vars["id"], 10, 64)
+        userID, err2 := strconv.ParseInt(vars["user_id"], 10, 64)
+        if err1 != nil || err2 != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID",
+            })
+            return
+        }
+
+        if err := models.RemoveDomainApprover(db, domainID, userID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления согласующего: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "remove_approver",
+            fmt.Sprintf("Пользователь ID: %d больше не согласующий домена ID: %d", userID, domainID))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Согласующий удалён",
+        })
+    }
+}
@@ -69,6 +69,8 @@ func LoginHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
         session.Values["user_id"] = user.ID
         session.Values["username"] = user.Username
         session.Values["role"] = string(user.Role)
+        delete(session.Values, sessionImpersonatorID)
+        delete(session.Values, sessionImpersonatorName)
 
         log.Printf("Login: role set to %q (type %T)", string(user.Role), user.Role)
 
@@ -108,6 +110,8 @@ func LogoutHandler(store *sessions.CookieStore) http.HandlerFunc {
         delete(session.Values, "user_id")
         delete(session.Values, "username")
         delete(session.Values, "role")
+        delete(session.Values, sessionImpersonatorID)
+        delete(session.Values, sessionImpersonatorName)
         session.Save(r, w)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
@@ -131,6 +135,14 @@ func ChangePasswordHandler(db *models.DB, store *sessions.CookieStore) http.Hand
             return
         }
 
+        if _, _, impersonating := impersonator(session); impersonating {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Нельзя менять пароль, действуя от имени пользователя",
+            })
+            return
+        }
+
         var data struct {
             CurrentPassword string `json:"current_password"`
             NewPassword     string `json:"new_password"`
@@ -200,4 +212,29 @@ func ChangePasswordHandler(db *models.DB, store *sessions.CookieStore) http.Hand
             "message": "Пароль успешно изменен",
         })
     }
-}
\ No newline at end of file
+}
+// sessionCan проверяет право текущей роли по общей матрице models.RoleCan
+func sessionCan(session *sessions.Session, c models.Capability) bool {
+    role, _ := session.Values["role"].(string)
+    return models.RoleCan(role, c)
+}
+
+// capabilitySet возвращает права роли для шаблонов: страницы показывают
+// элементы по правам, а не по названию роли
+func capabilitySet(role string) map[string]bool {
+    set := make(map[string]bool)
+    for _, c := range models.RoleCapabilities(role) {
+        set[string(c)] = true
+    }
+    return set
+}
+
+// roleCapabilitySets — права всех ролей, чтобы страницы могли проверять
+// права других пользователей
+func roleCapabilitySets() map[string]map[string]bool {
+    sets := make(map[string]map[string]bool)
+    for role := range models.RoleNames {
+        sets[string(role)] = capabilitySet(string(role))
+    }
+    return sets
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/sessions"
+)
+
+// GetCatalogHandler возвращает состав каталожной зоны, её serial и
+// результаты NOTIFY вторичным серверам
+func GetCatalogHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        if !services.CatalogEnabled() {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "enabled": false,
+            })
+            return
+        }
+
+        members, err := services.CatalogMembers(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        serial, err := models.GetCatalogSerial(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        results, err := models.GetNotifyResults(db, 0)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "enabled": true,
+            "zone":    services.CatalogZoneName(),
+            "serial":  serial,
+            "members": members,
+            "notify":  results,
+        })
+    }
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
     "encoding/json"
+    "fmt"
     "net/http"
     "strconv"
+    "strings"
 
     "dns-manager/models"
     "dns-manager/services"
@@ -13,6 +15,104 @@ import (
     "github.com/spf13/viper"
 )
 
+// newDomainOptions заполняет параметры SOA нового домена из конфига
+func newDomainOptions(name string, userID, orgID int64, soaEmail string) *models.DomainCreateOptions {
+    soaRefresh := viper.GetInt("dns.soa.refresh")
+    if soaRefresh == 0 {
+        soaRefresh = 7200
+    }
+    soaRetry := viper.GetInt("dns.soa.retry")
+    if soaRetry == 0 {
+        soaRetry = 3600
+    }
+    soaExpire := viper.GetInt("dns.soa.expire")
+    if soaExpire == 0 {
+        soaExpire = 1209600
+    }
+    soaMinimum := viper.GetInt("dns.soa.minimum")
+    if soaMinimum == 0 {
+        soaMinimum = 3600
+    }
+
+    return &models.DomainCreateOptions{
+        Name:         name,
+        UserID:       userID,
+        OrgID:        orgID,
+        SOAEmail:     soaEmail,
+        SOAPrimaryNS: "", // не используется
+        SOARefresh:   soaRefresh,
+        SOARetry:     soaRetry,
+        SOAExpire:    soaExpire,
+        SOAMinimum:   soaMinimum,
+    }
+}
+
+// createZoneBaseRecords создаёт SOA и NS записи новой зоны с учётом квоты
+// записей. Возвращает сообщение об ошибке или пустую строку.
+func createZoneBaseRecords(db *models.DB, domainID int64, name, soaEmail string) string {
+    if soaEmail == "" {
+        soaEmail = "admin." + name
+    }
+
+    err := services.CreateRecordWithQuota(db, &models.Record{
+        DomainID: domainID,
+        Type:     "SOA",
+        Name:     "@",
+        Content:  soaEmail,
+        TTL:      viper.GetInt("default_ttl"),
+    })
+    if err != nil {
+        return "Ошибка создания SOA записи: " + err.Error()
+    }
+
+    // Создаём NS записи из списка ns_servers (всегда, необходимо для делегирования)
+    nsServers := viper.GetStringSlice("dns.ns_servers")
+    if len(nsServers) == 0 {
+        // Если список пуст, создаём одну NS запись с ns1.домен (для обратной совместимости)
+        nsServers = []string{"ns1." + name}
+    }
+
+    for _, ns := range nsServers {
+        err = services.CreateRecordWithQuota(db, &models.Record{
+            DomainID: domainID,
+            Type:     "NS",
+            Name:     "@",
+            Content:  ns,
+            TTL:      viper.GetInt("default_ttl"),
+        })
+        if err != nil {
+            return "Ошибка создания NS записи: " + err.Error()
+        }
+    }
+    return ""
+}
+
+// requestDomain возвращает домен из URL, если у пользователя есть права perm.
+// Вторым значением возвращается сообщение об ошибке.
+func requestDomain(db *models.DB, session *sessions.Session, r *http.Request, perm models.Permission) (*models.Domain, string) {
+    userID := session.Values["user_id"].(int64)
+    userRole := session.Values["role"].(string)
+
+    domainID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        return nil, "Некорректный ID домена"
+    }
+
+    ok, err := models.CanAccessDomain(db, userID, userRole, domainID, perm)
+    if err != nil {
+        return nil, "Ошибка проверки доступа: " + err.Error()
+    }
+    if !ok {
+        return nil, "Доступ запрещён"
+    }
+
+    domain, err := models.GetDomainByID(db, domainID)
+    if err != nil || domain == nil {
+        return nil, "Домен не найден"
+    }
+    return domain, ""
+}
+
 func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
@@ -27,11 +127,23 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
         userRole, _ := session.Values["role"].(string)
+        if !models.RoleCan(userRole, models.CapEditDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ваша роль не позволяет создавать домены",
+            })
+            return
+        }
 
         var data struct {
             Name     string `json:"name"`
             IP       string `json:"ip"`        // IP для A-записи
             SOAEmail string `json:"soa_email"` // Email для SOA
+            OrgID    int64  `json:"org_id"`    // 0 — личный домен
+            TemplateID int64 `json:"template_id"` // шаблон записей, 0 — без шаблона
+            Type      string   `json:"type"`      // primary (по умолчанию) или secondary
+            Primaries []string `json:"primaries"` // первичные серверы вторичной зоны
+            TSIGKey   string   `json:"tsig_key"`  // TSIG ключ для передачи зоны
         }
 
         if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
@@ -42,7 +154,16 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        // Валидация домена
+        // Валидация домена. Unicode имена (например, .рф) переводятся в punycode
+        name, err := services.ToASCIIName(strings.TrimSpace(data.Name))
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректное имя домена: " + err.Error(),
+            })
+            return
+        }
+        data.Name = strings.TrimSuffix(name, ".")
         if !services.ValidateDomain(data.Name) {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -60,8 +181,75 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
+        // Домен организации может создать её владелец или редактор
+        if data.OrgID != 0 {
+            ok, err := models.CanAccessOrganization(db, userID, userRole, data.OrgID, models.PermWrite)
+            if err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Ошибка проверки доступа: " + err.Error(),
+                })
+                return
+            }
+            if !ok {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Нет прав на создание доменов организации",
+                })
+                return
+            }
+        }
+
+        // Вторичная зона: записи приходят с первичных серверов
+        secondary := data.Type == models.DomainSecondary
+        if data.Type != "" && data.Type != models.DomainPrimary && !secondary {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Неизвестный тип домена: " + data.Type,
+            })
+            return
+        }
+        var primaries []string
+        if secondary {
+            var msg string
+            if primaries, msg = secondaryPrimaries(db, data.Primaries, data.TSIGKey); msg != "" {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": msg,
+                })
+                return
+            }
+            if data.TemplateID != 0 {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Шаблон нельзя применить к вторичной зоне",
+                })
+                return
+            }
+        }
+
+        // Шаблон проверяем до создания домена, чтобы не оставить его наполовину настроенным
+        var template *models.RecordTemplate
+        if data.TemplateID != 0 {
+            var msg string
+            if template, msg = templateForUse(db, userID, userRole, data.TemplateID); template == nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": msg,
+                })
+                return
+            }
+        }
+
         // Проверка существования домена
         exists, err := models.DomainExists(db, data.Name)
+        if err == models.ErrDomainInTrash {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен " + data.Name + " находится в корзине: восстановите его или удалите окончательно",
+            })
+            return
+        }
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -77,94 +265,85 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             })
             return
         }
-
-        // Получаем настройки SOA из конфига
-        soaRefresh := viper.GetInt("dns.soa.refresh")
-        if soaRefresh == 0 {
-            soaRefresh = 7200
-        }
-        soaRetry := viper.GetInt("dns.soa.retry")
-        if soaRetry == 0 {
-            soaRetry = 3600
-        }
-        soaExpire := viper.GetInt("dns.soa.expire")
-        if soaExpire == 0 {
-            soaExpire = 1209600
+        if services.CatalogEnabled() && data.Name == services.CatalogZoneName() {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Имя занято каталожной зоной",
+            })
+            return
         }
-        soaMinimum := viper.GetInt("dns.soa.minimum")
-        if soaMinimum == 0 {
-            soaMinimum = 3600
+
+        quota, err := services.GetEffectiveQuota(db, userID, userRole)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки квоты: " + err.Error(),
+            })
+            return
         }
 
         // Создаём запись домена в БД
-        opts := &models.DomainCreateOptions{
-            Name:         data.Name,
-            UserID:       userID,
-            SOAEmail:     data.SOAEmail,
-            SOAPrimaryNS: "", // не используется
-            SOARefresh:   soaRefresh,
-            SOARetry:     soaRetry,
-            SOAExpire:    soaExpire,
-            SOAMinimum:   soaMinimum,
+        opts := newDomainOptions(data.Name, userID, data.OrgID, data.SOAEmail)
+        opts.MaxDomains = quota.MaxDomains
+        if secondary {
+            opts.Kind = models.DomainSecondary
+            opts.Primaries = strings.Join(primaries, ",")
+            opts.TSIGKey = data.TSIGKey
         }
 
         domainID, err := models.CreateDomain(db, opts)
-        if err != nil {
+        if err == models.ErrQuotaExceeded {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка создания домена: " + err.Error(),
+                "message": services.DomainQuotaMessage(quota),
             })
             return
         }
-
-        // Создаём SOA запись
-        soaEmail := data.SOAEmail
-        if soaEmail == "" {
-            soaEmail = "admin." + data.Name
-        }
-
-        err = models.CreateRecord(db, &models.Record{
-            DomainID: domainID,
-            Type:     "SOA",
-            Name:     "@",
-            Content:  soaEmail,
-            TTL:      viper.GetInt("default_ttl"),
-        })
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка создания SOA записи: " + err.Error(),
+                "message": "Ошибка создания домена: " + err.Error(),
             })
             return
         }
 
-        // Создаём NS записи из списка ns_servers (всегда, необходимо для делегирования)
-        nsServers := viper.GetStringSlice("dns.ns_servers")
-        if len(nsServers) == 0 {
-            // Если список пуст, создаём одну NS запись с ns1.домен (для обратной совместимости)
-            nsServers = []string{"ns1." + data.Name}
+        if secondary {
+            logAction(db, session, r, "create_domain", fmt.Sprintf("Создан вторичный домен: %s (первичные серверы: %s)",
+                data.Name, strings.Join(primaries, ", ")))
+            services.RebuildZonesConf(db)
+            message := "Вторичный домен создан, зона будет получена с первичного сервера"
+            if err := services.PublishZone(db, domainID); err != nil {
+                message += ", но DNS сервер не обновлён: " + err.Error()
+            }
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success":      true,
+                "domain_id":    domainID,
+                "name":         data.Name,
+                "unicode_name": models.UnicodeName(data.Name),
+                "message":      message,
+            })
+            return
         }
 
-        for _, ns := range nsServers {
-            err = models.CreateRecord(db, &models.Record{
-                DomainID: domainID,
-                Type:     "NS",
-                Name:     "@",
-                Content:  ns,
-                TTL:      viper.GetInt("default_ttl"),
+        if msg := createZoneBaseRecords(db, domainID, data.Name, data.SOAEmail); msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
             })
-            if err != nil {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Ошибка создания NS записи: " + err.Error(),
-                })
-                return
-            }
+            return
         }
 
         // Создаём A запись, если IP указан и разрешено
-        allowA := viper.GetBool("security.allow_users_create_a")
-        if (userRole == "admin" || allowA) && data.IP != "" {
+        apexA := &models.Record{
+            DomainID: domainID,
+            Type:     "A",
+            Name:     "@",
+            Content:  data.IP,
+            TTL:      viper.GetInt("default_ttl"),
+        }
+        newDomain := &models.Domain{ID: domainID, Name: data.Name}
+        allowA := services.CheckRecordPolicy(db, userID, userRole, models.ChangeCreate, newDomain, apexA) == nil
+        if allowA && data.IP != "" {
             if !services.ValidateIP(data.IP) {
                 json.NewEncoder(w).Encode(map[string]interface{}{
                     "success": false,
@@ -172,13 +351,7 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
                 })
                 return
             }
-            err = models.CreateRecord(db, &models.Record{
-                DomainID: domainID,
-                Type:     "A",
-                Name:     "@",
-                Content:  data.IP,
-                TTL:      viper.GetInt("default_ttl"),
-            })
+            err = services.CreateRecordWithQuota(db, apexA)
             if err != nil {
                 json.NewEncoder(w).Encode(map[string]interface{}{
                     "success": false,
@@ -188,19 +361,46 @@ func CreateDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             }
         }
 
-        // Логирование
-        username := session.Values["username"].(string)
-        services.LogUserAction(db, userID, username, "create_domain", 
-            "Создан домен: "+data.Name, r.RemoteAddr)
-
-        // Генерация зоны
-        services.GenerateZone(db, domainID)
+        // Записи из шаблона
+        var templateResult *services.RecordSetResult
+        if template != nil {
+            templateResult, err = services.ApplyTemplate(db, userID, userRole, newDomain, template, data.IP, false)
+            if err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success":   false,
+                    "domain_id": domainID,
+                    "message":   "Домен создан, но шаблон не применён: " + err.Error(),
+                })
+                return
+            }
+        }
 
-        json.NewEncoder(w).Encode(map[string]interface{}{
-            "success":   true,
-            "domain_id": domainID,
-            "message":   "Домен успешно создан",
-        })
+        // Логирование
+        details := "Создан домен: " + data.Name
+        if template != nil {
+            details += fmt.Sprintf(" (шаблон %s, добавлено записей: %d)", template.Name, len(templateResult.Applied))
+        }
+        logAction(db, session, r, "create_domain", details)
+
+        // Генерация зоны. zones.conf пишется раньше, чтобы NSD уже знал о зоне
+        services.RebuildZonesConf(db)
+        services.PublishZone(db, domainID)
+        services.NotifySecondaries(db, domainID)
+
+        response := map[string]interface{}{
+            "success":      true,
+            "domain_id":    domainID,
+            "name":         data.Name,
+            "unicode_name": models.UnicodeName(data.Name),
+            "message":      "Домен успешно создан",
+        }
+        if templateResult != nil {
+            response["message"] = "Домен успешно создан. " + recordSetMessage(templateResult, false)
+            response["applied"] = templateResult.Applied
+            response["conflicts"] = templateResult.Conflicts
+            response["skipped"] = templateResult.Skipped
+        }
+        json.NewEncoder(w).Encode(response)
     }
 }
 
@@ -223,18 +423,32 @@ func GetUserDomainsHandler(db *models.DB, store *sessions.CookieStore) http.Hand
         var domains []models.Domain
         var err error
         
-        if userRole == "admin" {
+        if models.RoleCan(userRole, models.CapReadAllDomains) {
             domains, err = models.GetAllDomains(db)
         } else {
             domains, err = models.GetDomainsByUserID(db, userID)
         }
         
+        if err == nil {
+            err = services.SetRecordLimits(db, domains)
+        }
         if err != nil {
             http.Error(w, err.Error(), http.StatusInternalServerError)
             return
         }
 
-        json.NewEncoder(w).Encode(domains)
+        // Использование квоты доменов самим пользователем
+        usage, err := services.GetQuotaUsage(db, userID, userRole)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "domains": domains,
+            "quota":   usage,
+        })
     }
 }
 
@@ -256,7 +470,7 @@ func DeleteDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        ok, err := models.CanAccessDomain(db, userID, userRole, id)
+        ok, err := models.CanAccessDomain(db, userID, userRole, id, models.PermManage)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -289,24 +503,49 @@ func DeleteDomainHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        services.DeleteZoneFile(domain.Name)
+        retention := services.TrashRetention()
+        if retention <= 0 {
+            services.UnpublishZone(domain.Name)
+
+            if err := models.DeleteDomain(db, id); err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Ошибка удаления домена: " + err.Error(),
+                })
+                return
+            }
+            services.RebuildZonesConf(db)
+
+            // Логирование удаления домена
+            logAction(db, session, r, "delete_domain", 
+                "Удален домен: "+domain.Name)
+
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": true,
+                "message": "Домен успешно удален",
+            })
+            return
+        }
 
-        if err := models.DeleteDomain(db, id); err != nil {
+        // Домен перестаёт обслуживаться NSD, но остаётся в БД до очистки корзины
+        if err := models.TrashDomain(db, id, userID); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка удаления домена: " + err.Error(),
             })
             return
         }
+        services.UnpublishZone(domain.Name)
+        services.RebuildZonesConf(db)
+        services.ReloadServer()
 
-        // Логирование удаления домена
-        username := session.Values["username"].(string)
-        services.LogUserAction(db, userID, username, "delete_domain", 
-            "Удален домен: "+domain.Name, r.RemoteAddr)
+        logAction(db, session, r, "trash_domain",
+            "Домен перемещён в корзину: "+domain.Name)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
             "success": true,
-            "message": "Домен успешно удален",
+            "message": fmt.Sprintf("Домен перемещён в корзину и может быть восстановлен в течение %d дн.",
+                int(retention.Hours()/24)),
         })
     }
 }
\ No newline at end of file
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// Пока администратор действует от имени пользователя, user_id, username и role
+// в сессии принадлежат пользователю, а исходная учётная запись хранится здесь
+const (
+    sessionImpersonatorID   = "impersonator_id"
+    sessionImpersonatorName = "impersonator_name"
+)
+
+// impersonator возвращает администратора, действующего от имени пользователя
+func impersonator(session *sessions.Session) (int64, string, bool) {
+    id, ok := session.Values[sessionImpersonatorID].(int64)
+    if !ok {
+        return 0, "", false
+    }
+    name, _ := session.Values[sessionImpersonatorName].(string)
+    return id, name, true
+}
+
+// logAction записывает действие текущего пользователя сессии. Если действует
+// администратор от имени пользователя, в журнал попадают оба.
+func logAction(db *models.DB, session *sessions.Session, r *http.Request, action, details string) {
+    userID := session.Values["user_id"].(int64)
+    username := session.Values["username"].(string)
+
+    if adminID, adminName, ok := impersonator(session); ok {
+        services.LogImpersonatedAction(db, userID, username, adminID, adminName, action, details, r.RemoteAddr)
+        return
+    }
+    services.LogUserAction(db, userID, username, action, details, r.RemoteAddr)
+}
+
+func StartImpersonationHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageUsers) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        if _, _, ok := impersonator(session); ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Сначала завершите текущий режим работы от имени пользователя",
+            })
+            return
+        }
+
+        vars := mux.Vars(r)
+        targetID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID пользователя",
+            })
+            return
+        }
+
+        target, err := models.GetUserByID(db, targetID)
+        if err != nil || target == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь не найден",
+            })
+            return
+        }
+
+        // Нельзя войти от имени того, кто сам управляет пользователями
+        if models.RoleCan(string(target.Role), models.CapManageUsers) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Нельзя действовать от имени администратора",
+            })
+            return
+        }
+
+        if !target.Active {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Учётная запись пользователя отключена",
+            })
+            return
+        }
+
+        adminID := session.Values["user_id"].(int64)
+        adminName := session.Values["username"].(string)
+
+        session.Values[sessionImpersonatorID] = adminID
+        session.Values[sessionImpersonatorName] = adminName
+        session.Values["user_id"] = target.ID
+        session.Values["username"] = target.Username
+        session.Values["role"] = string(target.Role)
+
+        if err := session.Save(r, w); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения сессии: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "impersonate_start",
+            fmt.Sprintf("%s начал работу от имени %s", adminName, target.Username))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Вы действуете от имени " + target.Username,
+        })
+    }
+}
+
+func StopImpersonationHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        adminID, adminName, ok := impersonator(session)
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Режим работы от имени пользователя не активен",
+            })
+            return
+        }
+
+        logAction(db, session, r, "impersonate_stop",
+            fmt.Sprintf("%s завершил работу от имени %s", adminName, session.Values["username"]))
+
+        delete(session.Values, sessionImpersonatorID)
+        delete(session.Values, sessionImpersonatorName)
+
+        // Роль администратора берём из базы: за время сеанса её могли отозвать
+        admin, err := models.GetUserByID(db, adminID)
+        if err != nil || admin == nil || !admin.Active {
+            session.Values["authenticated"] = false
+            delete(session.Values, "user_id")
+            delete(session.Values, "username")
+            delete(session.Values, "role")
+        } else {
+            session.Values["user_id"] = admin.ID
+            session.Values["username"] = admin.Username
+            session.Values["role"] = string(admin.Role)
+        }
+
+        if err := session.Save(r, w); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения сессии: " + err.Error(),
+            })
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Вы снова действуете от своего имени",
+        })
+    }
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+    "github.com/spf13/viper"
+)
+
+// ImportZoneHandler добавляет в домен записи из файла зоны.
+// Записи, конфликтующие с текущими, не добавляются и возвращаются в ответе.
+func ImportZoneHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            Zone   string `json:"zone"`    // текст файла зоны
+            DryRun bool   `json:"dry_run"` // только показать результат, не изменяя домен
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermWrite)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        result, err := services.ImportZone(db, userID, userRole, domain, data.Zone, viper.GetInt("default_ttl"), data.DryRun)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка разбора зоны: " + err.Error(),
+            })
+            return
+        }
+
+        if !data.DryRun && len(result.Applied) > 0 {
+            logAction(db, session, r, "import_zone",
+                fmt.Sprintf("В домен %s импортировано записей: %d, конфликтов %d, пропущено %d",
+                    domain.Name, len(result.Applied), len(result.Conflicts), len(result.Skipped)))
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":   true,
+            "message":   recordSetMessage(result, data.DryRun),
+            "applied":   result.Applied,
+            "conflicts": result.Conflicts,
+            "skipped":   result.Skipped,
+            "warnings":  result.Warnings,
+        })
+    }
+}
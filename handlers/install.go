@@ -149,7 +149,7 @@ func InstallHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc
             session.Values["authenticated"] = true
             session.Values["user_id"] = user.ID
             session.Values["username"] = user.Username
-            session.Values["role"] = user.Role
+            session.Values["role"] = string(user.Role)
             session.Save(r, w)
 
             json.NewEncoder(w).Encode(map[string]interface{}{
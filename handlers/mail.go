@@ -0,0 +1,278 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/sessions"
+)
+
+// mailRecordError отвечает на ошибку PublishMailRecord. Изменение защищённой
+// записи отправляется на согласование, как в обработчиках записей.
+func mailRecordError(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session, err error) {
+    var protectedErr *services.ProtectedRecordError
+    if errors.As(err, &protectedErr) {
+        submitPendingChange(db, w, r, session, protectedErr.Action, &protectedErr.Record)
+        return
+    }
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success": false,
+        "message": err.Error(),
+    })
+}
+
+// SPFHandler собирает или проверяет SPF запись домена и публикует её,
+// если не указан dry_run
+func SPFHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        domain, msg := requestDomain(db, session, r, models.PermWrite)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        var data struct {
+            Record     string   `json:"record"` // готовая запись для проверки
+            Mechanisms []string `json:"mechanisms"`
+            All        string   `json:"all"`
+            Redirect   string   `json:"redirect"`
+            DryRun     bool     `json:"dry_run"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        var result *services.SPFResult
+        var err error
+        if data.Record != "" {
+            result, err = services.CheckSPF(db, data.Record)
+        } else {
+            result, err = services.BuildSPF(db, services.SPFOptions{
+                Mechanisms: data.Mechanisms,
+                All:        data.All,
+                Redirect:   data.Redirect,
+            })
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка в SPF: " + err.Error(),
+            })
+            return
+        }
+
+        response := map[string]interface{}{
+            "success":  true,
+            "record":   result.Record,
+            "lookups":  result.Lookups,
+            "warnings": result.Warnings,
+            "message":  fmt.Sprintf("SPF корректна, DNS запросов: %d из 10", result.Lookups),
+        }
+        if data.DryRun {
+            json.NewEncoder(w).Encode(response)
+            return
+        }
+
+        record, action, err := services.PublishMailRecord(db, userID, userRole, domain, "@",
+            services.FormatTXT(services.SplitTXT(result.Record)))
+        if err != nil {
+            mailRecordError(db, w, r, session, err)
+            return
+        }
+
+        logAction(db, session, r, "mail_spf",
+            fmt.Sprintf("SPF запись домена %s %s: %s", domain.Name, services.ChangeVerb(action), result.Record))
+
+        response["id"] = record.ID
+        response["message"] = "SPF запись " + services.ChangeVerb(action)
+        json.NewEncoder(w).Encode(response)
+    }
+}
+
+// DKIMHandler генерирует ключ DKIM и публикует запись селектора.
+// Закрытый ключ возвращается только в этом ответе и не сохраняется.
+func DKIMHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        domain, msg := requestDomain(db, session, r, models.PermWrite)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        var data struct {
+            Selector  string `json:"selector"`
+            Algorithm string `json:"algorithm"` // rsa или ed25519
+            Bits      int    `json:"bits"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        key, err := services.GenerateDKIMKey(data.Selector, data.Algorithm, data.Bits)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        record, action, err := services.PublishMailRecord(db, userID, userRole, domain, key.Name, key.Content)
+        var protectedErr *services.ProtectedRecordError
+        if errors.As(err, &protectedErr) {
+            // Закрытый ключ отдаётся и тогда, когда запись ждёт согласования
+            change, err := createPendingChange(db, r, session, protectedErr.Action, &protectedErr.Record, nil)
+            if err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Ошибка создания заявки: " + err.Error(),
+                })
+                return
+            }
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success":     true,
+                "pending":     true,
+                "change_id":   change.ID,
+                "name":        key.Name,
+                "content":     key.Content,
+                "private_key": key.PrivateKey,
+                "message":     "Запись защищена, DKIM запись отправлена на согласование. Сохраните закрытый ключ: повторно он показан не будет",
+            })
+            return
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "mail_dkim",
+            fmt.Sprintf("DKIM запись %s.%s %s", key.Name, domain.Name, services.ChangeVerb(action)))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":     true,
+            "id":          record.ID,
+            "name":        key.Name,
+            "content":     key.Content,
+            "private_key": key.PrivateKey,
+            "message":     "DKIM запись " + services.ChangeVerb(action) + ". Сохраните закрытый ключ: повторно он показан не будет",
+        })
+    }
+}
+
+// DMARCHandler собирает DMARC запись из параметров и публикует её в _dmarc,
+// если не указан dry_run
+func DMARCHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        domain, msg := requestDomain(db, session, r, models.PermWrite)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        var data struct {
+            Policy          string   `json:"policy"`
+            SubdomainPolicy string   `json:"subdomain_policy"`
+            Percent         int      `json:"pct"`
+            RUA             []string `json:"rua"`
+            RUF             []string `json:"ruf"`
+            ADKIM           string   `json:"adkim"`
+            ASPF            string   `json:"aspf"`
+            FailureOptions  string   `json:"fo"`
+            DryRun          bool     `json:"dry_run"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        value, err := services.BuildDMARC(services.DMARCOptions{
+            Policy:          data.Policy,
+            SubdomainPolicy: data.SubdomainPolicy,
+            Percent:         data.Percent,
+            RUA:             data.RUA,
+            RUF:             data.RUF,
+            ADKIM:           data.ADKIM,
+            ASPF:            data.ASPF,
+            FailureOptions:  data.FailureOptions,
+        })
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if data.DryRun {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": true,
+                "record":  value,
+                "message": "DMARC запись корректна",
+            })
+            return
+        }
+
+        record, action, err := services.PublishMailRecord(db, userID, userRole, domain, "_dmarc",
+            services.FormatTXT(services.SplitTXT(value)))
+        if err != nil {
+            mailRecordError(db, w, r, session, err)
+            return
+        }
+
+        logAction(db, session, r, "mail_dmarc",
+            fmt.Sprintf("DMARC запись домена %s %s: %s", domain.Name, services.ChangeVerb(action), value))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      record.ID,
+            "record":  value,
+            "message": "DMARC запись " + services.ChangeVerb(action),
+        })
+    }
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "dns-manager/models"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+func GetDomainMembersHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            http.Error(w, "Invalid domain ID", http.StatusBadRequest)
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermRead)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if !ok {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        members, err := models.GetDomainMembers(db, domainID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(members)
+    }
+}
+
+func AddDomainMemberHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermManage)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        var data struct {
+            Username string `json:"username"`
+            Role     string `json:"role"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        if !models.ValidMemberRole(data.Role) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректная роль, допустимы: owner, editor, viewer",
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        invitee, err := models.GetUserByUsername(db, data.Username)
+        if err != nil || invitee == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь не найден",
+            })
+            return
+        }
+        if invitee.ID == domain.UserID {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь уже является владельцем домена",
+            })
+            return
+        }
+
+        if err := models.AddDomainMember(db, domainID, invitee.ID, data.Role); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка добавления участника: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "add_domain_member",
+            "Доступ к домену "+domain.Name+" для "+invitee.Username+" ("+data.Role+")")
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Доступ предоставлен",
+        })
+    }
+}
+
+func RemoveDomainMemberHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err1 := strconv.ParseInt(vars["id"], 10, 64)
+        memberID, err2 := strconv.ParseInt(vars["user_id"], 10, 64)
+        if err1 != nil || err2 != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID",
+            })
+            return
+        }
+
+        // Участник может сам отказаться от доступа, остальных удаляет владелец
+        if memberID != userID {
+            ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermManage)
+            if err != nil || !ok {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Доступ запрещён",
+                })
+                return
+            }
+        }
+
+        if err := models.RemoveDomainMember(db, domainID, memberID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления участника: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "remove_domain_member",
+            "Отозван доступ пользователя ID: "+strconv.FormatInt(memberID, 10)+
+                " к домену ID: "+strconv.FormatInt(domainID, 10))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Доступ отозван",
+        })
+    }
+}
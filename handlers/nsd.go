@@ -12,6 +12,17 @@ import (
     "github.com/gorilla/sessions"
 )
 
+// applyZonesConf пересобирает zones.conf и перезагружает DNS сервер, дополняя сообщение ошибками
+func applyZonesConf(db *models.DB, message string) string {
+    if err := services.WriteZonesConf(db); err != nil {
+        return message + ", но zones.conf не обновлён: " + err.Error()
+    }
+    if !services.ReloadServer() {
+        return message + ", но DNS сервер не перезагружен (подробности в логе)"
+    }
+    return message
+}
+
 func SyncNSDHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
@@ -30,8 +41,11 @@ func SyncNSDHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc
             return
         }
 
-        // Проверка доступа к домену
-        ok, err := models.CanAccessDomain(db, userID, userRole, domainID)
+        // Оператор синхронизирует любые домены, остальным нужен доступ на запись
+        ok := models.RoleCan(userRole, models.CapSyncNSD)
+        if !ok {
+            ok, err = models.CanAccessDomain(db, userID, userRole, domainID, models.PermWrite)
+        }
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -64,7 +78,16 @@ func SyncNSDHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc
             return
         }
 
-        if err := services.GenerateZone(db, domainID); err != nil {
+        if err := services.WriteZonesConf(db); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка генерации zones.conf: " + err.Error(),
+            })
+            return
+        }
+
+        // Файл вторичной зоны сервер пишет сам после получения с первичного
+        if err := services.PublishZone(db, domainID); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка генерации зоны: " + err.Error(),
@@ -72,13 +95,17 @@ func SyncNSDHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc
             return
         }
 
-        reloaded := services.ReloadNSD()
+        reloaded := services.ReloadServer()
+        services.NotifySecondaries(db, domainID)
 
         message := "Зона создана"
+        if domain.IsSecondary() {
+            message = "Конфигурация вторичной зоны обновлена"
+        }
         if reloaded {
-            message += " и NSD перезагружен"
+            message += " и DNS сервер перезагружен"
         } else {
-            message += ", но NSD не перезагружен (возможно нужны права sudo)"
+            message += ", но DNS сервер не перезагружен (подробности в логе)"
         }
 
         json.NewEncoder(w).Encode(map[string]interface{}{
@@ -89,17 +116,51 @@ func SyncNSDHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc
     }
 }
 
-func NSDStatusHandler() http.HandlerFunc {
+func NSDStatusHandler(db *models.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
         
-        running := services.CheckNSDStatus()
+        backend := services.CurrentBackend()
+        statusErr := backend.Status()
         perms := services.CheckPermissions()
 
-        json.NewEncoder(w).Encode(map[string]interface{}{
+        response := map[string]interface{}{
             "success":     true,
-            "running":     running,
+            "backend":     backend.Name(),
+            "running":     statusErr == nil,
             "permissions": perms,
-        })
+        }
+        if statusErr != nil {
+            response["error"] = statusErr.Error()
+        }
+        if err := backend.CheckConfig(); err != nil {
+            response["config_ok"] = false
+            response["config_error"] = err.Error()
+        } else {
+            response["config_ok"] = true
+        }
+
+        var mirrors []map[string]interface{}
+        for _, mirror := range services.CurrentMirrors() {
+            status := map[string]interface{}{"backend": mirror.Name()}
+            if err := mirror.Status(); err != nil {
+                status["running"] = false
+                status["error"] = err.Error()
+            } else {
+                status["running"] = true
+            }
+            mirrors = append(mirrors, status)
+        }
+        if len(mirrors) > 0 {
+            response["mirrors"] = mirrors
+        }
+
+        // Удалённые NSD серверы, на которые копируются зоны
+        if servers, err := services.GetDistributionStatus(db); err != nil {
+            response["servers_error"] = err.Error()
+        } else if len(servers) > 0 {
+            response["servers"] = servers
+        }
+        json.NewEncoder(w).Encode(response)
     }
 }
\ No newline at end of file
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+func GetOrganizationsHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        orgs, err := models.GetOrganizations(db, userID, userRole)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(orgs)
+    }
+}
+
+func CreateOrganizationHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        if !sessionCan(session, models.CapEditDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ваша роль не позволяет создавать организации",
+            })
+            return
+        }
+
+        var data struct {
+            Name string `json:"name"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        name := strings.TrimSpace(data.Name)
+        if len(name) < 2 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Название организации должно быть не менее 2 символов",
+            })
+            return
+        }
+
+        exists, err := models.OrganizationExists(db, name)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки организации: " + err.Error(),
+            })
+            return
+        }
+        if exists {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Организация уже существует",
+            })
+            return
+        }
+
+        orgID, err := models.CreateOrganization(db, name, userID)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания организации: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "create_org", "Создана организация: "+name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      orgID,
+            "message": "Организация создана",
+        })
+    }
+}
+
+func DeleteOrganizationHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        orgID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID организации",
+            })
+            return
+        }
+
+        ok, err := models.CanAccessOrganization(db, userID, userRole, orgID, models.PermManage)
+        if err != nil || !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        org, err := models.GetOrganizationByID(db, orgID)
+        if err != nil || org == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Организация не найдена",
+            })
+            return
+        }
+
+        count, err := models.CountOrganizationDomains(db, orgID)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доменов: " + err.Error(),
+            })
+            return
+        }
+        if count > 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Сначала удалите или передайте домены организации",
+            })
+            return
+        }
+
+        if err := models.DeleteOrganization(db, orgID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления организации: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_org", "Удалена организация: "+org.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Организация удалена",
+        })
+    }
+}
+
+func GetOrgMembersHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        orgID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+            return
+        }
+
+        ok, err := models.CanAccessOrganization(db, userID, userRole, orgID, models.PermRead)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if !ok {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        members, err := models.GetOrgMembers(db, orgID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(members)
+    }
+}
+
+func AddOrgMemberHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        orgID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID организации",
+            })
+            return
+        }
+
+        ok, err := models.CanAccessOrganization(db, userID, userRole, orgID, models.PermManage)
+        if err != nil || !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        var data struct {
+            Username string `json:"username"`
+            Role     string `json:"role"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        if !models.ValidMemberRole(data.Role) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректная роль, допустимы: owner, editor, viewer",
+            })
+            return
+        }
+
+        org, err := models.GetOrganizationByID(db, orgID)
+        if err != nil || org == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Организация не найдена",
+            })
+            return
+        }
+
+        member, err := models.GetUserByUsername(db, data.Username)
+        if err != nil || member == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь не найден",
+            })
+            return
+        }
+
+        // Понижение единственного владельца оставит организацию без управления
+        if data.Role != models.MemberOwner {
+            if msg := checkLastOrgOwner(db, orgID, member.ID); msg != "" {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": msg,
+                })
+                return
+            }
+        }
+
+        if err := models.AddOrgMember(db, orgID, member.ID, data.Role); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка добавления участника: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "add_org_member",
+            "Организация "+org.Name+": "+member.Username+" ("+data.Role+")")
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Участник добавлен",
+        })
+    }
+}
+
+func RemoveOrgMemberHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        orgID, err1 := strconv.ParseInt(vars["id"], 10, 64)
+        memberID, err2 := strconv.ParseInt(vars["user_id"], 10, 64)
+        if err1 != nil || err2 != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID",
+            })
+            return
+        }
+
+        if memberID != userID {
+            ok, err := models.CanAccessOrganization(db, userID, userRole, orgID, models.PermManage)
+            if err != nil || !ok {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Доступ запрещён",
+                })
+                return
+            }
+        }
+
+        if msg := checkLastOrgOwner(db, orgID, memberID); msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.RemoveOrgMember(db, orgID, memberID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления участника: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "remove_org_member",
+            "Пользователь ID: "+strconv.FormatInt(memberID, 10)+
+                " исключён из организации ID: "+strconv.FormatInt(orgID, 10))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Участник исключён",
+        })
+    }
+}
+
+// checkLastOrgOwner возвращает сообщение об ошибке, если пользователь — последний владелец организации
+func checkLastOrgOwner(db *models.DB, orgID, memberID int64) string {
+    role, err := models.GetOrgRole(db, memberID, orgID)
+    if err != nil {
+        return "Ошибка проверки участника: " + err.Error()
+    }
+    if role != models.MemberOwner {
+        return ""
+    }
+    owners, err := models.CountOrgOwners(db, orgID)
+    if err != nil {
+        return "Ошибка проверки участника: " + err.Error()
+    }
+    if owners <= 1 {
+        return "Нельзя лишить организацию последнего владельца"
+    }
+    return ""
+}
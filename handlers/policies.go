@@ -0,0 +1,207 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+func GetRecordPoliciesHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewPolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        policies, err := models.GetAllRecordPolicies(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(policies)
+    }
+}
+
+func CreateRecordPolicyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        var data struct {
+            SubjectType string   `json:"subject_type"` // user или role
+            UserID      int64    `json:"user_id"`
+            Role        string   `json:"role"`
+            DomainID    int64    `json:"domain_id"`
+            RecordTypes []string `json:"record_types"`
+            Actions     []string `json:"actions"`
+            NamePattern string   `json:"name_pattern"`
+            MinTTL      int      `json:"min_ttl"`
+            MaxTTL      int      `json:"max_ttl"`
+        }
+
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        policy := &models.RecordPolicy{
+            SubjectType: data.SubjectType,
+            DomainID:    data.DomainID,
+            NamePattern: strings.TrimSpace(data.NamePattern),
+            MinTTL:      data.MinTTL,
+            MaxTTL:      data.MaxTTL,
+        }
+
+        switch data.SubjectType {
+        case models.PolicySubjectUser:
+            user, err := models.GetUserByID(db, data.UserID)
+            if err != nil || user == nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Пользователь не найден",
+                })
+                return
+            }
+            policy.Subject = strconv.FormatInt(user.ID, 10)
+        case models.PolicySubjectRole:
+            if data.Role == "" {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Не указана роль",
+                })
+                return
+            }
+            policy.Subject = data.Role
+        default:
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Тип субъекта должен быть user или role",
+            })
+            return
+        }
+
+        actions := make([]string, 0, len(data.Actions))
+        for _, a := range data.Actions {
+            a = strings.ToLower(strings.TrimSpace(a))
+            if a != "*" && a != models.ChangeCreate && a != models.ChangeUpdate && a != models.ChangeDelete {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Некорректное действие: " + a,
+                })
+                return
+            }
+            actions = append(actions, a)
+        }
+        if len(actions) == 0 {
+            actions = []string{"*"}
+        }
+        policy.Actions = strings.Join(actions, ",")
+
+        types := make([]string, 0, len(data.RecordTypes))
+        for _, t := range data.RecordTypes {
+            if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+                types = append(types, t)
+            }
+        }
+        if len(types) == 0 {
+            types = []string{"*"}
+        }
+        policy.RecordTypes = strings.Join(types, ",")
+
+        if policy.NamePattern == "" {
+            policy.NamePattern = "*"
+        }
+        if _, err := path.Match(policy.NamePattern, ""); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный шаблон имени",
+            })
+            return
+        }
+
+        if policy.MinTTL < 0 || policy.MaxTTL < 0 || (policy.MaxTTL > 0 && policy.MinTTL > policy.MaxTTL) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректные границы TTL",
+            })
+            return
+        }
+
+        if err := models.CreateRecordPolicy(db, policy); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания политики: " + err.Error(),
+            })
+            return
+        }
+
+        details := fmt.Sprintf("Политика #%d для %s %s: %s %s на %s, TTL %d–%d",
+            policy.ID, policy.SubjectType, policy.Subject, policy.Actions, policy.RecordTypes,
+            policy.NamePattern, policy.MinTTL, policy.MaxTTL)
+        logAction(db, session, r, "create_policy", details)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      policy.ID,
+            "message": "Политика создана",
+        })
+    }
+}
+
+func DeleteRecordPolicyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        id, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID политики",
+            })
+            return
+        }
+
+        if err := models.DeleteRecordPolicy(db, id); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления политики: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_policy",
+            "Удалена политика #"+strconv.FormatInt(id, 10))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Политика удалена",
+        })
+    }
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/sessions"
+)
+
+// GetMyQuotaHandler показывает пользователю его лимиты и текущее использование
+func GetMyQuotaHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        usage, err := services.GetQuotaUsage(db, userID, userRole)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(usage)
+    }
+}
+
+func GetQuotasHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewPolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        quotas, err := models.GetAllQuotas(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        defaults, _ := services.GetEffectiveQuota(db, 0, "")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "quotas":   quotas,
+            "defaults": defaults,
+        })
+    }
+}
+
+// quotaSubject разбирает субъект квоты так же, как у политик: пользователь по ID или роль
+func quotaSubject(db *models.DB, subjectType string, userID int64, role string) (string, string) {
+    switch subjectType {
+    case models.PolicySubjectUser:
+        user, err := models.GetUserByID(db, userID)
+        if err != nil || user == nil {
+            return "", "Пользователь не найден"
+        }
+        return strconv.FormatInt(user.ID, 10), ""
+    case models.PolicySubjectRole:
+        if role == "" {
+            return "", "Не указана роль"
+        }
+        return role, ""
+    }
+    return "", "Тип субъекта должен быть user или role"
+}
+
+func SetQuotaHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        var data struct {
+            SubjectType         string `json:"subject_type"`
+            UserID              int64  `json:"user_id"`
+            Role                string `json:"role"`
+            MaxDomains          int    `json:"max_domains"`
+            MaxRecordsPerDomain int    `json:"max_records_per_domain"`
+            MaxTotalRecords     int    `json:"max_total_records"`
+        }
+
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        subject, msg := quotaSubject(db, data.SubjectType, data.UserID, data.Role)
+        if msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if data.MaxDomains < 0 || data.MaxRecordsPerDomain < 0 || data.MaxTotalRecords < 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Лимиты не могут быть отрицательными (0 — без ограничения)",
+            })
+            return
+        }
+
+        quota := &models.Quota{
+            SubjectType:         data.SubjectType,
+            Subject:             subject,
+            MaxDomains:          data.MaxDomains,
+            MaxRecordsPerDomain: data.MaxRecordsPerDomain,
+            MaxTotalRecords:     data.MaxTotalRecords,
+        }
+        if err := models.SetQuota(db, quota); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения квоты: " + err.Error(),
+            })
+            return
+        }
+
+        details := fmt.Sprintf("Квота для %s %s: доменов %d, записей в домене %d, всего записей %d",
+            quota.SubjectType, quota.Subject, quota.MaxDomains, quota.MaxRecordsPerDomain, quota.MaxTotalRecords)
+        logAction(db, session, r, "set_quota", details)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Квота сохранена",
+        })
+    }
+}
+
+func DeleteQuotaHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManagePolicies) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        subjectType := r.URL.Query().Get("subject_type")
+        userID, _ := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+        subject, msg := quotaSubject(db, subjectType, userID, r.URL.Query().Get("role"))
+        if msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.DeleteQuota(db, subjectType, subject); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления квоты: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_quota",
+            fmt.Sprintf("Удалена квота для %s %s", subjectType, subject))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Квота удалена, действуют значения по умолчанию",
+        })
+    }
+}
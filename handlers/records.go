@@ -2,6 +2,8 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
     "strconv"
     "strings"
@@ -11,9 +13,51 @@ import (
 
     "github.com/gorilla/mux"
     "github.com/gorilla/sessions"
-    "github.com/spf13/viper"
 )
 
+// recordInput — запись из API. TXT запись можно передать списком строк
+// в strings вместо content. ptr — создать или обновить PTR для A/AAAA
+// в обслуживаемой обратной зоне.
+type recordInput struct {
+    models.Record
+    Strings []string `json:"strings"`
+    PTR     bool     `json:"ptr"`
+}
+
+// applyPTR выполняет запрошенное обновление PTR и добавляет итог в ответ.
+// Ошибка PTR не отменяет уже сохранённую прямую запись, изменение
+// защищённой PTR отправляется на согласование.
+func applyPTR(db *models.DB, session *sessions.Session, r *http.Request, record *models.Record, response map[string]interface{}) {
+    userID := session.Values["user_id"].(int64)
+    userRole, _ := session.Values["role"].(string)
+
+    msg, err := services.SetPTR(db, userID, userRole, record)
+    var protectedErr *services.ProtectedRecordError
+    if errors.As(err, &protectedErr) {
+        change, err := createPendingChange(db, r, session, protectedErr.Action, &protectedErr.Record, nil)
+        if err != nil {
+            response["ptr_error"] = "PTR не изменена: ошибка создания заявки: " + err.Error()
+            return
+        }
+        response["ptr"] = fmt.Sprintf("PTR защищена, изменение отправлено на согласование (заявка #%d)", change.ID)
+        return
+    }
+    if err != nil {
+        response["ptr_error"] = "PTR не изменена: " + err.Error()
+        return
+    }
+    response["ptr"] = msg
+    logAction(db, session, r, "set_ptr", msg)
+}
+
+func (in recordInput) record() models.Record {
+    record := in.Record
+    if len(in.Strings) > 0 {
+        record.Content = services.FormatTXT(in.Strings)
+    }
+    return record
+}
+
 func GetRecordsHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
@@ -29,7 +73,7 @@ func GetRecordsHandler(db *models.DB, store *sessions.CookieStore) http.HandlerF
             return
         }
 
-        ok, err := models.CanAccessDomain(db, userID, userRole, domainID)
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermRead)
         if err != nil {
             http.Error(w, err.Error(), http.StatusInternalServerError)
             return
@@ -59,19 +103,19 @@ func CreateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
         if !ok {
             userRole = "user"
         }
-        username := session.Values["username"].(string)
 
-        var record models.Record
-        if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+        var input recordInput
+        if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка чтения данных: " + err.Error(),
             })
             return
         }
+        record := input.record()
 
         // Проверка доступа к домену
-        ok, err := models.CanAccessDomain(db, userID, userRole, record.DomainID)
+        ok, err := models.CanAccessDomain(db, userID, userRole, record.DomainID, models.PermWrite)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -87,28 +131,6 @@ func CreateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        // Получаем настройки безопасности
-        allowNS := viper.GetBool("security.allow_users_create_ns")
-        allowA := viper.GetBool("security.allow_users_create_a")
-
-        // Если пользователь не admin, применяем ограничения
-        if userRole != "admin" {
-            if record.Type == "NS" && !allowNS {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Создание NS записей запрещено для пользователей",
-                })
-                return
-            }
-            if record.Type == "A" && !allowA {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Создание A записей запрещено для пользователей",
-                })
-                return
-            }
-        }
-
         domain, err := models.GetDomainByID(db, record.DomainID)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
@@ -126,31 +148,45 @@ func CreateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        nameCheck := services.ValidateRecordName(record.Name, domain.Name)
-        if !nameCheck.Valid {
+        if err := services.CheckDomainEditable(domain); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка в имени: " + nameCheck.Message,
+                "message": err.Error(),
             })
             return
         }
-        if nameCheck.Corrected != record.Name {
-            record.Name = nameCheck.Corrected
+
+        if err := services.PrepareRecord(&record, domain.Name); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
         }
 
-        contentCheck := services.ValidateRecordContent(record.Type, record.Content, domain.Name)
-        if !contentCheck.Valid {
+        if err := services.CheckRecordPolicy(db, userID, userRole, models.ChangeCreate, domain, &record); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка в значении: " + contentCheck.Message,
+                "message": err.Error(),
             })
             return
         }
-        if contentCheck.Corrected != record.Content {
-            record.Content = contentCheck.Corrected
+
+        // Изменения защищённых записей уходят на согласование
+        protected, err := models.IsRecordProtected(db, record.DomainID, record.Type, record.Name)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки правил защиты: " + err.Error(),
+            })
+            return
+        }
+        if protected {
+            submitPendingChange(db, w, r, session, models.ChangeCreate, &record)
+            return
         }
 
-        if err := models.CreateRecord(db, &record); err != nil {
+        if err := services.ApplyRecordChange(db, models.ChangeCreate, &record); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка сохранения записи: " + err.Error(),
@@ -160,16 +196,17 @@ func CreateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
 
         // Логирование создания записи
         details := "Создана запись: " + record.Type + " " + record.Name + " → " + record.Content
-        services.LogUserAction(db, userID, username, "create_record", details, r.RemoteAddr)
-
-        models.IncrementDomainSerial(db, record.DomainID)
-        services.GenerateZone(db, record.DomainID)
+        logAction(db, session, r, "create_record", details)
 
-        json.NewEncoder(w).Encode(map[string]interface{}{
+        response := map[string]interface{}{
             "success": true,
             "id":      record.ID,
             "message": "Запись успешно создана",
-        })
+        }
+        if input.PTR {
+            applyPTR(db, session, r, &record, response)
+        }
+        json.NewEncoder(w).Encode(response)
     }
 }
 
@@ -183,7 +220,6 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
         if !ok {
             userRole = "user"
         }
-        username := session.Values["username"].(string)
 
         vars := mux.Vars(r)
         id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -195,14 +231,15 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        var record models.Record
-        if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+        var input recordInput
+        if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка чтения данных: " + err.Error(),
             })
             return
         }
+        record := input.record()
         record.ID = id
 
         existing, err := models.GetRecordByID(db, id)
@@ -222,7 +259,7 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        ok, err = models.CanAccessDomain(db, userID, userRole, existing.DomainID)
+        ok, err = models.CanAccessDomain(db, userID, userRole, existing.DomainID, models.PermWrite)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -238,27 +275,6 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        // Если пользователь не admin, проверяем разрешённые типы
-        if userRole != "admin" {
-            allowNS := viper.GetBool("security.allow_users_create_ns")
-            allowA := viper.GetBool("security.allow_users_create_a")
-
-            if record.Type == "NS" && !allowNS {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Редактирование NS записей запрещено для пользователей",
-                })
-                return
-            }
-            if record.Type == "A" && !allowA {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Редактирование A записей запрещено для пользователей",
-                })
-                return
-            }
-        }
-
         domain, err := models.GetDomainByID(db, existing.DomainID)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
@@ -268,24 +284,53 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        nameCheck := services.ValidateRecordName(record.Name, domain.Name)
-        if !nameCheck.Valid {
+        if err := services.CheckDomainEditable(domain); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка в имени: " + nameCheck.Message,
+                "message": err.Error(),
             })
             return
         }
 
-        contentCheck := services.ValidateRecordContent(record.Type, record.Content, domain.Name)
-        if !contentCheck.Valid {
+        record.DomainID = existing.DomainID
+        if err := services.PrepareRecord(&record, domain.Name); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Ошибка в значении: " + contentCheck.Message,
+                "message": err.Error(),
             })
             return
         }
 
+        // Политика должна разрешать изменение как текущей записи, так и результата
+        err = services.CheckRecordPolicy(db, userID, userRole, models.ChangeUpdate, domain, existing)
+        if err == nil {
+            err = services.CheckRecordPolicy(db, userID, userRole, models.ChangeUpdate, domain, &record)
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        // Защищённой считается запись, если правило совпадает со старым или новым значением
+        protected, err := models.IsRecordProtected(db, existing.DomainID, existing.Type, existing.Name)
+        if err == nil && !protected {
+            protected, err = models.IsRecordProtected(db, existing.DomainID, record.Type, record.Name)
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки правил защиты: " + err.Error(),
+            })
+            return
+        }
+        if protected {
+            submitPendingChange(db, w, r, session, models.ChangeUpdate, &record)
+            return
+        }
+
         // Сохраняем старые значения для лога
         oldContent := existing.Content
         oldName := existing.Name
@@ -293,7 +338,7 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
         oldPriority := existing.Priority
         oldTTL := existing.TTL
 
-        if err := models.UpdateRecord(db, &record); err != nil {
+        if err := services.ApplyRecordChange(db, models.ChangeUpdate, &record); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка обновления записи: " + err.Error(),
@@ -319,15 +364,16 @@ func UpdateRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             details += "TTL: " + strconv.Itoa(oldTTL) + " → " + strconv.Itoa(record.TTL) + ", "
         }
         details = strings.TrimSuffix(details, ", ")
-        services.LogUserAction(db, userID, username, "update_record", details, r.RemoteAddr)
-
-        models.IncrementDomainSerial(db, existing.DomainID)
-        services.GenerateZone(db, existing.DomainID)
+        logAction(db, session, r, "update_record", details)
 
-        json.NewEncoder(w).Encode(map[string]interface{}{
+        response := map[string]interface{}{
             "success": true,
             "message": "Запись успешно обновлена",
-        })
+        }
+        if input.PTR {
+            applyPTR(db, session, r, &record, response)
+        }
+        json.NewEncoder(w).Encode(response)
     }
 }
 
@@ -341,7 +387,6 @@ func DeleteRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
         if !ok {
             userRole = "user"
         }
-        username := session.Values["username"].(string)
 
         vars := mux.Vars(r)
         id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -370,7 +415,7 @@ func DeleteRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        ok, err = models.CanAccessDomain(db, userID, userRole, record.DomainID)
+        ok, err = models.CanAccessDomain(db, userID, userRole, record.DomainID, models.PermWrite)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
@@ -386,44 +431,50 @@ func DeleteRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
             return
         }
 
-        // Если пользователь не admin, проверяем разрешённые типы
-        if userRole != "admin" {
-            allowNS := viper.GetBool("security.allow_users_create_ns")
-            allowA := viper.GetBool("security.allow_users_create_a")
-
-            if record.Type == "NS" && !allowNS {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Удаление NS записей запрещено для пользователей",
-                })
-                return
-            }
-            if record.Type == "A" && !allowA {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Удаление A записей запрещено для пользователей",
-                })
-                return
-            }
-        }
-
-        if record.Type == "NS" {
-            nsCount, err := models.CountNSRecords(db, record.DomainID)
-            if err != nil {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Ошибка проверки NS записей: " + err.Error(),
-                })
-                return
-            }
-            
-            if nsCount <= 1 {
-                json.NewEncoder(w).Encode(map[string]interface{}{
-                    "success": false,
-                    "message": "Нельзя удалить последний NS сервер",
-                })
-                return
-            }
+        domain, err := models.GetDomainByID(db, record.DomainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        if err := services.CheckDomainEditable(domain); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if err := services.CheckRecordPolicy(db, userID, userRole, models.ChangeDelete, domain, record); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if err := services.CheckRecordDelete(db, record); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        protected, err := models.IsRecordProtected(db, record.DomainID, record.Type, record.Name)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки правил защиты: " + err.Error(),
+            })
+            return
+        }
+        if protected {
+            submitPendingChange(db, w, r, session, models.ChangeDelete, record)
+            return
         }
 
         // Сохраняем информацию для лога
@@ -431,7 +482,7 @@ func DeleteRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
         recordName := record.Name
         recordContent := record.Content
 
-        if err := models.DeleteRecord(db, id); err != nil {
+        if err := services.ApplyRecordChange(db, models.ChangeDelete, record); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка удаления записи: " + err.Error(),
@@ -441,10 +492,7 @@ func DeleteRecordHandler(db *models.DB, store *sessions.CookieStore) http.Handle
 
         // Логирование удаления записи
         details := "Удалена запись: " + recordType + " " + recordName + " → " + recordContent
-        services.LogUserAction(db, userID, username, "delete_record", details, r.RemoteAddr)
-
-        models.IncrementDomainSerial(db, record.DomainID)
-        services.GenerateZone(db, record.DomainID)
+        logAction(db, session, r, "delete_record", details)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
             "success": true,
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/sessions"
+)
+
+// CreateReverseZoneHandler создаёт обратную зону in-addr.arpa или ip6.arpa
+// по префиксу. Для блоков меньше /24 создаётся бесклассовая зона (RFC 2317).
+func CreateReverseZoneHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        // Адресные блоки распределяет администратор
+        if !sessionCan(session, models.CapWriteAllDomains) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        var data struct {
+            CIDR     string `json:"cidr"`
+            SOAEmail string `json:"soa_email"`
+            OrgID    int64  `json:"org_id"` // 0 — личная зона
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        zone, err := services.ReverseZoneForCIDR(data.CIDR)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if data.SOAEmail != "" && !services.ValidateEmail(data.SOAEmail) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный email",
+            })
+            return
+        }
+
+        exists, err := models.DomainExists(db, zone.Name)
+        if err == models.ErrDomainInTrash {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Зона " + zone.Name + " находится в корзине: восстановите его или удалите окончательно",
+            })
+            return
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки домена: " + err.Error(),
+            })
+            return
+        }
+        if exists {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Зона " + zone.Name + " уже существует",
+            })
+            return
+        }
+
+        opts := newDomainOptions(zone.Name, userID, data.OrgID, data.SOAEmail)
+        opts.ReverseCIDR = zone.CIDR
+        domainID, err := models.CreateDomain(db, opts)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания зоны: " + err.Error(),
+            })
+            return
+        }
+
+        if msg := createZoneBaseRecords(db, domainID, zone.Name, data.SOAEmail); msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        services.RebuildZonesConf(db)
+        services.PublishZone(db, domainID)
+        services.NotifySecondaries(db, domainID)
+
+        response := map[string]interface{}{
+            "success":   true,
+            "domain_id": domainID,
+            "name":      zone.Name,
+            "cidr":      zone.CIDR,
+            "message":   "Обратная зона " + zone.Name + " создана",
+        }
+
+        details := fmt.Sprintf("Создана обратная зона %s для %s", zone.Name, zone.CIDR)
+        if zone.ParentName != "" {
+            result, manual, err := services.ApplyClasslessDelegation(db, userID, userRole, zone)
+            switch {
+            case err != nil:
+                response["delegation_error"] = "Ошибка делегирования: " + err.Error()
+            case result != nil:
+                response["delegation"] = map[string]interface{}{
+                    "zone":      zone.ParentName,
+                    "applied":   result.Applied,
+                    "conflicts": result.Conflicts,
+                    "skipped":   result.Skipped,
+                }
+                details += fmt.Sprintf(", в %s добавлено записей NS и CNAME: %d", zone.ParentName, len(result.Applied))
+            default:
+                // Родительская зона не у нас: записи должен добавить её владелец
+                lines := make([]string, len(manual))
+                for i, rec := range manual {
+                    lines[i] = fmt.Sprintf("%s.%s. IN %s %s", rec.Name, zone.ParentName, rec.Type,
+                        strings.TrimSuffix(rec.Content, ".")+".")
+                }
+                response["delegation_records"] = lines
+                response["message"] = fmt.Sprintf("Обратная зона %s создана. Попросите владельца %s добавить NS и CNAME записи для делегирования",
+                    zone.Name, zone.ParentName)
+            }
+        }
+
+        logAction(db, session, r, "create_reverse_zone", details)
+        json.NewEncoder(w).Encode(response)
+    }
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+func CreateScheduledChangeHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole, ok := session.Values["role"].(string)
+        if !ok {
+            userRole = "user"
+        }
+        username := session.Values["username"].(string)
+
+        var data struct {
+            Action   string `json:"action"`
+            RecordID int64  `json:"record_id"`
+            DomainID int64  `json:"domain_id"`
+            Type     string `json:"type"`
+            Name     string `json:"name"`
+            Content  string `json:"content"`
+            Strings  []string `json:"strings"` // TXT запись списком строк
+            Priority int    `json:"priority"`
+            TTL      int    `json:"ttl"`
+            RunAt    string `json:"run_at"` // RFC 3339, например 2026-03-01T03:00:00+03:00
+        }
+
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        runAt, err := time.Parse(time.RFC3339, data.RunAt)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректное время выполнения, ожидается формат RFC 3339",
+            })
+            return
+        }
+        if !runAt.After(time.Now()) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Время выполнения должно быть в будущем",
+            })
+            return
+        }
+
+        record := models.Record{
+            ID:       data.RecordID,
+            DomainID: data.DomainID,
+            Type:     data.Type,
+            Name:     data.Name,
+            Content:  data.Content,
+            Priority: data.Priority,
+            TTL:      data.TTL,
+        }
+        if len(data.Strings) > 0 {
+            record.Content = services.FormatTXT(data.Strings)
+        }
+
+        // existing — текущая запись для update и delete
+        var existing *models.Record
+        switch data.Action {
+        case models.ChangeCreate:
+            record.ID = 0
+        case models.ChangeUpdate, models.ChangeDelete:
+            existing, err = models.GetRecordByID(db, data.RecordID)
+            if err != nil || existing == nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Запись не найдена",
+                })
+                return
+            }
+            record.DomainID = existing.DomainID
+            if data.Action == models.ChangeDelete {
+                record = *existing
+            }
+        default:
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Неизвестное действие: " + data.Action,
+            })
+            return
+        }
+
+        ok, err = models.CanAccessDomain(db, userID, userRole, record.DomainID, models.PermWrite)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, record.DomainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        if err := services.CheckDomainEditable(domain); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        // Проверяем изменение сразу, чтобы ошибка не всплыла ночью во время окна работ
+        if data.Action != models.ChangeDelete {
+            if err := services.PrepareRecord(&record, domain.Name); err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": err.Error(),
+                })
+                return
+            }
+        }
+
+        // Политика должна разрешать изменение как текущей записи, так и результата
+        if existing != nil {
+            err = services.CheckRecordPolicy(db, userID, userRole, data.Action, domain, existing)
+        }
+        if err == nil {
+            err = services.CheckRecordPolicy(db, userID, userRole, data.Action, domain, &record)
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        // Запланированное изменение применяется без участия человека, поэтому
+        // защищённые записи может планировать только согласующий. Защищённой
+        // считается запись, если правило совпадает со старым или новым значением.
+        protected := false
+        if existing != nil {
+            protected, err = models.IsRecordProtected(db, existing.DomainID, existing.Type, existing.Name)
+        }
+        if err == nil && !protected {
+            protected, err = models.IsRecordProtected(db, record.DomainID, record.Type, record.Name)
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки правил защиты: " + err.Error(),
+            })
+            return
+        }
+        if protected {
+            canApprove, err := models.CanApproveChanges(db, userID, userRole, record.DomainID)
+            if err != nil || !canApprove {
+                // Без права согласования изменение уходит на согласование и после
+                // одобрения выполняется в то же запланированное время
+                submitPendingChangeAt(db, w, r, session, data.Action, &record, &runAt)
+                return
+            }
+        }
+
+        change := &models.ScheduledChange{
+            DomainID:      record.DomainID,
+            RecordID:      record.ID,
+            Action:        data.Action,
+            Type:          record.Type,
+            Name:          record.Name,
+            Content:       record.Content,
+            Priority:      record.Priority,
+            TTL:           record.TTL,
+            RunAt:         runAt,
+            CreatedBy:     userID,
+            CreatedByName: username,
+        }
+
+        if err := models.CreateScheduledChange(db, change); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания задания: " + err.Error(),
+            })
+            return
+        }
+
+        details := fmt.Sprintf("Запланировано изменение #%d на %s (%s): %s %s → %s",
+            change.ID, runAt.Format(time.RFC3339), data.Action, record.Type, record.Name, record.Content)
+        logAction(db, session, r, "schedule_change", details)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      change.ID,
+            "message": "Изменение запланировано",
+        })
+    }
+}
+
+func GetScheduledChangesHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        changes, err := models.GetScheduledChanges(db, userID, userRole, r.URL.Query().Get("status"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(changes)
+    }
+}
+
+func CancelScheduledChangeHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        id, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID задания",
+            })
+            return
+        }
+
+        change, err := models.GetScheduledChangeByID(db, id)
+        if err != nil || change == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Задание не найдено",
+            })
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, change.DomainID, models.PermWrite)
+        if err != nil || !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        cancelled, err := models.CancelScheduledChange(db, id)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка отмены задания: " + err.Error(),
+            })
+            return
+        }
+        if !cancelled {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Задание уже выполнено или отменено",
+            })
+            return
+        }
+
+        logAction(db, session, r, "cancel_scheduled_change",
+            fmt.Sprintf("Отменено запланированное изменение #%d (%s %s)", id, change.Type, change.Name))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Задание отменено",
+        })
+    }
+}
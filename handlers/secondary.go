@@ -0,0 +1,131 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/sessions"
+)
+
+// secondaryPrimaries проверяет список первичных серверов и имя TSIG ключа
+// вторичной зоны. Возвращает нормализованные адреса или сообщение об ошибке.
+func secondaryPrimaries(db *models.DB, list []string, tsigKey string) ([]string, string) {
+    var primaries []string
+    for _, addr := range list {
+        if strings.TrimSpace(addr) == "" {
+            continue
+        }
+        parsed, err := services.ParseXFRAddress(addr)
+        if err != nil {
+            return nil, "Первичный сервер: " + err.Error()
+        }
+        primaries = append(primaries, parsed)
+    }
+    if len(primaries) == 0 {
+        return nil, "Для вторичной зоны нужен хотя бы один первичный сервер"
+    }
+    if err := services.CheckTSIGKeyName(db, tsigKey); err != nil {
+        return nil, err.Error()
+    }
+    return primaries, ""
+}
+
+// secondaryDomain возвращает вторичный домен из URL после проверки прав
+func secondaryDomain(db *models.DB, session *sessions.Session, r *http.Request, perm models.Permission) (*models.Domain, string) {
+    domain, msg := requestDomain(db, session, r, perm)
+    if domain != nil && !domain.IsSecondary() {
+        return nil, "Домен не является вторичной зоной"
+    }
+    return domain, msg
+}
+
+// UpdateSecondaryHandler меняет первичные серверы и TSIG ключ вторичной зоны
+func UpdateSecondaryHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := secondaryDomain(db, session, r, models.PermWrite)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        var data struct {
+            Primaries []string `json:"primaries"`
+            TSIGKey   string   `json:"tsig_key"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        primaries, msg := secondaryPrimaries(db, data.Primaries, data.TSIGKey)
+        if msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.UpdateSecondarySettings(db, domain.ID, strings.Join(primaries, ","), data.TSIGKey); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения: " + err.Error(),
+            })
+            return
+        }
+
+        // Knot и BIND хранят первичные серверы и ключ в описании зоны,
+        // поэтому оно передаётся серверу заново
+        services.RebuildZonesConf(db)
+        message := "Настройки вторичной зоны сохранены"
+        if err := services.PublishZone(db, domain.ID); err != nil {
+            message += ", но DNS сервер не обновлён: " + err.Error()
+        }
+
+        logAction(db, session, r, "update_secondary", "Изменены первичные серверы домена "+domain.Name+": "+
+            strings.Join(primaries, ", "))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": message,
+        })
+    }
+}
+
+// ZoneTransferStatusHandler возвращает состояние передачи вторичной зоны
+func ZoneTransferStatusHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := secondaryDomain(db, session, r, models.PermRead)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":   true,
+            "name":      domain.Name,
+            "primaries": domain.PrimaryList(),
+            "tsig_key":  domain.TSIGKey,
+            "status":    services.GetZoneTransferStatus(domain.Name),
+        })
+    }
+}
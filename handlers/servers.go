@@ -0,0 +1,328 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "path"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+    "github.com/spf13/viper"
+)
+
+// dnsServerForAdmin возвращает удалённый сервер из URL
+func dnsServerForAdmin(db *models.DB, r *http.Request) (*models.DNSServer, string) {
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        return nil, "Некорректный ID сервера"
+    }
+    server, err := models.GetDNSServerByID(db, id)
+    if err != nil || server == nil {
+        return nil, "Сервер не найден"
+    }
+    return server, ""
+}
+
+func GetDNSServersHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        servers, err := services.GetDistributionStatus(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(servers)
+    }
+}
+
+// CreateDNSServerHandler добавляет удалённый NSD сервер и ставит в очередь
+// полную копию зон
+func CreateDNSServerHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        var data struct {
+            Name      string `json:"name"`
+            Transport string `json:"transport"`
+            Address   string `json:"address"`
+            ZoneDir   string `json:"zone_dir"`
+            ConfPath  string `json:"conf_path"`
+            Token     string `json:"token"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        server := &models.DNSServer{
+            Name:      strings.TrimSpace(data.Name),
+            Transport: strings.ToLower(strings.TrimSpace(data.Transport)),
+            Address:   strings.TrimSpace(data.Address),
+            ZoneDir:   strings.TrimSpace(data.ZoneDir),
+            ConfPath:  strings.TrimSpace(data.ConfPath),
+            Enabled:   true,
+        }
+        if server.ZoneDir == "" {
+            server.ZoneDir = viper.GetString("distribution.zone_dir")
+        }
+        if server.ConfPath == "" {
+            server.ConfPath = viper.GetString("distribution.conf_path")
+        }
+
+        // Агент в режиме pull может входить без токена, по клиентскому сертификату
+        msg := ""
+        switch {
+        case server.Name == "":
+            msg = "Укажите имя сервера"
+        case server.Transport != models.TransportSSH && server.Transport != models.TransportHTTP &&
+            server.Transport != models.TransportPull:
+            msg = "Способ доставки должен быть ssh, http или pull"
+        case server.Address == "" && server.Transport != models.TransportPull:
+            msg = "Укажите адрес сервера"
+        case !path.IsAbs(server.ZoneDir) || !path.IsAbs(server.ConfPath):
+            msg = "Каталог зон и путь к zones.conf должны быть абсолютными"
+        case server.Transport == models.TransportHTTP && data.Token == "":
+            msg = "Для агента нужен токен"
+        }
+        if msg == "" && server.Transport == models.TransportHTTP {
+            if u, err := url.Parse(server.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                msg = "Адрес агента должен быть URL вида https://host:port"
+            }
+        }
+        if msg == "" && server.Transport == models.TransportSSH {
+            if err := services.ValidateSSHAddress(server.Address); err != nil {
+                msg = "Некорректный адрес сервера: " + err.Error()
+            }
+        }
+        if msg == "" && strings.ContainsAny(server.Address, " '\"") {
+            msg = "Некорректный адрес сервера"
+        }
+        if msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+        if existing, _ := models.GetDNSServerByName(db, server.Name); existing != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Сервер с таким именем уже существует",
+            })
+            return
+        }
+
+        encrypted := ""
+        if data.Token != "" {
+            var err error
+            encrypted, err = services.EncryptSecret([]byte(data.Token))
+            if err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": err.Error(),
+                })
+                return
+            }
+        }
+
+        if err := models.CreateDNSServer(db, server, encrypted); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения сервера: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "create_dns_server", "Добавлен сервер "+server.Name+" ("+server.Transport+" "+server.Address+")")
+
+        message := "Сервер добавлен, зоны поставлены в очередь"
+        if err := services.QueueFullSync(db, server.ID); err != nil {
+            message = "Сервер добавлен, но зоны не поставлены в очередь: " + err.Error()
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      server.ID,
+            "message": message,
+        })
+    }
+}
+
+// UpdateDNSServerHandler включает или выключает копирование на сервер.
+// После включения зоны копируются заново.
+func UpdateDNSServerHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        server, msg := dnsServerForAdmin(db, r)
+        if server == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        var data struct {
+            Enabled bool `json:"enabled"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        if err := models.SetDNSServerEnabled(db, server.ID, data.Enabled); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения сервера: " + err.Error(),
+            })
+            return
+        }
+
+        message := "Копирование на сервер выключено"
+        if data.Enabled {
+            message = "Копирование на сервер включено"
+            if err := services.QueueFullSync(db, server.ID); err != nil {
+                message += ", но зоны не поставлены в очередь: " + err.Error()
+            }
+            logAction(db, session, r, "enable_dns_server", "Включён сервер "+server.Name)
+        } else {
+            logAction(db, session, r, "disable_dns_server", "Выключен сервер "+server.Name)
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": message,
+        })
+    }
+}
+
+// DeleteDNSServerHandler удаляет сервер из панели. Файлы на самом сервере остаются.
+func DeleteDNSServerHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        server, msg := dnsServerForAdmin(db, r)
+        if server == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.DeleteDNSServer(db, server.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления сервера: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_dns_server", "Удалён сервер "+server.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Сервер удалён",
+        })
+    }
+}
+
+// SyncDNSServerHandler ставит в очередь полную копию зон на сервер
+func SyncDNSServerHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        server, msg := dnsServerForAdmin(db, r)
+        if server == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := services.QueueFullSync(db, server.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка постановки в очередь: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "sync_dns_server", "Запущена полная синхронизация сервера "+server.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Зоны поставлены в очередь",
+        })
+    }
+}
+
+// GetDNSServerSyncHandler возвращает состояние и serial каждой зоны на сервере
+func GetDNSServerSyncHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        server, msg := dnsServerForAdmin(db, r)
+        if server == nil {
+            http.Error(w, msg, http.StatusNotFound)
+            return
+        }
+
+        jobs, err := models.GetServerSync(db, server.ID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(jobs)
+    }
+}
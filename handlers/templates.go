@@ -0,0 +1,294 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// templateForUse загружает шаблон и проверяет, доступен ли он пользователю.
+// Вторым значением возвращается сообщение об ошибке.
+func templateForUse(db *models.DB, userID int64, userRole string, id int64) (*models.RecordTemplate, string) {
+    template, err := models.GetRecordTemplateByID(db, id)
+    if err != nil {
+        return nil, "Ошибка получения шаблона: " + err.Error()
+    }
+    if template == nil || !models.CanUseTemplate(template, userID, userRole) {
+        return nil, "Шаблон не найден"
+    }
+    return template, ""
+}
+
+// recordSetMessage кратко описывает итог добавления набора записей
+func recordSetMessage(result *services.RecordSetResult, dryRun bool) string {
+    verb := "Добавлено"
+    if dryRun {
+        verb = "Будет добавлено"
+    }
+    msg := fmt.Sprintf("%s записей: %d", verb, len(result.Applied))
+    if len(result.Conflicts) > 0 {
+        msg += fmt.Sprintf(", конфликтов: %d", len(result.Conflicts))
+    }
+    if len(result.Skipped) > 0 {
+        msg += fmt.Sprintf(", пропущено: %d", len(result.Skipped))
+    }
+    if len(result.Warnings) > 0 {
+        msg += fmt.Sprintf(", предупреждений: %d", len(result.Warnings))
+    }
+    return msg
+}
+
+func GetTemplatesHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        templates, err := models.GetRecordTemplates(db, userID, userRole)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(templates)
+    }
+}
+
+func CreateTemplateHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+
+        if !sessionCan(session, models.CapEditDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ваша роль не позволяет создавать шаблоны",
+            })
+            return
+        }
+
+        var data struct {
+            Name    string                  `json:"name"`
+            Global  bool                    `json:"global"` // общий шаблон, доступный всем
+            Records []models.TemplateRecord `json:"records"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        data.Name = strings.TrimSpace(data.Name)
+        if data.Name == "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Укажите название шаблона",
+            })
+            return
+        }
+
+        if data.Global && !sessionCan(session, models.CapWriteAllDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Общие шаблоны может создавать только администратор",
+            })
+            return
+        }
+
+        if err := services.ValidateTemplateRecords(data.Records); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        template := &models.RecordTemplate{
+            Name:    data.Name,
+            OwnerID: userID,
+            Records: data.Records,
+        }
+        if data.Global {
+            template.OwnerID = 0
+        }
+
+        if err := models.CreateRecordTemplate(db, template); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания шаблона: " + err.Error(),
+            })
+            return
+        }
+
+        kind := "личный"
+        if data.Global {
+            kind = "общий"
+        }
+        logAction(db, session, r, "create_template",
+            fmt.Sprintf("Создан %s шаблон записей %s (%d записей)", kind, template.Name, len(template.Records)))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      template.ID,
+            "message": "Шаблон создан",
+        })
+    }
+}
+
+func DeleteTemplateHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+
+        vars := mux.Vars(r)
+        id, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID шаблона",
+            })
+            return
+        }
+
+        template, err := models.GetRecordTemplateByID(db, id)
+        if err != nil || template == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Шаблон не найден",
+            })
+            return
+        }
+
+        // Личный шаблон удаляет владелец, общие — администратор
+        if template.OwnerID != userID && !sessionCan(session, models.CapWriteAllDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        if err := models.DeleteRecordTemplate(db, id); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления шаблона: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_template", "Удалён шаблон записей "+template.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Шаблон удалён",
+        })
+    }
+}
+
+// ApplyTemplateHandler добавляет записи шаблона в существующий домен.
+// Записи, конфликтующие с текущими, не добавляются и возвращаются в ответе.
+func ApplyTemplateHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            TemplateID int64  `json:"template_id"`
+            IP         string `json:"ip"`
+            DryRun     bool   `json:"dry_run"` // только показать результат, не изменяя домен
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        ok, err := models.CanAccessDomain(db, userID, userRole, domainID, models.PermWrite)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки доступа: " + err.Error(),
+            })
+            return
+        }
+        if !ok {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        template, msg := templateForUse(db, userID, userRole, data.TemplateID)
+        if template == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        result, err := services.ApplyTemplate(db, userID, userRole, domain, template, data.IP, data.DryRun)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if !data.DryRun && len(result.Applied) > 0 {
+            logAction(db, session, r, "apply_template",
+                fmt.Sprintf("К домену %s применён шаблон %s: добавлено %d, конфликтов %d, пропущено %d",
+                    domain.Name, template.Name, len(result.Applied), len(result.Conflicts), len(result.Skipped)))
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":   true,
+            "message":   recordSetMessage(result, data.DryRun),
+            "applied":   result.Applied,
+            "conflicts": result.Conflicts,
+            "skipped":   result.Skipped,
+        })
+    }
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// transferRecipient проверяет, может ли пользователь стать владельцем домена
+func transferRecipient(user *models.User) string {
+    if user == nil {
+        return "Пользователь не найден"
+    }
+    if !user.Active {
+        return "Учётная запись получателя отключена"
+    }
+    if !models.RoleCan(string(user.Role), models.CapEditDomains) {
+        return "Роль получателя не позволяет владеть доменами"
+    }
+    return ""
+}
+
+// ReassignDomainOwnerHandler — прямая передача домена администратором
+func ReassignDomainOwnerHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapWriteAllDomains) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            UserID int64 `json:"user_id"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        user, _ := models.GetUserByID(db, data.UserID)
+        if msg := transferRecipient(user); msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if domain.UserID == user.ID && domain.OrgID == 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Пользователь уже владеет доменом",
+            })
+            return
+        }
+
+        previous := domain.OwnerName
+        if previous == "" {
+            if owner, _ := models.GetUserByID(db, domain.UserID); owner != nil {
+                previous = owner.Username
+            }
+        }
+
+        // Администратор передаёт домен без учёта квоты получателя
+        if err := models.TransferDomainOwnership(db, domainID, user.ID, 0, 0); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка передачи домена: " + err.Error(),
+            })
+            return
+        }
+
+        // Группа домена в каталожной зоне может зависеть от владельца
+        services.RebuildZonesConf(db)
+
+        logAction(db, session, r, "reassign_domain",
+            fmt.Sprintf("Домен %s передан от %s пользователю %s", domain.Name, previous, user.Username))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Владелец домена изменён",
+        })
+    }
+}
+
+// OfferDomainTransferHandler — владелец предлагает домен другому пользователю
+func OfferDomainTransferHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+
+        vars := mux.Vars(r)
+        domainID, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID домена",
+            })
+            return
+        }
+
+        var data struct {
+            Username string `json:"username"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        domain, err := models.GetDomainByID(db, domainID)
+        if err != nil || domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Домен не найден",
+            })
+            return
+        }
+
+        // Предложить передачу может только личный владелец домена
+        if domain.UserID != userID || domain.OrgID != 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Передать можно только собственный домен",
+            })
+            return
+        }
+
+        recipient, _ := models.GetUserByUsername(db, strings.TrimSpace(data.Username))
+        if msg := transferRecipient(recipient); msg != "" {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+        if recipient.ID == userID {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Нельзя передать домен самому себе",
+            })
+            return
+        }
+
+        transfer := &models.DomainTransfer{
+            DomainID:   domainID,
+            FromUserID: userID,
+            ToUserID:   recipient.ID,
+        }
+        if err := models.CreateDomainTransfer(db, transfer); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка создания предложения: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "offer_domain_transfer",
+            fmt.Sprintf("Предложена передача домена %s пользователю %s (#%d)", domain.Name, recipient.Username, transfer.ID))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      transfer.ID,
+            "message": "Предложение отправлено, домен перейдёт после подтверждения получателем",
+        })
+    }
+}
+
+func GetDomainTransfersHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+
+        transfers, err := models.GetPendingTransfers(db, userID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        json.NewEncoder(w).Encode(transfers)
+    }
+}
+
+func AcceptDomainTransferHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return resolveDomainTransferHandler(db, store, models.TransferAccepted)
+}
+
+func DeclineDomainTransferHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return resolveDomainTransferHandler(db, store, models.TransferDeclined)
+}
+
+func CancelDomainTransferHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return resolveDomainTransferHandler(db, store, models.TransferCancelled)
+}
+
+// resolveDomainTransferHandler закрывает предложение: получатель принимает или
+// отклоняет его, отправитель может отозвать
+func resolveDomainTransferHandler(db *models.DB, store *sessions.CookieStore, status string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        vars := mux.Vars(r)
+        id, err := strconv.ParseInt(vars["id"], 10, 64)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректный ID предложения",
+            })
+            return
+        }
+
+        transfer, err := models.GetDomainTransferByID(db, id)
+        if err != nil || transfer == nil || transfer.Status != models.TransferPending {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Предложение не найдено или уже закрыто",
+            })
+            return
+        }
+
+        allowed := transfer.ToUserID == userID
+        if status == models.TransferCancelled {
+            allowed = transfer.FromUserID == userID
+        }
+        if !allowed {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Доступ запрещён",
+            })
+            return
+        }
+
+        if status != models.TransferAccepted {
+            ok, err := models.ResolveDomainTransfer(db, id, status)
+            if err != nil || !ok {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Предложение не найдено или уже закрыто",
+                })
+                return
+            }
+
+            action, verb := "decline_domain_transfer", "отклонена"
+            if status == models.TransferCancelled {
+                action, verb = "cancel_domain_transfer", "отозвана"
+            }
+            logAction(db, session, r, action,
+                fmt.Sprintf("Передача домена %s (#%d) %s", transfer.DomainName, id, verb))
+
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": true,
+                "message": "Передача домена " + verb,
+            })
+            return
+        }
+
+        // Владелец мог смениться после отправки предложения
+        domain, err := models.GetDomainByID(db, transfer.DomainID)
+        if err != nil || domain == nil || domain.UserID != transfer.FromUserID || domain.OrgID != 0 {
+            models.ResolveDomainTransfer(db, id, models.TransferCancelled)
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Отправитель больше не владеет доменом, предложение отменено",
+            })
+            return
+        }
+
+        if !models.RoleCan(userRole, models.CapEditDomains) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ваша роль не позволяет владеть доменами",
+            })
+            return
+        }
+
+        quota, err := services.GetEffectiveQuota(db, userID, userRole)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки квоты: " + err.Error(),
+            })
+            return
+        }
+
+        err = models.TransferDomainOwnership(db, transfer.DomainID, userID, id, quota.MaxDomains)
+        if err == models.ErrQuotaExceeded {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": services.DomainQuotaMessage(quota),
+            })
+            return
+        }
+        if err == sql.ErrNoRows {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Предложение не найдено или уже закрыто",
+            })
+            return
+        }
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка передачи домена: " + err.Error(),
+            })
+            return
+        }
+
+        services.RebuildZonesConf(db)
+
+        logAction(db, session, r, "accept_domain_transfer",
+            fmt.Sprintf("Домен %s принят от %s (#%d)", transfer.DomainName, transfer.FromUsername, id))
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Домен " + transfer.DomainName + " передан вам",
+        })
+    }
+}
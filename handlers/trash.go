@@ -0,0 +1,154 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+type trashedDomain struct {
+    models.Domain
+    PurgeAt time.Time // когда домен будет удалён безвозвратно
+}
+
+func GetTrashHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        userID := session.Values["user_id"].(int64)
+        userRole := session.Values["role"].(string)
+
+        domains, err := models.GetTrashedDomains(db, userID, userRole)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+
+        retention := services.TrashRetention()
+        result := make([]trashedDomain, 0, len(domains))
+        for _, d := range domains {
+            result = append(result, trashedDomain{Domain: d, PurgeAt: d.DeletedAt.Add(retention)})
+        }
+
+        json.NewEncoder(w).Encode(result)
+    }
+}
+
+// trashedDomainForManage находит домен в корзине и проверяет право управлять им
+func trashedDomainForManage(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session) *models.Domain {
+    userID := session.Values["user_id"].(int64)
+    userRole := session.Values["role"].(string)
+
+    vars := mux.Vars(r)
+    id, err := strconv.ParseInt(vars["id"], 10, 64)
+    if err != nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Некорректный ID домена",
+        })
+        return nil
+    }
+
+    ok, err := models.CanManageTrashedDomain(db, userID, userRole, id, models.PermManage)
+    if err != nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Ошибка проверки доступа: " + err.Error(),
+        })
+        return nil
+    }
+    if !ok {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Домен не найден в корзине",
+        })
+        return nil
+    }
+
+    domain, err := models.GetTrashedDomainByID(db, id)
+    if err != nil || domain == nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Домен не найден в корзине",
+        })
+        return nil
+    }
+    return domain
+}
+
+func RestoreDomainHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain := trashedDomainForManage(db, w, r, session)
+        if domain == nil {
+            return
+        }
+
+        restored, err := models.RestoreDomain(db, domain.ID)
+        if err != nil || !restored {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Не удалось восстановить домен",
+            })
+            return
+        }
+
+        // Новый серийный номер, чтобы вторичные серверы забрали зону заново
+        models.IncrementDomainSerial(db, domain.ID)
+
+        message := "Домен восстановлен"
+        // Вторичную зону сервер заново получит с первичного
+        services.RebuildZonesConf(db)
+        if err := services.PublishZone(db, domain.ID); err != nil {
+            message += ", но зона не создана: " + err.Error()
+        } else if !services.ReloadServer() {
+            message += ", но DNS сервер не перезагружен (подробности в логе)"
+        } else {
+            services.NotifySecondaries(db, domain.ID)
+        }
+
+        logAction(db, session, r, "restore_domain", "Домен восстановлен из корзины: "+domain.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": message,
+        })
+    }
+}
+
+func PurgeDomainHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain := trashedDomainForManage(db, w, r, session)
+        if domain == nil {
+            return
+        }
+
+        if err := models.DeleteDomain(db, domain.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления домена: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "purge_domain", "Домен удалён из корзины: "+domain.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": "Домен удалён безвозвратно",
+        })
+    }
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// tsigKeyForAdmin возвращает ключ из URL
+func tsigKeyForAdmin(db *models.DB, r *http.Request) (*models.TSIGKey, string) {
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        return nil, "Некорректный ID ключа"
+    }
+    key, err := models.GetTSIGKeyByID(db, id)
+    if err != nil || key == nil {
+        return nil, "Ключ не найден"
+    }
+    return key, ""
+}
+
+// newTSIGSecret создаёт и шифрует секрет. Возвращает секрет в base64 для
+// передачи администратору вторичного сервера и зашифрованное значение для БД.
+func newTSIGSecret(algorithm string) (string, string, error) {
+    secret, err := services.GenerateTSIGSecret(algorithm)
+    if err != nil {
+        return "", "", err
+    }
+    encrypted, err := services.EncryptSecret(secret)
+    if err != nil {
+        return "", "", err
+    }
+    return base64.StdEncoding.EncodeToString(secret), encrypted, nil
+}
+
+func GetTSIGKeysHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        keys, err := models.GetTSIGKeys(db)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(keys)
+    }
+}
+
+// CreateTSIGKeyHandler создаёт ключ со случайным секретом. Секрет
+// возвращается только в этом ответе и при ротации.
+func CreateTSIGKeyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        var data struct {
+            Name      string `json:"name"`
+            Algorithm string `json:"algorithm"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка чтения данных: " + err.Error(),
+            })
+            return
+        }
+
+        key := &models.TSIGKey{
+            Name:      strings.ToLower(strings.TrimSuffix(strings.TrimSpace(data.Name), ".")),
+            Algorithm: data.Algorithm,
+        }
+        if key.Algorithm == "" {
+            key.Algorithm = "hmac-sha256"
+        }
+        if !services.ValidateTSIGKeyName(key.Name) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Некорректное имя TSIG ключа",
+            })
+            return
+        }
+        if existing, _ := models.GetTSIGKeyByName(db, key.Name); existing != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ключ с таким именем уже существует",
+            })
+            return
+        }
+
+        secret, encrypted, err := newTSIGSecret(key.Algorithm)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if err := models.CreateTSIGKey(db, key, encrypted); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения ключа: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "create_tsig_key", "Создан TSIG ключ "+key.Name+" ("+key.Algorithm+")")
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":   true,
+            "id":        key.ID,
+            "name":      key.Name,
+            "algorithm": key.Algorithm,
+            "secret":    secret,
+            "message":   applyZonesConf(db, "Ключ создан. Сохраните секрет: он больше не будет показан"),
+        })
+    }
+}
+
+// RotateTSIGKeyHandler заменяет секрет ключа. Вторичные серверы перестанут
+// принимать NOTIFY и получать зоны, пока на них не установлен новый секрет.
+func RotateTSIGKeyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        key, msg := tsigKeyForAdmin(db, r)
+        if key == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        secret, encrypted, err := newTSIGSecret(key.Algorithm)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": err.Error(),
+            })
+            return
+        }
+
+        if err := models.RotateTSIGKey(db, key.ID, encrypted); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения ключа: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "rotate_tsig_key", "Заменён секрет TSIG ключа "+key.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "name":    key.Name,
+            "secret":  secret,
+            "message": applyZonesConf(db, "Секрет заменён. Установите его на вторичных серверах"),
+        })
+    }
+}
+
+// DeleteTSIGKeyHandler удаляет ключ, если на него не ссылается ни одна зона
+func DeleteTSIGKeyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        key, msg := tsigKeyForAdmin(db, r)
+        if key == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        usage, err := models.TSIGKeyUsage(db, key.Name)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка проверки использования ключа: " + err.Error(),
+            })
+            return
+        }
+        if len(usage) > 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "used_by": usage,
+                "message": "Ключ используется: " + strings.Join(usage, ", "),
+            })
+            return
+        }
+
+        if err := models.DeleteTSIGKey(db, key.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления ключа: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_tsig_key", "Удалён TSIG ключ "+key.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": applyZonesConf(db, "Ключ удалён"),
+        })
+    }
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
     "encoding/json"
+    "fmt"
     "net/http"
     "strconv"
+    "strings"
 
     "dns-manager/models"
     "dns-manager/services"
@@ -18,7 +20,7 @@ func GetUsersHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFun
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapViewUsers) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -38,7 +40,7 @@ func CreateUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerF
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapManageUsers) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -82,6 +84,17 @@ func CreateUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerF
             return
         }
 
+        if data.Role == "" {
+            data.Role = string(models.RoleUser)
+        }
+        if !models.ValidRole(data.Role) {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Неизвестная роль: " + data.Role,
+            })
+            return
+        }
+
         existing, _ := models.GetUserByUsername(db, data.Username)
         if existing != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
@@ -113,10 +126,8 @@ func CreateUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerF
             return
         }
 
-        adminID := session.Values["user_id"].(int64)
-        adminName := session.Values["username"].(string)
-        services.LogUserAction(db, adminID, adminName, "create_user",
-            "Создан пользователь: "+data.Username, r.RemoteAddr)
+        logAction(db, session, r, "create_user",
+            "Создан пользователь: "+data.Username)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
             "success": true,
@@ -130,7 +141,7 @@ func UpdateUserStatusHandler(db *models.DB, store *sessions.CookieStore) http.Ha
         w.Header().Set("Content-Type", "application/json")
         
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapManageUsers) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
@@ -174,10 +185,8 @@ func UpdateUserStatusHandler(db *models.DB, store *sessions.CookieStore) http.Ha
             status = "деактивирован"
         }
 
-        adminID := session.Values["user_id"].(int64)
-        adminName := session.Values["username"].(string)
-        services.LogUserAction(db, adminID, adminName, "update_user",
-            "Пользователь "+strconv.FormatInt(userID, 10)+" "+status, r.RemoteAddr)
+        logAction(db, session, r, "update_user",
+            "Пользователь "+strconv.FormatInt(userID, 10)+" "+status)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
             "success": true,
@@ -186,36 +195,148 @@ func UpdateUserStatusHandler(db *models.DB, store *sessions.CookieStore) http.Ha
     }
 }
 
-func DeleteUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+// userForDeletion разбирает ID из пути и проверяет, что пользователя можно удалить
+func userForDeletion(db *models.DB, w http.ResponseWriter, r *http.Request, session *sessions.Session) *models.User {
+    vars := mux.Vars(r)
+    userID, err := strconv.ParseInt(vars["id"], 10, 64)
+    if err != nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Некорректный ID пользователя",
+        })
+        return nil
+    }
+
+    currentUserID := session.Values["user_id"].(int64)
+    if currentUserID == userID {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Нельзя удалить свою учетную запись",
+        })
+        return nil
+    }
+
+    user, err := models.GetUserByID(db, userID)
+    if err != nil || user == nil {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Пользователь не найден",
+        })
+        return nil
+    }
+    return user
+}
+
+// UserDeletionPreviewHandler показывает, какие домены и связи затронет удаление
+func UserDeletionPreviewHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
-        
+
         session, _ := store.Get(r, "session")
-        if session.Values["role"] != "admin" {
+        if !sessionCan(session, models.CapManageUsers) {
             http.Error(w, "Forbidden", http.StatusForbidden)
             return
         }
 
-        vars := mux.Vars(r)
-        userID, err := strconv.ParseInt(vars["id"], 10, 64)
+        user := userForDeletion(db, w, r, session)
+        if user == nil {
+            return
+        }
+
+        impact, err := models.GetUserDeletionImpact(db, user.ID)
         if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Некорректный ID пользователя",
+                "message": "Ошибка подготовки удаления: " + err.Error(),
             })
             return
         }
 
-        currentUserID := session.Values["user_id"].(int64)
-        if currentUserID == userID {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":  true,
+            "username": user.Username,
+            "impact":   impact,
+        })
+    }
+}
+
+// DeleteUserHandler удаляет пользователя. Если у него есть личные домены,
+// администратор выбирает: передать их другому пользователю (domains = "reassign")
+// или удалить вместе с файлами зон (domains = "delete").
+func DeleteUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageUsers) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        user := userForDeletion(db, w, r, session)
+        if user == nil {
+            return
+        }
+
+        var data struct {
+            Domains    string `json:"domains"` // reassign или delete
+            ReassignTo int64  `json:"reassign_to"`
+        }
+        if r.ContentLength != 0 {
+            if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": "Ошибка чтения данных: " + err.Error(),
+                })
+                return
+            }
+        }
+
+        impact, err := models.GetUserDeletionImpact(db, user.ID)
+        if err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
-                "message": "Нельзя удалить свою учетную запись",
+                "message": "Ошибка подготовки удаления: " + err.Error(),
             })
             return
         }
 
-        if err := models.DeleteUser(db, userID); err != nil {
+        var reassignTo *models.User
+        if len(impact.Domains) > 0 {
+            switch data.Domains {
+            case "reassign":
+                reassignTo, _ = models.GetUserByID(db, data.ReassignTo)
+                if msg := transferRecipient(reassignTo); msg != "" {
+                    json.NewEncoder(w).Encode(map[string]interface{}{
+                        "success": false,
+                        "message": msg,
+                    })
+                    return
+                }
+                if reassignTo.ID == user.ID {
+                    json.NewEncoder(w).Encode(map[string]interface{}{
+                        "success": false,
+                        "message": "Нельзя передать домены удаляемому пользователю",
+                    })
+                    return
+                }
+            case "delete":
+            default:
+                json.NewEncoder(w).Encode(map[string]interface{}{
+                    "success": false,
+                    "message": fmt.Sprintf("У пользователя %d доменов: укажите, передать их другому пользователю или удалить",
+                        len(impact.Domains)),
+                    "impact": impact,
+                })
+                return
+            }
+        }
+
+        var reassignID int64
+        if reassignTo != nil {
+            reassignID = reassignTo.ID
+        }
+        if err := models.DeleteUser(db, user.ID, reassignID); err != nil {
             json.NewEncoder(w).Encode(map[string]interface{}{
                 "success": false,
                 "message": "Ошибка удаления пользователя: " + err.Error(),
@@ -223,13 +344,47 @@ func DeleteUserHandler(db *models.DB, store *sessions.CookieStore) http.HandlerF
             return
         }
 
-        adminName := session.Values["username"].(string)
-        services.LogUserAction(db, currentUserID, adminName, "delete_user",
-            "Удален пользователь ID: "+strconv.FormatInt(userID, 10), r.RemoteAddr)
+        names := make([]string, 0, len(impact.Domains))
+        for _, d := range impact.Domains {
+            names = append(names, d.Name)
+        }
+
+        details := "Удален пользователь " + user.Username + " (ID: " + strconv.FormatInt(user.ID, 10) + ")"
+        switch {
+        case len(names) == 0:
+        case reassignTo != nil:
+            services.RebuildZonesConf(db)
+            details += ". Домены переданы " + reassignTo.Username + ": " + strings.Join(names, ", ")
+        default:
+            // Домены из корзины уже сняты с обслуживания, удаляем только активные зоны
+            for _, d := range impact.Domains {
+                if d.DeletedAt == nil {
+                    services.UnpublishZone(d.Name)
+                }
+            }
+            services.RebuildZonesConf(db)
+            services.ReloadServer()
+            details += fmt.Sprintf(". Удалены домены (%d записей): %s", impact.RecordCount, strings.Join(names, ", "))
+        }
+        if len(impact.OrgDomains) > 0 {
+            orgDomains := make([]string, 0, len(impact.OrgDomains))
+            for _, d := range impact.OrgDomains {
+                owner := d.OwnerName
+                if reassignTo != nil {
+                    owner = reassignTo.Username
+                }
+                if owner == "" {
+                    owner = "нет участников организации"
+                }
+                orgDomains = append(orgDomains, d.Name+" → "+owner)
+            }
+            details += ". Домены организаций записаны на: " + strings.Join(orgDomains, ", ")
+        }
+        logAction(db, session, r, "delete_user", details)
 
         json.NewEncoder(w).Encode(map[string]interface{}{
             "success": true,
             "message": "Пользователь успешно удален",
         })
     }
-}
\ No newline at end of file
+}
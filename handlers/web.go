@@ -5,6 +5,7 @@ import (
     "net/http"
 
     "dns-manager/models"
+    "dns-manager/services"
 
     "github.com/gorilla/sessions"
     "github.com/spf13/viper"
@@ -17,6 +18,7 @@ func IndexHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
         username, _ := session.Values["username"].(string)
         userRole, _ := session.Values["role"].(string)
         userID, _ := session.Values["user_id"].(int64)
+        _, impersonatorName, _ := impersonator(session)
 
         // Парсим ВСЕ необходимые шаблоны
         tmpl, err := template.ParseFiles(
@@ -30,12 +32,19 @@ func IndexHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
         }
 
         var domains []models.Domain
+        var quota *models.QuotaUsage
         if isLoggedIn {
-            if userRole == "admin" {
+            if models.RoleCan(userRole, models.CapReadAllDomains) {
                 domains, err = models.GetAllDomains(db)
             } else {
                 domains, err = models.GetDomainsByUserID(db, userID)
             }
+            if err == nil {
+                err = services.SetRecordLimits(db, domains)
+            }
+            if err == nil {
+                quota, err = services.GetQuotaUsage(db, userID, userRole)
+            }
             if err != nil {
                 http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
                 return
@@ -47,7 +56,10 @@ func IndexHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
             IsLoggedIn         bool
             Username           string
             UserRole           string
+            Capabilities       map[string]bool
+            Impersonator       string
             Domains            []models.Domain
+            Quota              *models.QuotaUsage
             ServerIP           string
             AllowUsersCreateNS bool
             AllowUsersCreateA  bool
@@ -56,7 +68,10 @@ func IndexHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
             IsLoggedIn:         isLoggedIn,
             Username:           username,
             UserRole:           userRole,
+            Capabilities:       capabilitySet(userRole),
+            Impersonator:       impersonatorName,
             Domains:            domains,
+            Quota:              quota,
             ServerIP:           viper.GetString("server_ip"),
             AllowUsersCreateNS: viper.GetBool("security.allow_users_create_ns"),
             AllowUsersCreateA:  viper.GetBool("security.allow_users_create_a"),
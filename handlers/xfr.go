@@ -0,0 +1,335 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "dns-manager/models"
+    "dns-manager/services"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/sessions"
+)
+
+// xfrTargetInput читает и проверяет вторичный сервер из тела запроса.
+// provide_xfr и notify по умолчанию включены.
+func xfrTargetInput(db *models.DB, r *http.Request, domainID int64) (*models.XFRTarget, string) {
+    var data struct {
+        Address    string `json:"address"`
+        TSIGKey    string `json:"tsig_key"`
+        ProvideXFR *bool  `json:"provide_xfr"`
+        Notify     *bool  `json:"notify"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+        return nil, "Ошибка чтения данных: " + err.Error()
+    }
+
+    address, err := services.ParseXFRAddress(data.Address)
+    if err != nil {
+        return nil, err.Error()
+    }
+    if err := services.CheckTSIGKeyName(db, data.TSIGKey); err != nil {
+        return nil, err.Error()
+    }
+
+    target := &models.XFRTarget{
+        DomainID:   domainID,
+        Address:    address,
+        TSIGKey:    data.TSIGKey,
+        ProvideXFR: data.ProvideXFR == nil || *data.ProvideXFR,
+        Notify:     data.Notify == nil || *data.Notify,
+    }
+    if !target.ProvideXFR && !target.Notify {
+        return nil, "Включите передачу зоны или NOTIFY"
+    }
+    return target, ""
+}
+
+// GetXFRTargetsHandler возвращает вторичные серверы домена вместе с глобальными
+func GetXFRTargetsHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := requestDomain(db, session, r, models.PermRead)
+        if domain == nil {
+            http.Error(w, msg, http.StatusForbidden)
+            return
+        }
+
+        targets, err := models.GetEffectiveXFRTargets(db, domain.ID)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(targets)
+    }
+}
+
+// CreateXFRTargetHandler добавляет вторичный сервер домена
+func CreateXFRTargetHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := requestDomain(db, session, r, models.PermManage)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+        if domain.IsSecondary() {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Передачу вторичной зоны настраивает первичный сервер",
+            })
+            return
+        }
+
+        target, msg := xfrTargetInput(db, r, domain.ID)
+        if target == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.CreateXFRTarget(db, target); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "add_xfr_target", "Добавлен вторичный сервер "+target.Address+" для домена "+domain.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      target.ID,
+            "message": applyZonesConf(db, "Вторичный сервер добавлен"),
+        })
+    }
+}
+
+// DeleteXFRTargetHandler удаляет вторичный сервер домена
+func DeleteXFRTargetHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := requestDomain(db, session, r, models.PermManage)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        targetID, _ := strconv.ParseInt(mux.Vars(r)["target_id"], 10, 64)
+        target, err := models.GetXFRTargetByID(db, targetID)
+        if err != nil || target == nil || target.DomainID != domain.ID {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Сервер не найден",
+            })
+            return
+        }
+
+        if err := models.DeleteXFRTarget(db, target.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_xfr_target", "Удалён вторичный сервер "+target.Address+" домена "+domain.Name)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": applyZonesConf(db, "Вторичный сервер удалён"),
+        })
+    }
+}
+
+// GetGlobalXFRTargetsHandler возвращает вторичные серверы всех первичных зон
+func GetGlobalXFRTargetsHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapViewSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        targets, err := models.GetXFRTargets(db, 0)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(targets)
+    }
+}
+
+// CreateGlobalXFRTargetHandler добавляет вторичный сервер для всех первичных зон
+func CreateGlobalXFRTargetHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        target, msg := xfrTargetInput(db, r, 0)
+        if target == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        if err := models.CreateXFRTarget(db, target); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка сохранения: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "add_xfr_target", "Добавлен глобальный вторичный сервер "+target.Address)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "id":      target.ID,
+            "message": applyZonesConf(db, "Вторичный сервер добавлен"),
+        })
+    }
+}
+
+// DeleteGlobalXFRTargetHandler удаляет глобальный вторичный сервер
+func DeleteGlobalXFRTargetHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        if !sessionCan(session, models.CapManageSettings) {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+
+        id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+        target, err := models.GetXFRTargetByID(db, id)
+        if err != nil || target == nil || target.DomainID != 0 {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Сервер не найден",
+            })
+            return
+        }
+
+        if err := models.DeleteXFRTarget(db, target.ID); err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка удаления: " + err.Error(),
+            })
+            return
+        }
+
+        logAction(db, session, r, "delete_xfr_target", "Удалён глобальный вторичный сервер "+target.Address)
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": applyZonesConf(db, "Вторичный сервер удалён"),
+        })
+    }
+}
+
+// GetNotifyStatusHandler возвращает итоги последних NOTIFY и serial,
+// который вернул каждый вторичный сервер
+func GetNotifyStatusHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := requestDomain(db, session, r, models.PermRead)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        results, err := models.GetNotifyResults(db, domain.ID)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка получения статуса: " + err.Error(),
+            })
+            return
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "serial":  domain.Serial,
+            "results": results,
+        })
+    }
+}
+
+// SendNotifyHandler отправляет NOTIFY сразу и ждёт ответа серверов
+func SendNotifyHandler(db *models.DB, store *sessions.CookieStore) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+
+        session, _ := store.Get(r, "session")
+        domain, msg := requestDomain(db, session, r, models.PermWrite)
+        if domain == nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": msg,
+            })
+            return
+        }
+
+        reports, err := services.NotifyDomain(db, domain.ID, 0)
+        if err != nil {
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success": false,
+                "message": "Ошибка отправки NOTIFY: " + err.Error(),
+            })
+            return
+        }
+
+        failed := 0
+        for _, report := range reports {
+            if !report.Success {
+                failed++
+            }
+        }
+        message := "NOTIFY отправлен"
+        switch {
+        case len(reports) == 0:
+            message = "Для домена не настроены серверы для NOTIFY"
+        case failed > 0:
+            message = "NOTIFY не принят частью серверов: " + strconv.Itoa(failed) + " из " + strconv.Itoa(len(reports))
+        }
+
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": failed == 0,
+            "serial":  domain.Serial,
+            "reports": reports,
+            "message": message,
+        })
+    }
+}
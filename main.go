@@ -7,6 +7,7 @@ import (
     "os"
     "time"
 
+    "dns-manager/agent"
     "dns-manager/handlers"
     "dns-manager/middleware"
     "dns-manager/models"
@@ -22,6 +23,12 @@ var store *sessions.CookieStore
 const Version = "1.2.0" // или ваша версия
 
 func main() {
+    // dns-manager agent — режим агента на удалённом DNS сервере
+    if len(os.Args) > 1 && os.Args[1] == "agent" {
+        runAgent(os.Args[2:])
+        return
+    }
+
     // Создаём директорию логов ДО настройки логгера
     if err := os.MkdirAll("logs", 0755); err != nil {
         log.Fatal("Cannot create logs directory:", err)
@@ -56,6 +63,17 @@ func main() {
         log.Println("Generated new session secret key")
     }
 
+    // Ключ шифрования секретов в БД (TSIG). При потере ключа секреты не восстановить.
+    if viper.GetString("security.encryption_key") == "" {
+        key, err := services.GenerateEncryptionKey()
+        if err != nil {
+            log.Fatal("Failed to generate encryption key:", err)
+        }
+        viper.Set("security.encryption_key", key)
+        viper.WriteConfig()
+        log.Println("Generated new encryption key")
+    }
+
     store = sessions.NewCookieStore([]byte(secretKey))
     store.Options = &sessions.Options{
         Path:     "/",
@@ -77,8 +95,27 @@ func main() {
         viper.GetString("nsd.zone_dir"),
         viper.GetString("nsd.zones_conf"),
     )
+    if err := services.InitBackend(viper.GetString("dns.backend")); err != nil {
+        log.Fatal("Failed to initialize DNS backend:", err)
+    }
+    if err := services.InitMirrors(viper.GetStringSlice("dns.mirrors")); err != nil {
+        log.Fatal("Failed to initialize DNS mirrors:", err)
+    }
 
     createDirectories()
+    services.StartDistributor(db, time.Duration(viper.GetInt("distribution.interval"))*time.Second)
+    services.RebuildZonesConf(db)
+    if n, err := services.MigrateLegacyTXT(db); err != nil {
+        log.Printf("Legacy TXT conversion failed: %v", err)
+    } else if n > 0 {
+        log.Printf("Converted %d legacy TXT records to quoted strings", n)
+    }
+    if err := services.StartEmbeddedServers(db); err != nil {
+        log.Fatal("Failed to start embedded DNS server:", err)
+    }
+
+    services.StartScheduler(db, time.Duration(viper.GetInt("scheduler.interval"))*time.Second)
+    services.StartTrashPurger(db, time.Duration(viper.GetInt("trash.purge_interval"))*time.Second)
 
     // Тестовая запись в лог
     log.Println("Logger initialized successfully")
@@ -92,6 +129,9 @@ func main() {
     router.HandleFunc("/api/login", handlers.LoginHandler(db, store)).Methods("POST")
     router.HandleFunc("/api/logout", handlers.LogoutHandler(store)).Methods("POST")
 
+    // API агентов удалённых DNS серверов: вход по токену сервера, без сессии
+    agentRoutes(router.PathPrefix(agent.APIPrefix).Subrouter(), db)
+
     api := router.PathPrefix("/api").Subrouter()
     api.Use(middleware.AuthMiddleware(store))
 
@@ -99,12 +139,54 @@ func main() {
     api.HandleFunc("/domains", handlers.CreateDomainHandler(db, store)).Methods("POST")
     api.HandleFunc("/domains/{id}", handlers.DeleteDomainHandler(db, store)).Methods("DELETE")
     api.HandleFunc("/domains/{id}/records", handlers.GetRecordsHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/secondary", handlers.UpdateSecondaryHandler(db, store)).Methods("PUT")
+    api.HandleFunc("/domains/{id}/xfr-status", handlers.ZoneTransferStatusHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/xfr-targets", handlers.GetXFRTargetsHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/xfr-targets", handlers.CreateXFRTargetHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/xfr-targets/{target_id}", handlers.DeleteXFRTargetHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/domains/{id}/notify", handlers.GetNotifyStatusHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/notify", handlers.SendNotifyHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/import", handlers.ImportZoneHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/template", handlers.ApplyTemplateHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/mail/spf", handlers.SPFHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/mail/dkim", handlers.DKIMHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/mail/dmarc", handlers.DMARCHandler(db, store)).Methods("POST")
+    api.HandleFunc("/templates", handlers.GetTemplatesHandler(db, store)).Methods("GET")
+    api.HandleFunc("/templates", handlers.CreateTemplateHandler(db, store)).Methods("POST")
+    api.HandleFunc("/templates/{id}", handlers.DeleteTemplateHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/reverse-zones", handlers.CreateReverseZoneHandler(db, store)).Methods("POST")
+    api.HandleFunc("/trash", handlers.GetTrashHandler(db, store)).Methods("GET")
+    api.HandleFunc("/trash/{id}/restore", handlers.RestoreDomainHandler(db, store)).Methods("POST")
+    api.HandleFunc("/trash/{id}", handlers.PurgeDomainHandler(db, store)).Methods("DELETE")
     api.HandleFunc("/records", handlers.CreateRecordHandler(db, store)).Methods("POST")
     api.HandleFunc("/records/{id}", handlers.UpdateRecordHandler(db, store)).Methods("PUT")
     api.HandleFunc("/records/{id}", handlers.DeleteRecordHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/orgs", handlers.GetOrganizationsHandler(db, store)).Methods("GET")
+    api.HandleFunc("/orgs", handlers.CreateOrganizationHandler(db, store)).Methods("POST")
+    api.HandleFunc("/orgs/{id}", handlers.DeleteOrganizationHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/orgs/{id}/members", handlers.GetOrgMembersHandler(db, store)).Methods("GET")
+    api.HandleFunc("/orgs/{id}/members", handlers.AddOrgMemberHandler(db, store)).Methods("POST")
+    api.HandleFunc("/orgs/{id}/members/{user_id}", handlers.RemoveOrgMemberHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/domains/{id}/members", handlers.GetDomainMembersHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/members", handlers.AddDomainMemberHandler(db, store)).Methods("POST")
+    api.HandleFunc("/domains/{id}/members/{user_id}", handlers.RemoveDomainMemberHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/domains/{id}/protection", handlers.GetProtectionRulesHandler(db, store)).Methods("GET")
+    api.HandleFunc("/domains/{id}/transfer", handlers.OfferDomainTransferHandler(db, store)).Methods("POST")
+    api.HandleFunc("/transfers", handlers.GetDomainTransfersHandler(db, store)).Methods("GET")
+    api.HandleFunc("/transfers/{id}/accept", handlers.AcceptDomainTransferHandler(db, store)).Methods("POST")
+    api.HandleFunc("/transfers/{id}/decline", handlers.DeclineDomainTransferHandler(db, store)).Methods("POST")
+    api.HandleFunc("/transfers/{id}", handlers.CancelDomainTransferHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/changes", handlers.GetPendingChangesHandler(db, store)).Methods("GET")
+    api.HandleFunc("/changes/{id}/approve", handlers.ApproveChangeHandler(db, store)).Methods("POST")
+    api.HandleFunc("/changes/{id}/reject", handlers.RejectChangeHandler(db, store)).Methods("POST")
+    api.HandleFunc("/scheduled", handlers.GetScheduledChangesHandler(db, store)).Methods("GET")
+    api.HandleFunc("/scheduled", handlers.CreateScheduledChangeHandler(db, store)).Methods("POST")
+    api.HandleFunc("/scheduled/{id}", handlers.CancelScheduledChangeHandler(db, store)).Methods("DELETE")
+    api.HandleFunc("/quota", handlers.GetMyQuotaHandler(db, store)).Methods("GET")
     api.HandleFunc("/nsd/sync/{domain_id}", handlers.SyncNSDHandler(db, store)).Methods("POST")
-    api.HandleFunc("/nsd/status", handlers.NSDStatusHandler()).Methods("GET")
+    api.HandleFunc("/nsd/status", handlers.NSDStatusHandler(db)).Methods("GET")
     api.HandleFunc("/user/change-password", handlers.ChangePasswordHandler(db, store)).Methods("POST")
+    api.HandleFunc("/impersonate/stop", handlers.StopImpersonationHandler(db, store)).Methods("POST")
 
     admin := api.PathPrefix("/admin").Subrouter()
     admin.Use(middleware.AdminMiddleware(store))
@@ -112,10 +194,37 @@ func main() {
     admin.HandleFunc("/users", handlers.CreateUserHandler(db, store)).Methods("POST")
     admin.HandleFunc("/users/{id}/status", handlers.UpdateUserStatusHandler(db, store)).Methods("PUT")
     admin.HandleFunc("/users/{id}", handlers.DeleteUserHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/users/{id}/deletion-preview", handlers.UserDeletionPreviewHandler(db, store)).Methods("GET")
     admin.HandleFunc("/users/{id}/activity", handlers.GetUserActivityHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/users/{id}/impersonate", handlers.StartImpersonationHandler(db, store)).Methods("POST")
     admin.HandleFunc("/settings", handlers.GetSettingsHandler(store)).Methods("GET")
     admin.HandleFunc("/settings", handlers.UpdateSettingsHandler(store)).Methods("POST")
     admin.HandleFunc("/logs", handlers.GetLogsHandler(store)).Methods("GET")
+    admin.HandleFunc("/policies", handlers.GetRecordPoliciesHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/policies", handlers.CreateRecordPolicyHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/policies/{id}", handlers.DeleteRecordPolicyHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/quotas", handlers.GetQuotasHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/quotas", handlers.SetQuotaHandler(db, store)).Methods("PUT")
+    admin.HandleFunc("/quotas", handlers.DeleteQuotaHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/xfr-targets", handlers.GetGlobalXFRTargetsHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/xfr-targets", handlers.CreateGlobalXFRTargetHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/xfr-targets/{id}", handlers.DeleteGlobalXFRTargetHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/tsig-keys", handlers.GetTSIGKeysHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/tsig-keys", handlers.CreateTSIGKeyHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/tsig-keys/{id}/rotate", handlers.RotateTSIGKeyHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/tsig-keys/{id}", handlers.DeleteTSIGKeyHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/catalog", handlers.GetCatalogHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/dns-servers", handlers.GetDNSServersHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/dns-servers", handlers.CreateDNSServerHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/dns-servers/{id}", handlers.UpdateDNSServerHandler(db, store)).Methods("PUT")
+    admin.HandleFunc("/dns-servers/{id}", handlers.DeleteDNSServerHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/dns-servers/{id}/sync", handlers.GetDNSServerSyncHandler(db, store)).Methods("GET")
+    admin.HandleFunc("/dns-servers/{id}/sync", handlers.SyncDNSServerHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/domains/{id}/owner", handlers.ReassignDomainOwnerHandler(db, store)).Methods("PUT")
+    admin.HandleFunc("/domains/{id}/protection", handlers.CreateProtectionRuleHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/domains/{id}/protection/{rule_id}", handlers.DeleteProtectionRuleHandler(db, store)).Methods("DELETE")
+    admin.HandleFunc("/domains/{id}/approvers", handlers.AddDomainApproverHandler(db, store)).Methods("POST")
+    admin.HandleFunc("/domains/{id}/approvers/{user_id}", handlers.RemoveDomainApproverHandler(db, store)).Methods("DELETE")
     // НОВЫЙ МАРШРУТ ДЛЯ ФАЙЛОВ ЗОН
     admin.HandleFunc("/zonefiles", handlers.GetZoneFilesHandler(store)).Methods("GET")
 
@@ -139,6 +248,10 @@ func main() {
         ReadTimeout:  15 * time.Second,
     }
 
+    if addr := viper.GetString("agent_api.listen"); addr != "" {
+        go serveAgentAPI(addr, db)
+    }
+
     log.Printf("Server v%s starting on port %s", Version, port)
     log.Fatal(srv.ListenAndServe())
 }
@@ -158,6 +271,36 @@ func initConfig() error {
     viper.SetDefault("nsd.zone_dir", "./zones/")
     viper.SetDefault("nsd.zones_conf", "./zones.conf")
     viper.SetDefault("nsd.enabled", true)
+    viper.SetDefault("nsd.control", "nsd-control")
+    viper.SetDefault("nsd.checkconf", "nsd-checkconf")
+    viper.SetDefault("nsd.conf", "/etc/nsd/nsd.conf")
+    viper.SetDefault("dns.backend", "nsd")
+    viper.SetDefault("knot.control", "knotc")
+    viper.SetDefault("bind.rndc", "rndc")
+    viper.SetDefault("bind.checkconf", "named-checkconf")
+    viper.SetDefault("dns.mirrors", []string{})
+    viper.SetDefault("powerdns.url", "http://127.0.0.1:8081")
+    viper.SetDefault("powerdns.api_key", "")
+    viper.SetDefault("powerdns.server_id", "localhost")
+    viper.SetDefault("powerdns.zone_kind", "Native")
+    viper.SetDefault("powerdns.timeout", 10)
+    viper.SetDefault("embedded.listen", "127.0.0.1:5353")
+    viper.SetDefault("embedded.axfr_allow", []string{})
+    viper.SetDefault("distribution.interval", 5)
+    viper.SetDefault("distribution.check_interval", 60)
+    viper.SetDefault("distribution.retry_base", 10)
+    viper.SetDefault("distribution.retry_max", 3600)
+    viper.SetDefault("distribution.timeout", 15)
+    viper.SetDefault("distribution.ssh_key", "")
+    viper.SetDefault("distribution.zone_dir", "/etc/nsd/zones")
+    viper.SetDefault("distribution.conf_path", "/etc/nsd/zones.conf")
+    viper.SetDefault("distribution.reload_command", "nsd-control reconfig && nsd-control reload")
+    viper.SetDefault("distribution.status_command", "nsd-control status")
+    viper.SetDefault("distribution.agent_timeout", 300)
+    viper.SetDefault("agent_api.listen", "")
+    viper.SetDefault("agent_api.cert", "")
+    viper.SetDefault("agent_api.key", "")
+    viper.SetDefault("agent_api.client_ca", "")
     viper.SetDefault("default_ttl", 3600)
     viper.SetDefault("server_ip", "127.0.0.1")
     viper.SetDefault("logging.level", "info")
@@ -167,6 +310,18 @@ func initConfig() error {
     viper.SetDefault("logging.max_age", 30)
     viper.SetDefault("security.allow_users_create_ns", true)
     viper.SetDefault("security.allow_users_create_a", true)
+    viper.SetDefault("scheduler.interval", 30)
+    viper.SetDefault("trash.retention_days", 30)
+    viper.SetDefault("trash.purge_interval", 3600)
+    viper.SetDefault("quotas.max_domains", 0)
+    viper.SetDefault("quotas.max_records_per_domain", 0)
+    viper.SetDefault("quotas.max_total_records", 0)
+    viper.SetDefault("notify.timeout", 3)
+    viper.SetDefault("notify.retries", 3)
+    viper.SetDefault("notify.serial_check_delay", 10)
+    viper.SetDefault("catalog.enabled", false)
+    viper.SetDefault("catalog.zone", "catalog.invalid")
+    viper.SetDefault("catalog.group_attribute", "")
 
     if err := viper.ReadInConfig(); err != nil {
         if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -199,6 +354,64 @@ nsd:
   zone_dir: "./zones/"
   zones_conf: "./zones.conf"
   enabled: true
+  control: "nsd-control"
+  checkconf: "nsd-checkconf"
+  conf: "/etc/nsd/nsd.conf"
+
+# DNS сервер: nsd, knot, bind, powerdns или embedded. Каталог зон и zones.conf берутся из раздела nsd.
+# В mirrors перечисляются серверы, которые получают зоны вместе с основным
+dns:
+  backend: "nsd"
+  mirrors: []
+
+# Knot DNS должен работать с базой конфигурации (knotc conf-*)
+knot:
+  control: "knotc"
+
+# Для BIND в named.conf нужен allow-new-zones yes
+bind:
+  rndc: "rndc"
+  checkconf: "named-checkconf"
+
+# PowerDNS получает записи через HTTP API (webserver=yes, api=yes в pdns.conf)
+powerdns:
+  url: "http://127.0.0.1:8081"
+  api_key: ""
+  server_id: "localhost"
+  zone_kind: "Native"
+  timeout: 10
+
+# Встроенный авторитативный сервер для проверки и небольших установок
+# (dns.backend: embedded или embedded в dns.mirrors). Отвечает только на
+# первичные зоны. AXFR разрешён адресам из axfr_allow и серверам provide-xfr
+# зоны, TSIG подписи не проверяются.
+embedded:
+  listen: "127.0.0.1:5353"
+  axfr_allow: []
+
+# Копирование зон на удалённые NSD серверы (серверы добавляются в админке).
+# Неудачные попытки повторяются с задержкой от retry_base до retry_max секунд
+distribution:
+  interval: 5
+  check_interval: 60
+  retry_base: 10
+  retry_max: 3600
+  timeout: 15
+  ssh_key: ""
+  zone_dir: "/etc/nsd/zones"
+  conf_path: "/etc/nsd/zones.conf"
+  reload_command: "nsd-control reconfig && nsd-control reload"
+  status_command: "nsd-control status"
+  # Агент в режиме pull считается недоступным, если не отчитывался столько секунд
+  agent_timeout: 300
+
+# Отдельный порт для агентов с проверкой клиентских сертификатов (mTLS).
+# CN сертификата агента должен совпадать с именем сервера в панели
+agent_api:
+  listen: ""
+  cert: ""
+  key: ""
+  client_ca: ""
 
 default_ttl: 3600
 server_ip: "127.0.0.1"
@@ -216,6 +429,34 @@ logging:
 security:
   allow_users_create_ns: true
   allow_users_create_a: true
+
+scheduler:
+  interval: 30
+
+# Удалённые домены хранятся в корзине retention_days дней, 0 — удалять сразу
+# (при 0 домены, уже лежащие в корзине, автоматически не удаляются)
+trash:
+  retention_days: 30
+  purge_interval: 3600
+
+# 0 — без ограничения
+quotas:
+  max_domains: 0
+  max_records_per_domain: 0
+  max_total_records: 0
+
+# NOTIFY вторичным серверам: таймаут ответа и пауза перед проверкой serial, в секундах
+notify:
+  timeout: 3
+  retries: 3
+  serial_check_delay: 10
+
+# Каталожная зона (RFC 9432) со списком первичных зон для вторичных серверов.
+# group_attribute: org — группа по организации, owner — по владельцу, пусто — без групп
+catalog:
+  enabled: false
+  zone: "catalog.invalid"
+  group_attribute: ""
 `
     return os.WriteFile("config.yaml", []byte(config), 0600)
 }
@@ -3,6 +3,8 @@ package middleware
 import (
     "net/http"
 
+    "dns-manager/models"
+
     "github.com/gorilla/sessions"
 )
 
@@ -26,6 +28,8 @@ func AuthMiddleware(store *sessions.CookieStore) func(http.Handler) http.Handler
     }
 }
 
+// AdminMiddleware пускает в раздел администрирования роли с правом CapAdminPanel.
+// Конкретные действия обработчики проверяют по той же матрице ролей.
 func AdminMiddleware(store *sessions.CookieStore) func(http.Handler) http.Handler {
     return func(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -42,7 +46,7 @@ func AdminMiddleware(store *sessions.CookieStore) func(http.Handler) http.Handle
             }
 
             role, ok := roleVal.(string)
-            if !ok || role != "admin" {
+            if !ok || !models.RoleCan(role, models.CapAdminPanel) {
                 http.Error(w, "Forbidden", http.StatusForbidden)
                 return
             }
@@ -0,0 +1,302 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+const (
+    ChangeCreate = "create"
+    ChangeUpdate = "update"
+    ChangeDelete = "delete"
+)
+
+const (
+    ChangePending  = "pending"
+    ChangeApproved = "approved"
+    ChangeRejected = "rejected"
+    ChangeFailed   = "failed"
+)
+
+// ProtectionRule описывает записи домена, изменения которых требуют согласования.
+// Name "*" означает любое имя записи указанного типа.
+type ProtectionRule struct {
+    ID         int64
+    DomainID   int64
+    RecordType string
+    Name       string
+    CreatedAt  time.Time
+}
+
+type PendingChange struct {
+    ID               int64
+    DomainID         int64
+    DomainName       string
+    RecordID         int64
+    Action           string
+    Type             string
+    Name             string
+    Content          string
+    Priority         int
+    TTL              int
+    Status           string
+    RequestedBy      int64
+    RequestedByName  string
+    // Администратор, подавший заявку от имени пользователя; 0 — подана самим пользователем
+    ImpersonatorID   int64
+    ImpersonatorName string
+    // Время из запланированного изменения: после согласования заявка
+    // передаётся планировщику; nil — применяется сразу
+    RunAt            *time.Time
+    ReviewedBy       int64
+    ReviewedByName   string
+    ReviewComment    string
+    CreatedAt        time.Time
+    ReviewedAt       *time.Time
+}
+
+// Record возвращает запись в том виде, в котором она будет применена.
+func (c *PendingChange) Record() Record {
+    return Record{
+        ID:       c.RecordID,
+        DomainID: c.DomainID,
+        Type:     c.Type,
+        Name:     c.Name,
+        Content:  c.Content,
+        Priority: c.Priority,
+        TTL:      c.TTL,
+    }
+}
+
+func CreateProtectionRule(db *DB, rule *ProtectionRule) error {
+    result, err := db.Exec(`INSERT INTO protection_rules (domain_id, record_type, name, created_at)
+                            VALUES (?, ?, ?, ?)`,
+        rule.DomainID, rule.RecordType, rule.Name, time.Now())
+    if err != nil {
+        return err
+    }
+
+    rule.ID, err = result.LastInsertId()
+    return err
+}
+
+func GetProtectionRules(db *DB, domainID int64) ([]ProtectionRule, error) {
+    rows, err := db.Query(`
+        SELECT id, domain_id, record_type, name, created_at
+        FROM protection_rules
+        WHERE domain_id = ?
+        ORDER BY record_type, name`, domainID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var rules []ProtectionRule
+    for rows.Next() {
+        var p ProtectionRule
+        if err := rows.Scan(&p.ID, &p.DomainID, &p.RecordType, &p.Name, &p.CreatedAt); err != nil {
+            return nil, err
+        }
+        rules = append(rules, p)
+    }
+    return rules, nil
+}
+
+func DeleteProtectionRule(db *DB, domainID, id int64) error {
+    _, err := db.Exec("DELETE FROM protection_rules WHERE id = ? AND domain_id = ?", id, domainID)
+    return err
+}
+
+// IsRecordProtected проверяет, попадает ли запись под одно из правил защиты домена
+func IsRecordProtected(db *DB, domainID int64, recordType, name string) (bool, error) {
+    var count int
+    err := db.QueryRow(`
+        SELECT COUNT(*) FROM protection_rules
+        WHERE domain_id = ? AND record_type = ? AND (name = ? OR name = '*')`,
+        domainID, recordType, name,
+    ).Scan(&count)
+    if err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
+func AddDomainApprover(db *DB, domainID, userID int64) error {
+    _, err := db.Exec(`INSERT OR IGNORE INTO domain_approvers (domain_id, user_id, created_at)
+                       VALUES (?, ?, ?)`, domainID, userID, time.Now())
+    return err
+}
+
+func RemoveDomainApprover(db *DB, domainID, userID int64) error {
+    _, err := db.Exec("DELETE FROM domain_approvers WHERE domain_id = ? AND user_id = ?", domainID, userID)
+    return err
+}
+
+func GetDomainApprovers(db *DB, domainID int64) ([]User, error) {
+    rows, err := db.Query(`
+        SELECT u.id, u.username, u.email, u.role
+        FROM domain_approvers a
+        JOIN users u ON a.user_id = u.id
+        WHERE a.domain_id = ?
+        ORDER BY u.username`, domainID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var users []User
+    for rows.Next() {
+        var u User
+        if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Role); err != nil {
+            return nil, err
+        }
+        users = append(users, u)
+    }
+    return users, nil
+}
+
+// CanApproveChanges разрешает согласование администраторам и назначенным согласующим домена
+func CanApproveChanges(db *DB, userID int64, userRole string, domainID int64) (bool, error) {
+    if RoleCan(userRole, CapWriteAllDomains) {
+        return true, nil
+    }
+    var count int
+    err := db.QueryRow("SELECT COUNT(*) FROM domain_approvers WHERE domain_id = ? AND user_id = ?",
+        domainID, userID).Scan(&count)
+    if err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
+func CreatePendingChange(db *DB, c *PendingChange) error {
+    query := `INSERT INTO pending_changes (
+        domain_id, record_id, action, type, name, content, priority, ttl,
+        status, requested_by, requested_by_name, impersonator_id, impersonator_name, run_at, created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+    var runAt sql.NullTime
+    if c.RunAt != nil {
+        runAt = sql.NullTime{Time: c.RunAt.UTC(), Valid: true}
+    }
+
+    result, err := db.Exec(query,
+        c.DomainID, c.RecordID, c.Action, c.Type, c.Name, c.Content, c.Priority, c.TTL,
+        ChangePending, c.RequestedBy, c.RequestedByName,
+        nullInt64(c.ImpersonatorID), c.ImpersonatorName, runAt, time.Now(),
+    )
+    if err != nil {
+        return err
+    }
+
+    c.ID, err = result.LastInsertId()
+    c.Status = ChangePending
+    return err
+}
+
+const pendingChangeColumns = `
+    c.id, c.domain_id, d.name, c.record_id, c.action, c.type, c.name, c.content,
+    c.priority, c.ttl, c.status, c.requested_by, c.requested_by_name,
+    COALESCE(c.impersonator_id, 0), COALESCE(c.impersonator_name, ''), c.run_at,
+    c.reviewed_by, c.reviewed_by_name, c.review_comment, c.created_at, c.reviewed_at`
+
+func scanPendingChange(scanner interface{ Scan(...interface{}) error }) (*PendingChange, error) {
+    var c PendingChange
+    var reviewedBy sql.NullInt64
+    var reviewedByName, reviewComment sql.NullString
+    var reviewedAt, runAt sql.NullTime
+
+    err := scanner.Scan(
+        &c.ID, &c.DomainID, &c.DomainName, &c.RecordID, &c.Action, &c.Type, &c.Name, &c.Content,
+        &c.Priority, &c.TTL, &c.Status, &c.RequestedBy, &c.RequestedByName,
+        &c.ImpersonatorID, &c.ImpersonatorName, &runAt,
+        &reviewedBy, &reviewedByName, &reviewComment, &c.CreatedAt, &reviewedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    c.ReviewedBy = reviewedBy.Int64
+    c.ReviewedByName = reviewedByName.String
+    c.ReviewComment = reviewComment.String
+    if reviewedAt.Valid {
+        c.ReviewedAt = &reviewedAt.Time
+    }
+    if runAt.Valid {
+        c.RunAt = &runAt.Time
+    }
+    return &c, nil
+}
+
+func GetPendingChangeByID(db *DB, id int64) (*PendingChange, error) {
+    row := db.QueryRow(`SELECT `+pendingChangeColumns+`
+        FROM pending_changes c
+        JOIN domains d ON c.domain_id = d.id
+        WHERE c.id = ?`, id)
+
+    c, err := scanPendingChange(row)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return c, err
+}
+
+// GetPendingChanges возвращает заявки, которые пользователь может видеть:
+// администратору — все, остальным — свои и заявки доменов, где он согласующий.
+func GetPendingChanges(db *DB, userID int64, userRole, status string, limit int) ([]PendingChange, error) {
+    query := `SELECT ` + pendingChangeColumns + `
+        FROM pending_changes c
+        JOIN domains d ON c.domain_id = d.id
+        WHERE (? = '' OR c.status = ?)`
+    args := []interface{}{status, status}
+
+    if !RoleCan(userRole, CapReadAllDomains) {
+        query += ` AND (c.requested_by = ? OR c.domain_id IN
+            (SELECT domain_id FROM domain_approvers WHERE user_id = ?))`
+        args = append(args, userID, userID)
+    }
+    query += ` ORDER BY c.created_at DESC LIMIT ?`
+    args = append(args, limit)
+
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var changes []PendingChange
+    for rows.Next() {
+        c, err := scanPendingChange(rows)
+        if err != nil {
+            return nil, err
+        }
+        changes = append(changes, *c)
+    }
+    return changes, nil
+}
+
+// ReviewPendingChange переводит заявку из статуса pending в итоговый.
+// Возвращает false, если заявка уже была рассмотрена.
+func ReviewPendingChange(db *DB, id int64, status string, reviewerID int64, reviewerName, comment string) (bool, error) {
+    result, err := db.Exec(`
+        UPDATE pending_changes
+        SET status = ?, reviewed_by = ?, reviewed_by_name = ?, review_comment = ?, reviewed_at = ?
+        WHERE id = ? AND status = ?`,
+        status, reviewerID, reviewerName, comment, time.Now(), id, ChangePending)
+    if err != nil {
+        return false, err
+    }
+
+    n, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n > 0, nil
+}
+
+// MarkPendingChangeFailed фиксирует ошибку применения одобренной заявки
+func MarkPendingChangeFailed(db *DB, id int64, reason string) error {
+    _, err := db.Exec(`UPDATE pending_changes SET status = ?, review_comment = ? WHERE id = ?`,
+        ChangeFailed, reason, id)
+    return err
+}
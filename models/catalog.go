@@ -0,0 +1,45 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// NextCatalogSerial увеличивает serial каталожной зоны и возвращает его.
+// Serial не меньше текущего времени в секундах, чтобы он рос и после пересоздания БД.
+func NextCatalogSerial(db *DB) (uint32, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    var serial int64
+    err = tx.QueryRow("SELECT serial FROM catalog_zone WHERE id = 1").Scan(&serial)
+    if err != nil && err != sql.ErrNoRows {
+        return 0, err
+    }
+    serial++
+    if now := time.Now().Unix(); serial < now {
+        serial = now
+    }
+    // Serial зоны — 32-битное число, переполнение допустимо по RFC 1982
+    serial = int64(uint32(serial))
+
+    if _, err := tx.Exec(`INSERT INTO catalog_zone (id, serial, updated_at) VALUES (1, ?, ?)
+                          ON CONFLICT(id) DO UPDATE SET serial = excluded.serial, updated_at = excluded.updated_at`,
+        serial, time.Now()); err != nil {
+        return 0, err
+    }
+    return uint32(serial), tx.Commit()
+}
+
+// GetCatalogSerial возвращает текущий serial каталожной зоны, 0 — зона ещё не создана
+func GetCatalogSerial(db *DB) (uint32, error) {
+    var serial int64
+    err := db.QueryRow("SELECT serial FROM catalog_zone WHERE id = 1").Scan(&serial)
+    if err == sql.ErrNoRows {
+        return 0, nil
+    }
+    return uint32(serial), err
+}
@@ -63,7 +63,9 @@ func createTables(db *sql.DB) error {
             action TEXT,
             details TEXT,
             ip TEXT,
-            created_at DATETIME
+            created_at DATETIME,
+            impersonator_id INTEGER,
+            impersonator_name TEXT
         )`,
 
         // Таблица доменов (обновленная)
@@ -79,6 +81,13 @@ func createTables(db *sql.DB) error {
             soa_minimum INTEGER DEFAULT 3600,
             serial INTEGER DEFAULT 1,
             created_at DATETIME,
+            org_id INTEGER,
+            deleted_at DATETIME,
+            deleted_by INTEGER,
+            reverse_cidr TEXT DEFAULT '',
+            kind TEXT DEFAULT 'primary',
+            primaries TEXT DEFAULT '',
+            tsig_key TEXT DEFAULT '',
             FOREIGN KEY(user_id) REFERENCES users(id)
         )`,
 
@@ -95,11 +104,243 @@ func createTables(db *sql.DB) error {
             FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
         )`,
 
+        // Организации (команды), которым могут принадлежать домены
+        `CREATE TABLE IF NOT EXISTS organizations (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT UNIQUE,
+            created_at DATETIME
+        )`,
+
+        // Участники организаций
+        `CREATE TABLE IF NOT EXISTS org_members (
+            org_id INTEGER,
+            user_id INTEGER,
+            role TEXT DEFAULT 'viewer',
+            created_at DATETIME,
+            PRIMARY KEY(org_id, user_id),
+            FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+            FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+        )`,
+
+        // Участники домена (совместный доступ)
+        `CREATE TABLE IF NOT EXISTS domain_members (
+            domain_id INTEGER,
+            user_id INTEGER,
+            role TEXT DEFAULT 'viewer',
+            created_at DATETIME,
+            PRIMARY KEY(domain_id, user_id),
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE,
+            FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+        )`,
+
+        // Политики доступа к записям по типам, именам и TTL
+        `CREATE TABLE IF NOT EXISTS record_policies (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            subject_type TEXT,
+            subject TEXT,
+            domain_id INTEGER DEFAULT 0,
+            record_types TEXT DEFAULT '*',
+            actions TEXT DEFAULT '*',
+            name_pattern TEXT DEFAULT '*',
+            min_ttl INTEGER DEFAULT 0,
+            max_ttl INTEGER DEFAULT 0,
+            created_at DATETIME
+        )`,
+
+        // Предложения передать домен другому пользователю
+        `CREATE TABLE IF NOT EXISTS domain_transfers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            domain_id INTEGER NOT NULL,
+            from_user_id INTEGER NOT NULL,
+            to_user_id INTEGER NOT NULL,
+            status TEXT DEFAULT 'pending',
+            created_at DATETIME,
+            resolved_at DATETIME,
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
+        )`,
+
+        // Шаблоны записей для новых и существующих доменов. owner_id = 0 — общий шаблон
+        `CREATE TABLE IF NOT EXISTS record_templates (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            owner_id INTEGER DEFAULT 0,
+            created_at DATETIME
+        )`,
+
+        `CREATE TABLE IF NOT EXISTS template_records (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            template_id INTEGER NOT NULL,
+            type TEXT,
+            name TEXT,
+            content TEXT,
+            priority INTEGER DEFAULT 0,
+            ttl INTEGER DEFAULT 0,
+            FOREIGN KEY(template_id) REFERENCES record_templates(id) ON DELETE CASCADE
+        )`,
+
+        // Квоты на домены и записи для пользователей и ролей
+        `CREATE TABLE IF NOT EXISTS quotas (
+            subject_type TEXT,
+            subject TEXT,
+            max_domains INTEGER DEFAULT 0,
+            max_records_per_domain INTEGER DEFAULT 0,
+            max_total_records INTEGER DEFAULT 0,
+            updated_at DATETIME,
+            PRIMARY KEY(subject_type, subject)
+        )`,
+
+        // Правила защиты записей, изменения которых требуют согласования
+        `CREATE TABLE IF NOT EXISTS protection_rules (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            domain_id INTEGER,
+            record_type TEXT,
+            name TEXT,
+            created_at DATETIME,
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
+        )`,
+
+        // Согласующие домена
+        `CREATE TABLE IF NOT EXISTS domain_approvers (
+            domain_id INTEGER,
+            user_id INTEGER,
+            created_at DATETIME,
+            PRIMARY KEY(domain_id, user_id),
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE,
+            FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+        )`,
+
+        // Заявки на изменение защищённых записей
+        `CREATE TABLE IF NOT EXISTS pending_changes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            domain_id INTEGER,
+            record_id INTEGER DEFAULT 0,
+            action TEXT,
+            type TEXT,
+            name TEXT,
+            content TEXT,
+            priority INTEGER DEFAULT 0,
+            ttl INTEGER DEFAULT 3600,
+            status TEXT DEFAULT 'pending',
+            requested_by INTEGER,
+            requested_by_name TEXT,
+            impersonator_id INTEGER,
+            impersonator_name TEXT,
+            run_at DATETIME,
+            reviewed_by INTEGER,
+            reviewed_by_name TEXT,
+            review_comment TEXT,
+            created_at DATETIME,
+            reviewed_at DATETIME,
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
+        )`,
+
+        // Запланированные изменения записей
+        `CREATE TABLE IF NOT EXISTS scheduled_changes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            domain_id INTEGER,
+            record_id INTEGER DEFAULT 0,
+            action TEXT,
+            type TEXT,
+            name TEXT,
+            content TEXT,
+            priority INTEGER DEFAULT 0,
+            ttl INTEGER DEFAULT 3600,
+            run_at DATETIME,
+            status TEXT DEFAULT 'pending',
+            error TEXT,
+            created_by INTEGER,
+            created_by_name TEXT,
+            approved_by INTEGER,
+            approved_by_name TEXT,
+            created_at DATETIME,
+            executed_at DATETIME,
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
+        )`,
+
+        // Вторичные серверы, которым разрешена передача зоны и отправляется NOTIFY.
+        // domain_id = 0 — сервер для всех первичных зон
+        `CREATE TABLE IF NOT EXISTS xfr_targets (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            domain_id INTEGER DEFAULT 0,
+            address TEXT,
+            tsig_key TEXT DEFAULT '',
+            provide_xfr INTEGER DEFAULT 1,
+            notify INTEGER DEFAULT 1,
+            created_at DATETIME
+        )`,
+
+        // Результат последнего NOTIFY и serial, который вернул вторичный сервер
+        `CREATE TABLE IF NOT EXISTS notify_results (
+            domain_id INTEGER,
+            address TEXT,
+            sent_at DATETIME,
+            success INTEGER DEFAULT 0,
+            message TEXT DEFAULT '',
+            serial INTEGER DEFAULT 0,
+            serial_checked_at DATETIME,
+            PRIMARY KEY(domain_id, address),
+            FOREIGN KEY(domain_id) REFERENCES domains(id) ON DELETE CASCADE
+        )`,
+
+        // TSIG ключи для передачи зон и NOTIFY, секрет зашифрован
+        `CREATE TABLE IF NOT EXISTS tsig_keys (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT UNIQUE COLLATE NOCASE,
+            algorithm TEXT,
+            secret TEXT,
+            created_at DATETIME,
+            rotated_at DATETIME
+        )`,
+
+        // Состояние каталожной зоны (RFC 9432), одна строка с id = 1
+        `CREATE TABLE IF NOT EXISTS catalog_zone (
+            id INTEGER PRIMARY KEY,
+            serial INTEGER DEFAULT 0,
+            updated_at DATETIME
+        )`,
+
+        // Удалённые DNS серверы, на которые панель копирует зоны
+        `CREATE TABLE IF NOT EXISTS dns_servers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT UNIQUE COLLATE NOCASE,
+            transport TEXT,
+            address TEXT,
+            zone_dir TEXT,
+            conf_path TEXT,
+            token TEXT DEFAULT '',
+            enabled BOOLEAN DEFAULT 1,
+            last_check_at DATETIME,
+            last_check_error TEXT DEFAULT '',
+            created_at DATETIME
+        )`,
+
+        // Состояние копирования зон на удалённые серверы. Пустое имя зоны — zones.conf
+        `CREATE TABLE IF NOT EXISTS server_sync (
+            server_id INTEGER,
+            zone TEXT,
+            action TEXT,
+            serial INTEGER DEFAULT 0,
+            state TEXT,
+            attempts INTEGER DEFAULT 0,
+            next_attempt_at DATETIME,
+            last_error TEXT DEFAULT '',
+            synced_at DATETIME,
+            PRIMARY KEY (server_id, zone)
+        )`,
+
         // Индексы
         `CREATE INDEX IF NOT EXISTS idx_records_domain_id ON records(domain_id)`,
         `CREATE INDEX IF NOT EXISTS idx_domains_user_id ON domains(user_id)`,
         `CREATE INDEX IF NOT EXISTS idx_login_logs_user_id ON login_logs(user_id)`,
         `CREATE INDEX IF NOT EXISTS idx_user_actions_user_id ON user_actions(user_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_domain_members_user_id ON domain_members(user_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_record_policies_subject ON record_policies(subject_type, subject)`,
+        `CREATE INDEX IF NOT EXISTS idx_protection_rules_domain_id ON protection_rules(domain_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_pending_changes_domain_id ON pending_changes(domain_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_scheduled_changes_status_run_at ON scheduled_changes(status, run_at)`,
+        `CREATE INDEX IF NOT EXISTS idx_domain_transfers_to_user_id ON domain_transfers(to_user_id, status)`,
+        `CREATE INDEX IF NOT EXISTS idx_template_records_template_id ON template_records(template_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_xfr_targets_domain_id ON xfr_targets(domain_id)`,
     }
 
     for _, query := range queries {
@@ -108,5 +349,77 @@ func createTables(db *sql.DB) error {
         }
     }
 
+    // CREATE TABLE IF NOT EXISTS не меняет таблицы, созданные старыми версиями,
+    // поэтому новые колонки добавляем отдельно
+    columns := []struct {
+        table, name, definition string
+    }{
+        {"domains", "org_id", "INTEGER"},
+        {"domains", "deleted_at", "DATETIME"},
+        {"domains", "deleted_by", "INTEGER"},
+        {"domains", "reverse_cidr", "TEXT DEFAULT ''"},
+        {"domains", "kind", "TEXT DEFAULT 'primary'"},
+        {"domains", "primaries", "TEXT DEFAULT ''"},
+        {"domains", "tsig_key", "TEXT DEFAULT ''"},
+        {"user_actions", "impersonator_id", "INTEGER"},
+        {"user_actions", "impersonator_name", "TEXT"},
+        {"pending_changes", "impersonator_id", "INTEGER"},
+        {"pending_changes", "impersonator_name", "TEXT"},
+        {"pending_changes", "run_at", "DATETIME"},
+        {"scheduled_changes", "approved_by", "INTEGER"},
+        {"scheduled_changes", "approved_by_name", "TEXT"},
+    }
+
+    for _, c := range columns {
+        if err := addColumnIfMissing(db, c.table, c.name, c.definition); err != nil {
+            return fmt.Errorf("error migrating table %s: %v", c.table, err)
+        }
+    }
+
+    // Индексы по добавленным колонкам
+    indexes := []string{
+        `CREATE INDEX IF NOT EXISTS idx_domains_org_id ON domains(org_id)`,
+        `CREATE INDEX IF NOT EXISTS idx_domains_deleted_at ON domains(deleted_at)`,
+        `CREATE INDEX IF NOT EXISTS idx_user_actions_impersonator_id ON user_actions(impersonator_id)`,
+    }
+
+    for _, query := range indexes {
+        if _, err := db.Exec(query); err != nil {
+            return fmt.Errorf("error creating index: %v", err)
+        }
+    }
+
     return nil
 }
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+    rows, err := db.Query("PRAGMA table_info(" + table + ")")
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var cid, notNull, pk int
+        var name, colType string
+        var defaultValue sql.NullString
+        if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+            return err
+        }
+        if name == column {
+            return nil
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    rows.Close()
+
+    _, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+    return err
+}
+
+// nullInt64 сохраняет 0 как NULL для необязательных внешних ключей
+func nullInt64(v int64) sql.NullInt64 {
+    return sql.NullInt64{Int64: v, Valid: v != 0}
+}
@@ -2,14 +2,20 @@ package models
 
 import (
     "database/sql"
+    "errors"
+    "strings"
     "time"
 )
 
 type Domain struct {
     ID           int64
     Name         string
+    UnicodeName  string // имя в Unicode для IDN (для ASCII совпадает с Name)
     UserID       int64
     OwnerName    string // Добавлено
+    OrgID        int64  // 0 — личный домен пользователя
+    OrgName      string
+    Role         string // роль текущего пользователя: owner, editor, viewer
     SOAEmail     string
     SOAPrimaryNS string
     SOARefresh   int
@@ -18,11 +24,42 @@ type Domain struct {
     SOAMinimum   int
     Serial       int
     CreatedAt    time.Time
+    DeletedAt    *time.Time // не nil — домен в корзине
+    ReverseCIDR  string     // префикс обратной зоны, пусто для прямых зон
+    Kind         string     // primary или secondary
+    Primaries    string     // для вторичной зоны: адреса первичных серверов через запятую
+    TSIGKey      string     // имя TSIG ключа для передачи зоны, пусто — без ключа
+    RecordCount  int        // число записей, заполняется только в списках доменов
+    RecordLimit  int        // лимит записей по квоте владельца, 0 — без ограничений
+}
+
+// Типы зон
+const (
+    DomainPrimary   = "primary"
+    DomainSecondary = "secondary"
+)
+
+// IsSecondary — зона получается передачей с первичного сервера, записи
+// в панели не редактируются
+func (d *Domain) IsSecondary() bool {
+    return d.Kind == DomainSecondary
+}
+
+// PrimaryList возвращает адреса первичных серверов вторичной зоны
+func (d *Domain) PrimaryList() []string {
+    var list []string
+    for _, p := range strings.Split(d.Primaries, ",") {
+        if p = strings.TrimSpace(p); p != "" {
+            list = append(list, p)
+        }
+    }
+    return list
 }
 
 type DomainCreateOptions struct {
     Name         string
     UserID       int64
+    OrgID        int64
     SOAEmail     string
     SOAPrimaryNS string
     SOARefresh   int
@@ -32,6 +69,11 @@ type DomainCreateOptions struct {
     CreateNS     bool
     CreateA      bool
     ServerIP     string
+    MaxDomains   int // квота пользователя на число доменов, 0 — без ограничения
+    ReverseCIDR  string // префикс, если создаётся обратная зона
+    Kind         string // пусто — первичная зона
+    Primaries    string
+    TSIGKey      string
 }
 
 func CreateDomain(db *DB, opts *DomainCreateOptions) (int64, error) {
@@ -47,16 +89,25 @@ func CreateDomain(db *DB, opts *DomainCreateOptions) (int64, error) {
     if opts.SOAMinimum == 0 {
         opts.SOAMinimum = 3600
     }
+    if opts.Kind == "" {
+        opts.Kind = DomainPrimary
+    }
 
+    // Квота проверяется в том же запросе, что и вставка, чтобы параллельные
+    // запросы не могли её превысить. Личная квота не распространяется на
+    // домены организаций.
     query := `INSERT INTO domains (
-        name, user_id, soa_email, soa_primary_ns,
+        name, user_id, org_id, soa_email, soa_primary_ns,
         soa_refresh, soa_retry, soa_expire, soa_minimum,
-        serial, created_at
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?)`
+        serial, created_at, reverse_cidr, kind, primaries, tsig_key
+    ) SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?
+      WHERE ? = 0 OR ? != 0
+         OR (SELECT COUNT(*) FROM domains WHERE user_id = ? AND org_id IS NULL) < ?`
     
     result, err := db.Exec(query,
         opts.Name,
         opts.UserID,
+        nullInt64(opts.OrgID),
         opts.SOAEmail,
         opts.SOAPrimaryNS,
         opts.SOARefresh,
@@ -64,22 +115,45 @@ func CreateDomain(db *DB, opts *DomainCreateOptions) (int64, error) {
         opts.SOAExpire,
         opts.SOAMinimum,
         time.Now(),
+        opts.ReverseCIDR,
+        opts.Kind,
+        opts.Primaries,
+        opts.TSIGKey,
+        opts.MaxDomains, opts.OrgID, opts.UserID, opts.MaxDomains,
     )
     if err != nil {
         return 0, err
     }
 
+    n, err := result.RowsAffected()
+    if err != nil {
+        return 0, err
+    }
+    if n == 0 {
+        return 0, ErrQuotaExceeded
+    }
+
     return result.LastInsertId()
 }
 
+// GetDomainsByUserID возвращает личные домены пользователя, домены его организаций
+// и домены, к которым ему открыт доступ
 func GetDomainsByUserID(db *DB, userID int64) ([]Domain, error) {
     rows, err := db.Query(`
-        SELECT id, name, user_id, soa_email, soa_primary_ns,
-               soa_refresh, soa_retry, soa_expire, soa_minimum,
-               serial, created_at
-        FROM domains
-        WHERE user_id = ?
-        ORDER BY name`, userID)
+        SELECT d.id, d.name, d.user_id, d.soa_email, d.soa_primary_ns,
+               d.soa_refresh, d.soa_retry, d.soa_expire, d.soa_minimum,
+               d.serial, d.created_at, d.org_id, COALESCE(o.name, ''),
+               COALESCE(d.kind, 'primary'), COALESCE(d.primaries, ''), COALESCE(d.tsig_key, ''),
+               (SELECT COUNT(*) FROM records r WHERE r.domain_id = d.id),
+               CASE WHEN d.user_id = ? AND d.org_id IS NULL THEN 'owner' ELSE '' END,
+               COALESCE(m.role, ''), COALESCE(om.role, '')
+        FROM domains d
+        LEFT JOIN domain_members m ON m.domain_id = d.id AND m.user_id = ?
+        LEFT JOIN org_members om ON om.org_id = d.org_id AND om.user_id = ?
+        LEFT JOIN organizations o ON o.id = d.org_id
+        WHERE d.deleted_at IS NULL
+          AND ((d.user_id = ? AND d.org_id IS NULL) OR m.user_id IS NOT NULL OR om.user_id IS NOT NULL)
+        ORDER BY d.name`, userID, userID, userID, userID)
     if err != nil {
         return nil, err
     }
@@ -88,14 +162,21 @@ func GetDomainsByUserID(db *DB, userID int64) ([]Domain, error) {
     var domains []Domain
     for rows.Next() {
         var d Domain
+        var orgID sql.NullInt64
+        var ownerRole, memberRole, orgRole string
         if err := rows.Scan(
             &d.ID, &d.Name, &d.UserID, &d.SOAEmail, &d.SOAPrimaryNS,
             &d.SOARefresh, &d.SOARetry, &d.SOAExpire, &d.SOAMinimum,
-            &d.Serial, &d.CreatedAt,
+            &d.Serial, &d.CreatedAt, &orgID, &d.OrgName,
+            &d.Kind, &d.Primaries, &d.TSIGKey, &d.RecordCount,
+            &ownerRole, &memberRole, &orgRole,
         ); err != nil {
             return nil, err
         }
-        d.OwnerName = "" // для обычного пользователя не заполняем
+        d.OrgID = orgID.Int64
+        d.UnicodeName = UnicodeName(d.Name)
+        d.Role = strongerRole(strongerRole(ownerRole, memberRole), orgRole)
+        d.OwnerName = d.OrgName // для обычного пользователя показываем только организацию
         domains = append(domains, d)
     }
     return domains, nil
@@ -105,9 +186,13 @@ func GetAllDomains(db *DB) ([]Domain, error) {
     rows, err := db.Query(`
         SELECT d.id, d.name, d.user_id, d.soa_email, d.soa_primary_ns,
                d.soa_refresh, d.soa_retry, d.soa_expire, d.soa_minimum,
-               d.serial, d.created_at, u.username
+               d.serial, d.created_at, d.org_id, COALESCE(o.name, ''), COALESCE(u.username, ''),
+               COALESCE(d.kind, 'primary'), COALESCE(d.primaries, ''), COALESCE(d.tsig_key, ''),
+               (SELECT COUNT(*) FROM records r WHERE r.domain_id = d.id)
         FROM domains d
-        JOIN users u ON d.user_id = u.id
+        LEFT JOIN users u ON d.user_id = u.id
+        LEFT JOIN organizations o ON o.id = d.org_id
+        WHERE d.deleted_at IS NULL
         ORDER BY d.created_at DESC`)
     if err != nil {
         return nil, err
@@ -117,15 +202,22 @@ func GetAllDomains(db *DB) ([]Domain, error) {
     var domains []Domain
     for rows.Next() {
         var d Domain
+        var orgID sql.NullInt64
         var username string
         if err := rows.Scan(
             &d.ID, &d.Name, &d.UserID, &d.SOAEmail, &d.SOAPrimaryNS,
             &d.SOARefresh, &d.SOARetry, &d.SOAExpire, &d.SOAMinimum,
-            &d.Serial, &d.CreatedAt, &username,
+            &d.Serial, &d.CreatedAt, &orgID, &d.OrgName, &username,
+            &d.Kind, &d.Primaries, &d.TSIGKey, &d.RecordCount,
         ); err != nil {
             return nil, err
         }
+        d.OrgID = orgID.Int64
+        d.UnicodeName = UnicodeName(d.Name)
         d.OwnerName = username
+        if d.OrgID != 0 {
+            d.OwnerName = d.OrgName
+        }
         domains = append(domains, d)
     }
     return domains, nil
@@ -133,15 +225,18 @@ func GetAllDomains(db *DB) ([]Domain, error) {
 
 func GetDomainByID(db *DB, id int64) (*Domain, error) {
     var d Domain
+    var orgID sql.NullInt64
     query := `SELECT id, name, user_id, soa_email, soa_primary_ns,
                      soa_refresh, soa_retry, soa_expire, soa_minimum,
-                     serial, created_at
-              FROM domains WHERE id = ?`
+                     serial, created_at, org_id, COALESCE(reverse_cidr, ''),
+                     COALESCE(kind, 'primary'), COALESCE(primaries, ''), COALESCE(tsig_key, '')
+              FROM domains WHERE id = ? AND deleted_at IS NULL`
 
     err := db.QueryRow(query, id).Scan(
         &d.ID, &d.Name, &d.UserID, &d.SOAEmail, &d.SOAPrimaryNS,
         &d.SOARefresh, &d.SOARetry, &d.SOAExpire, &d.SOAMinimum,
-        &d.Serial, &d.CreatedAt,
+        &d.Serial, &d.CreatedAt, &orgID, &d.ReverseCIDR,
+        &d.Kind, &d.Primaries, &d.TSIGKey,
     )
 
     if err == sql.ErrNoRows {
@@ -151,21 +246,100 @@ func GetDomainByID(db *DB, id int64) (*Domain, error) {
         return nil, err
     }
 
+    d.OrgID = orgID.Int64
+    d.UnicodeName = UnicodeName(d.Name)
     // Можно подгрузить имя владельца отдельным запросом, но пока оставим пустым
     return &d, nil
 }
 
+// GetReverseZones возвращает активные обратные зоны
+func GetReverseZones(db *DB) ([]Domain, error) {
+    rows, err := db.Query(`SELECT id, name, user_id, org_id, reverse_cidr FROM domains
+                           WHERE reverse_cidr != '' AND deleted_at IS NULL`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var zones []Domain
+    for rows.Next() {
+        var d Domain
+        var orgID sql.NullInt64
+        if err := rows.Scan(&d.ID, &d.Name, &d.UserID, &orgID, &d.ReverseCIDR); err != nil {
+            return nil, err
+        }
+        d.OrgID = orgID.Int64
+        zones = append(zones, d)
+    }
+    return zones, rows.Err()
+}
+
+// UpdateSecondarySettings меняет первичные серверы и TSIG ключ вторичной зоны
+func UpdateSecondarySettings(db *DB, domainID int64, primaries, tsigKey string) error {
+    _, err := db.Exec("UPDATE domains SET primaries = ?, tsig_key = ? WHERE id = ? AND kind = ?",
+        primaries, tsigKey, domainID, DomainSecondary)
+    return err
+}
+
+// GetDomainByName возвращает активный домен по имени
+func GetDomainByName(db *DB, name string) (*Domain, error) {
+    var id int64
+    err := db.QueryRow("SELECT id FROM domains WHERE name = ? AND deleted_at IS NULL", name).Scan(&id)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return GetDomainByID(db, id)
+}
+
+// ErrDomainInTrash возвращается, когда имя занято доменом из корзины
+var ErrDomainInTrash = errors.New("domain is in trash")
+
+// DomainExists проверяет, занято ли имя. Если имя занято только доменом
+// из корзины, возвращает true и ErrDomainInTrash.
 func DomainExists(db *DB, name string) (bool, error) {
-    var count int
-    err := db.QueryRow("SELECT COUNT(*) FROM domains WHERE name = ?", name).Scan(&count)
+    var active, trashed int
+    err := db.QueryRow(`
+        SELECT COALESCE(SUM(deleted_at IS NULL), 0), COALESCE(SUM(deleted_at IS NOT NULL), 0)
+        FROM domains WHERE name = ?`, name).Scan(&active, &trashed)
     if err != nil {
         return false, err
     }
-    return count > 0, nil
+    if active == 0 && trashed > 0 {
+        return true, ErrDomainInTrash
+    }
+    return active > 0, nil
 }
 
+// DeleteDomain удаляет домен безвозвратно вместе со всеми связанными данными.
+// Внешние ключи в SQLite по умолчанию не проверяются, поэтому ON DELETE CASCADE
+// не срабатывает и зависимые строки удаляются явно.
 func DeleteDomain(db *DB, id int64) error {
-    _, err := db.Exec("DELETE FROM domains WHERE id = ?", id)
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if err := deleteDomainTx(tx, id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func deleteDomainTx(tx *sql.Tx, id int64) error {
+    for _, table := range []string{
+        "records", "domain_members", "domain_approvers", "protection_rules",
+        "pending_changes", "scheduled_changes", "domain_transfers", "record_policies",
+        "xfr_targets", "notify_results",
+    } {
+        if _, err := tx.Exec("DELETE FROM "+table+" WHERE domain_id = ?", id); err != nil {
+            return err
+        }
+    }
+    _, err := tx.Exec("DELETE FROM domains WHERE id = ?", id)
     return err
 }
 
@@ -174,14 +348,27 @@ func IncrementDomainSerial(db *DB, domainID int64) error {
     return err
 }
 
-func CanAccessDomain(db *DB, userID int64, userRole string, domainID int64) (bool, error) {
-    if userRole == "admin" {
-        return true, nil
-    }
+// domainActive сообщает, что домен существует и не находится в корзине
+func domainActive(db *DB, domainID int64) (bool, error) {
     var count int
-    err := db.QueryRow("SELECT COUNT(*) FROM domains WHERE id = ? AND user_id = ?", domainID, userID).Scan(&count)
+    err := db.QueryRow("SELECT COUNT(*) FROM domains WHERE id = ? AND deleted_at IS NULL", domainID).Scan(&count)
+    return count > 0, err
+}
+
+// CanAccessDomain проверяет, есть ли у пользователя требуемый уровень доступа к домену.
+// Глобальная роль может дать доступ ко всем доменам (CapReadAllDomains, CapWriteAllDomains)
+// или, наоборот, ограничить пользователя чтением, если у роли нет CapEditDomains.
+// В остальном действует роль владельца или участника домена.
+func CanAccessDomain(db *DB, userID int64, userRole string, domainID int64, perm Permission) (bool, error) {
+    if RoleCan(userRole, CapWriteAllDomains) || perm == PermRead && RoleCan(userRole, CapReadAllDomains) {
+        return domainActive(db, domainID)
+    }
+    if perm > PermRead && !RoleCan(userRole, CapEditDomains) {
+        return false, nil
+    }
+    role, err := GetDomainRole(db, userID, domainID)
     if err != nil {
         return false, err
     }
-    return count > 0, nil
+    return memberRoleAllows(role, perm), nil
 }
\ No newline at end of file
@@ -0,0 +1,25 @@
+package models
+
+import (
+    "strings"
+
+    "golang.org/x/net/idna"
+)
+
+// UnicodeName возвращает имя домена или записи в Unicode для отображения.
+// Метки без префикса xn-- и некорректные A-метки остаются без изменений.
+func UnicodeName(name string) string {
+    if !strings.Contains(strings.ToLower(name), "xn--") {
+        return name
+    }
+    labels := strings.Split(name, ".")
+    for i, label := range labels {
+        if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+            continue
+        }
+        if unicode, err := idna.Display.ToUnicode(label); err == nil {
+            labels[i] = unicode
+        }
+    }
+    return strings.Join(labels, ".")
+}
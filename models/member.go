@@ -0,0 +1,119 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// Роли участника домена
+const (
+    MemberOwner  = "owner"
+    MemberEditor = "editor"
+    MemberViewer = "viewer"
+)
+
+// Permission — уровень доступа, который требуется для операции над доменом
+type Permission int
+
+const (
+    PermRead   Permission = iota + 1 // просмотр записей
+    PermWrite                        // изменение записей и синхронизация зоны
+    PermManage                       // управление участниками и удаление домена
+)
+
+type DomainMember struct {
+    DomainID  int64
+    UserID    int64
+    Username  string
+    Role      string
+    CreatedAt time.Time
+}
+
+func ValidMemberRole(role string) bool {
+    return role == MemberOwner || role == MemberEditor || role == MemberViewer
+}
+
+// memberRoleAllows сопоставляет роль участника с требуемым уровнем доступа
+func memberRoleAllows(role string, perm Permission) bool {
+    switch role {
+    case MemberOwner:
+        return true
+    case MemberEditor:
+        return perm <= PermWrite
+    case MemberViewer:
+        return perm == PermRead
+    }
+    return false
+}
+
+// strongerRole возвращает более сильную из двух ролей
+func strongerRole(a, b string) string {
+    rank := map[string]int{MemberViewer: 1, MemberEditor: 2, MemberOwner: 3}
+    if rank[b] > rank[a] {
+        return b
+    }
+    return a
+}
+
+// GetDomainRole возвращает роль пользователя в домене. Личный владелец из
+// domains.user_id считается owner; для доменов организации права определяются
+// ролью в организации. Роль из domain_members добавляется к ним, выбирается
+// наиболее сильная. Пустая строка — доступа нет, в том числе к доменам в корзине.
+func GetDomainRole(db *DB, userID, domainID int64) (string, error) {
+    return domainRole(db, userID, domainID, false)
+}
+
+func domainRole(db *DB, userID, domainID int64, deleted bool) (string, error) {
+    var ownerRole, memberRole, orgRole string
+    err := db.QueryRow(`
+        SELECT CASE WHEN d.user_id = ? AND d.org_id IS NULL THEN 'owner' ELSE '' END,
+               COALESCE(m.role, ''), COALESCE(om.role, '')
+        FROM domains d
+        LEFT JOIN domain_members m ON m.domain_id = d.id AND m.user_id = ?
+        LEFT JOIN org_members om ON om.org_id = d.org_id AND om.user_id = ?
+        WHERE d.id = ? AND (d.deleted_at IS NOT NULL) = ?`,
+        userID, userID, userID, domainID, deleted).Scan(&ownerRole, &memberRole, &orgRole)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        return "", err
+    }
+    return strongerRole(strongerRole(ownerRole, memberRole), orgRole), nil
+}
+
+func AddDomainMember(db *DB, domainID, userID int64, role string) error {
+    _, err := db.Exec(`INSERT INTO domain_members (domain_id, user_id, role, created_at)
+                       VALUES (?, ?, ?, ?)
+                       ON CONFLICT(domain_id, user_id) DO UPDATE SET role = excluded.role`,
+        domainID, userID, role, time.Now())
+    return err
+}
+
+func RemoveDomainMember(db *DB, domainID, userID int64) error {
+    _, err := db.Exec("DELETE FROM domain_members WHERE domain_id = ? AND user_id = ?", domainID, userID)
+    return err
+}
+
+func GetDomainMembers(db *DB, domainID int64) ([]DomainMember, error) {
+    rows, err := db.Query(`
+        SELECT m.domain_id, m.user_id, u.username, m.role, m.created_at
+        FROM domain_members m
+        JOIN users u ON m.user_id = u.id
+        WHERE m.domain_id = ?
+        ORDER BY u.username`, domainID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var members []DomainMember
+    for rows.Next() {
+        var m DomainMember
+        if err := rows.Scan(&m.DomainID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        members = append(members, m)
+    }
+    return members, nil
+}
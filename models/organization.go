@@ -0,0 +1,190 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// Organization — команда, которой могут принадлежать домены.
+// Домены организации не зависят от учётных записей отдельных сотрудников.
+type Organization struct {
+    ID        int64
+    Name      string
+    Role      string // роль текущего пользователя в организации
+    CreatedAt time.Time
+}
+
+type OrgMember struct {
+    OrgID     int64
+    UserID    int64
+    Username  string
+    Role      string
+    CreatedAt time.Time
+}
+
+// CreateOrganization создаёт организацию и делает создателя её владельцем
+func CreateOrganization(db *DB, name string, ownerID int64) (int64, error) {
+    tx, err := db.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    now := time.Now()
+    result, err := tx.Exec("INSERT INTO organizations (name, created_at) VALUES (?, ?)", name, now)
+    if err != nil {
+        return 0, err
+    }
+    orgID, err := result.LastInsertId()
+    if err != nil {
+        return 0, err
+    }
+
+    if _, err := tx.Exec(`INSERT INTO org_members (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`,
+        orgID, ownerID, MemberOwner, now); err != nil {
+        return 0, err
+    }
+
+    return orgID, tx.Commit()
+}
+
+func GetOrganizationByID(db *DB, id int64) (*Organization, error) {
+    var o Organization
+    err := db.QueryRow("SELECT id, name, created_at FROM organizations WHERE id = ?", id).
+        Scan(&o.ID, &o.Name, &o.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &o, nil
+}
+
+func OrganizationExists(db *DB, name string) (bool, error) {
+    var count int
+    err := db.QueryRow("SELECT COUNT(*) FROM organizations WHERE name = ?", name).Scan(&count)
+    if err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
+// GetOrganizations возвращает все организации для ролей с CapReadAllDomains и только свои для остальных
+func GetOrganizations(db *DB, userID int64, userRole string) ([]Organization, error) {
+    query := `SELECT o.id, o.name, o.created_at, COALESCE(m.role, '')
+              FROM organizations o
+              LEFT JOIN org_members m ON m.org_id = o.id AND m.user_id = ?`
+    if !RoleCan(userRole, CapReadAllDomains) {
+        query += ` WHERE m.user_id IS NOT NULL`
+    }
+    query += ` ORDER BY o.name`
+
+    rows, err := db.Query(query, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var orgs []Organization
+    for rows.Next() {
+        var o Organization
+        if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt, &o.Role); err != nil {
+            return nil, err
+        }
+        orgs = append(orgs, o)
+    }
+    return orgs, nil
+}
+
+// DeleteOrganization удаляет организацию без доменов
+func DeleteOrganization(db *DB, id int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM org_members WHERE org_id = ?", id); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("DELETE FROM organizations WHERE id = ?", id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func CountOrganizationDomains(db *DB, orgID int64) (int, error) {
+    var count int
+    err := db.QueryRow("SELECT COUNT(*) FROM domains WHERE org_id = ?", orgID).Scan(&count)
+    return count, err
+}
+
+func GetOrgRole(db *DB, userID, orgID int64) (string, error) {
+    var role string
+    err := db.QueryRow("SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&role)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    return role, err
+}
+
+// CanAccessOrganization проверяет уровень доступа к организации: PermRead — участник,
+// PermWrite — может создавать домены организации, PermManage — управляет составом.
+func CanAccessOrganization(db *DB, userID int64, userRole string, orgID int64, perm Permission) (bool, error) {
+    if RoleCan(userRole, CapWriteAllDomains) || perm == PermRead && RoleCan(userRole, CapReadAllDomains) {
+        return true, nil
+    }
+    if perm > PermRead && !RoleCan(userRole, CapEditDomains) {
+        return false, nil
+    }
+    role, err := GetOrgRole(db, userID, orgID)
+    if err != nil {
+        return false, err
+    }
+    return memberRoleAllows(role, perm), nil
+}
+
+func AddOrgMember(db *DB, orgID, userID int64, role string) error {
+    _, err := db.Exec(`INSERT INTO org_members (org_id, user_id, role, created_at)
+                       VALUES (?, ?, ?, ?)
+                       ON CONFLICT(org_id, user_id) DO UPDATE SET role = excluded.role`,
+        orgID, userID, role, time.Now())
+    return err
+}
+
+func RemoveOrgMember(db *DB, orgID, userID int64) error {
+    _, err := db.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
+    return err
+}
+
+// CountOrgOwners нужен, чтобы организация не осталась без владельца
+func CountOrgOwners(db *DB, orgID int64) (int, error) {
+    var count int
+    err := db.QueryRow("SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = ?",
+        orgID, MemberOwner).Scan(&count)
+    return count, err
+}
+
+func GetOrgMembers(db *DB, orgID int64) ([]OrgMember, error) {
+    rows, err := db.Query(`
+        SELECT m.org_id, m.user_id, u.username, m.role, m.created_at
+        FROM org_members m
+        JOIN users u ON m.user_id = u.id
+        WHERE m.org_id = ?
+        ORDER BY u.username`, orgID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var members []OrgMember
+    for rows.Next() {
+        var m OrgMember
+        if err := rows.Scan(&m.OrgID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+            return nil, err
+        }
+        members = append(members, m)
+    }
+    return members, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+    "strconv"
+    "time"
+)
+
+const (
+    PolicySubjectUser = "user"
+    PolicySubjectRole = "role"
+)
+
+// RecordPolicy разрешает пользователю или роли операции над записями.
+// Если к пользователю применима хотя бы одна политика, разрешено только то,
+// что явно перечислено в политиках. "*" в списках означает «любой».
+type RecordPolicy struct {
+    ID          int64
+    SubjectType string // user или role
+    Subject     string // ID пользователя или название роли
+    DomainID    int64  // 0 — все домены
+    RecordTypes string // через запятую: "A,AAAA,CNAME" или "*"
+    Actions     string // через запятую: "create,update,delete" или "*"
+    NamePattern string // шаблон имени, например "*.dev.example.com"
+    MinTTL      int    // 0 — без ограничения
+    MaxTTL      int    // 0 — без ограничения
+    CreatedAt   time.Time
+}
+
+func CreateRecordPolicy(db *DB, p *RecordPolicy) error {
+    result, err := db.Exec(`INSERT INTO record_policies (
+        subject_type, subject, domain_id, record_types, actions, name_pattern,
+        min_ttl, max_ttl, created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+        p.SubjectType, p.Subject, p.DomainID, p.RecordTypes, p.Actions, p.NamePattern,
+        p.MinTTL, p.MaxTTL, time.Now())
+    if err != nil {
+        return err
+    }
+
+    p.ID, err = result.LastInsertId()
+    return err
+}
+
+func DeleteRecordPolicy(db *DB, id int64) error {
+    _, err := db.Exec("DELETE FROM record_policies WHERE id = ?", id)
+    return err
+}
+
+func queryRecordPolicies(db *DB, query string, args ...interface{}) ([]RecordPolicy, error) {
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var policies []RecordPolicy
+    for rows.Next() {
+        var p RecordPolicy
+        if err := rows.Scan(&p.ID, &p.SubjectType, &p.Subject, &p.DomainID, &p.RecordTypes,
+            &p.Actions, &p.NamePattern, &p.MinTTL, &p.MaxTTL, &p.CreatedAt); err != nil {
+            return nil, err
+        }
+        policies = append(policies, p)
+    }
+    return policies, nil
+}
+
+func GetAllRecordPolicies(db *DB) ([]RecordPolicy, error) {
+    return queryRecordPolicies(db, `
+        SELECT id, subject_type, subject, domain_id, record_types, actions, name_pattern,
+               min_ttl, max_ttl, created_at
+        FROM record_policies
+        ORDER BY subject_type, subject, id`)
+}
+
+// GetApplicablePolicies возвращает политики пользователя и его роли для домена
+func GetApplicablePolicies(db *DB, userID int64, userRole string, domainID int64) ([]RecordPolicy, error) {
+    return queryRecordPolicies(db, `
+        SELECT id, subject_type, subject, domain_id, record_types, actions, name_pattern,
+               min_ttl, max_ttl, created_at
+        FROM record_policies
+        WHERE ((subject_type = ? AND subject = ?) OR (subject_type = ? AND subject = ?))
+          AND (domain_id = 0 OR domain_id = ?)
+        ORDER BY id`,
+        PolicySubjectUser, strconv.FormatInt(userID, 10), PolicySubjectRole, userRole, domainID)
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+    "database/sql"
+    "errors"
+    "strconv"
+    "time"
+)
+
+// ErrQuotaExceeded возвращается, когда вставка не выполнена из-за квоты
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota ограничивает число доменов и записей. 0 — без ограничения.
+// Квота пользователя полностью заменяет квоту его роли.
+type Quota struct {
+    SubjectType         string // user или role, как у RecordPolicy
+    Subject             string
+    MaxDomains          int
+    MaxRecordsPerDomain int
+    MaxTotalRecords     int
+    UpdatedAt           time.Time
+}
+
+type QuotaUsage struct {
+    Domains      int
+    TotalRecords int
+    Limits       Quota
+}
+
+func SetQuota(db *DB, q *Quota) error {
+    _, err := db.Exec(`INSERT INTO quotas (
+        subject_type, subject, max_domains, max_records_per_domain, max_total_records, updated_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT(subject_type, subject) DO UPDATE SET
+        max_domains = excluded.max_domains,
+        max_records_per_domain = excluded.max_records_per_domain,
+        max_total_records = excluded.max_total_records,
+        updated_at = excluded.updated_at`,
+        q.SubjectType, q.Subject, q.MaxDomains, q.MaxRecordsPerDomain, q.MaxTotalRecords, time.Now())
+    return err
+}
+
+func DeleteQuota(db *DB, subjectType, subject string) error {
+    _, err := db.Exec("DELETE FROM quotas WHERE subject_type = ? AND subject = ?", subjectType, subject)
+    return err
+}
+
+func GetAllQuotas(db *DB) ([]Quota, error) {
+    rows, err := db.Query(`
+        SELECT subject_type, subject, max_domains, max_records_per_domain, max_total_records, updated_at
+        FROM quotas
+        ORDER BY subject_type, subject`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var quotas []Quota
+    for rows.Next() {
+        var q Quota
+        if err := rows.Scan(&q.SubjectType, &q.Subject, &q.MaxDomains, &q.MaxRecordsPerDomain,
+            &q.MaxTotalRecords, &q.UpdatedAt); err != nil {
+            return nil, err
+        }
+        quotas = append(quotas, q)
+    }
+    return quotas, nil
+}
+
+// GetQuota возвращает квоту пользователя, а если её нет — квоту роли.
+// found == false означает, что нужно использовать значения по умолчанию.
+func GetQuota(db *DB, userID int64, userRole string) (q Quota, found bool, err error) {
+    err = db.QueryRow(`
+        SELECT subject_type, subject, max_domains, max_records_per_domain, max_total_records, updated_at
+        FROM quotas
+        WHERE (subject_type = ? AND subject = ?) OR (subject_type = ? AND subject = ?)
+        ORDER BY CASE subject_type WHEN 'user' THEN 0 ELSE 1 END
+        LIMIT 1`,
+        PolicySubjectUser, strconv.FormatInt(userID, 10), PolicySubjectRole, userRole,
+    ).Scan(&q.SubjectType, &q.Subject, &q.MaxDomains, &q.MaxRecordsPerDomain, &q.MaxTotalRecords, &q.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return q, false, nil
+    }
+    if err != nil {
+        return q, false, err
+    }
+    return q, true, nil
+}
+
+// GetQuotaUsage считает личные домены пользователя и записи в них. Домены
+// организаций в личную квоту не входят.
+func GetQuotaUsage(db *DB, userID int64) (domains, totalRecords int, err error) {
+    err = db.QueryRow(`
+        SELECT (SELECT COUNT(*) FROM domains WHERE user_id = ? AND org_id IS NULL),
+               (SELECT COUNT(*) FROM records r JOIN domains d ON r.domain_id = d.id
+                WHERE d.user_id = ? AND d.org_id IS NULL)`,
+        userID, userID).Scan(&domains, &totalRecords)
+    return
+}
+
+func CountDomainRecords(db *DB, domainID int64) (int, error) {
+    var count int
+    err := db.QueryRow("SELECT COUNT(*) FROM records WHERE domain_id = ?", domainID).Scan(&count)
+    return count, err
+}
+
+// CreateRecordWithinQuota добавляет запись одним INSERT ... SELECT, условие которого
+// проверяет квоты. SQLite выполняет такой запрос атомарно, поэтому параллельные
+// запросы не могут вместе превысить лимит. Лимиты считаются по владельцу домена,
+// общий лимит записей — только по его личным доменам.
+func CreateRecordWithinQuota(db *DB, record *Record, maxPerDomain, maxTotal int) error {
+    result, err := db.Exec(`
+        INSERT INTO records (domain_id, type, name, content, priority, ttl)
+        SELECT ?, ?, ?, ?, ?, ?
+        WHERE (? = 0 OR (SELECT COUNT(*) FROM records WHERE domain_id = ?) < ?)
+          AND (? = 0 OR (SELECT COUNT(*) FROM records r JOIN domains d ON r.domain_id = d.id
+                         WHERE d.user_id = (SELECT user_id FROM domains WHERE id = ?) AND d.org_id IS NULL) < ?)`,
+        record.DomainID, record.Type, record.Name, record.Content, record.Priority, record.TTL,
+        maxPerDomain, record.DomainID, maxPerDomain,
+        maxTotal, record.DomainID, maxTotal,
+    )
+    if err != nil {
+        return err
+    }
+
+    n, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if n == 0 {
+        return ErrQuotaExceeded
+    }
+
+    record.ID, err = result.LastInsertId()
+    return err
+}
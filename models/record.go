@@ -9,6 +9,7 @@ type Record struct {
     DomainID int64
     Type     string
     Name     string
+    UnicodeName string // имя в Unicode, если оно содержит IDN метки
     Content  string
     Priority int
     TTL      int
@@ -38,11 +39,42 @@ func GetRecordsByDomainID(db *DB, domainID int64) ([]Record, error) {
         if err := rows.Scan(&r.ID, &r.DomainID, &r.Type, &r.Name, &r.Content, &r.Priority, &r.TTL); err != nil {
             return nil, err
         }
+        r.UnicodeName = UnicodeName(r.Name)
         records = append(records, r)
     }
     return records, nil
 }
 
+// GetUnquotedTXTRecords возвращает TXT записи, сохранённые до перехода на
+// формат файла зоны: значение без кавычек считалось одной строкой
+func GetUnquotedTXTRecords(db *DB) ([]Record, error) {
+    rows, err := db.Query(`
+        SELECT id, domain_id, type, name, content, priority, ttl
+        FROM records
+        WHERE type = 'TXT' AND substr(ltrim(content, ' ' || char(9)), 1, 1) != '"'
+        ORDER BY domain_id, id`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var records []Record
+    for rows.Next() {
+        var r Record
+        if err := rows.Scan(&r.ID, &r.DomainID, &r.Type, &r.Name, &r.Content, &r.Priority, &r.TTL); err != nil {
+            return nil, err
+        }
+        records = append(records, r)
+    }
+    return records, nil
+}
+
+// SetRecordContent меняет только значение записи
+func SetRecordContent(db *DB, id int64, content string) error {
+    _, err := db.Exec("UPDATE records SET content = ? WHERE id = ?", content, id)
+    return err
+}
+
 func GetRecordByID(db *DB, id int64) (*Record, error) {
     var r Record
     query := `SELECT id, domain_id, type, name, content, priority, ttl 
@@ -58,6 +90,7 @@ func GetRecordByID(db *DB, id int64) (*Record, error) {
     if err != nil {
         return nil, err
     }
+    r.UnicodeName = UnicodeName(r.Name)
     
     return &r, nil
 }
@@ -0,0 +1,78 @@
+package models
+
+// Capability — отдельное право в общей матрице ролей. Проверки в middleware,
+// обработчиках и моделях обращаются к матрице, а не сравнивают роль с "admin".
+type Capability string
+
+const (
+    CapAdminPanel      Capability = "admin_panel"       // вход в раздел администрирования
+    CapViewUsers       Capability = "view_users"        // список пользователей и их активность
+    CapManageUsers     Capability = "manage_users"      // создание, блокировка и удаление пользователей
+    CapViewSettings    Capability = "view_settings"
+    CapManageSettings  Capability = "manage_settings"
+    CapViewLogs        Capability = "view_logs"
+    CapViewZoneFiles   Capability = "view_zone_files"
+    CapViewPolicies    Capability = "view_policies"     // политики, квоты, защита записей
+    CapManagePolicies  Capability = "manage_policies"
+    CapReadAllDomains  Capability = "read_all_domains"  // чтение любых доменов и заявок
+    CapWriteAllDomains Capability = "write_all_domains" // изменение любых доменов в обход политик
+    CapSyncNSD         Capability = "sync_nsd"          // синхронизация и перезагрузка NSD для любого домена
+    CapEditDomains     Capability = "edit_domains"      // создание своих доменов и изменение записей
+)
+
+const (
+    RoleAuditor  UserRole = "auditor"
+    RoleOperator UserRole = "operator"
+    RoleViewer   UserRole = "viewer"
+)
+
+var roleCapabilities = map[UserRole][]Capability{
+    RoleAdmin: {
+        CapAdminPanel, CapViewUsers, CapManageUsers, CapViewSettings, CapManageSettings,
+        CapViewLogs, CapViewZoneFiles, CapViewPolicies, CapManagePolicies,
+        CapReadAllDomains, CapWriteAllDomains, CapSyncNSD, CapEditDomains,
+    },
+    // Аудитор видит всё, включая журналы и файлы зон, но ничего не меняет
+    RoleAuditor: {
+        CapAdminPanel, CapViewUsers, CapViewSettings, CapViewLogs, CapViewZoneFiles,
+        CapViewPolicies, CapReadAllDomains,
+    },
+    // Оператор обслуживает NSD, но не управляет пользователями и настройками
+    RoleOperator: {
+        CapAdminPanel, CapViewZoneFiles, CapReadAllDomains, CapSyncNSD, CapEditDomains,
+    },
+    RoleUser: {
+        CapEditDomains,
+    },
+    // Наблюдатель только читает домены, к которым ему выдан доступ
+    RoleViewer: {},
+}
+
+// RoleNames — названия ролей для интерфейса
+var RoleNames = map[UserRole]string{
+    RoleAdmin:    "Администратор",
+    RoleAuditor:  "Аудитор",
+    RoleOperator: "Оператор",
+    RoleUser:     "Пользователь",
+    RoleViewer:   "Наблюдатель",
+}
+
+func ValidRole(role string) bool {
+    _, ok := roleCapabilities[UserRole(role)]
+    return ok
+}
+
+// RoleCapabilities возвращает права роли. Неизвестная роль прав не имеет.
+func RoleCapabilities(role string) []Capability {
+    return append([]Capability(nil), roleCapabilities[UserRole(role)]...)
+}
+
+// RoleCan сообщает, есть ли у роли право. Неизвестная роль не имеет прав.
+func RoleCan(role string, c Capability) bool {
+    for _, have := range roleCapabilities[UserRole(role)] {
+        if have == c {
+            return true
+        }
+    }
+    return false
+}
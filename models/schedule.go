@@ -0,0 +1,202 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+const (
+    ScheduleStatusPending   = "pending"
+    ScheduleStatusRunning   = "running"
+    ScheduleStatusDone      = "done"
+    ScheduleStatusFailed    = "failed"
+    ScheduleStatusCancelled = "cancelled"
+)
+
+// ScheduledChange — изменение записи, которое должно быть применено в RunAt
+type ScheduledChange struct {
+    ID             int64
+    DomainID       int64
+    DomainName     string
+    RecordID       int64
+    Action         string
+    Type           string
+    Name           string
+    Content        string
+    Priority       int
+    TTL            int
+    RunAt          time.Time
+    Status         string
+    Error          string
+    CreatedBy      int64
+    CreatedByName  string
+    // Согласующий, одобривший задание по заявке; 0 — задание создано без заявки
+    ApprovedBy     int64
+    ApprovedByName string
+    CreatedAt      time.Time
+    ExecutedAt     *time.Time
+}
+
+func (c *ScheduledChange) Record() Record {
+    return Record{
+        ID:       c.RecordID,
+        DomainID: c.DomainID,
+        Type:     c.Type,
+        Name:     c.Name,
+        Content:  c.Content,
+        Priority: c.Priority,
+        TTL:      c.TTL,
+    }
+}
+
+func CreateScheduledChange(db *DB, c *ScheduledChange) error {
+    query := `INSERT INTO scheduled_changes (
+        domain_id, record_id, action, type, name, content, priority, ttl,
+        run_at, status, created_by, created_by_name, approved_by, approved_by_name, created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+    result, err := db.Exec(query,
+        c.DomainID, c.RecordID, c.Action, c.Type, c.Name, c.Content, c.Priority, c.TTL,
+        c.RunAt.UTC(), ScheduleStatusPending, c.CreatedBy, c.CreatedByName,
+        nullInt64(c.ApprovedBy), c.ApprovedByName, time.Now(),
+    )
+    if err != nil {
+        return err
+    }
+
+    c.ID, err = result.LastInsertId()
+    c.Status = ScheduleStatusPending
+    return err
+}
+
+const scheduledChangeColumns = `
+    s.id, s.domain_id, d.name, s.record_id, s.action, s.type, s.name, s.content,
+    s.priority, s.ttl, s.run_at, s.status, s.error, s.created_by, s.created_by_name,
+    COALESCE(s.approved_by, 0), COALESCE(s.approved_by_name, ''), s.created_at, s.executed_at`
+
+func scanScheduledChange(scanner interface{ Scan(...interface{}) error }) (*ScheduledChange, error) {
+    var c ScheduledChange
+    var errText sql.NullString
+    var executedAt sql.NullTime
+
+    err := scanner.Scan(
+        &c.ID, &c.DomainID, &c.DomainName, &c.RecordID, &c.Action, &c.Type, &c.Name, &c.Content,
+        &c.Priority, &c.TTL, &c.RunAt, &c.Status, &errText, &c.CreatedBy, &c.CreatedByName,
+        &c.ApprovedBy, &c.ApprovedByName, &c.CreatedAt, &executedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    c.Error = errText.String
+    if executedAt.Valid {
+        c.ExecutedAt = &executedAt.Time
+    }
+    return &c, nil
+}
+
+func queryScheduledChanges(db *DB, query string, args ...interface{}) ([]ScheduledChange, error) {
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var changes []ScheduledChange
+    for rows.Next() {
+        c, err := scanScheduledChange(rows)
+        if err != nil {
+            return nil, err
+        }
+        changes = append(changes, *c)
+    }
+    return changes, nil
+}
+
+func GetScheduledChangeByID(db *DB, id int64) (*ScheduledChange, error) {
+    row := db.QueryRow(`SELECT `+scheduledChangeColumns+`
+        FROM scheduled_changes s
+        JOIN domains d ON s.domain_id = d.id
+        WHERE s.id = ?`, id)
+
+    c, err := scanScheduledChange(row)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return c, err
+}
+
+// GetScheduledChanges возвращает задания: администратору все, остальным — по доступным доменам
+func GetScheduledChanges(db *DB, userID int64, userRole, status string) ([]ScheduledChange, error) {
+    query := `SELECT ` + scheduledChangeColumns + `
+        FROM scheduled_changes s
+        JOIN domains d ON s.domain_id = d.id
+        WHERE (? = '' OR s.status = ?)`
+    args := []interface{}{status, status}
+
+    if !RoleCan(userRole, CapReadAllDomains) {
+        query += ` AND (s.created_by = ? OR d.user_id = ?
+            OR s.domain_id IN (SELECT domain_id FROM domain_members WHERE user_id = ?)
+            OR d.org_id IN (SELECT org_id FROM org_members WHERE user_id = ?))`
+        args = append(args, userID, userID, userID, userID)
+    }
+    query += ` ORDER BY s.run_at`
+
+    return queryScheduledChanges(db, query, args...)
+}
+
+// GetDueScheduledChanges возвращает ожидающие задания, время которых наступило
+func GetDueScheduledChanges(db *DB, now time.Time) ([]ScheduledChange, error) {
+    return queryScheduledChanges(db, `SELECT `+scheduledChangeColumns+`
+        FROM scheduled_changes s
+        JOIN domains d ON s.domain_id = d.id
+        WHERE s.status = ? AND s.run_at <= ?
+        ORDER BY s.run_at, s.id`, ScheduleStatusPending, now.UTC())
+}
+
+// ClaimScheduledChange атомарно переводит задание из pending в running.
+// Возвращает false, если задание уже взято или отменено.
+func ClaimScheduledChange(db *DB, id int64) (bool, error) {
+    result, err := db.Exec(`UPDATE scheduled_changes SET status = ? WHERE id = ? AND status = ?`,
+        ScheduleStatusRunning, id, ScheduleStatusPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n > 0, nil
+}
+
+func FinishScheduledChange(db *DB, id int64, status, errText string) error {
+    _, err := db.Exec(`UPDATE scheduled_changes SET status = ?, error = ?, executed_at = ? WHERE id = ?`,
+        status, errText, time.Now(), id)
+    return err
+}
+
+// CancelScheduledChange отменяет задание, если оно ещё не начало выполняться
+func CancelScheduledChange(db *DB, id int64) (bool, error) {
+    result, err := db.Exec(`UPDATE scheduled_changes SET status = ? WHERE id = ? AND status = ?`,
+        ScheduleStatusCancelled, id, ScheduleStatusPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return n > 0, nil
+}
+
+// FailInterruptedScheduledChanges помечает как ошибочные задания, выполнение
+// которых было прервано остановкой сервера. Повторно их не запускаем:
+// часть изменения могла уже примениться.
+func FailInterruptedScheduledChanges(db *DB) (int64, error) {
+    result, err := db.Exec(`UPDATE scheduled_changes SET status = ?, error = ?, executed_at = ? WHERE status = ?`,
+        ScheduleStatusFailed, "выполнение прервано перезапуском сервера", time.Now(), ScheduleStatusRunning)
+    if err != nil {
+        return 0, err
+    }
+    return result.RowsAffected()
+}
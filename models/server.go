@@ -0,0 +1,266 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// Способы доставки зон на удалённый сервер
+const (
+    TransportSSH  = "ssh"  // scp и ssh с ключом из distribution.ssh_key
+    TransportHTTP = "http" // HTTP API агента на сервере
+    TransportPull = "pull" // агент сам забирает зоны с панели
+)
+
+// Действия и состояния копирования зоны
+const (
+    SyncPush    = "push"
+    SyncRemove  = "remove"
+    SyncPending = "pending"
+    SyncRunning = "running"
+    SyncFailed  = "failed"
+    SyncDone    = "synced"
+)
+
+// DNSServer — удалённый NSD сервер, на который панель копирует файлы зон
+// и zones.conf. Токен агента хранится зашифрованным и сюда не загружается.
+type DNSServer struct {
+    ID             int64
+    Name           string
+    Transport      string
+    Address        string // [user@]host[:port] для ssh, URL агента для http, для pull не нужен
+    ZoneDir        string // каталог файлов зон на сервере
+    ConfPath       string // путь к zones.conf на сервере
+    Enabled        bool
+    LastCheckAt    *time.Time
+    LastCheckError string
+    CreatedAt      time.Time
+}
+
+// ServerSync — состояние зоны на удалённом сервере
+type ServerSync struct {
+    ServerID      int64
+    Zone          string // пустое имя — zones.conf
+    Action        string
+    Serial        int64
+    State         string
+    Attempts      int
+    NextAttemptAt time.Time
+    LastError     string
+    SyncedAt      *time.Time
+}
+
+func CreateDNSServer(db *DB, s *DNSServer, encryptedToken string) error {
+    s.CreatedAt = time.Now()
+    result, err := db.Exec(`
+        INSERT INTO dns_servers (name, transport, address, zone_dir, conf_path, token, enabled, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+        s.Name, s.Transport, s.Address, s.ZoneDir, s.ConfPath, encryptedToken, s.Enabled, s.CreatedAt)
+    if err != nil {
+        return err
+    }
+    s.ID, err = result.LastInsertId()
+    return err
+}
+
+// SetDNSServerEnabled включает или выключает копирование на сервер
+func SetDNSServerEnabled(db *DB, id int64, enabled bool) error {
+    _, err := db.Exec("UPDATE dns_servers SET enabled = ? WHERE id = ?", enabled, id)
+    return err
+}
+
+// DeleteDNSServer удаляет сервер вместе с состоянием его зон
+func DeleteDNSServer(db *DB, id int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM server_sync WHERE server_id = ?", id); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("DELETE FROM dns_servers WHERE id = ?", id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// SaveDNSServerCheck сохраняет результат проверки доступности сервера
+func SaveDNSServerCheck(db *DB, id int64, checkErr string) error {
+    _, err := db.Exec("UPDATE dns_servers SET last_check_at = ?, last_check_error = ? WHERE id = ?",
+        time.Now(), checkErr, id)
+    return err
+}
+
+func queryDNSServers(db *DB, query string, args ...interface{}) ([]DNSServer, error) {
+    rows, err := db.Query(`
+        SELECT id, name, transport, address, zone_dir, conf_path, enabled,
+               last_check_at, COALESCE(last_check_error, ''), created_at
+        FROM dns_servers `+query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var servers []DNSServer
+    for rows.Next() {
+        var s DNSServer
+        var checkedAt sql.NullTime
+        if err := rows.Scan(&s.ID, &s.Name, &s.Transport, &s.Address, &s.ZoneDir, &s.ConfPath,
+            &s.Enabled, &checkedAt, &s.LastCheckError, &s.CreatedAt); err != nil {
+            return nil, err
+        }
+        if checkedAt.Valid {
+            s.LastCheckAt = &checkedAt.Time
+        }
+        servers = append(servers, s)
+    }
+    return servers, nil
+}
+
+func GetDNSServers(db *DB) ([]DNSServer, error) {
+    return queryDNSServers(db, "ORDER BY name")
+}
+
+func GetEnabledDNSServers(db *DB) ([]DNSServer, error) {
+    return queryDNSServers(db, "WHERE enabled = 1 ORDER BY name")
+}
+
+func GetDNSServerByID(db *DB, id int64) (*DNSServer, error) {
+    servers, err := queryDNSServers(db, "WHERE id = ?", id)
+    if err != nil || len(servers) == 0 {
+        return nil, err
+    }
+    return &servers[0], nil
+}
+
+func GetDNSServerByName(db *DB, name string) (*DNSServer, error) {
+    servers, err := queryDNSServers(db, "WHERE name = ?", name)
+    if err != nil || len(servers) == 0 {
+        return nil, err
+    }
+    return &servers[0], nil
+}
+
+// GetDNSServerToken возвращает зашифрованный токен агента
+func GetDNSServerToken(db *DB, id int64) (string, error) {
+    var token string
+    err := db.QueryRow("SELECT COALESCE(token, '') FROM dns_servers WHERE id = ?", id).Scan(&token)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    return token, err
+}
+
+// QueueServerSync ставит зону в очередь на копирование. Уже ожидающая
+// запись заменяется: на сервер всегда уходит последнее состояние зоны.
+func QueueServerSync(db *DB, serverID int64, zone, action string, serial int64) error {
+    _, err := db.Exec(`
+        INSERT INTO server_sync (server_id, zone, action, serial, state, attempts, next_attempt_at, last_error)
+        VALUES (?, ?, ?, ?, ?, 0, ?, '')
+        ON CONFLICT(server_id, zone) DO UPDATE SET
+            action = excluded.action, serial = excluded.serial, state = excluded.state,
+            attempts = 0, next_attempt_at = excluded.next_attempt_at, last_error = ''`,
+        serverID, zone, action, serial, SyncPending, time.Now())
+    return err
+}
+
+// MarkServerSynced отмечает зону скопированной. Удалённая зона убирается из таблицы.
+func MarkServerSynced(db *DB, s *ServerSync) error {
+    if s.Action == SyncRemove {
+        _, err := db.Exec("DELETE FROM server_sync WHERE server_id = ? AND zone = ? AND action = ? AND state != ?",
+            s.ServerID, s.Zone, SyncRemove, SyncPending)
+        return err
+    }
+    // Если зону поставили в очередь заново, пока шло копирование, запись не трогается
+    _, err := db.Exec(`
+        UPDATE server_sync SET state = ?, attempts = 0, last_error = '', synced_at = ?
+        WHERE server_id = ? AND zone = ? AND action = ? AND serial = ? AND state != ?`,
+        SyncDone, time.Now(), s.ServerID, s.Zone, s.Action, s.Serial, SyncPending)
+    return err
+}
+
+// MarkServerSyncFailed сохраняет ошибку и время следующей попытки
+func MarkServerSyncFailed(db *DB, s *ServerSync, syncErr string, next time.Time) error {
+    _, err := db.Exec(`
+        UPDATE server_sync SET state = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+        WHERE server_id = ? AND zone = ? AND action = ? AND serial = ? AND state != ?`,
+        SyncFailed, syncErr, next, s.ServerID, s.Zone, s.Action, s.Serial, SyncPending)
+    return err
+}
+
+// StartServerSync переводит задание в работу. Возвращает false, если его уже
+// заменило более новое.
+func StartServerSync(db *DB, s *ServerSync) (bool, error) {
+    result, err := db.Exec(`
+        UPDATE server_sync SET state = ?
+        WHERE server_id = ? AND zone = ? AND action = ? AND serial = ? AND state != ?`,
+        SyncRunning, s.ServerID, s.Zone, s.Action, s.Serial, SyncDone)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// ResetRunningServerSync возвращает в очередь задания, прерванные перезапуском
+func ResetRunningServerSync(db *DB) error {
+    _, err := db.Exec("UPDATE server_sync SET state = ? WHERE state = ?", SyncPending, SyncRunning)
+    return err
+}
+
+func queryServerSync(db *DB, query string, args ...interface{}) ([]ServerSync, error) {
+    rows, err := db.Query(`
+        SELECT server_id, zone, action, serial, state, attempts, next_attempt_at,
+               COALESCE(last_error, ''), synced_at
+        FROM server_sync `+query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var list []ServerSync
+    for rows.Next() {
+        var s ServerSync
+        var syncedAt sql.NullTime
+        if err := rows.Scan(&s.ServerID, &s.Zone, &s.Action, &s.Serial, &s.State, &s.Attempts,
+            &s.NextAttemptAt, &s.LastError, &syncedAt); err != nil {
+            return nil, err
+        }
+        if syncedAt.Valid {
+            s.SyncedAt = &syncedAt.Time
+        }
+        list = append(list, s)
+    }
+    return list, nil
+}
+
+// GetDueServerSync возвращает задания включённых серверов, время которых пришло.
+// Серверы с агентом в режиме pull забирают зоны сами и сюда не попадают.
+func GetDueServerSync(db *DB, now time.Time) ([]ServerSync, error) {
+    return queryServerSync(db, `
+        WHERE state IN (?, ?) AND next_attempt_at <= ?
+          AND server_id IN (SELECT id FROM dns_servers WHERE enabled = 1 AND transport != ?)
+        ORDER BY server_id, zone`, SyncPending, SyncFailed, now, TransportPull)
+}
+
+// ConfirmServerSync отмечает задание выполненным по отчёту агента: зона
+// применена с serial не меньше ожидаемого. Удалённая зона убирается из таблицы.
+func ConfirmServerSync(db *DB, serverID int64, zone, action string, serial int64) error {
+    if action == SyncRemove {
+        _, err := db.Exec("DELETE FROM server_sync WHERE server_id = ? AND zone = ? AND action = ?",
+            serverID, zone, SyncRemove)
+        return err
+    }
+    _, err := db.Exec(`
+        UPDATE server_sync SET state = ?, attempts = 0, last_error = '', synced_at = ?
+        WHERE server_id = ? AND zone = ? AND action = ? AND serial <= ? AND state != ?`,
+        SyncDone, time.Now(), serverID, zone, action, serial, SyncDone)
+    return err
+}
+
+// GetServerSync возвращает состояние всех зон сервера
+func GetServerSync(db *DB, serverID int64) ([]ServerSync, error) {
+    return queryServerSync(db, "WHERE server_id = ? ORDER BY zone", serverID)
+}
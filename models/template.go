@@ -0,0 +1,149 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// RecordTemplate — набор записей, которые можно добавить в домен одним действием.
+// В имени и значении записей допускаются подстановки {{domain}} и {{ip}}.
+type RecordTemplate struct {
+    ID        int64
+    Name      string
+    OwnerID   int64 // 0 — общий шаблон, созданный администратором
+    OwnerName string
+    Records   []TemplateRecord
+    CreatedAt time.Time
+}
+
+type TemplateRecord struct {
+    Type     string
+    Name     string
+    Content  string
+    Priority int
+    TTL      int // 0 — TTL по умолчанию
+}
+
+func CreateRecordTemplate(db *DB, t *RecordTemplate) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    result, err := tx.Exec("INSERT INTO record_templates (name, owner_id, created_at) VALUES (?, ?, ?)",
+        t.Name, t.OwnerID, time.Now())
+    if err != nil {
+        return err
+    }
+    if t.ID, err = result.LastInsertId(); err != nil {
+        return err
+    }
+
+    for _, rec := range t.Records {
+        if _, err := tx.Exec(`INSERT INTO template_records (template_id, type, name, content, priority, ttl)
+                              VALUES (?, ?, ?, ?, ?, ?)`,
+            t.ID, rec.Type, rec.Name, rec.Content, rec.Priority, rec.TTL); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+func DeleteRecordTemplate(db *DB, id int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM template_records WHERE template_id = ?", id); err != nil {
+        return err
+    }
+    if _, err := tx.Exec("DELETE FROM record_templates WHERE id = ?", id); err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+func getTemplateRecords(db *DB, templateID int64) ([]TemplateRecord, error) {
+    rows, err := db.Query(`SELECT type, name, content, priority, ttl FROM template_records
+                           WHERE template_id = ? ORDER BY id`, templateID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var records []TemplateRecord
+    for rows.Next() {
+        var rec TemplateRecord
+        if err := rows.Scan(&rec.Type, &rec.Name, &rec.Content, &rec.Priority, &rec.TTL); err != nil {
+            return nil, err
+        }
+        records = append(records, rec)
+    }
+    return records, rows.Err()
+}
+
+func GetRecordTemplateByID(db *DB, id int64) (*RecordTemplate, error) {
+    var t RecordTemplate
+    err := db.QueryRow(`
+        SELECT t.id, t.name, t.owner_id, COALESCE(u.username, ''), t.created_at
+        FROM record_templates t
+        LEFT JOIN users u ON u.id = t.owner_id
+        WHERE t.id = ?`, id).Scan(&t.ID, &t.Name, &t.OwnerID, &t.OwnerName, &t.CreatedAt)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    t.Records, err = getTemplateRecords(db, t.ID)
+    if err != nil {
+        return nil, err
+    }
+    return &t, nil
+}
+
+// GetRecordTemplates возвращает общие шаблоны и шаблоны пользователя,
+// а ролям с CapReadAllDomains — все шаблоны
+func GetRecordTemplates(db *DB, userID int64, userRole string) ([]RecordTemplate, error) {
+    query := `SELECT t.id, t.name, t.owner_id, COALESCE(u.username, ''), t.created_at
+              FROM record_templates t
+              LEFT JOIN users u ON u.id = t.owner_id`
+    var args []interface{}
+    if !RoleCan(userRole, CapReadAllDomains) {
+        query += ` WHERE t.owner_id = 0 OR t.owner_id = ?`
+        args = append(args, userID)
+    }
+    query += ` ORDER BY t.owner_id, t.name`
+
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+
+    var templates []RecordTemplate
+    for rows.Next() {
+        var t RecordTemplate
+        if err := rows.Scan(&t.ID, &t.Name, &t.OwnerID, &t.OwnerName, &t.CreatedAt); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        templates = append(templates, t)
+    }
+    rows.Close()
+
+    for i := range templates {
+        if templates[i].Records, err = getTemplateRecords(db, templates[i].ID); err != nil {
+            return nil, err
+        }
+    }
+    return templates, nil
+}
+
+// CanUseTemplate: общими шаблонами пользуются все, личными — только владелец
+func CanUseTemplate(t *RecordTemplate, userID int64, userRole string) bool {
+    return t.OwnerID == 0 || t.OwnerID == userID || RoleCan(userRole, CapReadAllDomains)
+}
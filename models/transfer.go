@@ -0,0 +1,175 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// Статусы передачи домена
+const (
+    TransferPending   = "pending"
+    TransferAccepted  = "accepted"
+    TransferDeclined  = "declined"
+    TransferCancelled = "cancelled"
+)
+
+type DomainTransfer struct {
+    ID           int64
+    DomainID     int64
+    DomainName   string
+    FromUserID   int64
+    FromUsername string
+    ToUserID     int64
+    ToUsername   string
+    Status       string
+    CreatedAt    time.Time
+    ResolvedAt   *time.Time
+}
+
+const domainTransferColumns = `t.id, t.domain_id, d.name, t.from_user_id, COALESCE(uf.username, ''),
+    t.to_user_id, COALESCE(ut.username, ''), t.status, t.created_at, t.resolved_at`
+
+const domainTransferJoins = `
+    FROM domain_transfers t
+    JOIN domains d ON t.domain_id = d.id
+    LEFT JOIN users uf ON t.from_user_id = uf.id
+    LEFT JOIN users ut ON t.to_user_id = ut.id`
+
+func scanDomainTransfer(scanner interface{ Scan(...interface{}) error }) (*DomainTransfer, error) {
+    var t DomainTransfer
+    var resolvedAt sql.NullTime
+    if err := scanner.Scan(&t.ID, &t.DomainID, &t.DomainName, &t.FromUserID, &t.FromUsername,
+        &t.ToUserID, &t.ToUsername, &t.Status, &t.CreatedAt, &resolvedAt); err != nil {
+        return nil, err
+    }
+    if resolvedAt.Valid {
+        t.ResolvedAt = &resolvedAt.Time
+    }
+    return &t, nil
+}
+
+// CreateDomainTransfer создаёт предложение передачи. Предыдущие ожидающие
+// предложения по этому домену отменяются: активным может быть только одно.
+func CreateDomainTransfer(db *DB, t *DomainTransfer) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    now := time.Now()
+    if _, err := tx.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                          WHERE domain_id = ? AND status = ?`,
+        TransferCancelled, now, t.DomainID, TransferPending); err != nil {
+        return err
+    }
+
+    result, err := tx.Exec(`INSERT INTO domain_transfers (domain_id, from_user_id, to_user_id, status, created_at)
+                            VALUES (?, ?, ?, ?, ?)`,
+        t.DomainID, t.FromUserID, t.ToUserID, TransferPending, now)
+    if err != nil {
+        return err
+    }
+    t.ID, err = result.LastInsertId()
+    if err != nil {
+        return err
+    }
+    t.Status = TransferPending
+    t.CreatedAt = now
+    return tx.Commit()
+}
+
+func GetDomainTransferByID(db *DB, id int64) (*DomainTransfer, error) {
+    t, err := scanDomainTransfer(db.QueryRow(`SELECT `+domainTransferColumns+domainTransferJoins+`
+        WHERE t.id = ?`, id))
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    return t, err
+}
+
+// GetPendingTransfers возвращает входящие и исходящие ожидающие предложения пользователя
+func GetPendingTransfers(db *DB, userID int64) ([]DomainTransfer, error) {
+    rows, err := db.Query(`SELECT `+domainTransferColumns+domainTransferJoins+`
+        WHERE t.status = ? AND (t.to_user_id = ? OR t.from_user_id = ?)
+        ORDER BY t.created_at DESC`, TransferPending, userID, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var transfers []DomainTransfer
+    for rows.Next() {
+        t, err := scanDomainTransfer(rows)
+        if err != nil {
+            return nil, err
+        }
+        transfers = append(transfers, *t)
+    }
+    return transfers, nil
+}
+
+// ResolveDomainTransfer закрывает ожидающее предложение без передачи домена.
+// false — предложение уже закрыто.
+func ResolveDomainTransfer(db *DB, id int64, status string) (bool, error) {
+    result, err := db.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                            WHERE id = ? AND status = ?`, status, time.Now(), id, TransferPending)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+// TransferDomainOwnership делает пользователя личным владельцем домена. Домен
+// выходит из организации, прежний владелец теряет доступ, а членство нового
+// владельца в domain_members становится лишним и удаляется. Если передана
+// transferID, предложение помечается принятым в той же транзакции; если оно
+// уже закрыто, передача не выполняется. maxDomains > 0 ограничивает число
+// доменов получателя, как при создании домена.
+func TransferDomainOwnership(db *DB, domainID, toUserID, transferID int64, maxDomains int) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    now := time.Now()
+    if transferID != 0 {
+        result, err := tx.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                                WHERE id = ? AND status = ?`, TransferAccepted, now, transferID, TransferPending)
+        if err != nil {
+            return err
+        }
+        if n, err := result.RowsAffected(); err != nil {
+            return err
+        } else if n == 0 {
+            return sql.ErrNoRows
+        }
+    }
+
+    result, err := tx.Exec(`UPDATE domains SET user_id = ?, org_id = NULL
+        WHERE id = ? AND (? = 0 OR (SELECT COUNT(*) FROM domains WHERE user_id = ? AND org_id IS NULL AND id != ?) < ?)`,
+        toUserID, domainID, maxDomains, toUserID, domainID, maxDomains)
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); err != nil {
+        return err
+    } else if n == 0 {
+        return ErrQuotaExceeded
+    }
+
+    if _, err := tx.Exec("DELETE FROM domain_members WHERE domain_id = ? AND user_id = ?", domainID, toUserID); err != nil {
+        return err
+    }
+
+    // Остальные предложения по домену теряют смысл
+    if _, err := tx.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                          WHERE domain_id = ? AND status = ?`,
+        TransferCancelled, now, domainID, TransferPending); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
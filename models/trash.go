@@ -0,0 +1,138 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// TrashDomain переносит домен в корзину: запись и её данные остаются в БД до
+// восстановления или очистки. Ожидающие передачи домена отменяются.
+func TrashDomain(db *DB, id, deletedBy int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // Время храним в UTC, чтобы сравнение строк в SQLite совпадало с хронологией
+    now := time.Now().UTC()
+    result, err := tx.Exec("UPDATE domains SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL",
+        now, deletedBy, id)
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); err != nil {
+        return err
+    } else if n == 0 {
+        return sql.ErrNoRows
+    }
+
+    if _, err := tx.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                          WHERE domain_id = ? AND status = ?`,
+        TransferCancelled, now, id, TransferPending); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// RestoreDomain возвращает домен из корзины. false — домен не в корзине.
+func RestoreDomain(db *DB, id int64) (bool, error) {
+    result, err := db.Exec("UPDATE domains SET deleted_at = NULL, deleted_by = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+    if err != nil {
+        return false, err
+    }
+    n, err := result.RowsAffected()
+    return n > 0, err
+}
+
+const trashedDomainColumns = `d.id, d.name, d.user_id, d.soa_email, d.soa_primary_ns,
+    d.soa_refresh, d.soa_retry, d.soa_expire, d.soa_minimum,
+    d.serial, d.created_at, d.org_id, COALESCE(o.name, ''), COALESCE(u.username, ''), d.deleted_at`
+
+func queryTrashedDomains(db *DB, query string, args ...interface{}) ([]Domain, error) {
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var domains []Domain
+    for rows.Next() {
+        var d Domain
+        var orgID sql.NullInt64
+        var deletedAt time.Time
+        if err := rows.Scan(
+            &d.ID, &d.Name, &d.UserID, &d.SOAEmail, &d.SOAPrimaryNS,
+            &d.SOARefresh, &d.SOARetry, &d.SOAExpire, &d.SOAMinimum,
+            &d.Serial, &d.CreatedAt, &orgID, &d.OrgName, &d.OwnerName, &deletedAt,
+        ); err != nil {
+            return nil, err
+        }
+        d.OrgID = orgID.Int64
+        d.UnicodeName = UnicodeName(d.Name)
+        if d.OrgID != 0 {
+            d.OwnerName = d.OrgName
+        }
+        d.DeletedAt = &deletedAt
+        domains = append(domains, d)
+    }
+    return domains, nil
+}
+
+// GetTrashedDomains возвращает домены в корзине: ролям с CapReadAllDomains все,
+// остальным — те, которыми они управляли (личный владелец или владелец организации)
+func GetTrashedDomains(db *DB, userID int64, userRole string) ([]Domain, error) {
+    query := `SELECT ` + trashedDomainColumns + `
+        FROM domains d
+        LEFT JOIN users u ON d.user_id = u.id
+        LEFT JOIN organizations o ON o.id = d.org_id
+        WHERE d.deleted_at IS NOT NULL`
+    var args []interface{}
+    if !RoleCan(userRole, CapReadAllDomains) {
+        query += ` AND ((d.user_id = ? AND d.org_id IS NULL)
+            OR d.id IN (SELECT domain_id FROM domain_members WHERE user_id = ? AND role = ?)
+            OR d.org_id IN (SELECT org_id FROM org_members WHERE user_id = ? AND role = ?))`
+        args = append(args, userID, userID, MemberOwner, userID, MemberOwner)
+    }
+    query += ` ORDER BY d.deleted_at DESC`
+    return queryTrashedDomains(db, query, args...)
+}
+
+// GetTrashedDomainByID возвращает домен, только если он в корзине
+func GetTrashedDomainByID(db *DB, id int64) (*Domain, error) {
+    domains, err := queryTrashedDomains(db, `SELECT `+trashedDomainColumns+`
+        FROM domains d
+        LEFT JOIN users u ON d.user_id = u.id
+        LEFT JOIN organizations o ON o.id = d.org_id
+        WHERE d.id = ? AND d.deleted_at IS NOT NULL`, id)
+    if err != nil || len(domains) == 0 {
+        return nil, err
+    }
+    return &domains[0], nil
+}
+
+// GetExpiredTrashedDomains возвращает домены, удалённые раньше указанного момента
+func GetExpiredTrashedDomains(db *DB, before time.Time) ([]Domain, error) {
+    return queryTrashedDomains(db, `SELECT `+trashedDomainColumns+`
+        FROM domains d
+        LEFT JOIN users u ON d.user_id = u.id
+        LEFT JOIN organizations o ON o.id = d.org_id
+        WHERE d.deleted_at IS NOT NULL AND d.deleted_at < ?`, before.UTC())
+}
+
+// CanManageTrashedDomain проверяет права на домен в корзине так же, как
+// CanAccessDomain для активных доменов
+func CanManageTrashedDomain(db *DB, userID int64, userRole string, domainID int64, perm Permission) (bool, error) {
+    if RoleCan(userRole, CapWriteAllDomains) || perm == PermRead && RoleCan(userRole, CapReadAllDomains) {
+        return true, nil
+    }
+    if perm > PermRead && !RoleCan(userRole, CapEditDomains) {
+        return false, nil
+    }
+    role, err := domainRole(db, userID, domainID, true)
+    if err != nil {
+        return false, err
+    }
+    return memberRoleAllows(role, perm), nil
+}
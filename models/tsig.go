@@ -0,0 +1,161 @@
+package models
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+)
+
+// TSIGKey — общий ключ для подписи передачи зон и NOTIFY. Секрет хранится
+// зашифрованным и в эту структуру не загружается.
+type TSIGKey struct {
+    ID        int64
+    Name      string
+    Algorithm string // hmac-sha256 или hmac-sha512
+    CreatedAt time.Time
+    RotatedAt *time.Time
+}
+
+// TSIGKeySecret — ключ вместе с зашифрованным секретом
+type TSIGKeySecret struct {
+    Name            string
+    Algorithm       string
+    EncryptedSecret string
+}
+
+func CreateTSIGKey(db *DB, k *TSIGKey, encryptedSecret string) error {
+    k.CreatedAt = time.Now()
+    result, err := db.Exec("INSERT INTO tsig_keys (name, algorithm, secret, created_at) VALUES (?, ?, ?, ?)",
+        k.Name, k.Algorithm, encryptedSecret, k.CreatedAt)
+    if err != nil {
+        return err
+    }
+    k.ID, err = result.LastInsertId()
+    return err
+}
+
+// RotateTSIGKey заменяет секрет ключа
+func RotateTSIGKey(db *DB, id int64, encryptedSecret string) error {
+    _, err := db.Exec("UPDATE tsig_keys SET secret = ?, rotated_at = ? WHERE id = ?", encryptedSecret, time.Now(), id)
+    return err
+}
+
+func DeleteTSIGKey(db *DB, id int64) error {
+    _, err := db.Exec("DELETE FROM tsig_keys WHERE id = ?", id)
+    return err
+}
+
+func queryTSIGKeys(db *DB, query string, args ...interface{}) ([]TSIGKey, error) {
+    rows, err := db.Query("SELECT id, name, algorithm, created_at, rotated_at FROM tsig_keys "+query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var keys []TSIGKey
+    for rows.Next() {
+        var k TSIGKey
+        var rotatedAt sql.NullTime
+        if err := rows.Scan(&k.ID, &k.Name, &k.Algorithm, &k.CreatedAt, &rotatedAt); err != nil {
+            return nil, err
+        }
+        if rotatedAt.Valid {
+            k.RotatedAt = &rotatedAt.Time
+        }
+        keys = append(keys, k)
+    }
+    return keys, nil
+}
+
+func GetTSIGKeys(db *DB) ([]TSIGKey, error) {
+    return queryTSIGKeys(db, "ORDER BY name")
+}
+
+func GetTSIGKeyByID(db *DB, id int64) (*TSIGKey, error) {
+    keys, err := queryTSIGKeys(db, "WHERE id = ?", id)
+    if err != nil || len(keys) == 0 {
+        return nil, err
+    }
+    return &keys[0], nil
+}
+
+// GetTSIGKeyByName ищет ключ без учёта регистра: имена TSIG ключей — доменные имена
+func GetTSIGKeyByName(db *DB, name string) (*TSIGKey, error) {
+    keys, err := queryTSIGKeys(db, "WHERE name = ? COLLATE NOCASE", name)
+    if err != nil || len(keys) == 0 {
+        return nil, err
+    }
+    return &keys[0], nil
+}
+
+func GetTSIGKeySecret(db *DB, name string) (*TSIGKeySecret, error) {
+    var k TSIGKeySecret
+    err := db.QueryRow("SELECT name, algorithm, secret FROM tsig_keys WHERE name = ? COLLATE NOCASE", name).
+        Scan(&k.Name, &k.Algorithm, &k.EncryptedSecret)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &k, nil
+}
+
+// GetTSIGKeySecrets возвращает все ключи с секретами, используется при генерации конфига NSD
+func GetTSIGKeySecrets(db *DB) ([]TSIGKeySecret, error) {
+    rows, err := db.Query("SELECT name, algorithm, secret FROM tsig_keys ORDER BY name")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var keys []TSIGKeySecret
+    for rows.Next() {
+        var k TSIGKeySecret
+        if err := rows.Scan(&k.Name, &k.Algorithm, &k.EncryptedSecret); err != nil {
+            return nil, err
+        }
+        keys = append(keys, k)
+    }
+    return keys, nil
+}
+
+// TSIGKeyUsage возвращает, где используется ключ: вторичные зоны (включая
+// домены в корзине — их можно восстановить) и серверы передачи зон
+func TSIGKeyUsage(db *DB, name string) ([]string, error) {
+    var usage []string
+
+    rows, err := db.Query("SELECT name FROM domains WHERE tsig_key = ? COLLATE NOCASE ORDER BY name", name)
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var domain string
+        if err := rows.Scan(&domain); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        usage = append(usage, "вторичная зона "+domain)
+    }
+    rows.Close()
+
+    rows, err = db.Query(`SELECT t.address, COALESCE(d.name, '') FROM xfr_targets t
+                          LEFT JOIN domains d ON d.id = t.domain_id
+                          WHERE t.tsig_key = ? COLLATE NOCASE ORDER BY t.domain_id, t.id`, name)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var address, domain string
+        if err := rows.Scan(&address, &domain); err != nil {
+            return nil, err
+        }
+        if domain == "" {
+            usage = append(usage, "глобальный сервер "+address)
+        } else {
+            usage = append(usage, fmt.Sprintf("сервер %s зоны %s", address, domain))
+        }
+    }
+    return usage, nil
+}
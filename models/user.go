@@ -2,6 +2,7 @@ package models
 
 import (
     "database/sql"
+    "fmt"
     "time"
 )
 
@@ -42,6 +43,9 @@ type UserAction struct {
     Details   string
     IP        string
     CreatedAt time.Time
+    // Администратор, выполнивший действие от имени пользователя (0 — действовал сам пользователь)
+    ImpersonatorID   int64
+    ImpersonatorName string
 }
 
 func CreateUser(db *DB, user *User) error {
@@ -165,9 +169,183 @@ func UpdateUserStatus(db *DB, userID int64, active bool) error {
     return err
 }
 
-func DeleteUser(db *DB, userID int64) error {
-    _, err := db.Exec("DELETE FROM users WHERE id = ?", userID)
-    return err
+// UserDeletionImpact описывает, что затронет удаление пользователя
+type UserDeletionImpact struct {
+    Domains           []Domain // личные домены, включая находящиеся в корзине
+    RecordCount       int      // записей в этих доменах
+    OrgMemberships    int
+    DomainMemberships int
+    SoleOwnerOrgs     []string // организации, которые останутся без владельца
+    PendingTransfers  int
+    // OrgDomains — домены организаций, записанные на пользователя. Они
+    // переходят новому владельцу личных доменов, а если личные домены
+    // удаляются — участнику организации из OwnerName.
+    OrgDomains []Domain
+}
+
+// orgSuccessorQuery выбирает участника организации домена, кроме удаляемого
+// пользователя, на которого записываются её домены: сначала владельцев
+const orgSuccessorQuery = `
+    SELECT m.user_id FROM org_members m
+    WHERE m.org_id = %s AND m.user_id != ?
+    ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, m.created_at
+    LIMIT 1`
+
+func GetUserDeletionImpact(db *DB, userID int64) (*UserDeletionImpact, error) {
+    impact := &UserDeletionImpact{}
+
+    rows, err := db.Query(`SELECT id, name, deleted_at FROM domains
+                           WHERE user_id = ? AND org_id IS NULL ORDER BY name`, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var d Domain
+        var deletedAt sql.NullTime
+        if err := rows.Scan(&d.ID, &d.Name, &deletedAt); err != nil {
+            return nil, err
+        }
+        if deletedAt.Valid {
+            d.DeletedAt = &deletedAt.Time
+        }
+        d.UserID = userID
+        impact.Domains = append(impact.Domains, d)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    err = db.QueryRow(`
+        SELECT (SELECT COUNT(*) FROM records WHERE domain_id IN
+                   (SELECT id FROM domains WHERE user_id = ? AND org_id IS NULL)),
+               (SELECT COUNT(*) FROM org_members WHERE user_id = ?),
+               (SELECT COUNT(*) FROM domain_members WHERE user_id = ?),
+               (SELECT COUNT(*) FROM domain_transfers
+                WHERE status = ? AND (from_user_id = ? OR to_user_id = ?))`,
+        userID, userID, userID, TransferPending, userID, userID,
+    ).Scan(&impact.RecordCount, &impact.OrgMemberships, &impact.DomainMemberships, &impact.PendingTransfers)
+    if err != nil {
+        return nil, err
+    }
+
+    orgRows, err := db.Query(`
+        SELECT o.name FROM org_members m
+        JOIN organizations o ON o.id = m.org_id
+        WHERE m.user_id = ? AND m.role = ?
+          AND (SELECT COUNT(*) FROM org_members x WHERE x.org_id = m.org_id AND x.role = ?) = 1
+        ORDER BY o.name`, userID, MemberOwner, MemberOwner)
+    if err != nil {
+        return nil, err
+    }
+    defer orgRows.Close()
+    for orgRows.Next() {
+        var name string
+        if err := orgRows.Scan(&name); err != nil {
+            return nil, err
+        }
+        impact.SoleOwnerOrgs = append(impact.SoleOwnerOrgs, name)
+    }
+    if err := orgRows.Err(); err != nil {
+        return nil, err
+    }
+
+    domainRows, err := db.Query(`
+        SELECT d.id, d.name, d.org_id, o.name, COALESCE(u.id, 0), COALESCE(u.username, ''), d.deleted_at
+        FROM domains d
+        JOIN organizations o ON o.id = d.org_id
+        LEFT JOIN users u ON u.id = (`+fmt.Sprintf(orgSuccessorQuery, "d.org_id")+`)
+        WHERE d.user_id = ? AND d.org_id IS NOT NULL
+        ORDER BY d.name`, userID, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer domainRows.Close()
+    for domainRows.Next() {
+        var d Domain
+        var deletedAt sql.NullTime
+        if err := domainRows.Scan(&d.ID, &d.Name, &d.OrgID, &d.OrgName, &d.UserID, &d.OwnerName, &deletedAt); err != nil {
+            return nil, err
+        }
+        if deletedAt.Valid {
+            d.DeletedAt = &deletedAt.Time
+        }
+        impact.OrgDomains = append(impact.OrgDomains, d)
+    }
+    return impact, domainRows.Err()
+}
+
+// DeleteUser удаляет пользователя вместе с его членством в организациях и доменах.
+// Личные домены передаются пользователю reassignTo, а если он равен 0 —
+// удаляются со всеми данными. Домены организаций остаются за организацией
+// и записываются на reassignTo или на участника организации.
+func DeleteUser(db *DB, userID, reassignTo int64) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if reassignTo != 0 {
+        // Членство нового владельца в переданных доменах становится лишним
+        if _, err := tx.Exec(`DELETE FROM domain_members WHERE user_id = ? AND domain_id IN
+                              (SELECT id FROM domains WHERE user_id = ? AND org_id IS NULL)`,
+            reassignTo, userID); err != nil {
+            return err
+        }
+        if _, err := tx.Exec("UPDATE domains SET user_id = ? WHERE user_id = ? AND org_id IS NULL",
+            reassignTo, userID); err != nil {
+            return err
+        }
+    } else {
+        rows, err := tx.Query("SELECT id FROM domains WHERE user_id = ? AND org_id IS NULL", userID)
+        if err != nil {
+            return err
+        }
+        var ids []int64
+        for rows.Next() {
+            var id int64
+            if err := rows.Scan(&id); err != nil {
+                rows.Close()
+                return err
+            }
+            ids = append(ids, id)
+        }
+        rows.Close()
+        for _, id := range ids {
+            if err := deleteDomainTx(tx, id); err != nil {
+                return err
+            }
+        }
+    }
+
+    // Если других участников в организации нет и reassignTo не задан, домен
+    // остаётся записан на удалённого пользователя
+    if _, err := tx.Exec(`UPDATE domains SET user_id = COALESCE(NULLIF(?, 0), (`+
+        fmt.Sprintf(orgSuccessorQuery, "domains.org_id")+`), user_id)
+                          WHERE user_id = ? AND org_id IS NOT NULL`,
+        reassignTo, userID, userID); err != nil {
+        return err
+    }
+
+    if _, err := tx.Exec(`UPDATE domain_transfers SET status = ?, resolved_at = ?
+                          WHERE status = ? AND (from_user_id = ? OR to_user_id = ?)`,
+        TransferCancelled, time.Now(), TransferPending, userID, userID); err != nil {
+        return err
+    }
+
+    queries := []string{
+        "DELETE FROM org_members WHERE user_id = ?",
+        "DELETE FROM domain_members WHERE user_id = ?",
+        "DELETE FROM domain_approvers WHERE user_id = ?",
+        "DELETE FROM users WHERE id = ?",
+    }
+    for _, query := range queries {
+        if _, err := tx.Exec(query, userID); err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
 }
 
 // Login Logs
@@ -229,16 +407,19 @@ func GetLoginLogsByUserID(db *DB, userID int64, limit int) ([]LoginLog, error) {
 
 // User Actions
 func CreateUserAction(db *DB, action *UserAction) error {
-    query := `INSERT INTO user_actions (user_id, username, action, details, ip, created_at) 
-              VALUES (?, ?, ?, ?, ?, ?)`
+    query := `INSERT INTO user_actions (user_id, username, action, details, ip, created_at,
+                                        impersonator_id, impersonator_name) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
     _, err := db.Exec(query, action.UserID, action.Username, action.Action, 
-                     action.Details, action.IP, time.Now())
+                     action.Details, action.IP, time.Now(),
+                     nullInt64(action.ImpersonatorID), action.ImpersonatorName)
     return err
 }
 
 func GetUserActions(db *DB, limit int) ([]UserAction, error) {
     rows, err := db.Query(`
-        SELECT id, user_id, username, action, details, ip, created_at 
+        SELECT id, user_id, username, action, details, ip, created_at,
+               COALESCE(impersonator_id, 0), COALESCE(impersonator_name, '')
         FROM user_actions 
         ORDER BY created_at DESC 
         LIMIT ?`, limit)
@@ -251,7 +432,8 @@ func GetUserActions(db *DB, limit int) ([]UserAction, error) {
     for rows.Next() {
         var a UserAction
         if err := rows.Scan(&a.ID, &a.UserID, &a.Username, &a.Action, 
-                           &a.Details, &a.IP, &a.CreatedAt); err != nil {
+                           &a.Details, &a.IP, &a.CreatedAt,
+                           &a.ImpersonatorID, &a.ImpersonatorName); err != nil {
             return nil, err
         }
         actions = append(actions, a)
@@ -259,14 +441,16 @@ func GetUserActions(db *DB, limit int) ([]UserAction, error) {
     return actions, nil
 }
 
-// GetUserActionsByUserID возвращает действия конкретного пользователя
+// GetUserActionsByUserID возвращает действия конкретного пользователя, включая
+// выполненные им от имени других пользователей
 func GetUserActionsByUserID(db *DB, userID int64, limit int) ([]UserAction, error) {
     rows, err := db.Query(`
-        SELECT id, user_id, username, action, details, ip, created_at 
+        SELECT id, user_id, username, action, details, ip, created_at,
+               COALESCE(impersonator_id, 0), COALESCE(impersonator_name, '')
         FROM user_actions 
-        WHERE user_id = ?
+        WHERE user_id = ? OR impersonator_id = ?
         ORDER BY created_at DESC 
-        LIMIT ?`, userID, limit)
+        LIMIT ?`, userID, userID, limit)
     if err != nil {
         return nil, err
     }
@@ -276,7 +460,8 @@ func GetUserActionsByUserID(db *DB, userID int64, limit int) ([]UserAction, erro
     for rows.Next() {
         var a UserAction
         if err := rows.Scan(&a.ID, &a.UserID, &a.Username, &a.Action, 
-                           &a.Details, &a.IP, &a.CreatedAt); err != nil {
+                           &a.Details, &a.IP, &a.CreatedAt,
+                           &a.ImpersonatorID, &a.ImpersonatorName); err != nil {
             return nil, err
         }
         actions = append(actions, a)
@@ -0,0 +1,133 @@
+package models
+
+import (
+    "database/sql"
+    "time"
+)
+
+// XFRTarget — вторичный сервер, которому разрешено забирать зону (provide-xfr)
+// и которому отправляется NOTIFY после изменений
+type XFRTarget struct {
+    ID         int64
+    DomainID   int64  // 0 — сервер для всех первичных зон
+    Address    string // IP или IP@порт
+    TSIGKey    string // имя TSIG ключа, пустое — без подписи
+    ProvideXFR bool
+    Notify     bool
+    CreatedAt  time.Time
+}
+
+// NotifyResult — итог последнего NOTIFY вторичному серверу
+type NotifyResult struct {
+    DomainID        int64
+    Address         string
+    SentAt          time.Time
+    Success         bool
+    Message         string
+    Serial          uint32 // serial зоны, который вернул сервер; 0 — неизвестен
+    SerialCheckedAt *time.Time
+}
+
+func CreateXFRTarget(db *DB, t *XFRTarget) error {
+    t.CreatedAt = time.Now()
+    result, err := db.Exec(`INSERT INTO xfr_targets (domain_id, address, tsig_key, provide_xfr, notify, created_at)
+                            VALUES (?, ?, ?, ?, ?, ?)`,
+        t.DomainID, t.Address, t.TSIGKey, t.ProvideXFR, t.Notify, t.CreatedAt)
+    if err != nil {
+        return err
+    }
+    t.ID, err = result.LastInsertId()
+    return err
+}
+
+func DeleteXFRTarget(db *DB, id int64) error {
+    _, err := db.Exec("DELETE FROM xfr_targets WHERE id = ?", id)
+    return err
+}
+
+func queryXFRTargets(db *DB, query string, args ...interface{}) ([]XFRTarget, error) {
+    rows, err := db.Query(`SELECT id, domain_id, address, tsig_key, provide_xfr, notify, created_at
+                           FROM xfr_targets `+query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var targets []XFRTarget
+    for rows.Next() {
+        var t XFRTarget
+        if err := rows.Scan(&t.ID, &t.DomainID, &t.Address, &t.TSIGKey, &t.ProvideXFR, &t.Notify, &t.CreatedAt); err != nil {
+            return nil, err
+        }
+        targets = append(targets, t)
+    }
+    return targets, nil
+}
+
+func GetXFRTargetByID(db *DB, id int64) (*XFRTarget, error) {
+    targets, err := queryXFRTargets(db, "WHERE id = ?", id)
+    if err != nil || len(targets) == 0 {
+        return nil, err
+    }
+    return &targets[0], nil
+}
+
+// GetXFRTargets возвращает серверы, заданные для домена (0 — глобальные)
+func GetXFRTargets(db *DB, domainID int64) ([]XFRTarget, error) {
+    return queryXFRTargets(db, "WHERE domain_id = ? ORDER BY id", domainID)
+}
+
+// GetEffectiveXFRTargets возвращает глобальные серверы и серверы домена
+func GetEffectiveXFRTargets(db *DB, domainID int64) ([]XFRTarget, error) {
+    return queryXFRTargets(db, "WHERE domain_id = 0 OR domain_id = ? ORDER BY domain_id, id", domainID)
+}
+
+// GetAllXFRTargets возвращает все серверы, используется при генерации zones.conf
+func GetAllXFRTargets(db *DB) ([]XFRTarget, error) {
+    return queryXFRTargets(db, "ORDER BY domain_id, id")
+}
+
+// SaveNotifyResult запоминает итог NOTIFY, serial не меняется
+func SaveNotifyResult(db *DB, domainID int64, address string, success bool, message string) error {
+    _, err := db.Exec(`INSERT INTO notify_results (domain_id, address, sent_at, success, message)
+                       VALUES (?, ?, ?, ?, ?)
+                       ON CONFLICT(domain_id, address) DO UPDATE SET
+                           sent_at = excluded.sent_at, success = excluded.success, message = excluded.message`,
+        domainID, address, time.Now(), success, message)
+    return err
+}
+
+// SaveSecondarySerial запоминает serial зоны, который вернул вторичный сервер
+func SaveSecondarySerial(db *DB, domainID int64, address string, serial uint32) error {
+    _, err := db.Exec(`INSERT INTO notify_results (domain_id, address, serial, serial_checked_at)
+                       VALUES (?, ?, ?, ?)
+                       ON CONFLICT(domain_id, address) DO UPDATE SET
+                           serial = excluded.serial, serial_checked_at = excluded.serial_checked_at`,
+        domainID, address, serial, time.Now())
+    return err
+}
+
+func GetNotifyResults(db *DB, domainID int64) ([]NotifyResult, error) {
+    rows, err := db.Query(`SELECT domain_id, address, sent_at, success, message, serial, serial_checked_at
+                           FROM notify_results WHERE domain_id = ? ORDER BY address`, domainID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var results []NotifyResult
+    for rows.Next() {
+        var res NotifyResult
+        var sentAt, checkedAt sql.NullTime
+        if err := rows.Scan(&res.DomainID, &res.Address, &sentAt, &res.Success, &res.Message,
+            &res.Serial, &checkedAt); err != nil {
+            return nil, err
+        }
+        res.SentAt = sentAt.Time
+        if checkedAt.Valid {
+            res.SerialCheckedAt = &checkedAt.Time
+        }
+        results = append(results, res)
+    }
+    return results, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "log"
+    "os"
+    "time"
+
+    "dns-manager/agent"
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+// agentZones возвращает зоны, файлы которых получают удалённые серверы:
+// все первичные и каталожная
+func agentZones(db *models.DB) ([]agent.ManifestZone, error) {
+    domains, err := models.GetAllDomains(db)
+    if err != nil {
+        return nil, err
+    }
+    var zones []agent.ManifestZone
+    for _, d := range domains {
+        if !d.IsSecondary() {
+            zones = append(zones, agent.ManifestZone{Name: d.Name, Serial: int64(d.Serial)})
+        }
+    }
+    if CatalogEnabled() {
+        catalog := CatalogZoneName()
+        zones = append(zones, agent.ManifestZone{Name: catalog, Serial: syncSerial(db, catalog, models.SyncPush)})
+    }
+    return zones, nil
+}
+
+func hashBytes(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// AgentManifest собирает желаемое состояние сервера для агента. Зоны, файл
+// которых ещё не создан, пропускаются и попадут в следующий манифест.
+func AgentManifest(db *models.DB, server *models.DNSServer) (*agent.Manifest, error) {
+    zones, err := agentZones(db)
+    if err != nil {
+        return nil, err
+    }
+    conf, err := ServerZonesConf(db, server)
+    if err != nil {
+        return nil, err
+    }
+
+    manifest := &agent.Manifest{ConfHash: hashBytes(conf), Zones: []agent.ManifestZone{}}
+    for _, zone := range zones {
+        data, err := os.ReadFile(ZoneFilePath(zone.Name))
+        if err != nil {
+            if !os.IsNotExist(err) {
+                log.Printf("Agent API: cannot read zone %s: %v", zone.Name, err)
+            }
+            continue
+        }
+        zone.Hash = hashBytes(data)
+        manifest.Zones = append(manifest.Zones, zone)
+    }
+    return manifest, nil
+}
+
+// AgentZoneFile возвращает файл зоны, если она входит в манифест. Возвращает
+// nil, nil для чужих и несуществующих зон.
+func AgentZoneFile(db *models.DB, name string) ([]byte, error) {
+    zones, err := agentZones(db)
+    if err != nil {
+        return nil, err
+    }
+    for _, zone := range zones {
+        if zone.Name == name {
+            data, err := os.ReadFile(ZoneFilePath(name))
+            if os.IsNotExist(err) {
+                return nil, nil
+            }
+            return data, err
+        }
+    }
+    return nil, nil
+}
+
+// ServerZonesConf формирует zones.conf с путями удалённого сервера
+func ServerZonesConf(db *models.DB, server *models.DNSServer) ([]byte, error) {
+    return renderZonesConf(db, server.ZoneDir)
+}
+
+// ApplyAgentReport сохраняет состояние сервера из отчёта агента и отмечает
+// выполненными задания, которые агент уже применил
+func ApplyAgentReport(db *models.DB, server *models.DNSServer, report *agent.Report) error {
+    checkErr := report.Error
+    if checkErr == "" && !report.Healthy {
+        checkErr = "DNS сервер не работает"
+    }
+    if err := models.SaveDNSServerCheck(db, server.ID, checkErr); err != nil {
+        return err
+    }
+    if report.ReloadPending {
+        return nil
+    }
+
+    jobs, err := models.GetServerSync(db, server.ID)
+    if err != nil {
+        return err
+    }
+    confHash := ""
+    for _, job := range jobs {
+        if job.State == models.SyncDone {
+            continue
+        }
+        serial, applied := report.Zones[job.Zone]
+        done := false
+        switch {
+        case job.Zone == "":
+            if confHash == "" {
+                conf, err := ServerZonesConf(db, server)
+                if err != nil {
+                    return err
+                }
+                confHash = hashBytes(conf)
+            }
+            done = report.ConfHash == confHash
+        case job.Action == models.SyncRemove:
+            done = !applied
+        default:
+            done = applied && serial >= job.Serial
+        }
+        if done {
+            if err := models.ConfirmServerSync(db, server.ID, job.Zone, job.Action, job.Serial); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// agentReachable — агент отчитывался недавно и без ошибок
+func agentReachable(server *models.DNSServer) bool {
+    timeout := time.Duration(viper.GetInt("distribution.agent_timeout")) * time.Second
+    if timeout <= 0 {
+        timeout = 5 * time.Minute
+    }
+    return server.LastCheckAt != nil && server.LastCheckError == "" && time.Since(*server.LastCheckAt) < timeout
+}
@@ -0,0 +1,498 @@
+package services
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "strings"
+    "sync"
+    "time"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+    "golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+    // Размер UDP ответа без EDNS и наибольший размер, который мы объявляем
+    udpMinSize  = 512
+    udpMaxSize  = 1232
+    tcpIdle     = 10 * time.Second
+    axfrMsgSize = 16384 // примерный предел одного сообщения AXFR
+)
+
+// EmbeddedBackend — встроенный авторитативный DNS сервер для проверки и
+// небольших установок. Первичные зоны отдаются из снимка в памяти, который
+// обновляется при каждой публикации зоны. Вторичные зоны и каталог не
+// обслуживаются. AXFR разрешён адресам из embedded.axfr_allow и серверам
+// provide_xfr зоны, TSIG не проверяется.
+type EmbeddedBackend struct {
+    Listen    string   // адрес UDP и TCP, например 127.0.0.1:5353
+    AXFRAllow []string // IP или подсети, которым разрешён AXFR любой зоны
+
+    mu      sync.RWMutex
+    db      *models.DB
+    zones   map[string]*authZone // абсолютное имя зоны → снимок
+    allow   []*net.IPNet
+    udp     net.PacketConn
+    tcp     net.Listener
+    started bool
+}
+
+func NewEmbeddedBackend() *EmbeddedBackend {
+    return &EmbeddedBackend{
+        Listen:    viper.GetString("embedded.listen"),
+        AXFRAllow: viper.GetStringSlice("embedded.axfr_allow"),
+        zones:     make(map[string]*authZone),
+    }
+}
+
+func (b *EmbeddedBackend) Name() string { return "embedded" }
+
+// needsRecords — снимок зоны строится из записей, а не из файла
+func (b *EmbeddedBackend) needsRecords() bool { return true }
+
+// parseAllow разбирает список IP и подсетей
+func parseAllow(list []string) ([]*net.IPNet, error) {
+    var nets []*net.IPNet
+    for _, item := range list {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+        if _, n, err := net.ParseCIDR(item); err == nil {
+            nets = append(nets, n)
+            continue
+        }
+        ip := net.ParseIP(item)
+        if ip == nil {
+            return nil, fmt.Errorf("некорректный адрес %s в embedded.axfr_allow", item)
+        }
+        bits := 8 * net.IPv6len
+        if ip.To4() != nil {
+            ip, bits = ip.To4(), 8*net.IPv4len
+        }
+        nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+    }
+    return nets, nil
+}
+
+// Start загружает зоны из БД и начинает принимать запросы по UDP и TCP
+func (b *EmbeddedBackend) Start(db *models.DB) error {
+    allow, err := parseAllow(b.AXFRAllow)
+    if err != nil {
+        return err
+    }
+    b.mu.Lock()
+    b.db, b.allow = db, allow
+    b.mu.Unlock()
+    if err := b.Reload(); err != nil {
+        return err
+    }
+
+    udp, err := net.ListenPacket("udp", b.Listen)
+    if err != nil {
+        return err
+    }
+    // Для порта 0 TCP слушает тот же порт, что выбрала система для UDP
+    tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+    if err != nil {
+        udp.Close()
+        return err
+    }
+    b.mu.Lock()
+    b.udp, b.tcp, b.started = udp, tcp, true
+    b.mu.Unlock()
+
+    go b.serveUDP(udp)
+    go b.serveTCP(tcp)
+    log.Printf("Embedded DNS server listening on %s", udp.LocalAddr())
+    return nil
+}
+
+// Addr возвращает адрес, на котором работает сервер
+func (b *EmbeddedBackend) Addr() string {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    if b.udp == nil {
+        return ""
+    }
+    return b.udp.LocalAddr().String()
+}
+
+// Stop закрывает сокеты сервера
+func (b *EmbeddedBackend) Stop() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.udp != nil {
+        b.udp.Close()
+        b.tcp.Close()
+    }
+    b.started = false
+}
+
+func (b *EmbeddedBackend) setZone(name string, zone *authZone) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if zone == nil {
+        delete(b.zones, absoluteName(name))
+        return
+    }
+    b.zones[zone.name] = zone
+}
+
+// WriteZone заменяет снимок зоны. Вторичная зона убирается из снимка:
+// встроенный сервер не забирает зоны с других серверов.
+func (b *EmbeddedBackend) WriteZone(zone ZoneConfig) error {
+    if zone.Domain == nil {
+        return nil
+    }
+    if zone.Secondary {
+        b.setZone(zone.Name, nil)
+        return nil
+    }
+    snapshot, warnings, err := buildAuthZone(zone.Domain, zone.Records)
+    if err != nil {
+        return err
+    }
+    for _, warning := range warnings {
+        log.Printf("Zone %s: embedded server skipped record %s", zone.Name, warning)
+    }
+    b.setZone(zone.Name, snapshot)
+    return nil
+}
+
+func (b *EmbeddedBackend) RemoveZone(name string) error {
+    b.setZone(name, nil)
+    return nil
+}
+
+// Reload перечитывает все первичные зоны из БД
+func (b *EmbeddedBackend) Reload() error {
+    b.mu.RLock()
+    db := b.db
+    b.mu.RUnlock()
+    if db == nil {
+        return nil
+    }
+
+    domains, err := models.GetAllDomains(db)
+    if err != nil {
+        return err
+    }
+    zones := make(map[string]*authZone, len(domains))
+    for i := range domains {
+        domain := &domains[i]
+        if domain.IsSecondary() {
+            continue
+        }
+        records, err := models.GetRecordsByDomainID(db, domain.ID)
+        if err != nil {
+            return err
+        }
+        snapshot, warnings, err := buildAuthZone(domain, records)
+        if err != nil {
+            log.Printf("Zone %s: embedded server skipped zone: %v", domain.Name, err)
+            continue
+        }
+        for _, warning := range warnings {
+            log.Printf("Zone %s: embedded server skipped record %s", domain.Name, warning)
+        }
+        zones[snapshot.name] = snapshot
+    }
+
+    b.mu.Lock()
+    b.zones = zones
+    b.mu.Unlock()
+    return nil
+}
+
+func (b *EmbeddedBackend) Status() error {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    if !b.started {
+        return errors.New("встроенный DNS сервер не запущен")
+    }
+    return nil
+}
+
+func (b *EmbeddedBackend) CheckConfig() error {
+    if _, _, err := net.SplitHostPort(b.Listen); err != nil {
+        return fmt.Errorf("некорректный embedded.listen %q: %v", b.Listen, err)
+    }
+    _, err := parseAllow(b.AXFRAllow)
+    return err
+}
+
+// StartEmbeddedServers запускает встроенный сервер, если он выбран основным
+// DNS сервером или указан в dns.mirrors
+func StartEmbeddedServers(db *models.DB) error {
+    for _, backend := range append([]Backend{CurrentBackend()}, CurrentMirrors()...) {
+        if embedded, ok := backend.(*EmbeddedBackend); ok {
+            if err := embedded.Start(db); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// findZone возвращает зону, ближайшую к имени запроса
+func (b *EmbeddedBackend) findZone(name string) *authZone {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    for n := strings.ToLower(name); n != ""; n = parentName(n) {
+        if zone := b.zones[n]; zone != nil {
+            return zone
+        }
+    }
+    return nil
+}
+
+// transferAllowed проверяет, может ли адрес забрать зону через AXFR
+func (b *EmbeddedBackend) transferAllowed(zone *authZone, addr net.Addr) bool {
+    tcpAddr, ok := addr.(*net.TCPAddr)
+    if !ok {
+        return false
+    }
+    b.mu.RLock()
+    db, allow := b.db, b.allow
+    b.mu.RUnlock()
+
+    for _, n := range allow {
+        if n.Contains(tcpAddr.IP) {
+            return true
+        }
+    }
+    if db == nil {
+        return false
+    }
+    targets, err := models.GetEffectiveXFRTargets(db, zone.domainID)
+    if err != nil {
+        log.Printf("Zone %s: cannot load transfer targets: %v", zone.name, err)
+        return false
+    }
+    for _, target := range targets {
+        if !target.ProvideXFR {
+            continue
+        }
+        host, _ := hostPort(target.Address)
+        if _, n, err := net.ParseCIDR(host); err == nil {
+            if n.Contains(tcpAddr.IP) {
+                return true
+            }
+        } else if ip := net.ParseIP(host); ip != nil && ip.Equal(tcpAddr.IP) {
+            return true
+        }
+    }
+    return false
+}
+
+// handle отвечает на запрос. Для AXFR по TCP возвращается несколько сообщений,
+// nil — запрос не разобран и ответа не будет.
+func (b *EmbeddedBackend) handle(packet []byte, addr net.Addr, tcp bool) [][]byte {
+    var req dnsmessage.Message
+    if err := req.Unpack(packet); err != nil {
+        // Если заголовок цел, отвечаем FORMERR, иначе молчим
+        var p dnsmessage.Parser
+        h, herr := p.Start(packet)
+        if herr != nil || h.Response {
+            return nil
+        }
+        resp := dnsmessage.Message{Header: dnsmessage.Header{ID: h.ID, Response: true, OpCode: h.OpCode, RCode: dnsmessage.RCodeFormatError}}
+        out, _ := resp.Pack()
+        return [][]byte{out}
+    }
+    if req.Response {
+        return nil
+    }
+
+    resp := dnsmessage.Message{
+        Header: dnsmessage.Header{
+            ID:               req.ID,
+            Response:         true,
+            OpCode:           req.OpCode,
+            RecursionDesired: req.RecursionDesired,
+        },
+        Questions: req.Questions,
+    }
+
+    // EDNS: размер UDP ответа берётся из OPT клиента, но не больше udpMaxSize
+    limit, edns := udpMinSize, false
+    for _, rr := range req.Additionals {
+        if rr.Header.Type == dnsmessage.TypeOPT {
+            edns = true
+            if size := int(rr.Header.Class); size > limit {
+                limit = size
+            }
+        }
+    }
+    if limit > udpMaxSize {
+        limit = udpMaxSize
+    }
+
+    switch {
+    case req.OpCode != 0:
+        resp.RCode = dnsmessage.RCodeNotImplemented
+    case len(req.Questions) != 1:
+        resp.RCode = dnsmessage.RCodeFormatError
+    default:
+        q := req.Questions[0]
+        zone := b.findZone(q.Name.String())
+        switch {
+        case zone == nil || (q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY):
+            resp.RCode = dnsmessage.RCodeRefused
+        case q.Type == dnsmessage.TypeAXFR || q.Type == dnsTypeIXFR:
+            if strings.ToLower(q.Name.String()) != zone.name {
+                resp.RCode = dnsRCodeNotAuth
+                break
+            }
+            if !tcp {
+                // AXFR по UDP не бывает, на IXFR отвечаем текущим SOA:
+                // вторичный сервер повторит запрос по TCP
+                if q.Type == dnsmessage.TypeAXFR {
+                    resp.RCode = dnsmessage.RCodeRefused
+                } else {
+                    resp.Authoritative = true
+                    resp.Answers = []dnsmessage.Resource{zone.soa}
+                }
+                break
+            }
+            if !b.transferAllowed(zone, addr) {
+                resp.RCode = dnsmessage.RCodeRefused
+                break
+            }
+            // На IXFR отвечаем полной зоной (RFC 1995, раздел 4)
+            return transferMessages(resp, zone.transfer())
+        default:
+            zone.answer(&resp, q)
+        }
+    }
+
+    if edns {
+        var opt dnsmessage.Resource
+        opt.Header.SetEDNS0(udpMaxSize, resp.RCode, false)
+        opt.Body = &dnsmessage.OPTResource{}
+        resp.Additionals = append(resp.Additionals, opt)
+    }
+    out, err := resp.Pack()
+    if err != nil {
+        log.Printf("Embedded DNS: cannot pack answer for %v: %v", req.Questions, err)
+        return nil
+    }
+    if !tcp && len(out) > limit {
+        // Не помещается в UDP: клиент повторит запрос по TCP
+        resp.Truncated = true
+        resp.Answers, resp.Authorities = nil, nil
+        if edns {
+            resp.Additionals = resp.Additionals[len(resp.Additionals)-1:]
+        } else {
+            resp.Additionals = nil
+        }
+        if out, err = resp.Pack(); err != nil {
+            return nil
+        }
+    }
+    return [][]byte{out}
+}
+
+// transferMessages делит зону на сообщения AXFR. Вопрос есть только в первом.
+func transferMessages(head dnsmessage.Message, records []dnsmessage.Resource) [][]byte {
+    head.Authoritative = true
+    var out [][]byte
+    msg, size := head, 0
+    flush := func() bool {
+        data, err := msg.Pack()
+        if err != nil {
+            log.Printf("Embedded DNS: cannot pack transfer: %v", err)
+            return false
+        }
+        out = append(out, data)
+        msg, size = head, 0
+        msg.Questions = nil
+        return true
+    }
+    for _, rr := range records {
+        // Размер записи без сжатия имён — оценка сверху
+        single := dnsmessage.Message{Answers: []dnsmessage.Resource{rr}}
+        data, err := single.Pack()
+        if err != nil {
+            log.Printf("Embedded DNS: cannot pack %s: %v", rr.Header.Name, err)
+            return nil
+        }
+        if size > 0 && size+len(data) > axfrMsgSize {
+            if !flush() {
+                return nil
+            }
+        }
+        msg.Answers = append(msg.Answers, rr)
+        size += len(data)
+    }
+    if !flush() {
+        return nil
+    }
+    return out
+}
+
+func (b *EmbeddedBackend) serveUDP(conn net.PacketConn) {
+    buf := make([]byte, 65535)
+    for {
+        n, addr, err := conn.ReadFrom(buf)
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return
+            }
+            log.Printf("Embedded DNS: UDP read failed: %v", err)
+            continue
+        }
+        packet := append([]byte(nil), buf[:n]...)
+        go func() {
+            for _, out := range b.handle(packet, addr, false) {
+                conn.WriteTo(out, addr)
+            }
+        }()
+    }
+}
+
+func (b *EmbeddedBackend) serveTCP(listener net.Listener) {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if errors.Is(err, net.ErrClosed) {
+                return
+            }
+            log.Printf("Embedded DNS: TCP accept failed: %v", err)
+            time.Sleep(100 * time.Millisecond)
+            continue
+        }
+        go b.serveConn(conn)
+    }
+}
+
+// serveConn обслуживает TCP соединение: сообщения с двухбайтовой длиной,
+// соединение закрывается после tcpIdle без запросов
+func (b *EmbeddedBackend) serveConn(conn net.Conn) {
+    defer conn.Close()
+    var length [2]byte
+    for {
+        conn.SetDeadline(time.Now().Add(tcpIdle))
+        if _, err := io.ReadFull(conn, length[:]); err != nil {
+            return
+        }
+        packet := make([]byte, binary.BigEndian.Uint16(length[:]))
+        if _, err := io.ReadFull(conn, packet); err != nil {
+            return
+        }
+        for _, out := range b.handle(packet, conn.RemoteAddr(), true) {
+            frame := make([]byte, 2+len(out))
+            binary.BigEndian.PutUint16(frame, uint16(len(out)))
+            copy(frame[2:], out)
+            if _, err := conn.Write(frame); err != nil {
+                return
+            }
+        }
+    }
+}
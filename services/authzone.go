@@ -0,0 +1,393 @@
+package services
+
+import (
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+    "golang.org/x/net/dns/dnsmessage"
+)
+
+// IXFR, CAA и NOTAUTH нет среди констант dnsmessage
+const (
+    dnsTypeIXFR     dnsmessage.Type  = 251
+    dnsTypeCAA      dnsmessage.Type  = 257
+    dnsRCodeNotAuth dnsmessage.RCode = 9
+)
+
+// maxCNAMEChain ограничивает цепочку CNAME внутри зоны
+const maxCNAMEChain = 8
+
+// authZone — снимок первичной зоны для встроенного DNS сервера. Снимок
+// не меняется после создания, при изменении зоны он заменяется целиком.
+type authZone struct {
+    name     string // абсолютное имя в нижнем регистре
+    domainID int64
+    soa      dnsmessage.Resource
+    minimum  uint32
+    nodes    map[string]map[dnsmessage.Type][]dnsmessage.Resource
+    names    map[string]bool       // все имена зоны вместе с пустыми промежуточными
+    records  []dnsmessage.Resource // все записи, кроме SOA, в порядке из БД
+}
+
+// parentName отрезает первую метку абсолютного имени
+func parentName(name string) string {
+    i := strings.IndexByte(name, '.')
+    if i < 0 || i == len(name)-1 {
+        return ""
+    }
+    return name[i+1:]
+}
+
+func dnsName(name string) (dnsmessage.Name, error) {
+    return dnsmessage.NewName(absoluteName(name))
+}
+
+// authResource переводит запись панели в запись DNS
+func authResource(record models.Record, zone string) (dnsmessage.Resource, error) {
+    name, err := dnsName(recordFQDN(record.Name, zone))
+    if err != nil {
+        return dnsmessage.Resource{}, err
+    }
+    rr := dnsmessage.Resource{Header: dnsmessage.ResourceHeader{
+        Name:  name,
+        Class: dnsmessage.ClassINET,
+        TTL:   uint32(record.TTL),
+    }}
+    target := func() (dnsmessage.Name, error) {
+        return dnsName(absoluteTarget(record.Content, zone))
+    }
+
+    switch record.Type {
+    case "A":
+        ip := net.ParseIP(record.Content).To4()
+        if ip == nil {
+            return rr, fmt.Errorf("некорректный IPv4 адрес %s", record.Content)
+        }
+        body := &dnsmessage.AResource{}
+        copy(body.A[:], ip)
+        rr.Header.Type, rr.Body = dnsmessage.TypeA, body
+    case "AAAA":
+        ip := net.ParseIP(record.Content)
+        if ip == nil || ip.To4() != nil {
+            return rr, fmt.Errorf("некорректный IPv6 адрес %s", record.Content)
+        }
+        body := &dnsmessage.AAAAResource{}
+        copy(body.AAAA[:], ip.To16())
+        rr.Header.Type, rr.Body = dnsmessage.TypeAAAA, body
+    case "CNAME":
+        t, err := target()
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypeCNAME, &dnsmessage.CNAMEResource{CNAME: t}
+    case "NS":
+        t, err := target()
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypeNS, &dnsmessage.NSResource{NS: t}
+    case "PTR":
+        t, err := target()
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypePTR, &dnsmessage.PTRResource{PTR: t}
+    case "MX":
+        t, err := target()
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: uint16(record.Priority), MX: t}
+    case "TXT":
+        chunks, err := ParseTXT(record.Content)
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: chunks}
+    case "SRV":
+        body, err := srvResource(record, zone)
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsmessage.TypeSRV, body
+    case "CAA":
+        data, err := caaRData(record.Content)
+        if err != nil {
+            return rr, err
+        }
+        rr.Header.Type, rr.Body = dnsTypeCAA, &dnsmessage.UnknownResource{Type: dnsTypeCAA, Data: data}
+    default:
+        return rr, fmt.Errorf("тип %s не поддерживается", record.Type)
+    }
+    return rr, nil
+}
+
+// srvResource разбирает SRV запись. Как и у MX, приоритет хранится в поле
+// Priority, а в содержимом — "вес порт цель"; допускается и полная форма
+// "приоритет вес порт цель".
+func srvResource(record models.Record, zone string) (*dnsmessage.SRVResource, error) {
+    fields := strings.Fields(record.Content)
+    priority := strconv.Itoa(record.Priority)
+    if len(fields) == 4 {
+        priority, fields = fields[0], fields[1:]
+    }
+    if len(fields) != 3 {
+        return nil, fmt.Errorf("SRV запись должна содержать вес, порт и цель: %s", record.Content)
+    }
+
+    var numbers [3]uint16
+    for i, value := range []string{priority, fields[0], fields[1]} {
+        n, err := strconv.ParseUint(value, 10, 16)
+        if err != nil {
+            return nil, fmt.Errorf("некорректное число в SRV записи: %s", value)
+        }
+        numbers[i] = uint16(n)
+    }
+    target, err := dnsName(absoluteTarget(fields[2], zone))
+    if err != nil {
+        return nil, err
+    }
+    return &dnsmessage.SRVResource{Priority: numbers[0], Weight: numbers[1], Port: numbers[2], Target: target}, nil
+}
+
+// caaRData собирает RDATA записи CAA (RFC 8659) из "флаги тег значение"
+func caaRData(content string) ([]byte, error) {
+    parts := strings.SplitN(strings.TrimSpace(content), " ", 3)
+    if len(parts) != 3 {
+        return nil, fmt.Errorf("CAA запись должна содержать флаги, тег и значение: %s", content)
+    }
+    flags, err := strconv.ParseUint(parts[0], 10, 8)
+    if err != nil {
+        return nil, fmt.Errorf("некорректные флаги CAA: %s", parts[0])
+    }
+    tag := parts[1]
+    if tag == "" || len(tag) > 15 || strings.Trim(strings.ToLower(tag), "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+        return nil, fmt.Errorf("некорректный тег CAA: %s", tag)
+    }
+    value := strings.TrimSpace(parts[2])
+    if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+        value = value[1 : len(value)-1]
+    }
+
+    data := make([]byte, 0, 2+len(tag)+len(value))
+    data = append(data, byte(flags), byte(len(tag)))
+    data = append(data, tag...)
+    return append(data, value...), nil
+}
+
+// buildAuthZone собирает снимок зоны из домена и его записей. Записи,
+// которые не удалось перевести, пропускаются и возвращаются в warnings.
+func buildAuthZone(domain *models.Domain, records []models.Record) (*authZone, []string, error) {
+    z := &authZone{
+        name:     absoluteName(domain.Name),
+        domainID: domain.ID,
+        minimum:  uint32(domain.SOAMinimum),
+        nodes:    make(map[string]map[dnsmessage.Type][]dnsmessage.Resource),
+        names:    make(map[string]bool),
+    }
+
+    var warnings []string
+    soaEmail, soaTTL := "", 0
+    for _, record := range records {
+        if record.Type == "SOA" {
+            soaEmail, soaTTL = record.Content, record.TTL
+            continue
+        }
+        rr, err := authResource(record, domain.Name)
+        if err != nil {
+            warnings = append(warnings, fmt.Sprintf("%s %s: %v", record.Name, record.Type, err))
+            continue
+        }
+        owner := strings.ToLower(rr.Header.Name.String())
+        if !strings.HasSuffix(owner, "."+z.name) && owner != z.name {
+            warnings = append(warnings, fmt.Sprintf("%s %s: имя вне зоны", record.Name, record.Type))
+            continue
+        }
+        if z.nodes[owner] == nil {
+            z.nodes[owner] = make(map[dnsmessage.Type][]dnsmessage.Resource)
+        }
+        z.nodes[owner][rr.Header.Type] = append(z.nodes[owner][rr.Header.Type], rr)
+        z.records = append(z.records, rr)
+        for n := owner; n != "" && n != z.name; n = parentName(n) {
+            z.names[n] = true
+        }
+    }
+    z.names[z.name] = true
+
+    if soaTTL == 0 {
+        soaTTL = domain.SOAMinimum
+    }
+    primary, mbox := soaFields(domain, soaEmail, records)
+    apex, err := dnsName(z.name)
+    if err != nil {
+        return nil, nil, err
+    }
+    ns, err := dnsName(primary)
+    if err != nil {
+        return nil, nil, err
+    }
+    mb, err := dnsName(mbox)
+    if err != nil {
+        return nil, nil, err
+    }
+    z.soa = dnsmessage.Resource{
+        Header: dnsmessage.ResourceHeader{Name: apex, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: uint32(soaTTL)},
+        Body: &dnsmessage.SOAResource{
+            NS:      ns,
+            MBox:    mb,
+            Serial:  uint32(domain.Serial),
+            Refresh: uint32(domain.SOARefresh),
+            Retry:   uint32(domain.SOARetry),
+            Expire:  uint32(domain.SOAExpire),
+            MinTTL:  uint32(domain.SOAMinimum),
+        },
+    }
+    if z.nodes[z.name] == nil {
+        z.nodes[z.name] = make(map[dnsmessage.Type][]dnsmessage.Resource)
+    }
+    z.nodes[z.name][dnsmessage.TypeSOA] = []dnsmessage.Resource{z.soa}
+    return z, warnings, nil
+}
+
+// negativeSOA — SOA для раздела authority в ответах NXDOMAIN и NODATA.
+// TTL не больше minimum (RFC 2308).
+func (z *authZone) negativeSOA() dnsmessage.Resource {
+    soa := z.soa
+    if z.minimum < soa.Header.TTL {
+        soa.Header.TTL = z.minimum
+    }
+    return soa
+}
+
+// delegation ищет ближайшую к вершине точку делегирования над именем
+func (z *authZone) delegation(owner string) (string, []dnsmessage.Resource) {
+    cut, ns := "", []dnsmessage.Resource(nil)
+    for n := owner; n != "" && n != z.name; n = parentName(n) {
+        if set := z.nodes[n][dnsmessage.TypeNS]; len(set) > 0 {
+            cut, ns = n, set
+        }
+    }
+    return cut, ns
+}
+
+// wildcard возвращает записи подстановки *.<ближайшее существующее имя>
+func (z *authZone) wildcard(owner string) map[dnsmessage.Type][]dnsmessage.Resource {
+    encloser := owner
+    for encloser != z.name {
+        encloser = parentName(encloser)
+        if encloser == "" {
+            return nil
+        }
+        if z.names[encloser] {
+            break
+        }
+    }
+    return z.nodes["*."+encloser]
+}
+
+// synthesize подставляет имя запроса в записи подстановки
+func synthesize(set []dnsmessage.Resource, name dnsmessage.Name) []dnsmessage.Resource {
+    out := make([]dnsmessage.Resource, len(set))
+    for i, rr := range set {
+        rr.Header.Name = name
+        out[i] = rr
+    }
+    return out
+}
+
+// glue добавляет адреса серверов NS, MX и SRV, если они есть в зоне
+func (z *authZone) glue(msg *dnsmessage.Message, set []dnsmessage.Resource) {
+    for _, rr := range set {
+        var target dnsmessage.Name
+        switch body := rr.Body.(type) {
+        case *dnsmessage.NSResource:
+            target = body.NS
+        case *dnsmessage.MXResource:
+            target = body.MX
+        case *dnsmessage.SRVResource:
+            target = body.Target
+        default:
+            continue
+        }
+        name := strings.ToLower(target.String())
+        msg.Additionals = append(msg.Additionals, z.nodes[name][dnsmessage.TypeA]...)
+        msg.Additionals = append(msg.Additionals, z.nodes[name][dnsmessage.TypeAAAA]...)
+    }
+}
+
+// answer заполняет ответ на запрос к зоне. CNAME внутри зоны раскрывается,
+// для NXDOMAIN и NODATA в authority добавляется SOA зоны.
+func (z *authZone) answer(msg *dnsmessage.Message, q dnsmessage.Question) {
+    msg.Authoritative = true
+    owner := strings.ToLower(q.Name.String())
+    qname := q.Name
+
+    for hop := 0; ; hop++ {
+        if cut, ns := z.delegation(owner); cut != "" {
+            // Имя делегировано: отвечаем ссылкой на серверы поддомена
+            if len(msg.Answers) == 0 {
+                msg.Authoritative = false
+            }
+            msg.Authorities = append(msg.Authorities, ns...)
+            z.glue(msg, ns)
+            return
+        }
+
+        node, exists := z.nodes[owner]
+        if !exists && !z.names[owner] {
+            if wc := z.wildcard(owner); wc != nil {
+                node, exists = make(map[dnsmessage.Type][]dnsmessage.Resource, len(wc)), true
+                for t, set := range wc {
+                    node[t] = synthesize(set, qname)
+                }
+            }
+        }
+        if !exists && !z.names[owner] {
+            msg.RCode = dnsmessage.RCodeNameError
+            msg.Authorities = append(msg.Authorities, z.negativeSOA())
+            return
+        }
+
+        if q.Type == dnsmessage.TypeALL {
+            for _, set := range node {
+                msg.Answers = append(msg.Answers, set...)
+            }
+            if len(node) == 0 {
+                msg.Authorities = append(msg.Authorities, z.negativeSOA())
+            }
+            return
+        }
+        if set := node[q.Type]; len(set) > 0 {
+            msg.Answers = append(msg.Answers, set...)
+            if q.Type == dnsmessage.TypeNS || q.Type == dnsmessage.TypeMX || q.Type == dnsmessage.TypeSRV {
+                z.glue(msg, set)
+            }
+            return
+        }
+        if cname := node[dnsmessage.TypeCNAME]; len(cname) > 0 {
+            msg.Answers = append(msg.Answers, cname...)
+            target := cname[0].Body.(*dnsmessage.CNAMEResource).CNAME
+            next := strings.ToLower(target.String())
+            // Цель вне зоны или слишком длинная цепочка: резолвер продолжит сам
+            if hop >= maxCNAMEChain || (next != z.name && !strings.HasSuffix(next, "."+z.name)) {
+                return
+            }
+            owner, qname = next, target
+            continue
+        }
+
+        msg.Authorities = append(msg.Authorities, z.negativeSOA())
+        return
+    }
+}
+
+// transfer возвращает записи зоны для AXFR: SOA, записи, SOA
+func (z *authZone) transfer() []dnsmessage.Resource {
+    out := make([]dnsmessage.Resource, 0, len(z.records)+2)
+    out = append(out, z.soa)
+    out = append(out, z.records...)
+    return append(out, z.soa)
+}
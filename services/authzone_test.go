@@ -0,0 +1,253 @@
+package services
+
+import (
+    "net"
+    "reflect"
+    "testing"
+
+    "dns-manager/models"
+    "golang.org/x/net/dns/dnsmessage"
+)
+
+func testAuthZone(t *testing.T) *authZone {
+    t.Helper()
+    domain := &models.Domain{
+        ID: 7, Name: "auth.test", SOAEmail: "hostmaster@auth.test", Serial: 2024010101,
+        SOARefresh: 7200, SOARetry: 3600, SOAExpire: 1209600, SOAMinimum: 300,
+    }
+    records := []models.Record{
+        {Type: "SOA", Name: "@", Content: "hostmaster@auth.test", TTL: 3600},
+        {Type: "NS", Name: "@", Content: "ns1.auth.test", TTL: 3600},
+        {Type: "A", Name: "ns1", Content: "192.0.2.53", TTL: 3600},
+        {Type: "A", Name: "www", Content: "192.0.2.1", TTL: 300},
+        {Type: "CNAME", Name: "alias", Content: "www", TTL: 300},
+        {Type: "CNAME", Name: "chain", Content: "alias.auth.test.", TTL: 300},
+        {Type: "CNAME", Name: "out", Content: "www.example.net.", TTL: 300},
+        {Type: "A", Name: "host.ent", Content: "192.0.2.2", TTL: 300},
+        {Type: "A", Name: "*.wild", Content: "192.0.2.7", TTL: 300},
+        {Type: "NS", Name: "sub", Content: "ns.sub.auth.test", TTL: 3600},
+        {Type: "A", Name: "ns.sub", Content: "192.0.2.54", TTL: 3600},
+        {Type: "SRV", Name: "_sip._tcp", Priority: 10, Content: "5 5060 sip", TTL: 300},
+        {Type: "A", Name: "sip", Content: "192.0.2.60", TTL: 300},
+        {Type: "CAA", Name: "@", Content: `0 issue "letsencrypt.org"`, TTL: 300},
+        {Type: "SRV", Name: "_bad._udp", Content: "5 sip", TTL: 300},
+        {Type: "CAA", Name: "bad", Content: "0 is-sue x", TTL: 300},
+    }
+    zone, warnings, err := buildAuthZone(domain, records)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(warnings) != 2 {
+        t.Errorf("предупреждения %q, ожидались две некорректные записи", warnings)
+    }
+    return zone
+}
+
+func query(t *testing.T, zone *authZone, name string, qtype dnsmessage.Type) dnsmessage.Message {
+    t.Helper()
+    msg := dnsmessage.Message{Header: dnsmessage.Header{Response: true}}
+    zone.answer(&msg, dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET})
+    // Ответ должен упаковываться в сообщение
+    if _, err := msg.Pack(); err != nil {
+        t.Fatalf("%s %v: %v", name, qtype, err)
+    }
+    return msg
+}
+
+func rrNames(set []dnsmessage.Resource) []string {
+    names := make([]string, len(set))
+    for i, rr := range set {
+        names[i] = rr.Header.Name.String() + " " + rr.Header.Type.String()
+    }
+    return names
+}
+
+// expectNegative проверяет ответ без записей с SOA зоны в authority
+func expectNegative(t *testing.T, msg dnsmessage.Message, rcode dnsmessage.RCode) {
+    t.Helper()
+    if msg.RCode != rcode || !msg.Authoritative || len(msg.Answers) != 0 {
+        t.Fatalf("rcode %v aa %v answers %v", msg.RCode, msg.Authoritative, rrNames(msg.Answers))
+    }
+    if len(msg.Authorities) != 1 || msg.Authorities[0].Header.Type != dnsmessage.TypeSOA {
+        t.Fatalf("authority %v, ожидался SOA", rrNames(msg.Authorities))
+    }
+    if ttl := msg.Authorities[0].Header.TTL; ttl != 300 {
+        t.Errorf("TTL SOA %d, ожидался minimum 300", ttl)
+    }
+}
+
+func TestAuthZoneNegativeAnswers(t *testing.T) {
+    zone := testAuthZone(t)
+
+    expectNegative(t, query(t, zone, "missing.auth.test.", dnsmessage.TypeA), dnsmessage.RCodeNameError)
+    // Имя есть, но записей нужного типа нет
+    expectNegative(t, query(t, zone, "www.auth.test.", dnsmessage.TypeAAAA), dnsmessage.RCodeSuccess)
+    // Пустое промежуточное имя существует
+    expectNegative(t, query(t, zone, "ent.auth.test.", dnsmessage.TypeA), dnsmessage.RCodeSuccess)
+}
+
+func TestAuthZoneWildcard(t *testing.T) {
+    zone := testAuthZone(t)
+
+    for _, name := range []string{"x.wild.auth.test.", "a.b.wild.auth.test."} {
+        msg := query(t, zone, name, dnsmessage.TypeA)
+        if msg.RCode != dnsmessage.RCodeSuccess || len(msg.Answers) != 1 {
+            t.Fatalf("%s: rcode %v answers %v", name, msg.RCode, rrNames(msg.Answers))
+        }
+        if got := msg.Answers[0].Header.Name.String(); got != name {
+            t.Errorf("синтезированное имя %s, ожидалось %s", got, name)
+        }
+        if a := msg.Answers[0].Body.(*dnsmessage.AResource).A; a != [4]byte{192, 0, 2, 7} {
+            t.Errorf("%s: адрес %v", name, a)
+        }
+    }
+
+    // Подстановка не действует на существующие имена и на другие типы
+    expectNegative(t, query(t, zone, "wild.auth.test.", dnsmessage.TypeA), dnsmessage.RCodeSuccess)
+    expectNegative(t, query(t, zone, "x.wild.auth.test.", dnsmessage.TypeMX), dnsmessage.RCodeSuccess)
+}
+
+func TestAuthZoneCNAMEChain(t *testing.T) {
+    zone := testAuthZone(t)
+
+    msg := query(t, zone, "chain.auth.test.", dnsmessage.TypeA)
+    want := []string{"chain.auth.test. TypeCNAME", "alias.auth.test. TypeCNAME", "www.auth.test. TypeA"}
+    if got := rrNames(msg.Answers); !reflect.DeepEqual(got, want) {
+        t.Errorf("цепочка %v, ожидалось %v", got, want)
+    }
+
+    // Цель вне зоны раскрывает резолвер
+    msg = query(t, zone, "out.auth.test.", dnsmessage.TypeA)
+    if got := rrNames(msg.Answers); !reflect.DeepEqual(got, []string{"out.auth.test. TypeCNAME"}) || len(msg.Authorities) != 0 {
+        t.Errorf("CNAME вне зоны: answers %v authority %v", got, rrNames(msg.Authorities))
+    }
+
+    // Сам CNAME отдаётся без раскрытия
+    msg = query(t, zone, "alias.auth.test.", dnsmessage.TypeCNAME)
+    if got := rrNames(msg.Answers); !reflect.DeepEqual(got, []string{"alias.auth.test. TypeCNAME"}) {
+        t.Errorf("запрос CNAME: %v", got)
+    }
+}
+
+func TestAuthZoneReferral(t *testing.T) {
+    zone := testAuthZone(t)
+
+    for _, name := range []string{"sub.auth.test.", "host.sub.auth.test."} {
+        msg := query(t, zone, name, dnsmessage.TypeA)
+        if msg.RCode != dnsmessage.RCodeSuccess || msg.Authoritative || len(msg.Answers) != 0 {
+            t.Fatalf("%s: rcode %v aa %v answers %v", name, msg.RCode, msg.Authoritative, rrNames(msg.Answers))
+        }
+        if got := rrNames(msg.Authorities); !reflect.DeepEqual(got, []string{"sub.auth.test. TypeNS"}) {
+            t.Errorf("%s: authority %v", name, got)
+        }
+        if got := rrNames(msg.Additionals); !reflect.DeepEqual(got, []string{"ns.sub.auth.test. TypeA"}) {
+            t.Errorf("%s: glue %v", name, got)
+        }
+    }
+}
+
+func TestAuthZoneSRVAndCAA(t *testing.T) {
+    zone := testAuthZone(t)
+
+    msg := query(t, zone, "_sip._tcp.auth.test.", dnsmessage.TypeSRV)
+    if len(msg.Answers) != 1 {
+        t.Fatalf("SRV: %v", rrNames(msg.Answers))
+    }
+    srv := msg.Answers[0].Body.(*dnsmessage.SRVResource)
+    want := dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 5060, Target: dnsmessage.MustNewName("sip.auth.test.")}
+    if *srv != want {
+        t.Errorf("SRV %+v, ожидалось %+v", *srv, want)
+    }
+    if got := rrNames(msg.Additionals); !reflect.DeepEqual(got, []string{"sip.auth.test. TypeA"}) {
+        t.Errorf("glue SRV %v", got)
+    }
+
+    msg = query(t, zone, "auth.test.", dnsTypeCAA)
+    if len(msg.Answers) != 1 {
+        t.Fatalf("CAA: %v", rrNames(msg.Answers))
+    }
+    data := msg.Answers[0].Body.(*dnsmessage.UnknownResource).Data
+    if want := append([]byte{0, 5}, "issueletsencrypt.org"...); !reflect.DeepEqual(data, want) {
+        t.Errorf("RDATA CAA %q, ожидалось %q", data, want)
+    }
+
+    // Полная форма SRV с приоритетом в содержимом
+    rr, err := authResource(models.Record{Type: "SRV", Name: "_ldap._tcp", Content: "20 0 389 ldap.example.net.", TTL: 300}, "auth.test")
+    if err != nil || rr.Body.(*dnsmessage.SRVResource).Priority != 20 {
+        t.Errorf("SRV с приоритетом в содержимом: %+v, %v", rr.Body, err)
+    }
+}
+
+func TestEmbeddedTransferACL(t *testing.T) {
+    zone := testAuthZone(t)
+    b := &EmbeddedBackend{zones: make(map[string]*authZone)}
+    b.setZone(zone.name, zone)
+    var err error
+    if b.allow, err = parseAllow([]string{"198.51.100.0/24"}); err != nil {
+        t.Fatal(err)
+    }
+
+    axfr := func(name string, ip string, tcp bool) (dnsmessage.RCode, int) {
+        t.Helper()
+        req := dnsmessage.Message{
+            Header:    dnsmessage.Header{ID: 1},
+            Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeAXFR, Class: dnsmessage.ClassINET}},
+        }
+        packet, err := req.Pack()
+        if err != nil {
+            t.Fatal(err)
+        }
+        var addr net.Addr = &net.TCPAddr{IP: net.ParseIP(ip), Port: 53000}
+        if !tcp {
+            addr = &net.UDPAddr{IP: net.ParseIP(ip), Port: 53000}
+        }
+        out := b.handle(packet, addr, tcp)
+        if len(out) == 0 {
+            t.Fatalf("AXFR %s от %s: нет ответа", name, ip)
+        }
+        var first dnsmessage.Message
+        if err := first.Unpack(out[0]); err != nil {
+            t.Fatal(err)
+        }
+        answers := 0
+        for _, packet := range out {
+            var msg dnsmessage.Message
+            if err := msg.Unpack(packet); err != nil {
+                t.Fatal(err)
+            }
+            answers += len(msg.Answers)
+        }
+        return first.RCode, answers
+    }
+
+    // Адрес из embedded.axfr_allow получает зону целиком: SOA, записи, SOA
+    if rcode, n := axfr("auth.test.", "198.51.100.7", true); rcode != dnsmessage.RCodeSuccess || n != len(zone.records)+2 {
+        t.Errorf("разрешённый адрес: %v, записей %d", rcode, n)
+    }
+    if rcode, _ := axfr("auth.test.", "198.51.100.7", false); rcode != dnsmessage.RCodeRefused {
+        t.Errorf("AXFR по UDP: %v", rcode)
+    }
+    if rcode, _ := axfr("auth.test.", "203.0.113.9", true); rcode != dnsmessage.RCodeRefused {
+        t.Errorf("чужой адрес: %v", rcode)
+    }
+    if rcode, _ := axfr("sub.auth.test.", "198.51.100.7", true); rcode != dnsRCodeNotAuth {
+        t.Errorf("AXFR не вершины зоны: %v", rcode)
+    }
+
+    // Вторичные серверы из xfr_targets получают зону, только если им разрешена передача
+    b.db = newTestDB(t)
+    for _, target := range []models.XFRTarget{
+        {DomainID: zone.domainID, Address: "203.0.113.9", ProvideXFR: true},
+        {DomainID: 0, Address: "203.0.113.10", Notify: true},
+    } {
+        if err := models.CreateXFRTarget(b.db, &target); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if rcode, _ := axfr("auth.test.", "203.0.113.9", true); rcode != dnsmessage.RCodeSuccess {
+        t.Errorf("сервер с provide_xfr: %v", rcode)
+    }
+    if rcode, _ := axfr("auth.test.", "203.0.113.10", true); rcode != dnsmessage.RCodeRefused {
+        t.Errorf("сервер только с notify: %v", rcode)
+    }
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "os/exec"
+    "strings"
+    "sync"
+
+    "dns-manager/models"
+)
+
+// CommandRunner выполняет внешние команды управления DNS сервером.
+// Бэкенды получают его при создании, в тестах подставляется поддельный.
+type CommandRunner interface {
+    Run(name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner запускает команды через os/exec
+type ExecRunner struct{}
+
+func (ExecRunner) Run(name string, args ...string) ([]byte, error) {
+    return exec.Command(name, args...).CombinedOutput()
+}
+
+// ZoneConfig — зона, которую должен обслуживать DNS сервер
+type ZoneConfig struct {
+    Name      string
+    File      string   // путь к файлу зоны
+    Secondary bool     // зона забирается с первичных серверов
+    Primaries []string // IP или IP@порт первичных серверов
+    TSIGKey   string   // имя TSIG ключа для передачи, пустое — без ключа
+    // TSIG — ключ TSIGKey вместе с секретом, для серверов, которым нужно
+    // передать само определение ключа
+    TSIG *tsigKey
+    // Domain и Records заполняются только для бэкендов, которые получают
+    // записи вместо файла зоны (recordBackend)
+    Domain  *models.Domain
+    Records []models.Record
+}
+
+// recordBackend — бэкенд, которому нужны записи зоны, а не её файл
+type recordBackend interface {
+    needsRecords() bool
+}
+
+func wantsRecords(backend Backend) bool {
+    rb, ok := backend.(recordBackend)
+    return ok && rb.needsRecords()
+}
+
+// Backend — DNS сервер, который обслуживает зоны панели. Файлы первичных
+// зон панель пишет сама, бэкенд только сообщает о них серверу.
+type Backend interface {
+    Name() string
+    // WriteZone добавляет зону на сервер или перечитывает её файл
+    WriteZone(zone ZoneConfig) error
+    // RemoveZone убирает зону с сервера и удаляет её файл
+    RemoveZone(name string) error
+    Reload() error
+    // Status возвращает nil, если сервер работает
+    Status() error
+    // CheckConfig проверяет конфигурацию сервера
+    CheckConfig() error
+}
+
+// NewBackend создаёт бэкенд по имени из dns.backend
+func NewBackend(name string, runner CommandRunner) (Backend, error) {
+    switch strings.ToLower(name) {
+    case "", "nsd":
+        return NewNSDBackend(runner), nil
+    case "knot":
+        return NewKnotBackend(runner), nil
+    case "bind":
+        return NewBindBackend(runner), nil
+    case "powerdns":
+        return NewPowerDNSBackend(), nil
+    case "embedded":
+        return NewEmbeddedBackend(), nil
+    }
+    return nil, fmt.Errorf("неизвестный DNS сервер: %s", name)
+}
+
+var (
+    backendMu     sync.RWMutex
+    activeBackend Backend = NewNSDBackend(ExecRunner{})
+    // mirrorBackends получают те же зоны, что и основной сервер. Их ошибки
+    // только пишутся в лог и не мешают публикации зоны.
+    mirrorBackends []Backend
+)
+
+// InitBackend выбирает DNS сервер по имени из конфига
+func InitBackend(name string) error {
+    backend, err := NewBackend(name, ExecRunner{})
+    if err != nil {
+        return err
+    }
+    SetBackend(backend)
+    return nil
+}
+
+// InitMirrors создаёт дополнительные серверы из dns.mirrors
+func InitMirrors(names []string) error {
+    var mirrors []Backend
+    for _, name := range names {
+        backend, err := NewBackend(name, ExecRunner{})
+        if err != nil {
+            return err
+        }
+        mirrors = append(mirrors, backend)
+    }
+    SetMirrors(mirrors)
+    return nil
+}
+
+// SetMirrors заменяет список дополнительных серверов
+func SetMirrors(mirrors []Backend) {
+    backendMu.Lock()
+    mirrorBackends = mirrors
+    backendMu.Unlock()
+}
+
+// CurrentMirrors возвращает дополнительные серверы
+func CurrentMirrors() []Backend {
+    backendMu.RLock()
+    defer backendMu.RUnlock()
+    return mirrorBackends
+}
+
+// SetBackend заменяет текущий бэкенд
+func SetBackend(backend Backend) {
+    backendMu.Lock()
+    activeBackend = backend
+    backendMu.Unlock()
+}
+
+// CurrentBackend возвращает текущий бэкенд
+func CurrentBackend() Backend {
+    backendMu.RLock()
+    defer backendMu.RUnlock()
+    return activeBackend
+}
+
+// zoneConfigFor описывает зону домена для бэкенда
+func zoneConfigFor(db *models.DB, domain *models.Domain) (ZoneConfig, error) {
+    zone := ZoneConfig{Name: domain.Name, File: ZoneFilePath(domain.Name)}
+    if domain.IsSecondary() {
+        zone.Secondary = true
+        zone.Primaries = domain.PrimaryList()
+        zone.TSIGKey = domain.TSIGKey
+        if zone.TSIGKey != "" {
+            key, err := lookupTSIGKey(db, zone.TSIGKey)
+            if err != nil {
+                return zone, err
+            }
+            zone.TSIG = key
+        }
+    }
+    return zone, nil
+}
+
+// PublishZone записывает файл первичной зоны и сообщает о зоне DNS серверу
+func PublishZone(db *models.DB, domainID int64) error {
+    domain, err := models.GetDomainByID(db, domainID)
+    if err != nil {
+        return err
+    }
+    if domain == nil {
+        return fmt.Errorf("домен %d не найден", domainID)
+    }
+    if !domain.IsSecondary() {
+        if err := GenerateZone(db, domainID); err != nil {
+            return err
+        }
+        // Удалённые серверы получают файл независимо от перезагрузки локального
+        QueueZoneSync(domain.Name)
+    }
+
+    backend, mirrors := CurrentBackend(), CurrentMirrors()
+    zone, err := zoneConfigFor(db, domain)
+    if err != nil {
+        return err
+    }
+    needRecords := wantsRecords(backend)
+    for _, mirror := range mirrors {
+        needRecords = needRecords || wantsRecords(mirror)
+    }
+    if needRecords && !domain.IsSecondary() {
+        records, err := models.GetRecordsByDomainID(db, domainID)
+        if err != nil {
+            return err
+        }
+        zone.Domain, zone.Records = domain, records
+    } else if needRecords {
+        zone.Domain = domain
+    }
+
+    if err := backend.WriteZone(zone); err != nil {
+        return err
+    }
+    for _, mirror := range mirrors {
+        if err := mirror.WriteZone(zone); err != nil {
+            log.Printf("Zone %s: %s mirror failed: %v", domain.Name, mirror.Name(), err)
+        }
+    }
+    return nil
+}
+
+// UnpublishZone убирает зону с DNS сервера, дополнительных и удалённых серверов.
+// Ошибка основного сервера пишется в лог и возвращается.
+func UnpublishZone(name string) error {
+    QueueZoneRemoval(name)
+    err := CurrentBackend().RemoveZone(name)
+    if err != nil {
+        log.Printf("Zone %s removal failed: %v", name, err)
+    }
+    for _, mirror := range CurrentMirrors() {
+        if merr := mirror.RemoveZone(name); merr != nil {
+            log.Printf("Zone %s: %s mirror removal failed: %v", name, mirror.Name(), merr)
+        }
+    }
+    return err
+}
+
+// ReloadServer перезагружает DNS сервер, ошибку пишет в лог. Ошибки
+// дополнительных серверов на результат не влияют.
+func ReloadServer() bool {
+    for _, mirror := range CurrentMirrors() {
+        if err := mirror.Reload(); err != nil {
+            log.Printf("%s mirror reload failed: %v", mirror.Name(), err)
+        }
+    }
+    if err := CurrentBackend().Reload(); err != nil {
+        log.Printf("%s reload failed: %v", CurrentBackend().Name(), err)
+        return false
+    }
+    return true
+}
+
+// runBackendCommand выполняет команду и добавляет её вывод к ошибке
+func runBackendCommand(runner CommandRunner, name string, args ...string) (string, error) {
+    out, err := runner.Run(name, args...)
+    output := strings.TrimSpace(string(out))
+    if err != nil {
+        if output != "" {
+            return output, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, output)
+        }
+        return output, fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+    }
+    return output, nil
+}
+
+// hostPort разбирает адрес вида IP или IP@порт
+func hostPort(addr string) (string, string) {
+    if i := strings.LastIndex(addr, "@"); i >= 0 {
+        return addr[:i], addr[i+1:]
+    }
+    return addr, ""
+}
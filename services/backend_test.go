@@ -0,0 +1,332 @@
+package services
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+// recordingRunner запоминает выполненные команды. Команды из fail один раз
+// завершаются ошибкой с заданным выводом.
+type recordingRunner struct {
+    calls []string
+    fail  map[string]string
+}
+
+func (r *recordingRunner) Run(name string, args ...string) ([]byte, error) {
+    command := strings.Join(append([]string{name}, args...), " ")
+    r.calls = append(r.calls, command)
+    if out, ok := r.fail[command]; ok {
+        delete(r.fail, command)
+        return []byte(out), errors.New("exit status 1")
+    }
+    return nil, nil
+}
+
+// take возвращает команды, выполненные с прошлого вызова
+func (r *recordingRunner) take() []string {
+    calls := r.calls
+    r.calls = nil
+    return calls
+}
+
+func expectCommands(t *testing.T, runner *recordingRunner, want ...string) {
+    t.Helper()
+    if got := runner.take(); !reflect.DeepEqual(got, want) {
+        t.Errorf("команды:\n  %q\nожидались:\n  %q", got, want)
+    }
+}
+
+// setupBackendConfig задаёт команды серверов и временный каталог зон
+func setupBackendConfig(t *testing.T) string {
+    t.Helper()
+    dir := t.TempDir()
+    viper.Set("nsd.enabled", true)
+    viper.Set("nsd.control", "nsd-control")
+    viper.Set("nsd.checkconf", "nsd-checkconf")
+    viper.Set("nsd.conf", "/etc/nsd/nsd.conf")
+    viper.Set("nsd.zone_dir", dir)
+    viper.Set("knot.control", "knotc")
+    viper.Set("bind.rndc", "rndc")
+    viper.Set("bind.checkconf", "named-checkconf")
+    return dir
+}
+
+// useBackend подменяет основной и дополнительные серверы на время теста
+func useBackend(t *testing.T, backend Backend, mirrors ...Backend) {
+    t.Helper()
+    prevBackend, prevMirrors := CurrentBackend(), CurrentMirrors()
+    SetBackend(backend)
+    SetMirrors(mirrors)
+    t.Cleanup(func() {
+        SetBackend(prevBackend)
+        SetMirrors(prevMirrors)
+    })
+}
+
+func newTestDB(t *testing.T) *models.DB {
+    t.Helper()
+    db, err := models.InitDB("file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+func TestNSDBackendCommands(t *testing.T) {
+    setupBackendConfig(t)
+    runner := &recordingRunner{}
+    backend := NewNSDBackend(runner)
+
+    // Изменение известной зоны: перечитывается только её файл
+    if err := backend.WriteZone(ZoneConfig{Name: "example.com"}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "nsd-control reload example.com")
+
+    // Новая зона: NSD её не знает, сначала перечитывается zones.conf
+    runner.fail = map[string]string{"nsd-control reload new.com": "error zone new.com not found"}
+    if err := backend.WriteZone(ZoneConfig{Name: "new.com"}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "nsd-control reload new.com", "nsd-control reconfig", "nsd-control reload new.com")
+
+    if err := backend.WriteZone(ZoneConfig{Name: "sec.com", Secondary: true, Primaries: []string{"192.0.2.1"}}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "nsd-control reconfig")
+
+    // Файл зоны удаляет менеджер NSD, команды сервера не нужны
+    backend.RemoveZone("example.com")
+    expectCommands(t, runner)
+
+    if err := backend.CheckConfig(); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "nsd-checkconf /etc/nsd/nsd.conf")
+
+    runner.fail = map[string]string{"nsd-control reload broken.com": "error: zone broken.com has errors"}
+    if err := backend.WriteZone(ZoneConfig{Name: "broken.com"}); err == nil || !strings.Contains(err.Error(), "has errors") {
+        t.Errorf("ожидалась ошибка с выводом nsd-control, получено %v", err)
+    }
+    expectCommands(t, runner, "nsd-control reload broken.com")
+}
+
+func TestKnotBackendCommands(t *testing.T) {
+    dir := setupBackendConfig(t)
+    runner := &recordingRunner{}
+    backend := NewKnotBackend(runner)
+
+    if err := backend.WriteZone(ZoneConfig{Name: "example.com", File: ZoneFilePath("example.com")}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "knotc zone-status example.com", "knotc zone-reload example.com")
+
+    file := ZoneFilePath("new.com")
+    runner.fail = map[string]string{"knotc zone-status new.com": "error: (no such zone found)"}
+    if err := backend.WriteZone(ZoneConfig{Name: "new.com", File: file}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner,
+        "knotc zone-status new.com",
+        "knotc conf-begin",
+        "knotc conf-set zone[new.com]",
+        "knotc conf-set zone[new.com].file "+file,
+        "knotc conf-commit")
+
+    runner.fail = map[string]string{"knotc zone-status sec.com": "error: (no such zone found)"}
+    err := backend.WriteZone(ZoneConfig{Name: "sec.com", File: ZoneFilePath("sec.com"), Secondary: true,
+        Primaries: []string{"192.0.2.1@5353"}, TSIGKey: "xfr-key",
+        TSIG: &tsigKey{Name: "xfr-key", Algorithm: "hmac-sha256", Secret: []byte("secret")}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner,
+        "knotc zone-status sec.com",
+        "knotc conf-begin",
+        "knotc conf-set zone[sec.com]",
+        "knotc conf-set zone[sec.com].file "+ZoneFilePath("sec.com"),
+        "knotc conf-set key[xfr-key]",
+        "knotc conf-set key[xfr-key].algorithm hmac-sha256",
+        "knotc conf-set key[xfr-key].secret c2VjcmV0",
+        "knotc conf-set remote[dnsmgr-192-0-2-1-p5353-k-xfr-key]",
+        "knotc conf-set remote[dnsmgr-192-0-2-1-p5353-k-xfr-key].address 192.0.2.1@5353",
+        "knotc conf-set remote[dnsmgr-192-0-2-1-p5353-k-xfr-key].key xfr-key",
+        "knotc conf-set zone[sec.com].master dnsmgr-192-0-2-1-p5353-k-xfr-key",
+        "knotc conf-commit")
+
+    // Существующей вторичной зоне заново задаются первичные серверы
+    if err := backend.WriteZone(ZoneConfig{Name: "sec.com", Secondary: true, Primaries: []string{"192.0.2.2"}}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner,
+        "knotc zone-status sec.com",
+        "knotc conf-begin",
+        "knotc conf-unset zone[sec.com].master",
+        "knotc conf-set remote[dnsmgr-192-0-2-2]",
+        "knotc conf-set remote[dnsmgr-192-0-2-2].address 192.0.2.2",
+        "knotc conf-set zone[sec.com].master dnsmgr-192-0-2-2",
+        "knotc conf-commit",
+        "knotc zone-refresh sec.com")
+
+    // Ссылка на ключ без его описания Knot не примет
+    err = backend.WriteZone(ZoneConfig{Name: "sec.com", Secondary: true, Primaries: []string{"192.0.2.2"}, TSIGKey: "xfr-key"})
+    if err == nil {
+        t.Error("TSIG ключ без секрета принят")
+    }
+    expectCommands(t, runner, "knotc zone-status sec.com")
+
+    // Ошибка внутри транзакции отменяет её
+    runner.fail = map[string]string{
+        "knotc zone-status bad.com":           "error: (no such zone found)",
+        "knotc conf-set zone[bad.com].file " + ZoneFilePath("bad.com"): "error: invalid item",
+    }
+    if err := backend.WriteZone(ZoneConfig{Name: "bad.com", File: ZoneFilePath("bad.com")}); err == nil {
+        t.Error("ожидалась ошибка conf-set")
+    }
+    expectCommands(t, runner,
+        "knotc zone-status bad.com",
+        "knotc conf-begin",
+        "knotc conf-set zone[bad.com]",
+        "knotc conf-set zone[bad.com].file "+ZoneFilePath("bad.com"),
+        "knotc conf-abort")
+
+    if err := os.WriteFile(filepath.Join(dir, "new.com.zone"), []byte("; zone\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := backend.RemoveZone("new.com"); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "knotc conf-begin", "knotc conf-unset zone[new.com]", "knotc conf-commit")
+    if _, err := os.Stat(filepath.Join(dir, "new.com.zone")); !os.IsNotExist(err) {
+        t.Error("файл зоны не удалён")
+    }
+
+    if err := backend.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    if err := backend.CheckConfig(); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "knotc reload", "knotc conf-check")
+}
+
+func TestBindBackendCommands(t *testing.T) {
+    dir := setupBackendConfig(t)
+    runner := &recordingRunner{}
+    backend := NewBindBackend(runner)
+
+    if err := backend.WriteZone(ZoneConfig{Name: "example.com", File: ZoneFilePath("example.com")}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "rndc reload example.com")
+
+    file := ZoneFilePath("new.com")
+    runner.fail = map[string]string{"rndc reload new.com": "rndc: 'reload' failed: not found\nno matching zone 'new.com' in any view"}
+    if err := backend.WriteZone(ZoneConfig{Name: "new.com", File: file}); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "rndc reload new.com", `rndc addzone new.com { type primary; file "`+file+`"; };`)
+
+    secFile := ZoneFilePath("sec.com")
+    secOptions := `{ type secondary; file "` + secFile + `"; primaries { 192.0.2.1 key "xfr-key"; 192.0.2.2 port 5353 key "xfr-key"; }; };`
+    runner.fail = map[string]string{"rndc modzone sec.com " + secOptions: "rndc: 'modzone' failed: not found"}
+    err := backend.WriteZone(ZoneConfig{Name: "sec.com", File: secFile, Secondary: true,
+        Primaries: []string{"192.0.2.1", "192.0.2.2@5353"}, TSIGKey: "xfr-key"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "rndc modzone sec.com "+secOptions, "rndc addzone sec.com "+secOptions)
+
+    // Существующей вторичной зоне заменяется описание
+    err = backend.WriteZone(ZoneConfig{Name: "sec.com", File: secFile, Secondary: true, Primaries: []string{"192.0.2.3"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner,
+        `rndc modzone sec.com { type secondary; file "`+secFile+`"; primaries { 192.0.2.3; }; };`,
+        "rndc refresh sec.com")
+
+    // Ошибка, не связанная с отсутствием зоны, не приводит к addzone
+    runner.fail = map[string]string{"rndc reload example.com": "rndc: connect failed: 127.0.0.1#953: connection refused"}
+    if err := backend.WriteZone(ZoneConfig{Name: "example.com"}); err == nil || !strings.Contains(err.Error(), "connection refused") {
+        t.Errorf("ожидалась ошибка rndc, получено %v", err)
+    }
+    expectCommands(t, runner, "rndc reload example.com")
+
+    if err := os.WriteFile(filepath.Join(dir, "new.com.zone"), []byte("; zone\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := backend.RemoveZone("new.com"); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "rndc delzone new.com")
+    if _, err := os.Stat(filepath.Join(dir, "new.com.zone")); !os.IsNotExist(err) {
+        t.Error("файл зоны не удалён")
+    }
+
+    // Зоны уже нет на сервере — это не ошибка
+    runner.fail = map[string]string{"rndc delzone gone.com": "rndc: 'delzone' failed: not found"}
+    if err := backend.RemoveZone("gone.com"); err != nil {
+        t.Errorf("удаление отсутствующей зоны: %v", err)
+    }
+    expectCommands(t, runner, "rndc delzone gone.com")
+
+    if err := backend.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    if err := backend.CheckConfig(); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner, "rndc reload", "named-checkconf")
+}
+
+func TestBackendErrorsReachCallers(t *testing.T) {
+    setupBackendConfig(t)
+    db := newTestDB(t)
+    // Вторичная зона публикуется без генерации файла
+    id, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "sec.test", UserID: 1,
+        Kind: models.DomainSecondary, Primaries: "192.0.2.1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    runner := &recordingRunner{fail: map[string]string{
+        "knotc zone-status sec.test": "error: (no such zone found)",
+        "knotc conf-commit":          "error: (conflicting item)",
+    }}
+    mirrorRunner := &recordingRunner{}
+    useBackend(t, NewKnotBackend(runner), NewBindBackend(mirrorRunner))
+
+    if err := PublishZone(db, id); err == nil || !strings.Contains(err.Error(), "conflicting item") {
+        t.Errorf("PublishZone: ожидалась ошибка knotc, получено %v", err)
+    }
+    // После ошибки основного сервера дополнительные не трогаются
+    expectCommands(t, mirrorRunner)
+
+    runner.fail = map[string]string{"knotc conf-unset zone[sec.test]": "error: (no such zone)"}
+    if err := UnpublishZone("sec.test"); err == nil || !strings.Contains(err.Error(), "no such zone") {
+        t.Errorf("UnpublishZone: ожидалась ошибка knotc, получено %v", err)
+    }
+    // Дополнительный сервер всё равно получает удаление
+    expectCommands(t, mirrorRunner, "rndc delzone sec.test")
+
+    runner.fail = map[string]string{"knotc reload": "error: (connection refused)"}
+    if ReloadServer() {
+        t.Error("ReloadServer: ожидалась ошибка основного сервера")
+    }
+
+    // Ошибка дополнительного сервера на результат не влияет
+    mirrorRunner.fail = map[string]string{"rndc reload": "rndc: connect failed"}
+    if !ReloadServer() {
+        t.Error("ReloadServer: ошибка дополнительного сервера не должна влиять на результат")
+    }
+    expectCommands(t, mirrorRunner, "rndc reload", "rndc reload")
+}
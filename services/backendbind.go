@@ -0,0 +1,90 @@
+package services
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// BindBackend — BIND 9. Зоны добавляются через rndc addzone, поэтому в
+// named.conf должно быть включено allow-new-zones.
+type BindBackend struct {
+    Runner CommandRunner
+}
+
+func NewBindBackend(runner CommandRunner) *BindBackend {
+    return &BindBackend{Runner: runner}
+}
+
+func (b *BindBackend) Name() string { return "bind" }
+
+func (b *BindBackend) rndc(args ...string) (string, error) {
+    return runBackendCommand(b.Runner, viper.GetString("bind.rndc"), args...)
+}
+
+// bindZoneOptions формирует описание зоны для rndc addzone
+func bindZoneOptions(zone ZoneConfig) string {
+    if !zone.Secondary {
+        return fmt.Sprintf(`{ type primary; file "%s"; };`, zone.File)
+    }
+    var primaries strings.Builder
+    for _, primary := range zone.Primaries {
+        host, port := hostPort(primary)
+        primaries.WriteString(host)
+        if port != "" {
+            primaries.WriteString(" port " + port)
+        }
+        if zone.TSIGKey != "" {
+            fmt.Fprintf(&primaries, ` key "%s"`, zone.TSIGKey)
+        }
+        primaries.WriteString("; ")
+    }
+    return fmt.Sprintf(`{ type secondary; file "%s"; primaries { %s}; };`, zone.File, primaries.String())
+}
+
+func (b *BindBackend) WriteZone(zone ZoneConfig) error {
+    var out string
+    var err error
+    if zone.Secondary {
+        // Первичные серверы и ключ могли измениться: modzone заменяет
+        // описание зоны, после чего она запрашивается заново
+        if out, err = b.rndc("modzone", zone.Name, bindZoneOptions(zone)); err == nil {
+            _, err = b.rndc("refresh", zone.Name)
+            return err
+        }
+    } else {
+        out, err = b.rndc("reload", zone.Name)
+    }
+    if err == nil || !strings.Contains(out, "not found") {
+        return err
+    }
+    _, err = b.rndc("addzone", zone.Name, bindZoneOptions(zone))
+    return err
+}
+
+func (b *BindBackend) RemoveZone(name string) error {
+    if out, err := b.rndc("delzone", name); err != nil && !strings.Contains(out, "not found") {
+        return err
+    }
+    if err := os.Remove(ZoneFilePath(name)); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func (b *BindBackend) Reload() error {
+    _, err := b.rndc("reload")
+    return err
+}
+
+func (b *BindBackend) Status() error {
+    _, err := b.rndc("status")
+    return err
+}
+
+func (b *BindBackend) CheckConfig() error {
+    _, err := runBackendCommand(b.Runner, viper.GetString("bind.checkconf"))
+    return err
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+    "encoding/base64"
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// KnotBackend — Knot DNS. Зоны добавляются транзакциями knotc conf-*,
+// поэтому Knot должен работать с базой конфигурации (confdb).
+type KnotBackend struct {
+    Runner CommandRunner
+}
+
+func NewKnotBackend(runner CommandRunner) *KnotBackend {
+    return &KnotBackend{Runner: runner}
+}
+
+func (b *KnotBackend) Name() string { return "knot" }
+
+func (b *KnotBackend) knotc(args ...string) (string, error) {
+    return runBackendCommand(b.Runner, viper.GetString("knot.control"), args...)
+}
+
+// knotRemoteID — идентификатор remote для первичного сервера. Ключ входит в
+// идентификатор, чтобы зоны с разными ключами не делили один remote.
+func knotRemoteID(addr, key string) string {
+    replacer := strings.NewReplacer(".", "-", ":", "-", "@", "-p")
+    id := "dnsmgr-" + replacer.Replace(addr)
+    if key != "" {
+        id += "-k-" + replacer.Replace(key)
+    }
+    return id
+}
+
+// confTransaction выполняет изменения конфигурации в одной транзакции
+func (b *KnotBackend) confTransaction(commands [][]string) error {
+    if _, err := b.knotc("conf-begin"); err != nil {
+        return err
+    }
+    for _, args := range commands {
+        if _, err := b.knotc(args...); err != nil {
+            b.knotc("conf-abort")
+            return err
+        }
+    }
+    _, err := b.knotc("conf-commit")
+    return err
+}
+
+// knotPrimaryCommands описывает TSIG ключ, remote первичных серверов и
+// задаёт их зоне
+func knotPrimaryCommands(zone ZoneConfig) ([][]string, error) {
+    var commands [][]string
+    if zone.TSIGKey != "" {
+        // remote ссылается на ключ, поэтому ключ должен быть описан в той же конфигурации
+        if zone.TSIG == nil {
+            return nil, fmt.Errorf("секрет TSIG ключа %s не передан", zone.TSIGKey)
+        }
+        key := fmt.Sprintf("key[%s]", zone.TSIGKey)
+        commands = append(commands,
+            []string{"conf-set", key},
+            []string{"conf-set", key + ".algorithm", zone.TSIG.Algorithm},
+            []string{"conf-set", key + ".secret", base64.StdEncoding.EncodeToString(zone.TSIG.Secret)})
+    }
+    section := fmt.Sprintf("zone[%s]", zone.Name)
+    for _, primary := range zone.Primaries {
+        // Knot принимает адрес в том же виде IP@порт
+        id := knotRemoteID(primary, zone.TSIGKey)
+        commands = append(commands,
+            []string{"conf-set", fmt.Sprintf("remote[%s]", id)},
+            []string{"conf-set", fmt.Sprintf("remote[%s].address", id), primary})
+        if zone.TSIGKey != "" {
+            commands = append(commands, []string{"conf-set", fmt.Sprintf("remote[%s].key", id), zone.TSIGKey})
+        }
+        commands = append(commands, []string{"conf-set", section + ".master", id})
+    }
+    return commands, nil
+}
+
+func (b *KnotBackend) WriteZone(zone ZoneConfig) error {
+    section := fmt.Sprintf("zone[%s]", zone.Name)
+    _, err := b.knotc("zone-status", zone.Name)
+    exists := err == nil
+    if exists && !zone.Secondary {
+        // Зона уже есть: перечитываем файл
+        _, err = b.knotc("zone-reload", zone.Name)
+        return err
+    }
+
+    var commands [][]string
+    if exists {
+        // Первичные серверы и ключ могли измениться: заменяем список master
+        commands = append(commands, []string{"conf-unset", section + ".master"})
+    } else {
+        commands = append(commands,
+            []string{"conf-set", section},
+            []string{"conf-set", section + ".file", zone.File})
+    }
+    if zone.Secondary {
+        primaryCommands, err := knotPrimaryCommands(zone)
+        if err != nil {
+            return err
+        }
+        commands = append(commands, primaryCommands...)
+    }
+    if err := b.confTransaction(commands); err != nil {
+        return err
+    }
+    if exists {
+        // Запрашиваем обновление с первичного по новым настройкам
+        _, err = b.knotc("zone-refresh", zone.Name)
+        return err
+    }
+    return nil
+}
+
+func (b *KnotBackend) RemoveZone(name string) error {
+    if err := b.confTransaction([][]string{{"conf-unset", fmt.Sprintf("zone[%s]", name)}}); err != nil {
+        return err
+    }
+    if err := os.Remove(ZoneFilePath(name)); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+func (b *KnotBackend) Reload() error {
+    _, err := b.knotc("reload")
+    return err
+}
+
+func (b *KnotBackend) Status() error {
+    _, err := b.knotc("status")
+    return err
+}
+
+func (b *KnotBackend) CheckConfig() error {
+    _, err := b.knotc("conf-check")
+    return err
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+    "errors"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// NSDBackend — NSD. Зоны перечислены в zones.conf (см. WriteZonesConf),
+// файлы и перезагрузку ведёт менеджер NSD.
+type NSDBackend struct {
+    Runner CommandRunner
+}
+
+func NewNSDBackend(runner CommandRunner) *NSDBackend {
+    return &NSDBackend{Runner: runner}
+}
+
+func (b *NSDBackend) Name() string { return "nsd" }
+
+func (b *NSDBackend) control(args ...string) (string, error) {
+    return runBackendCommand(b.Runner, viper.GetString("nsd.control"), args...)
+}
+
+// WriteZone перечитывает файл зоны. Новые зоны NSD узнаёт из zones.conf,
+// поэтому для незнакомой зоны сначала перечитывается конфигурация.
+func (b *NSDBackend) WriteZone(zone ZoneConfig) error {
+    if !viper.GetBool("nsd.enabled") {
+        return nil
+    }
+    if zone.Secondary {
+        _, err := b.control("reconfig")
+        return err
+    }
+    out, err := b.control("reload", zone.Name)
+    if err != nil && strings.Contains(out, "not found") {
+        if _, err := b.control("reconfig"); err != nil {
+            return err
+        }
+        _, err = b.control("reload", zone.Name)
+        return err
+    }
+    return err
+}
+
+func (b *NSDBackend) RemoveZone(name string) error {
+    return DeleteZoneFile(name)
+}
+
+func (b *NSDBackend) Reload() error {
+    if !ReloadNSD() {
+        return errors.New("NSD не перезагружен (возможно нужны права sudo)")
+    }
+    return nil
+}
+
+func (b *NSDBackend) Status() error {
+    if !CheckNSDStatus() {
+        return errors.New("NSD не запущен")
+    }
+    return nil
+}
+
+func (b *NSDBackend) CheckConfig() error {
+    _, err := runBackendCommand(b.Runner, viper.GetString("nsd.checkconf"), viper.GetString("nsd.conf"))
+    return err
+}
+
+// TransferStatus запрашивает у NSD состояние передачи вторичной зоны
+func (b *NSDBackend) TransferStatus(name string) ZoneTransferStatus {
+    out, err := b.control("zonestatus", name)
+    if err != nil {
+        return ZoneTransferStatus{Error: err.Error()}
+    }
+    return parseNSDZoneStatus(out)
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+// PowerDNSBackend — авторитативный PowerDNS. Зоны передаются через HTTP API:
+// панель читает текущие RRset'ы зоны и отправляет PATCH только с отличиями.
+// Файлы зон панель продолжает писать, но PowerDNS их не читает.
+type PowerDNSBackend struct {
+    BaseURL  string // адрес API, например http://127.0.0.1:8081
+    APIKey   string
+    ServerID string
+    ZoneKind string // Native или Master для первичных зон
+    Client   *http.Client
+}
+
+func NewPowerDNSBackend() *PowerDNSBackend {
+    return &PowerDNSBackend{
+        BaseURL:  viper.GetString("powerdns.url"),
+        APIKey:   viper.GetString("powerdns.api_key"),
+        ServerID: viper.GetString("powerdns.server_id"),
+        ZoneKind: viper.GetString("powerdns.zone_kind"),
+        Client:   &http.Client{Timeout: time.Duration(viper.GetInt("powerdns.timeout")) * time.Second},
+    }
+}
+
+func (b *PowerDNSBackend) Name() string { return "powerdns" }
+
+// needsRecords — PowerDNS получает записи зоны, а не файл
+func (b *PowerDNSBackend) needsRecords() bool { return true }
+
+// pdnsRecord и pdnsRRSet — объекты PowerDNS API
+type pdnsRecord struct {
+    Content  string `json:"content"`
+    Disabled bool   `json:"disabled"`
+}
+
+type pdnsRRSet struct {
+    Name       string       `json:"name"`
+    Type       string       `json:"type"`
+    TTL        int          `json:"ttl,omitempty"`
+    ChangeType string       `json:"changetype,omitempty"`
+    Records    []pdnsRecord `json:"records"`
+}
+
+type pdnsZone struct {
+    Name        string      `json:"name"`
+    Kind        string      `json:"kind"`
+    Masters     []string    `json:"masters"`
+    Nameservers []string    `json:"nameservers"`
+    SOAEditAPI  string      `json:"soa_edit_api"`
+    RRSets      []pdnsRRSet `json:"rrsets,omitempty"`
+}
+
+// pdnsError — ответ API с кодом ошибки
+type pdnsError struct {
+    Status  int
+    Message string
+}
+
+func (e *pdnsError) Error() string {
+    return fmt.Sprintf("PowerDNS API: %d %s", e.Status, e.Message)
+}
+
+func pdnsNotFound(err error) bool {
+    var apiErr *pdnsError
+    return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+func (b *PowerDNSBackend) serverID() string {
+    if b.ServerID == "" {
+        return "localhost"
+    }
+    return b.ServerID
+}
+
+func (b *PowerDNSBackend) zoneKind() string {
+    if b.ZoneKind == "" {
+        return "Native"
+    }
+    return b.ZoneKind
+}
+
+func (b *PowerDNSBackend) serverPath() string {
+    return "/api/v1/servers/" + url.PathEscape(b.serverID())
+}
+
+func (b *PowerDNSBackend) zonePath(name string) string {
+    return b.serverPath() + "/zones/" + url.PathEscape(absoluteName(name))
+}
+
+// request выполняет запрос к API и декодирует ответ в out, если он задан
+func (b *PowerDNSBackend) request(method, path string, body, out interface{}) error {
+    if b.BaseURL == "" {
+        return errors.New("не задан адрес PowerDNS API (powerdns.url)")
+    }
+    var reader io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        reader = bytes.NewReader(data)
+    }
+    req, err := http.NewRequest(method, strings.TrimSuffix(b.BaseURL, "/")+path, reader)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("X-API-Key", b.APIKey)
+    req.Header.Set("Accept", "application/json")
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    client := b.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+    if resp.StatusCode >= 300 {
+        apiErr := &pdnsError{Status: resp.StatusCode}
+        var payload struct {
+            Error string `json:"error"`
+        }
+        if json.Unmarshal(data, &payload) == nil && payload.Error != "" {
+            apiErr.Message = payload.Error
+        } else {
+            apiErr.Message = strings.TrimSpace(string(data))
+        }
+        return apiErr
+    }
+    if out != nil && len(data) > 0 {
+        return json.Unmarshal(data, out)
+    }
+    return nil
+}
+
+// pdnsMasters переводит адреса IP@порт в формат PowerDNS
+func pdnsMasters(primaries []string) []string {
+    masters := make([]string, 0, len(primaries))
+    for _, primary := range primaries {
+        host, port := hostPort(primary)
+        if port != "" {
+            host = net.JoinHostPort(host, port)
+        }
+        masters = append(masters, host)
+    }
+    return masters
+}
+
+func (b *PowerDNSBackend) WriteZone(zone ZoneConfig) error {
+    // Служебные зоны без записей в базе (каталог) в PowerDNS не передаются
+    if zone.Domain == nil {
+        return nil
+    }
+
+    var desired []pdnsRRSet
+    kind, masters := b.zoneKind(), []string{}
+    if zone.Secondary {
+        kind, masters = "Slave", pdnsMasters(zone.Primaries)
+    } else {
+        desired = pdnsRRSets(zone.Domain, zone.Records)
+    }
+
+    var current pdnsZone
+    err := b.request(http.MethodGet, b.zonePath(zone.Name), nil, &current)
+    if pdnsNotFound(err) {
+        return b.request(http.MethodPost, b.serverPath()+"/zones", pdnsZone{
+            Name:        absoluteName(zone.Name),
+            Kind:        kind,
+            Masters:     masters,
+            Nameservers: []string{},
+            RRSets:      desired,
+        }, nil)
+    }
+    if err != nil {
+        return err
+    }
+
+    if !strings.EqualFold(current.Kind, kind) || !sameStrings(current.Masters, masters) {
+        err := b.request(http.MethodPut, b.zonePath(zone.Name), map[string]interface{}{
+            "kind":    kind,
+            "masters": masters,
+        }, nil)
+        if err != nil {
+            return err
+        }
+    }
+    if zone.Secondary {
+        return nil
+    }
+
+    changes := diffRRSets(current.RRSets, desired)
+    if len(changes) == 0 {
+        return nil
+    }
+    return b.request(http.MethodPatch, b.zonePath(zone.Name), map[string]interface{}{"rrsets": changes}, nil)
+}
+
+func (b *PowerDNSBackend) RemoveZone(name string) error {
+    err := b.request(http.MethodDelete, b.zonePath(name), nil, nil)
+    if pdnsNotFound(err) {
+        return nil
+    }
+    return err
+}
+
+// Reload не нужен: PowerDNS применяет изменения API сразу
+func (b *PowerDNSBackend) Reload() error { return nil }
+
+func (b *PowerDNSBackend) Status() error {
+    return b.request(http.MethodGet, b.serverPath(), nil, nil)
+}
+
+func (b *PowerDNSBackend) CheckConfig() error {
+    if b.APIKey == "" {
+        return errors.New("не задан ключ PowerDNS API (powerdns.api_key)")
+    }
+    return b.Status()
+}
+
+// absoluteName возвращает имя в нижнем регистре с точкой на конце
+func absoluteName(name string) string {
+    return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// absoluteTarget превращает имя сервера из записи в абсолютное. Имена без точек
+// считаются относительными, как в файле зоны.
+func absoluteTarget(target, zone string) string {
+    target = strings.TrimSpace(target)
+    if target == "@" || target == "" {
+        return absoluteName(zone)
+    }
+    if strings.HasSuffix(target, ".") || strings.Contains(target, ".") {
+        return absoluteName(target)
+    }
+    return absoluteName(target + "." + zone)
+}
+
+// pdnsContent переводит содержимое записи панели в формат PowerDNS
+func pdnsContent(record models.Record, zone string) string {
+    switch record.Type {
+    case "MX":
+        return strconv.Itoa(record.Priority) + " " + absoluteTarget(record.Content, zone)
+    case "CNAME", "NS", "PTR":
+        return absoluteTarget(record.Content, zone)
+    case "AAAA":
+        if ip := net.ParseIP(record.Content); ip != nil {
+            return ip.String()
+        }
+    case "TXT":
+        // PowerDNS ждёт строки в кавычках; старые значения без кавычек
+        // считаются одной строкой
+        if content, err := NormalizeTXT(record.Content); err == nil {
+            return content
+        }
+    }
+    return record.Content
+}
+
+// soaFields возвращает первичный сервер и почтовый ящик администратора для
+// SOA зоны. В записи SOA панель хранит только адрес администратора.
+func soaFields(domain *models.Domain, email string, records []models.Record) (string, string) {
+    primary := domain.SOAPrimaryNS
+    if primary == "" {
+        for _, record := range records {
+            if record.Type == "NS" && recordFQDN(record.Name, domain.Name) == strings.ToLower(domain.Name) {
+                primary = record.Content
+                break
+            }
+        }
+    }
+    if primary == "" {
+        primary = "ns1." + domain.Name
+    }
+    if email == "" {
+        email = domain.SOAEmail
+    }
+    if email == "" {
+        email = "admin." + domain.Name
+    }
+    return absoluteTarget(primary, domain.Name), absoluteName(strings.Replace(email, "@", ".", 1))
+}
+
+// pdnsSOA собирает SOA зоны, остальные поля берутся из домена
+func pdnsSOA(domain *models.Domain, email string, records []models.Record) string {
+    primary, mbox := soaFields(domain, email, records)
+    return fmt.Sprintf("%s %s %d %d %d %d %d", primary, mbox,
+        domain.Serial, domain.SOARefresh, domain.SOARetry, domain.SOAExpire, domain.SOAMinimum)
+}
+
+// pdnsRRSets группирует записи домена в RRset'ы. TTL набора — наименьший
+// из TTL его записей.
+func pdnsRRSets(domain *models.Domain, records []models.Record) []pdnsRRSet {
+    index := make(map[string]int)
+    var sets []pdnsRRSet
+    add := func(name, rrType string, ttl int, content string) {
+        key := name + "|" + rrType
+        i, ok := index[key]
+        if !ok {
+            index[key] = len(sets)
+            sets = append(sets, pdnsRRSet{Name: name, Type: rrType, TTL: ttl})
+            i = len(sets) - 1
+        } else if ttl < sets[i].TTL {
+            sets[i].TTL = ttl
+        }
+        for _, existing := range sets[i].Records {
+            if existing.Content == content {
+                return
+            }
+        }
+        sets[i].Records = append(sets[i].Records, pdnsRecord{Content: content})
+    }
+
+    soaEmail, soaTTL := "", 0
+    for _, record := range records {
+        if record.Type == "SOA" {
+            soaEmail, soaTTL = record.Content, record.TTL
+            continue
+        }
+        add(absoluteName(recordFQDN(record.Name, domain.Name)), record.Type, record.TTL, pdnsContent(record, domain.Name))
+    }
+    if soaTTL == 0 {
+        soaTTL = domain.SOAMinimum
+    }
+    add(absoluteName(domain.Name), "SOA", soaTTL, pdnsSOA(domain, soaEmail, records))
+    return sets
+}
+
+// rrsetKey — ключ набора в нижнем регистре для сравнения
+func rrsetKey(set pdnsRRSet) string {
+    return strings.ToLower(set.Name) + "|" + strings.ToUpper(set.Type)
+}
+
+// rrsetContents возвращает отсортированное содержимое набора. Регистр
+// учитывается только у TXT, остальные данные в DNS от него не зависят.
+func rrsetContents(set pdnsRRSet) []string {
+    contents := make([]string, 0, len(set.Records))
+    for _, record := range set.Records {
+        content := record.Content
+        if set.Type != "TXT" {
+            content = strings.ToLower(content)
+        }
+        if record.Disabled {
+            content = "!" + content
+        }
+        contents = append(contents, content)
+    }
+    sort.Strings(contents)
+    return contents
+}
+
+// diffRRSets возвращает изменения, которые приводят current к desired:
+// REPLACE для новых и изменённых наборов, DELETE для лишних
+func diffRRSets(current, desired []pdnsRRSet) []pdnsRRSet {
+    existing := make(map[string]pdnsRRSet, len(current))
+    for _, set := range current {
+        existing[rrsetKey(set)] = set
+    }
+
+    var changes []pdnsRRSet
+    wanted := make(map[string]bool, len(desired))
+    for _, set := range desired {
+        key := rrsetKey(set)
+        wanted[key] = true
+        if old, ok := existing[key]; ok && old.TTL == set.TTL && sameStrings(rrsetContents(old), rrsetContents(set)) {
+            continue
+        }
+        set.ChangeType = "REPLACE"
+        changes = append(changes, set)
+    }
+    for _, set := range current {
+        if !wanted[rrsetKey(set)] {
+            changes = append(changes, pdnsRRSet{
+                Name:       set.Name,
+                Type:       set.Type,
+                ChangeType: "DELETE",
+                Records:    []pdnsRecord{},
+            })
+        }
+    }
+    return changes
+}
+
+func sameStrings(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
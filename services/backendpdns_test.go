@@ -0,0 +1,333 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
+    "testing"
+
+    "dns-manager/models"
+)
+
+// fakePowerDNS — минимальная замена PowerDNS API: хранит зоны в памяти и
+// применяет PATCH так же, как сервер
+type fakePowerDNS struct {
+    mu       sync.Mutex
+    zones    map[string]*pdnsZone
+    requests []string
+    patches  [][]pdnsRRSet
+    // errors — ответы с ошибкой для "METHOD путь"
+    errors map[string]fakeError
+}
+
+type fakeError struct {
+    status int
+    body   string
+}
+
+func newFakePowerDNS(t *testing.T) (*fakePowerDNS, *PowerDNSBackend) {
+    fake := &fakePowerDNS{zones: make(map[string]*pdnsZone), errors: make(map[string]fakeError)}
+    srv := httptest.NewServer(fake)
+    t.Cleanup(srv.Close)
+    return fake, &PowerDNSBackend{BaseURL: srv.URL, APIKey: "secret", Client: srv.Client()}
+}
+
+func (f *fakePowerDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    request := r.Method + " " + r.URL.Path
+    f.requests = append(f.requests, request)
+
+    if r.Header.Get("X-API-Key") != "secret" {
+        w.WriteHeader(http.StatusUnauthorized)
+        w.Write([]byte(`{"error": "Unauthorized"}`))
+        return
+    }
+    if e, ok := f.errors[request]; ok {
+        w.WriteHeader(e.status)
+        w.Write([]byte(e.body))
+        return
+    }
+
+    const server = "/api/v1/servers/localhost"
+    switch {
+    case r.URL.Path == server && r.Method == http.MethodGet:
+        w.Write([]byte(`{"id": "localhost", "daemon_type": "authoritative"}`))
+        return
+    case r.URL.Path == server+"/zones" && r.Method == http.MethodPost:
+        var zone pdnsZone
+        json.NewDecoder(r.Body).Decode(&zone)
+        if f.zones[zone.Name] != nil {
+            w.WriteHeader(http.StatusConflict)
+            w.Write([]byte(`{"error": "Domain '` + zone.Name + `' already exists"}`))
+            return
+        }
+        f.zones[zone.Name] = &zone
+        w.WriteHeader(http.StatusCreated)
+        json.NewEncoder(w).Encode(zone)
+        return
+    }
+
+    name := strings.TrimPrefix(r.URL.Path, server+"/zones/")
+    zone := f.zones[name]
+    if zone == nil {
+        w.WriteHeader(http.StatusNotFound)
+        w.Write([]byte(`{"error": "Could not find domain '` + name + `'"}`))
+        return
+    }
+    switch r.Method {
+    case http.MethodGet:
+        json.NewEncoder(w).Encode(zone)
+    case http.MethodPut:
+        var update pdnsZone
+        json.NewDecoder(r.Body).Decode(&update)
+        zone.Kind, zone.Masters = update.Kind, update.Masters
+        w.WriteHeader(http.StatusNoContent)
+    case http.MethodPatch:
+        var patch struct {
+            RRSets []pdnsRRSet `json:"rrsets"`
+        }
+        json.NewDecoder(r.Body).Decode(&patch)
+        f.patches = append(f.patches, patch.RRSets)
+        for _, change := range patch.RRSets {
+            var kept []pdnsRRSet
+            for _, set := range zone.RRSets {
+                if rrsetKey(set) != rrsetKey(change) {
+                    kept = append(kept, set)
+                }
+            }
+            if change.ChangeType == "REPLACE" {
+                change.ChangeType = ""
+                kept = append(kept, change)
+            }
+            zone.RRSets = kept
+        }
+        w.WriteHeader(http.StatusNoContent)
+    case http.MethodDelete:
+        delete(f.zones, name)
+        w.WriteHeader(http.StatusNoContent)
+    }
+}
+
+// takeRequests возвращает запросы, полученные с прошлого вызова
+func (f *fakePowerDNS) takeRequests() []string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    requests := f.requests
+    f.requests = nil
+    return requests
+}
+
+func pdnsTestDomain() *models.Domain {
+    return &models.Domain{
+        ID:         1,
+        Name:       "example.com",
+        SOAEmail:   "hostmaster@example.com",
+        SOARefresh: 7200,
+        SOARetry:   3600,
+        SOAExpire:  1209600,
+        SOAMinimum: 3600,
+        Serial:     2026101901,
+    }
+}
+
+func pdnsTestRecords() []models.Record {
+    return []models.Record{
+        {Type: "SOA", Name: "@", Content: "hostmaster@example.com", TTL: 3600},
+        {Type: "NS", Name: "@", Content: "ns1", TTL: 3600},
+        {Type: "A", Name: "ns1", Content: "192.0.2.53", TTL: 3600},
+        {Type: "A", Name: "www", Content: "192.0.2.1", TTL: 300},
+        {Type: "MX", Name: "@", Content: "mail.example.net.", Priority: 10, TTL: 300},
+        // Старая запись без кавычек — одна строка
+        {Type: "TXT", Name: "@", Content: "v=spf1 include:_spf.example.net ~all", TTL: 300},
+    }
+}
+
+// rrsetsByKey раскладывает наборы по ключу имя|тип
+func rrsetsByKey(sets []pdnsRRSet) map[string]pdnsRRSet {
+    byKey := make(map[string]pdnsRRSet, len(sets))
+    for _, set := range sets {
+        byKey[rrsetKey(set)] = set
+    }
+    return byKey
+}
+
+func TestPowerDNSCreatesZone(t *testing.T) {
+    fake, backend := newFakePowerDNS(t)
+    domain := pdnsTestDomain()
+
+    err := backend.WriteZone(ZoneConfig{Name: domain.Name, Domain: domain, Records: pdnsTestRecords()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []string{
+        "GET /api/v1/servers/localhost/zones/example.com.",
+        "POST /api/v1/servers/localhost/zones",
+    }
+    if got := fake.takeRequests(); !reflect.DeepEqual(got, want) {
+        t.Fatalf("запросы %q, ожидались %q", got, want)
+    }
+
+    zone := fake.zones["example.com."]
+    if zone == nil {
+        t.Fatal("зона не создана")
+    }
+    if zone.Kind != "Native" || len(zone.Masters) != 0 {
+        t.Errorf("kind %q masters %q", zone.Kind, zone.Masters)
+    }
+    sets := rrsetsByKey(zone.RRSets)
+    expect := map[string][]string{
+        "example.com.|SOA":   {"ns1.example.com. hostmaster.example.com. 2026101901 7200 3600 1209600 3600"},
+        "example.com.|NS":    {"ns1.example.com."},
+        "ns1.example.com.|A": {"192.0.2.53"},
+        "www.example.com.|A": {"192.0.2.1"},
+        "example.com.|MX":    {"10 mail.example.net."},
+        "example.com.|TXT":   {`"v=spf1 include:_spf.example.net ~all"`},
+    }
+    if len(sets) != len(expect) {
+        t.Errorf("наборов %d, ожидалось %d: %+v", len(sets), len(expect), zone.RRSets)
+    }
+    for key, contents := range expect {
+        set, ok := sets[key]
+        if !ok {
+            t.Errorf("нет набора %s", key)
+            continue
+        }
+        if got := rrsetContents(set); !reflect.DeepEqual(got, contents) {
+            t.Errorf("%s: %q, ожидалось %q", key, got, contents)
+        }
+    }
+}
+
+func TestPowerDNSPatchesOnlyChangedRRSets(t *testing.T) {
+    fake, backend := newFakePowerDNS(t)
+    domain := pdnsTestDomain()
+    records := pdnsTestRecords()
+    if err := backend.WriteZone(ZoneConfig{Name: domain.Name, Domain: domain, Records: records}); err != nil {
+        t.Fatal(err)
+    }
+    fake.takeRequests()
+
+    // Повторная публикация без изменений не отправляет PATCH
+    if err := backend.WriteZone(ZoneConfig{Name: domain.Name, Domain: domain, Records: records}); err != nil {
+        t.Fatal(err)
+    }
+    if got := fake.takeRequests(); !reflect.DeepEqual(got, []string{"GET /api/v1/servers/localhost/zones/example.com."}) {
+        t.Errorf("без изменений: запросы %q", got)
+    }
+
+    // Вторая A запись для www, MX удалён, TTL NS изменён
+    var changed []models.Record
+    for _, record := range records {
+        switch record.Type {
+        case "MX":
+            continue
+        case "NS":
+            record.TTL = 86400
+        }
+        changed = append(changed, record)
+    }
+    changed = append(changed, models.Record{Type: "A", Name: "www", Content: "192.0.2.2", TTL: 300})
+    if err := backend.WriteZone(ZoneConfig{Name: domain.Name, Domain: domain, Records: changed}); err != nil {
+        t.Fatal(err)
+    }
+    if len(fake.patches) != 1 {
+        t.Fatalf("PATCH отправлен %d раз", len(fake.patches))
+    }
+
+    var got []string
+    for _, change := range fake.patches[0] {
+        got = append(got, change.ChangeType+" "+rrsetKey(change))
+    }
+    sort.Strings(got)
+    want := []string{
+        "DELETE example.com.|MX",
+        "REPLACE example.com.|NS",
+        "REPLACE www.example.com.|A",
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("изменения %q, ожидались %q", got, want)
+    }
+
+    sets := rrsetsByKey(fake.zones["example.com."].RRSets)
+    if got := rrsetContents(sets["www.example.com.|A"]); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.2"}) {
+        t.Errorf("www A после PATCH: %q", got)
+    }
+    if sets["example.com.|NS"].TTL != 86400 {
+        t.Errorf("TTL NS после PATCH: %d", sets["example.com.|NS"].TTL)
+    }
+    if _, ok := sets["example.com.|MX"]; ok {
+        t.Error("MX не удалён")
+    }
+}
+
+func TestDiffRRSetsIgnoresCaseAndOrder(t *testing.T) {
+    current := []pdnsRRSet{
+        {Name: "Example.com.", Type: "NS", TTL: 3600, Records: []pdnsRecord{{Content: "NS2.example.com."}, {Content: "ns1.example.com."}}},
+        {Name: "example.com.", Type: "TXT", TTL: 300, Records: []pdnsRecord{{Content: `"Hello"`}}},
+    }
+    desired := []pdnsRRSet{
+        {Name: "example.com.", Type: "NS", TTL: 3600, Records: []pdnsRecord{{Content: "ns1.example.com."}, {Content: "ns2.example.com."}}},
+        {Name: "example.com.", Type: "TXT", TTL: 300, Records: []pdnsRecord{{Content: `"hello"`}}},
+    }
+    changes := diffRRSets(current, desired)
+    // Регистр важен только для TXT
+    if len(changes) != 1 || changes[0].Type != "TXT" || changes[0].ChangeType != "REPLACE" {
+        t.Errorf("изменения %+v", changes)
+    }
+}
+
+func TestPowerDNSErrors(t *testing.T) {
+    fake, backend := newFakePowerDNS(t)
+    domain := pdnsTestDomain()
+    zone := ZoneConfig{Name: domain.Name, Domain: domain, Records: pdnsTestRecords()}
+
+    // Сообщение из JSON ответа
+    backend.APIKey = "wrong"
+    err := backend.Status()
+    var apiErr *pdnsError
+    if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || apiErr.Message != "Unauthorized" {
+        t.Errorf("неверный ключ: %#v", err)
+    }
+    backend.APIKey = "secret"
+
+    // Ответ не в JSON передаётся как есть
+    fake.errors["POST /api/v1/servers/localhost/zones"] = fakeError{http.StatusUnprocessableEntity, "RRset example.com. IN TXT: bad content\n"}
+    err = backend.WriteZone(zone)
+    if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity || apiErr.Message != "RRset example.com. IN TXT: bad content" {
+        t.Errorf("ошибка создания: %#v", err)
+    }
+    if err == nil || err.Error() != "PowerDNS API: 422 RRset example.com. IN TXT: bad content" {
+        t.Errorf("текст ошибки: %v", err)
+    }
+    delete(fake.errors, "POST /api/v1/servers/localhost/zones")
+
+    if err := backend.WriteZone(zone); err != nil {
+        t.Fatal(err)
+    }
+    fake.errors["PATCH /api/v1/servers/localhost/zones/example.com."] = fakeError{http.StatusBadRequest, `{"error": "Conflicts with pre-existing RRset"}`}
+    zone.Records = append(zone.Records, models.Record{Type: "A", Name: "new", Content: "192.0.2.9", TTL: 300})
+    if err := backend.WriteZone(zone); err == nil || !strings.Contains(err.Error(), "400 Conflicts with pre-existing RRset") {
+        t.Errorf("ошибка PATCH: %v", err)
+    }
+    fake.errors = map[string]fakeError{}
+
+    // Удаление отсутствующей зоны — не ошибка, другие ошибки возвращаются
+    if err := backend.RemoveZone("missing.com"); err != nil {
+        t.Errorf("удаление отсутствующей зоны: %v", err)
+    }
+    fake.errors["DELETE /api/v1/servers/localhost/zones/example.com."] = fakeError{http.StatusInternalServerError, `{"error": "database is locked"}`}
+    if err := backend.RemoveZone("example.com"); err == nil || !strings.Contains(err.Error(), "database is locked") {
+        t.Errorf("ошибка удаления: %v", err)
+    }
+
+    backend.APIKey = ""
+    if err := backend.CheckConfig(); err == nil {
+        t.Error("CheckConfig без ключа должен вернуть ошибку")
+    }
+}
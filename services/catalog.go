@@ -0,0 +1,128 @@
+package services
+
+import (
+    "bytes"
+    "crypto/sha1"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// Каталожная зона (RFC 9432) перечисляет первичные зоны панели, чтобы
+// вторичные серверы добавляли и удаляли их без ручной правки конфигов.
+
+// CatalogEnabled сообщает, включена ли каталожная зона
+func CatalogEnabled() bool {
+    return viper.GetBool("catalog.enabled") && CatalogZoneName() != ""
+}
+
+// CatalogZoneName возвращает имя каталожной зоны без завершающей точки
+func CatalogZoneName() string {
+    return strings.TrimSuffix(strings.ToLower(viper.GetString("catalog.zone")), ".")
+}
+
+// CatalogMember — зона в каталоге
+type CatalogMember struct {
+    ID    string // уникальный идентификатор записи в каталоге
+    Name  string
+    Group string // свойство group, пустое — без группы
+}
+
+// catalogMemberID — стабильный идентификатор участника: SHA-1 от имени зоны
+// в формате DNS, как у других производителей каталогов
+func catalogMemberID(name string) string {
+    sum := sha1.Sum(appendWireName(nil, name))
+    return hex.EncodeToString(sum[:])
+}
+
+// catalogGroup возвращает группу домена по атрибуту из catalog.group_attribute:
+// org — организация, owner — владелец (организация или пользователь)
+func catalogGroup(d *models.Domain) string {
+    switch viper.GetString("catalog.group_attribute") {
+    case "org":
+        return d.OrgName
+    case "owner":
+        // Домен организации принадлежит ей, а не создавшему его пользователю
+        if d.OrgID != 0 {
+            return d.OrgName
+        }
+        return d.OwnerName
+    }
+    return ""
+}
+
+// CatalogMembers возвращает участников каталога: все активные первичные зоны.
+// Вторичные зоны в каталог не входят — их источник другой сервер.
+func CatalogMembers(db *models.DB) ([]CatalogMember, error) {
+    domains, err := models.GetAllDomains(db)
+    if err != nil {
+        return nil, err
+    }
+    catalog := CatalogZoneName()
+
+    var members []CatalogMember
+    for i := range domains {
+        d := &domains[i]
+        if d.IsSecondary() || d.Name == catalog {
+            continue
+        }
+        members = append(members, CatalogMember{ID: catalogMemberID(d.Name), Name: d.Name, Group: catalogGroup(d)})
+    }
+    return members, nil
+}
+
+// renderCatalogRecords формирует записи каталога без SOA
+func renderCatalogRecords(members []CatalogMember) []byte {
+    zone := CatalogZoneName() + "."
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "%s 0 IN NS invalid.\n", zone)
+    fmt.Fprintf(&b, "version.%s 0 IN TXT \"2\"\n", zone)
+    for _, m := range members {
+        fmt.Fprintf(&b, "%s.zones.%s 0 IN PTR %s.\n", m.ID, zone, m.Name)
+        if m.Group != "" {
+            fmt.Fprintf(&b, "group.%s.zones.%s 0 IN TXT %s\n", m.ID, zone, FormatTXT(SplitTXT(m.Group)))
+        }
+    }
+    return b.Bytes()
+}
+
+func catalogSOA(serial uint32) string {
+    return fmt.Sprintf("%s. 0 IN SOA invalid. invalid. %d 3600 600 2147483646 0\n", CatalogZoneName(), serial)
+}
+
+// UpdateCatalogZone перезаписывает файл каталожной зоны, если состав каталога
+// изменился. Возвращает true, если зона изменилась и вторичным нужен NOTIFY.
+func UpdateCatalogZone(db *models.DB) (bool, error) {
+    if !CatalogEnabled() {
+        return false, nil
+    }
+    members, err := CatalogMembers(db)
+    if err != nil {
+        return false, err
+    }
+    records := renderCatalogRecords(members)
+
+    path := ZoneFilePath(CatalogZoneName())
+    if current, err := os.ReadFile(path); err == nil {
+        // Первая строка — SOA, остальное сравниваем с новым содержимым
+        if i := bytes.IndexByte(current, '\n'); i >= 0 && bytes.Equal(current[i+1:], records) {
+            return false, nil
+        }
+    }
+
+    serial, err := models.NextCatalogSerial(db)
+    if err != nil {
+        return false, err
+    }
+    data := append([]byte(catalogSOA(serial)), records...)
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0644); err != nil {
+        return false, err
+    }
+    return true, os.Rename(tmp, path)
+}
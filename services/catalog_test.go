@@ -0,0 +1,78 @@
+package services
+
+import (
+    "os"
+    "strings"
+    "testing"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+func TestCatalogGroupFollowsOwner(t *testing.T) {
+    setupBackendConfig(t)
+    viper.Set("catalog.enabled", true)
+    viper.Set("catalog.zone", "catalog.invalid")
+    viper.Set("catalog.group_attribute", "owner")
+    t.Cleanup(func() { viper.Set("catalog.enabled", false) })
+    db := newTestDB(t)
+
+    ids := map[string]int64{}
+    for _, name := range []string{"alice", "bob"} {
+        if err := models.CreateUser(db, &models.User{Username: name, Role: models.RoleUser, Active: true}); err != nil {
+            t.Fatal(err)
+        }
+        user, err := models.GetUserByUsername(db, name)
+        if err != nil || user == nil {
+            t.Fatal(name, err)
+        }
+        ids[name] = user.ID
+    }
+    orgID, err := models.CreateOrganization(db, "acme", ids["alice"])
+    if err != nil {
+        t.Fatal(err)
+    }
+    personalID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "personal.test", UserID: ids["alice"]})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "org.test", UserID: ids["alice"], OrgID: orgID}); err != nil {
+        t.Fatal(err)
+    }
+
+    groups := func() map[string]string {
+        t.Helper()
+        members, err := CatalogMembers(db)
+        if err != nil {
+            t.Fatal(err)
+        }
+        result := map[string]string{}
+        for _, m := range members {
+            result[m.Name] = m.Group
+        }
+        return result
+    }
+    // Группа домена организации — организация, а не создавший домен пользователь
+    if g := groups(); g["personal.test"] != "alice" || g["org.test"] != "acme" {
+        t.Errorf("группы %v", g)
+    }
+    if changed, err := UpdateCatalogZone(db); err != nil || !changed {
+        t.Fatalf("каталог не записан: %v", err)
+    }
+
+    // После смены владельца каталог меняется при следующей пересборке
+    if err := models.TransferDomainOwnership(db, personalID, ids["bob"], 0, 0); err != nil {
+        t.Fatal(err)
+    }
+    if changed, err := UpdateCatalogZone(db); err != nil || !changed {
+        t.Fatalf("каталог не обновлён после передачи домена: %v", err)
+    }
+    data, err := os.ReadFile(ZoneFilePath("catalog.invalid"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), `TXT "bob"`) || strings.Contains(string(data), `TXT "alice"`) {
+        t.Errorf("группы в каталоге не обновлены:\n%s", data)
+    }
+}
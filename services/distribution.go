@@ -0,0 +1,403 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "sort"
+    "sync"
+    "time"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+// distributor копирует файлы зон и zones.conf на удалённые NSD серверы.
+// Очередь хранится в таблице server_sync, поэтому неудачные попытки
+// повторяются и после перезапуска панели.
+type distributor struct {
+    db        *models.DB
+    runner    CommandRunner
+    wake      chan struct{}
+    lastCheck time.Time
+}
+
+var (
+    distMu            sync.RWMutex
+    activeDistributor *distributor
+)
+
+// StartDistributor запускает фоновое копирование зон на серверы из dns_servers
+func StartDistributor(db *models.DB, interval time.Duration) {
+    if interval <= 0 {
+        interval = 5 * time.Second
+    }
+    if err := models.ResetRunningServerSync(db); err != nil {
+        log.Printf("Distribution: cannot reset interrupted jobs: %v", err)
+    }
+
+    d := &distributor{db: db, runner: ExecRunner{}, wake: make(chan struct{}, 1)}
+    distMu.Lock()
+    activeDistributor = d
+    distMu.Unlock()
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            d.run()
+            select {
+            case <-ticker.C:
+            case <-d.wake:
+            }
+        }
+    }()
+}
+
+func currentDistributor() *distributor {
+    distMu.RLock()
+    defer distMu.RUnlock()
+    return activeDistributor
+}
+
+func (d *distributor) wakeUp() {
+    select {
+    case d.wake <- struct{}{}:
+    default:
+    }
+}
+
+// QueueZoneSync ставит файл зоны в очередь на все включённые серверы
+func QueueZoneSync(name string) {
+    if d := currentDistributor(); d != nil {
+        d.queueAll(name, models.SyncPush)
+    }
+}
+
+// QueueZoneRemoval ставит в очередь удаление файла зоны с серверов
+func QueueZoneRemoval(name string) {
+    if d := currentDistributor(); d != nil {
+        d.queueAll(name, models.SyncRemove)
+    }
+}
+
+// QueueConfSync ставит zones.conf в очередь на все включённые серверы
+func QueueConfSync() {
+    if d := currentDistributor(); d != nil {
+        d.queueAll("", models.SyncPush)
+    }
+}
+
+func (d *distributor) queueAll(zone, action string) {
+    servers, err := models.GetEnabledDNSServers(d.db)
+    if err != nil {
+        log.Printf("Distribution: cannot load servers: %v", err)
+        return
+    }
+    if len(servers) == 0 {
+        return
+    }
+    serial := syncSerial(d.db, zone, action)
+    for _, server := range servers {
+        if err := models.QueueServerSync(d.db, server.ID, zone, action, serial); err != nil {
+            log.Printf("Distribution: cannot queue %s for %s: %v", syncZoneLabel(zone), server.Name, err)
+        }
+    }
+    d.wakeUp()
+}
+
+// QueueFullSync ставит в очередь на сервер zones.conf и все первичные зоны,
+// например после добавления сервера или долгой недоступности
+func QueueFullSync(db *models.DB, serverID int64) error {
+    domains, err := models.GetAllDomains(db)
+    if err != nil {
+        return err
+    }
+    for _, domain := range domains {
+        if domain.IsSecondary() {
+            continue
+        }
+        if err := models.QueueServerSync(db, serverID, domain.Name, models.SyncPush, int64(domain.Serial)); err != nil {
+            return err
+        }
+    }
+    if CatalogEnabled() {
+        catalog := CatalogZoneName()
+        if err := models.QueueServerSync(db, serverID, catalog, models.SyncPush, syncSerial(db, catalog, models.SyncPush)); err != nil {
+            return err
+        }
+    }
+    if err := models.QueueServerSync(db, serverID, "", models.SyncPush, syncSerial(db, "", models.SyncPush)); err != nil {
+        return err
+    }
+    if d := currentDistributor(); d != nil {
+        d.wakeUp()
+    }
+    return nil
+}
+
+// syncSerial — serial зоны, которая уходит на сервер. У zones.conf serial
+// нет, вместо него используется время постановки в очередь.
+func syncSerial(db *models.DB, zone, action string) int64 {
+    if action == models.SyncRemove {
+        return 0
+    }
+    if zone == "" {
+        return time.Now().Unix()
+    }
+    if CatalogEnabled() && zone == CatalogZoneName() {
+        serial, _ := models.GetCatalogSerial(db)
+        return int64(serial)
+    }
+    domain, err := models.GetDomainByName(db, zone)
+    if err != nil || domain == nil {
+        return 0
+    }
+    return int64(domain.Serial)
+}
+
+func syncZoneLabel(zone string) string {
+    if zone == "" {
+        return "zones.conf"
+    }
+    return zone
+}
+
+// syncBackoff — задержка перед следующей попыткой: удваивается после
+// каждой ошибки, но не больше distribution.retry_max
+func syncBackoff(attempts int) time.Duration {
+    base := time.Duration(viper.GetInt("distribution.retry_base")) * time.Second
+    max := time.Duration(viper.GetInt("distribution.retry_max")) * time.Second
+    if base <= 0 {
+        base = 10 * time.Second
+    }
+    if max < base {
+        max = base
+    }
+    delay := base
+    for i := 0; i < attempts && delay < max; i++ {
+        delay *= 2
+    }
+    if delay > max {
+        delay = max
+    }
+    return delay
+}
+
+func (d *distributor) run() {
+    jobs, err := models.GetDueServerSync(d.db, time.Now())
+    if err != nil {
+        log.Printf("Distribution: cannot load due jobs: %v", err)
+        return
+    }
+    byServer := make(map[int64][]models.ServerSync)
+    var order []int64
+    for _, job := range jobs {
+        if _, ok := byServer[job.ServerID]; !ok {
+            order = append(order, job.ServerID)
+        }
+        byServer[job.ServerID] = append(byServer[job.ServerID], job)
+    }
+    for _, id := range order {
+        d.syncServer(id, byServer[id])
+    }
+
+    interval := time.Duration(viper.GetInt("distribution.check_interval")) * time.Second
+    if interval > 0 && time.Since(d.lastCheck) >= interval {
+        d.lastCheck = time.Now()
+        d.checkServers()
+    }
+}
+
+func (d *distributor) transport(server *models.DNSServer) (SyncTransport, error) {
+    token := ""
+    if server.Transport == models.TransportHTTP {
+        encrypted, err := models.GetDNSServerToken(d.db, server.ID)
+        if err != nil {
+            return nil, err
+        }
+        if encrypted != "" {
+            secret, err := DecryptSecret(encrypted)
+            if err != nil {
+                return nil, fmt.Errorf("токен агента: %v", err)
+            }
+            token = string(secret)
+        }
+    }
+    return NewSyncTransport(server, token, d.runner)
+}
+
+// syncServer выполняет задания одного сервера и перезагружает его один раз.
+// Сначала копируются файлы зон, затем zones.conf, в конце удаляются
+// файлы зон, которых в zones.conf уже нет.
+func (d *distributor) syncServer(serverID int64, jobs []models.ServerSync) {
+    server, err := models.GetDNSServerByID(d.db, serverID)
+    if err != nil || server == nil || !server.Enabled {
+        return
+    }
+    transport, err := d.transport(server)
+    if err != nil {
+        for i := range jobs {
+            if started, _ := models.StartServerSync(d.db, &jobs[i]); started {
+                d.fail(server, &jobs[i], err)
+            }
+        }
+        return
+    }
+
+    stage := func(job models.ServerSync) int {
+        switch {
+        case job.Action == models.SyncRemove:
+            return 2
+        case job.Zone == "":
+            return 1
+        }
+        return 0
+    }
+    sort.SliceStable(jobs, func(i, j int) bool { return stage(jobs[i]) < stage(jobs[j]) })
+
+    var done []models.ServerSync
+    for i := range jobs {
+        job := &jobs[i]
+        started, err := models.StartServerSync(d.db, job)
+        if err != nil || !started {
+            continue
+        }
+        if err := d.apply(server, transport, job); err != nil {
+            d.fail(server, job, err)
+            continue
+        }
+        done = append(done, *job)
+    }
+    if len(done) == 0 {
+        return
+    }
+
+    if err := transport.Reload(); err != nil {
+        err = fmt.Errorf("перезагрузка: %v", err)
+        for i := range done {
+            d.fail(server, &done[i], err)
+        }
+        models.SaveDNSServerCheck(d.db, server.ID, err.Error())
+        return
+    }
+    for i := range done {
+        if err := models.MarkServerSynced(d.db, &done[i]); err != nil {
+            log.Printf("Distribution: cannot save state of %s on %s: %v", syncZoneLabel(done[i].Zone), server.Name, err)
+        }
+    }
+    models.SaveDNSServerCheck(d.db, server.ID, "")
+}
+
+func (d *distributor) apply(server *models.DNSServer, transport SyncTransport, job *models.ServerSync) error {
+    if job.Zone == "" {
+        data, err := renderZonesConf(d.db, server.ZoneDir)
+        if err != nil {
+            return err
+        }
+        return transport.PutConf(data)
+    }
+    if job.Action == models.SyncRemove {
+        return transport.RemoveZone(job.Zone)
+    }
+    data, err := os.ReadFile(ZoneFilePath(job.Zone))
+    if err != nil {
+        return err
+    }
+    return transport.PutZone(job.Zone, data)
+}
+
+func (d *distributor) fail(server *models.DNSServer, job *models.ServerSync, err error) {
+    next := time.Now().Add(syncBackoff(job.Attempts))
+    log.Printf("Distribution: %s on %s failed (attempt %d): %v", syncZoneLabel(job.Zone), server.Name, job.Attempts+1, err)
+    if err := models.MarkServerSyncFailed(d.db, job, err.Error(), next); err != nil {
+        log.Printf("Distribution: cannot save state of %s on %s: %v", syncZoneLabel(job.Zone), server.Name, err)
+    }
+}
+
+// checkServers проверяет доступность включённых серверов
+func (d *distributor) checkServers() {
+    servers, err := models.GetEnabledDNSServers(d.db)
+    if err != nil {
+        log.Printf("Distribution: cannot load servers: %v", err)
+        return
+    }
+    for i := range servers {
+        // Агенты в режиме pull отчитываются сами
+        if servers[i].Transport == models.TransportPull {
+            continue
+        }
+        checkErr := ""
+        if transport, err := d.transport(&servers[i]); err != nil {
+            checkErr = err.Error()
+        } else if err := transport.Status(); err != nil {
+            checkErr = err.Error()
+        }
+        models.SaveDNSServerCheck(d.db, servers[i].ID, checkErr)
+    }
+}
+
+// DistributionStatus — состояние удалённого сервера для страницы статуса
+type DistributionStatus struct {
+    ID             int64
+    Name           string
+    Transport      string
+    Address        string
+    Enabled        bool
+    Reachable      bool
+    LastCheckAt    *time.Time
+    LastCheckError string
+    Synced         int
+    Pending        int
+    Failed         int
+    ConfSerial     int64 // время последнего скопированного zones.conf
+    LastSyncAt     *time.Time
+    LastError      string
+}
+
+// GetDistributionStatus собирает состояние всех удалённых серверов
+func GetDistributionStatus(db *models.DB) ([]DistributionStatus, error) {
+    servers, err := models.GetDNSServers(db)
+    if err != nil {
+        return nil, err
+    }
+    result := make([]DistributionStatus, 0, len(servers))
+    for _, server := range servers {
+        status := DistributionStatus{
+            ID:             server.ID,
+            Name:           server.Name,
+            Transport:      server.Transport,
+            Address:        server.Address,
+            Enabled:        server.Enabled,
+            Reachable:      server.LastCheckAt != nil && server.LastCheckError == "",
+            LastCheckAt:    server.LastCheckAt,
+            LastCheckError: server.LastCheckError,
+        }
+        if server.Transport == models.TransportPull {
+            status.Reachable = agentReachable(&server)
+        }
+        jobs, err := models.GetServerSync(db, server.ID)
+        if err != nil {
+            return nil, err
+        }
+        for _, job := range jobs {
+            switch job.State {
+            case models.SyncDone:
+                status.Synced++
+                if job.Zone == "" {
+                    status.ConfSerial = job.Serial
+                }
+            case models.SyncFailed:
+                status.Failed++
+                status.LastError = syncZoneLabel(job.Zone) + ": " + job.LastError
+            default:
+                status.Pending++
+            }
+            if job.SyncedAt != nil && (status.LastSyncAt == nil || job.SyncedAt.After(*status.LastSyncAt)) {
+                status.LastSyncAt = job.SyncedAt
+            }
+        }
+        result = append(result, status)
+    }
+    return result, nil
+}
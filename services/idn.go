@@ -0,0 +1,132 @@
+package services
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "unicode"
+
+    "golang.org/x/net/idna"
+)
+
+// idnaProfile — преобразование UTS-46 без переходной обработки (IDNA2008):
+// ß и ς сохраняются. Подчёркивания и * допустимы, т.к. встречаются
+// в именах записей (_dmarc, *.example.com).
+var idnaProfile = idna.New(
+    idna.MapForLookup(),
+    idna.BidiRule(),
+    idna.Transitional(false),
+    idna.StrictDomainName(false),
+)
+
+// Сочетания письменностей, которые допустимы в одной метке (UTS-39)
+var allowedScriptSets = [][]string{
+    {"Han", "Hiragana", "Katakana"},
+    {"Han", "Hangul"},
+    {"Han", "Bopomofo"},
+}
+
+// ToASCIIName переводит имя домена или записи с Unicode метками в punycode.
+// ASCII имена без меток xn-- возвращаются без изменений. Метки, в которых
+// смешаны разные алфавиты (например, латиница и кириллица), отклоняются.
+func ToASCIIName(name string) (string, error) {
+    if isASCIIName(name) && !strings.Contains(strings.ToLower(name), "xn--") {
+        return name, nil
+    }
+
+    fqdn := strings.HasSuffix(name, ".")
+    ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(name, "."))
+    if err != nil {
+        return "", fmt.Errorf("некорректное IDN имя %s: %v", name, err)
+    }
+    display, err := idnaProfile.ToUnicode(ascii)
+    if err != nil {
+        return "", fmt.Errorf("некорректное IDN имя %s: %v", name, err)
+    }
+
+    for _, label := range strings.Split(display, ".") {
+        // UTS-46 допускает символы, запрещённые IDNA2008 (например, эмодзи)
+        if !isASCIIName(label) {
+            if _, err := idna.Registration.ToASCII(label); err != nil {
+                return "", fmt.Errorf("метка %s недопустима по IDNA2008: %v", label, err)
+            }
+            for _, r := range label {
+                if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+                    return "", fmt.Errorf("метка %s содержит недопустимый символ %q", label, r)
+                }
+            }
+        }
+        if scripts := labelScripts(label); mixedScripts(scripts) {
+            return "", fmt.Errorf("в метке %s смешаны алфавиты: %s", label, strings.Join(scripts, ", "))
+        }
+    }
+
+    if fqdn {
+        ascii += "."
+    }
+    return ascii, nil
+}
+
+func isASCIIName(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] >= 0x80 {
+            return false
+        }
+    }
+    return true
+}
+
+// labelScripts возвращает письменности букв метки. Цифры, дефис и
+// диакритика (Common, Inherited) не учитываются.
+func labelScripts(label string) []string {
+    found := map[string]bool{}
+    for _, r := range label {
+        if r < 0x80 {
+            if unicode.IsLetter(r) {
+                found["Latin"] = true
+            }
+            continue
+        }
+        for script, table := range unicode.Scripts {
+            if script != "Common" && script != "Inherited" && unicode.Is(table, r) {
+                found[script] = true
+                break
+            }
+        }
+    }
+
+    scripts := make([]string, 0, len(found))
+    for s := range found {
+        scripts = append(scripts, s)
+    }
+    sort.Strings(scripts)
+    return scripts
+}
+
+func mixedScripts(scripts []string) bool {
+    if len(scripts) <= 1 {
+        return false
+    }
+    for _, set := range allowedScriptSets {
+        allowed := true
+        for _, s := range scripts {
+            if !scriptInSet(set, s) {
+                allowed = false
+                break
+            }
+        }
+        if allowed {
+            return false
+        }
+    }
+    return true
+}
+
+func scriptInSet(set []string, script string) bool {
+    for _, s := range set {
+        if s == script {
+            return true
+        }
+    }
+    return false
+}
@@ -22,3 +22,20 @@ func LogUserAction(db *models.DB, userID int64, username, action, details, ip st
 func LogUserActionWithDB(db *models.DB, userID int64, username, action, details, ip string) {
     go LogUserAction(db, userID, username, action, details, ip) // Асинхронно
 }
+
+// LogImpersonatedAction записывает действие, которое администратор выполнил от имени
+// пользователя: в журнале сохраняются обе учётные записи
+func LogImpersonatedAction(db *models.DB, userID int64, username string, adminID int64, adminName, action, details, ip string) error {
+    log := &models.UserAction{
+        UserID:           userID,
+        Username:         username,
+        Action:           action,
+        Details:          details,
+        IP:               ip,
+        CreatedAt:        time.Now(),
+        ImpersonatorID:   adminID,
+        ImpersonatorName: adminName,
+    }
+
+    return models.CreateUserAction(db, log)
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "net"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// Лимит DNS запросов при проверке SPF (RFC 7208, раздел 4.6.4)
+const spfLookupLimit = 10
+
+// SPFOptions — структурированное описание SPF записи
+type SPFOptions struct {
+    Mechanisms []string // a, mx, ip4:1.2.3.4, include:_spf.example.com и т.п.
+    All        string   // -all, ~all, ?all; по умолчанию ~all
+    Redirect   string   // redirect=домен вместо all
+}
+
+// SPFResult — итог проверки SPF записи
+type SPFResult struct {
+    Record   string
+    Lookups  int      // число механизмов, требующих DNS запроса, с учётом вложенных include
+    Warnings []string
+}
+
+var spfMechanisms = map[string]bool{
+    "all": true, "include": true, "a": true, "mx": true,
+    "ptr": true, "ip4": true, "ip6": true, "exists": true,
+}
+
+// BuildSPF собирает SPF запись из опций и проверяет её
+func BuildSPF(db *models.DB, opts SPFOptions) (*SPFResult, error) {
+    terms := []string{"v=spf1"}
+    for _, m := range opts.Mechanisms {
+        if m = strings.TrimSpace(m); m != "" {
+            terms = append(terms, m)
+        }
+    }
+
+    if opts.Redirect != "" {
+        if opts.All != "" {
+            return nil, errors.New("Укажите либо all, либо redirect")
+        }
+        terms = append(terms, "redirect="+strings.TrimSpace(opts.Redirect))
+    } else {
+        all := opts.All
+        if all == "" {
+            all = "~all"
+        }
+        switch all {
+        case "-all", "~all", "?all", "+all", "all":
+        default:
+            return nil, fmt.Errorf("Некорректное значение all: %s", all)
+        }
+        terms = append(terms, all)
+    }
+
+    return CheckSPF(db, strings.Join(terms, " "))
+}
+
+// CheckSPF проверяет синтаксис SPF записи и считает DNS запросы. Цели include:,
+// которые обслуживаются панелью, раскрываются по их записям в базе.
+func CheckSPF(db *models.DB, record string) (*SPFResult, error) {
+    result := &SPFResult{Record: strings.Join(strings.Fields(TXTValue(record)), " ")}
+
+    lookups, err := countSPFLookups(db, result.Record, "", map[string]bool{}, &result.Warnings)
+    if err != nil {
+        return nil, err
+    }
+    result.Lookups = lookups
+
+    if lookups > spfLookupLimit {
+        return nil, fmt.Errorf("SPF требует %d DNS запросов, допускается не более %d", lookups, spfLookupLimit)
+    }
+    return result, nil
+}
+
+// countSPFLookups разбирает SPF запись и возвращает число DNS запросов.
+// source — имя, с которого запись получена через include (пусто для проверяемой).
+func countSPFLookups(db *models.DB, record, source string, seen map[string]bool, warnings *[]string) (int, error) {
+    prefix := ""
+    if source != "" {
+        prefix = "include:" + source + ": "
+    }
+
+    terms := strings.Fields(record)
+    if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+        return 0, fmt.Errorf("%sзапись должна начинаться с v=spf1", prefix)
+    }
+
+    lookups := 0
+    hasAll, hasRedirect := false, false
+    for _, term := range terms[1:] {
+        lower := strings.ToLower(term)
+
+        // Модификаторы имя=значение
+        if eq := strings.Index(lower, "="); eq > 0 && !strings.ContainsAny(lower[:eq], ":/") {
+            name, value := lower[:eq], term[eq+1:]
+            if value == "" {
+                return 0, fmt.Errorf("%sпустое значение модификатора %s", prefix, name)
+            }
+            switch name {
+            case "redirect":
+                if hasRedirect {
+                    return 0, fmt.Errorf("%sмодификатор redirect указан дважды", prefix)
+                }
+                hasRedirect = true
+                n, err := spfInclude(db, value, seen, warnings)
+                if err != nil {
+                    return 0, fmt.Errorf("%s%v", prefix, err)
+                }
+                lookups += n
+            case "exp":
+            default:
+                *warnings = append(*warnings, fmt.Sprintf("%sнеизвестный модификатор %s", prefix, name))
+            }
+            continue
+        }
+
+        qualifier := "+"
+        if strings.ContainsAny(lower[:1], "+-~?") {
+            qualifier, lower, term = lower[:1], lower[1:], term[1:]
+        }
+
+        name, arg := lower, ""
+        if i := strings.IndexAny(lower, ":/"); i >= 0 {
+            name, arg = lower[:i], term[i:]
+        }
+        if !spfMechanisms[name] {
+            return 0, fmt.Errorf("%sнеизвестный механизм %s", prefix, term)
+        }
+
+        switch name {
+        case "all":
+            if arg != "" {
+                return 0, fmt.Errorf("%sмеханизм all не принимает аргументов", prefix)
+            }
+            hasAll = true
+            if qualifier == "+" {
+                *warnings = append(*warnings, prefix+"+all разрешает отправку писем с любого сервера")
+            }
+        case "ip4", "ip6":
+            if err := checkSPFNetwork(name, strings.TrimPrefix(arg, ":")); err != nil {
+                return 0, fmt.Errorf("%s%v", prefix, err)
+            }
+        case "include", "exists":
+            target := strings.TrimPrefix(arg, ":")
+            if !strings.HasPrefix(arg, ":") || target == "" {
+                return 0, fmt.Errorf("%sмеханизм %s требует имя домена", prefix, name)
+            }
+            if name == "exists" {
+                lookups++
+                continue
+            }
+            n, err := spfInclude(db, target, seen, warnings)
+            if err != nil {
+                return 0, fmt.Errorf("%s%v", prefix, err)
+            }
+            lookups += n
+        case "a", "mx", "ptr":
+            if name == "ptr" {
+                *warnings = append(*warnings, prefix+"механизм ptr устарел и не рекомендуется (RFC 7208)")
+            }
+            lookups++
+        }
+    }
+
+    if source == "" && !hasAll && !hasRedirect {
+        *warnings = append(*warnings, "Запись не заканчивается механизмом all: письма с неизвестных серверов получат нейтральный результат")
+    }
+    return lookups, nil
+}
+
+func checkSPFNetwork(mechanism, value string) error {
+    ip := value
+    if i := strings.Index(value, "/"); i >= 0 {
+        ip = value[:i]
+        if _, _, err := net.ParseCIDR(value); err != nil {
+            return fmt.Errorf("некорректная сеть %s:%s", mechanism, value)
+        }
+    }
+    parsed := net.ParseIP(ip)
+    if parsed == nil || (mechanism == "ip4") != (parsed.To4() != nil) {
+        return fmt.Errorf("некорректный адрес %s:%s", mechanism, value)
+    }
+    return nil
+}
+
+// spfInclude учитывает запрос к цели include или redirect. Если цель обслуживается
+// панелью, её SPF запись проверяется рекурсивно.
+func spfInclude(db *models.DB, target string, seen map[string]bool, warnings *[]string) (int, error) {
+    target = strings.ToLower(strings.TrimSuffix(target, "."))
+    if strings.Contains(target, "%{") {
+        *warnings = append(*warnings, "Цель "+target+" содержит макросы и не проверялась")
+        return 1, nil
+    }
+    if seen[target] {
+        return 0, fmt.Errorf("циклическая ссылка на %s", target)
+    }
+
+    record, hosted, err := hostedSPFRecord(db, target)
+    if err != nil {
+        return 0, err
+    }
+    if !hosted {
+        *warnings = append(*warnings, fmt.Sprintf("Домен %s не обслуживается панелью, вложенные запросы не учтены", target))
+        return 1, nil
+    }
+    if record == "" {
+        return 0, fmt.Errorf("у %s нет SPF записи", target)
+    }
+
+    seen[target] = true
+    n, err := countSPFLookups(db, record, target, seen, warnings)
+    delete(seen, target)
+    return n + 1, err
+}
+
+// hostedSPFRecord ищет SPF запись имени в доменах панели. hosted = false,
+// если имя не относится ни к одному домену панели.
+func hostedSPFRecord(db *models.DB, fqdn string) (string, bool, error) {
+    labels := strings.Split(fqdn, ".")
+    for i := 0; i < len(labels)-1; i++ {
+        domain, err := models.GetDomainByName(db, strings.Join(labels[i:], "."))
+        if err != nil {
+            return "", false, err
+        }
+        if domain == nil {
+            continue
+        }
+
+        records, err := models.GetRecordsByDomainID(db, domain.ID)
+        if err != nil {
+            return "", true, err
+        }
+        for _, r := range records {
+            if r.Type == "TXT" && recordFQDN(r.Name, domain.Name) == fqdn && txtVersionTag(r.Content) == "v=spf1" {
+                return TXTValue(r.Content), true, nil
+            }
+        }
+        return "", true, nil
+    }
+    return "", false, nil
+}
+
+// DKIMKey — сгенерированный ключ DKIM. Закрытый ключ нигде не сохраняется.
+type DKIMKey struct {
+    Selector   string
+    Name       string // имя TXT записи: <selector>._domainkey
+    Content    string // значение TXT записи, разбитое на строки по 255 байт
+    PrivateKey string // PEM (PKCS#8)
+}
+
+var dkimSelectorPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// GenerateDKIMKey создаёт пару ключей rsa (bits 1024–4096, по умолчанию 2048) или ed25519
+func GenerateDKIMKey(selector, algorithm string, bits int) (*DKIMKey, error) {
+    selector = strings.ToLower(strings.TrimSpace(selector))
+    if !dkimSelectorPattern.MatchString(selector) {
+        return nil, errors.New("Некорректный селектор DKIM")
+    }
+
+    var private interface{}
+    var public string
+    switch strings.ToLower(algorithm) {
+    case "", "rsa":
+        algorithm = "rsa"
+        if bits == 0 {
+            bits = 2048
+        }
+        if bits < 1024 || bits > 4096 {
+            return nil, errors.New("Длина RSA ключа должна быть от 1024 до 4096 бит")
+        }
+        key, err := rsa.GenerateKey(rand.Reader, bits)
+        if err != nil {
+            return nil, err
+        }
+        der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+        if err != nil {
+            return nil, err
+        }
+        private, public = key, base64.StdEncoding.EncodeToString(der)
+    case "ed25519":
+        algorithm = "ed25519"
+        pub, key, err := ed25519.GenerateKey(rand.Reader)
+        if err != nil {
+            return nil, err
+        }
+        // RFC 8463: в записи публикуется сам 32-байтный ключ, без обёртки PKIX
+        private, public = key, base64.StdEncoding.EncodeToString(pub)
+    default:
+        return nil, fmt.Errorf("Неподдерживаемый алгоритм DKIM: %s", algorithm)
+    }
+
+    der, err := x509.MarshalPKCS8PrivateKey(private)
+    if err != nil {
+        return nil, err
+    }
+
+    value := fmt.Sprintf("v=DKIM1; k=%s; p=%s", algorithm, public)
+    return &DKIMKey{
+        Selector:   selector,
+        Name:       selector + "._domainkey",
+        Content:    FormatTXT(SplitTXT(value)),
+        PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+    }, nil
+}
+
+// DMARCOptions — параметры DMARC политики (RFC 7489)
+type DMARCOptions struct {
+    Policy          string   // none, quarantine, reject
+    SubdomainPolicy string   // sp, по умолчанию совпадает с Policy
+    Percent         int      // pct, 0 — 100%
+    RUA             []string // адреса для агрегированных отчётов
+    RUF             []string // адреса для отчётов об ошибках
+    ADKIM           string   // r или s
+    ASPF            string   // r или s
+    FailureOptions  string   // fo: 0, 1, d, s
+}
+
+var dmarcPolicies = map[string]bool{"none": true, "quarantine": true, "reject": true}
+
+// BuildDMARC собирает значение DMARC записи
+func BuildDMARC(opts DMARCOptions) (string, error) {
+    if !dmarcPolicies[opts.Policy] {
+        return "", errors.New("Политика DMARC должна быть none, quarantine или reject")
+    }
+    tags := []string{"v=DMARC1", "p=" + opts.Policy}
+
+    if opts.SubdomainPolicy != "" && opts.SubdomainPolicy != opts.Policy {
+        if !dmarcPolicies[opts.SubdomainPolicy] {
+            return "", errors.New("Политика для поддоменов должна быть none, quarantine или reject")
+        }
+        tags = append(tags, "sp="+opts.SubdomainPolicy)
+    }
+    if opts.Percent < 0 || opts.Percent > 100 {
+        return "", errors.New("pct должен быть от 0 до 100")
+    }
+    if opts.Percent != 0 && opts.Percent != 100 {
+        tags = append(tags, "pct="+strconv.Itoa(opts.Percent))
+    }
+
+    for _, list := range []struct {
+        tag   string
+        addrs []string
+    }{{"rua", opts.RUA}, {"ruf", opts.RUF}} {
+        var uris []string
+        for _, addr := range list.addrs {
+            addr = strings.TrimPrefix(strings.TrimSpace(addr), "mailto:")
+            if addr == "" {
+                continue
+            }
+            if !ValidateEmail(addr) {
+                return "", fmt.Errorf("Некорректный адрес %s: %s", list.tag, addr)
+            }
+            uris = append(uris, "mailto:"+addr)
+        }
+        if len(uris) > 0 {
+            tags = append(tags, list.tag+"="+strings.Join(uris, ","))
+        }
+    }
+
+    for _, align := range []struct{ tag, value string }{{"adkim", opts.ADKIM}, {"aspf", opts.ASPF}} {
+        switch align.value {
+        case "", "r":
+        case "s":
+            tags = append(tags, align.tag+"=s")
+        default:
+            return "", fmt.Errorf("%s должен быть r или s", align.tag)
+        }
+    }
+
+    if opts.FailureOptions != "" && opts.FailureOptions != "0" {
+        for _, fo := range strings.Split(opts.FailureOptions, ":") {
+            if fo != "0" && fo != "1" && fo != "d" && fo != "s" {
+                return "", errors.New("fo может содержать только 0, 1, d и s")
+            }
+        }
+        tags = append(tags, "fo="+opts.FailureOptions)
+    }
+
+    return strings.Join(tags, "; "), nil
+}
+
+// PublishMailRecord создаёт или заменяет TXT запись с тем же тегом версии
+// (v=spf1, v=DKIM1, v=DMARC1) на указанном имени. Возвращает сохранённую запись
+// и выполненное действие. Для защищённой записи возвращается
+// ProtectedRecordError: изменение нужно отправить на согласование.
+func PublishMailRecord(db *models.DB, userID int64, userRole string, domain *models.Domain,
+    name, content string) (*models.Record, string, error) {
+
+    record := &models.Record{
+        DomainID: domain.ID,
+        Type:     "TXT",
+        Name:     name,
+        Content:  content,
+        TTL:      viper.GetInt("default_ttl"),
+    }
+    if err := PrepareRecord(record, domain.Name); err != nil {
+        return nil, "", err
+    }
+
+    existing, err := models.GetRecordsByDomainID(db, domain.ID)
+    if err != nil {
+        return nil, "", err
+    }
+
+    action := models.ChangeCreate
+    fqdn := recordFQDN(record.Name, domain.Name)
+    tag := txtVersionTag(content)
+    for _, e := range existing {
+        if e.Type == "TXT" && recordFQDN(e.Name, domain.Name) == fqdn && txtVersionTag(e.Content) == tag {
+            action = models.ChangeUpdate
+            record.ID = e.ID
+            record.TTL = e.TTL
+            break
+        }
+    }
+
+    if err := CheckRecordPolicy(db, userID, userRole, action, domain, record); err != nil {
+        return nil, "", err
+    }
+    if err := checkRecordProtection(db, action, record); err != nil {
+        return nil, "", err
+    }
+
+    if err := ApplyRecordChange(db, action, record); err != nil {
+        return nil, "", err
+    }
+    return record, action, nil
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+    "crypto/rand"
+    "encoding/binary"
+    "fmt"
+    "log"
+    "net"
+    "strings"
+    "time"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+    "golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsOpNotify — opcode NOTIFY (RFC 1996), в dnsmessage константы нет
+const dnsOpNotify dnsmessage.OpCode = 4
+
+// NotifyReport — итог NOTIFY одному вторичному серверу
+type NotifyReport struct {
+    Address string
+    Success bool
+    Message string
+    Serial  uint32 // serial, который вернул сервер; 0 — не удалось получить
+    Error   string // ошибка запроса serial
+}
+
+// xfrHostPort переводит адрес вида IP или IP@порт в host:port
+func xfrHostPort(addr string) string {
+    host, port := addr, "53"
+    if i := strings.LastIndex(addr, "@"); i >= 0 {
+        host, port = addr[:i], addr[i+1:]
+    }
+    return net.JoinHostPort(host, port)
+}
+
+func notifyTimeout() time.Duration {
+    timeout := time.Duration(viper.GetInt("notify.timeout")) * time.Second
+    if timeout <= 0 {
+        timeout = 3 * time.Second
+    }
+    return timeout
+}
+
+func randomID() uint16 {
+    var b [2]byte
+    rand.Read(b[:])
+    return binary.BigEndian.Uint16(b[:])
+}
+
+// buildQuery собирает DNS сообщение с одним вопросом о SOA зоны
+func buildQuery(zone string, opcode dnsmessage.OpCode) (uint16, []byte, error) {
+    name, err := dnsmessage.NewName(strings.TrimSuffix(zone, ".") + ".")
+    if err != nil {
+        return 0, nil, err
+    }
+    id := randomID()
+    b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+        ID:            id,
+        OpCode:        opcode,
+        Authoritative: opcode == dnsOpNotify,
+    })
+    if err := b.StartQuestions(); err != nil {
+        return 0, nil, err
+    }
+    if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+        return 0, nil, err
+    }
+    msg, err := b.Finish()
+    return id, msg, err
+}
+
+// dnsExchange отправляет запрос по UDP и ждёт ответ с тем же ID.
+// При таймауте запрос повторяется notify.retries раз.
+func dnsExchange(addr string, id uint16, msg []byte) (*dnsmessage.Parser, dnsmessage.Header, error) {
+    retries := viper.GetInt("notify.retries")
+    if retries <= 0 {
+        retries = 1
+    }
+
+    var lastErr error
+    for attempt := 0; attempt < retries; attempt++ {
+        conn, err := net.DialTimeout("udp", xfrHostPort(addr), notifyTimeout())
+        if err != nil {
+            return nil, dnsmessage.Header{}, err
+        }
+        conn.SetDeadline(time.Now().Add(notifyTimeout()))
+        if _, err := conn.Write(msg); err != nil {
+            conn.Close()
+            return nil, dnsmessage.Header{}, err
+        }
+
+        buf := make([]byte, 65535)
+        for {
+            n, err := conn.Read(buf)
+            if err != nil {
+                lastErr = err
+                break
+            }
+            var p dnsmessage.Parser
+            h, err := p.Start(buf[:n])
+            if err != nil || h.ID != id || !h.Response {
+                // Чужой или повреждённый ответ, ждём дальше
+                continue
+            }
+            conn.Close()
+            return &p, h, nil
+        }
+        conn.Close()
+        if ne, ok := lastErr.(net.Error); !ok || !ne.Timeout() {
+            break
+        }
+    }
+    return nil, dnsmessage.Header{}, lastErr
+}
+
+// SendNotify отправляет DNS NOTIFY (RFC 1996) о зоне на адрес вторичного сервера.
+// Если задан ключ, запрос подписывается TSIG. Подпись ответа не проверяется:
+// ответ используется только для отчёта.
+func SendNotify(zone, addr string, key *tsigKey) error {
+    id, msg, err := buildQuery(zone, dnsOpNotify)
+    if err != nil {
+        return err
+    }
+    if key != nil {
+        if msg, err = signTSIG(msg, key, time.Now()); err != nil {
+            return err
+        }
+    }
+
+    _, h, err := dnsExchange(addr, id, msg)
+    if err != nil {
+        return err
+    }
+    if h.OpCode != dnsOpNotify {
+        return fmt.Errorf("сервер ответил с другим opcode %d", h.OpCode)
+    }
+    if h.RCode != dnsmessage.RCodeSuccess {
+        return fmt.Errorf("сервер отклонил NOTIFY: %s", strings.TrimPrefix(h.RCode.String(), "RCode"))
+    }
+    return nil
+}
+
+// QuerySOASerial запрашивает у сервера SOA зоны и возвращает её serial
+func QuerySOASerial(zone, addr string) (uint32, error) {
+    id, msg, err := buildQuery(zone, 0)
+    if err != nil {
+        return 0, err
+    }
+
+    p, h, err := dnsExchange(addr, id, msg)
+    if err != nil {
+        return 0, err
+    }
+    if h.RCode != dnsmessage.RCodeSuccess {
+        return 0, fmt.Errorf("сервер вернул %s", strings.TrimPrefix(h.RCode.String(), "RCode"))
+    }
+    if err := p.SkipAllQuestions(); err != nil {
+        return 0, err
+    }
+    for {
+        rh, err := p.AnswerHeader()
+        if err == dnsmessage.ErrSectionDone {
+            break
+        }
+        if err != nil {
+            return 0, err
+        }
+        if rh.Type != dnsmessage.TypeSOA {
+            if err := p.SkipAnswer(); err != nil {
+                return 0, err
+            }
+            continue
+        }
+        soa, err := p.SOAResource()
+        if err != nil {
+            return 0, err
+        }
+        return soa.Serial, nil
+    }
+    return 0, fmt.Errorf("сервер не вернул SOA зоны")
+}
+
+// NotifyDomain отправляет NOTIFY всем вторичным серверам домена и глобальным,
+// затем через checkDelay запрашивает у них serial. Результаты сохраняются в БД.
+func NotifyDomain(db *models.DB, domainID int64, checkDelay time.Duration) ([]NotifyReport, error) {
+    domain, err := models.GetDomainByID(db, domainID)
+    if err != nil || domain == nil {
+        return nil, err
+    }
+    // Вторичные зоны уведомляет сам NSD после получения новой версии
+    if domain.IsSecondary() {
+        return nil, nil
+    }
+
+    targets, err := models.GetEffectiveXFRTargets(db, domainID)
+    if err != nil {
+        return nil, err
+    }
+    return notifyZone(db, domain.Name, domainID, targets, checkDelay), nil
+}
+
+// NotifyCatalog отправляет NOTIFY о каталожной зоне глобальным вторичным серверам.
+// Результаты сохраняются с domain_id = 0.
+func NotifyCatalog(db *models.DB, checkDelay time.Duration) ([]NotifyReport, error) {
+    if !CatalogEnabled() {
+        return nil, nil
+    }
+    targets, err := models.GetXFRTargets(db, 0)
+    if err != nil {
+        return nil, err
+    }
+    return notifyZone(db, CatalogZoneName(), 0, targets, checkDelay), nil
+}
+
+// notifyZone уведомляет серверы о зоне и через checkDelay запрашивает у них serial
+func notifyZone(db *models.DB, zone string, domainID int64, targets []models.XFRTarget, checkDelay time.Duration) []NotifyReport {
+    var reports []NotifyReport
+    for _, t := range targets {
+        if !t.Notify {
+            continue
+        }
+        report := NotifyReport{Address: t.Address, Success: true, Message: "NOTIFY принят"}
+
+        var key *tsigKey
+        var err error
+        if t.TSIGKey != "" {
+            key, err = lookupTSIGKey(db, t.TSIGKey)
+        }
+        if err == nil {
+            err = SendNotify(zone, t.Address, key)
+        }
+        if err != nil {
+            report.Success = false
+            report.Message = err.Error()
+        }
+        if err := models.SaveNotifyResult(db, domainID, t.Address, report.Success, report.Message); err != nil {
+            log.Printf("NOTIFY: cannot save result for %s: %v", t.Address, err)
+        }
+        reports = append(reports, report)
+    }
+
+    if len(reports) > 0 && checkDelay > 0 {
+        time.Sleep(checkDelay)
+    }
+    for i := range reports {
+        reports[i].Serial, reports[i].Error = checkSecondarySerial(db, zone, domainID, reports[i].Address)
+    }
+    return reports
+}
+
+// checkSecondarySerial запрашивает serial у вторичного сервера и сохраняет его
+func checkSecondarySerial(db *models.DB, zone string, domainID int64, addr string) (uint32, string) {
+    serial, err := QuerySOASerial(zone, addr)
+    if err != nil {
+        return 0, err.Error()
+    }
+    if err := models.SaveSecondarySerial(db, domainID, addr, serial); err != nil {
+        log.Printf("NOTIFY: cannot save serial for %s: %v", addr, err)
+    }
+    return serial, ""
+}
+
+// NotifySecondaries уведомляет вторичные серверы об изменении зоны в фоне,
+// чтобы изменение записи не ждало ответа от них
+func NotifySecondaries(db *models.DB, domainID int64) {
+    go func() {
+        delay := time.Duration(viper.GetInt("notify.serial_check_delay")) * time.Second
+        reports, err := NotifyDomain(db, domainID, delay)
+        if err != nil {
+            log.Printf("NOTIFY for domain %d failed: %v", domainID, err)
+            return
+        }
+        for _, r := range reports {
+            if !r.Success {
+                log.Printf("NOTIFY for domain %d to %s failed: %s", domainID, r.Address, r.Message)
+            }
+        }
+    }()
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+    "bytes"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// ErrSecondaryZone — записи вторичной зоны приходят с первичного сервера
+var ErrSecondaryZone = errors.New("Зона вторичная: записи редактируются на первичном сервере")
+
+// CheckDomainEditable запрещает изменять записи вторичных зон
+func CheckDomainEditable(domain *models.Domain) error {
+    if domain != nil && domain.IsSecondary() {
+        return ErrSecondaryZone
+    }
+    return nil
+}
+
+// ParseXFRAddress проверяет адрес сервера для передачи зоны: IP или IP@порт
+func ParseXFRAddress(addr string) (string, error) {
+    addr = strings.TrimSpace(addr)
+    host, port := addr, ""
+    if i := strings.LastIndex(addr, "@"); i >= 0 {
+        host, port = addr[:i], addr[i+1:]
+        if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+            return "", fmt.Errorf("некорректный порт в адресе %s", addr)
+        }
+    }
+    ip := net.ParseIP(host)
+    if ip == nil {
+        return "", fmt.Errorf("некорректный IP адрес %s", addr)
+    }
+    if port != "" {
+        return ip.String() + "@" + port, nil
+    }
+    return ip.String(), nil
+}
+
+var tsigKeyNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,62}[A-Za-z0-9])?$`)
+
+// ValidateTSIGKeyName проверяет имя TSIG ключа: оно попадает в nsd.conf без кавычек
+func ValidateTSIGKeyName(name string) bool {
+    return tsigKeyNameRe.MatchString(name) && name != "NOKEY" && name != "BLOCKED"
+}
+
+// nsdKeyRef — ссылка на TSIG ключ в ACL NSD
+func nsdKeyRef(key string) string {
+    if key == "" {
+        return "NOKEY"
+    }
+    return key
+}
+
+// ZoneFilePath возвращает путь к файлу зоны домена
+func ZoneFilePath(name string) string {
+    return zoneFileIn(viper.GetString("nsd.zone_dir"), name)
+}
+
+func zoneFileIn(dir, name string) string {
+    return filepath.Join(dir, name+".zone")
+}
+
+// RenderZonesConf формирует zones.conf для NSD по всем активным доменам
+func RenderZonesConf(db *models.DB) ([]byte, error) {
+    return renderZonesConf(db, viper.GetString("nsd.zone_dir"))
+}
+
+// renderZonesConf формирует zones.conf, в котором файлы зон лежат в zoneDir.
+// Для удалённых серверов каталог свой.
+func renderZonesConf(db *models.DB, zoneDir string) ([]byte, error) {
+    domains, err := models.GetAllDomains(db)
+    if err != nil {
+        return nil, err
+    }
+    targets, err := models.GetAllXFRTargets(db)
+    if err != nil {
+        return nil, err
+    }
+    byDomain := make(map[int64][]models.XFRTarget)
+    for _, t := range targets {
+        byDomain[t.DomainID] = append(byDomain[t.DomainID], t)
+    }
+
+    keys, err := models.GetTSIGKeySecrets(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var b bytes.Buffer
+    b.WriteString("# Сгенерировано DNS Manager, изменения вручную будут перезаписаны\n")
+    writeXFRTargets := func(list []models.XFRTarget) {
+        for _, t := range list {
+            if t.ProvideXFR {
+                host := strings.SplitN(t.Address, "@", 2)[0]
+                fmt.Fprintf(&b, "    provide-xfr: %s %s\n", host, nsdKeyRef(t.TSIGKey))
+            }
+            if t.Notify {
+                fmt.Fprintf(&b, "    notify: %s %s\n", t.Address, nsdKeyRef(t.TSIGKey))
+            }
+        }
+    }
+    for _, k := range keys {
+        secret, err := DecryptSecret(k.EncryptedSecret)
+        if err != nil {
+            return nil, fmt.Errorf("TSIG ключ %s: %v", k.Name, err)
+        }
+        fmt.Fprintf(&b, "\nkey:\n    name: \"%s\"\n    algorithm: %s\n    secret: \"%s\"\n",
+            k.Name, k.Algorithm, base64.StdEncoding.EncodeToString(secret))
+    }
+    for _, d := range domains {
+        fmt.Fprintf(&b, "\nzone:\n    name: \"%s\"\n    zonefile: \"%s\"\n", d.Name, zoneFileIn(zoneDir, d.Name))
+        if d.IsSecondary() {
+            for _, primary := range d.PrimaryList() {
+                fmt.Fprintf(&b, "    request-xfr: %s %s\n", primary, nsdKeyRef(d.TSIGKey))
+            }
+            for _, primary := range d.PrimaryList() {
+                // NOTIFY приходит с адреса сервера, порт в allow-notify не указывается
+                host := strings.SplitN(primary, "@", 2)[0]
+                fmt.Fprintf(&b, "    allow-notify: %s %s\n", host, nsdKeyRef(d.TSIGKey))
+            }
+            continue
+        }
+        // Глобальные серверы и серверы домена
+        writeXFRTargets(byDomain[0])
+        writeXFRTargets(byDomain[d.ID])
+    }
+
+    // Каталожная зона передаётся глобальным вторичным серверам
+    if CatalogEnabled() {
+        catalog := CatalogZoneName()
+        fmt.Fprintf(&b, "\nzone:\n    name: \"%s\"\n    zonefile: \"%s\"\n", catalog, zoneFileIn(zoneDir, catalog))
+        writeXFRTargets(byDomain[0])
+    }
+    return b.Bytes(), nil
+}
+
+// WriteZonesConf перезаписывает zones.conf. Файл заменяется атомарно,
+// чтобы NSD не прочитал его наполовину записанным. В файле есть секреты
+// TSIG ключей, поэтому он недоступен для чтения посторонним.
+func WriteZonesConf(db *models.DB) error {
+    // Состав каталога меняется вместе со списком зон
+    catalogChanged, err := UpdateCatalogZone(db)
+    if err != nil {
+        return fmt.Errorf("каталожная зона: %v", err)
+    }
+
+    // zones.conf нужен только NSD, остальные серверы получают зоны через WriteZone
+    if _, ok := CurrentBackend().(*NSDBackend); ok {
+        data, err := RenderZonesConf(db)
+        if err != nil {
+            return err
+        }
+
+        path := viper.GetString("nsd.zones_conf")
+        tmp := path + ".tmp"
+        if err := os.WriteFile(tmp, data, 0640); err != nil {
+            return err
+        }
+        if err := os.Rename(tmp, path); err != nil {
+            return err
+        }
+    }
+
+    // Удалённые серверы получают свой zones.conf, а при смене каталога и его зону
+    QueueConfSync()
+    if catalogChanged {
+        QueueZoneSync(CatalogZoneName())
+        go func() {
+            catalog := CatalogZoneName()
+            if err := CurrentBackend().WriteZone(ZoneConfig{Name: catalog, File: ZoneFilePath(catalog)}); err != nil {
+                log.Printf("Catalog zone reload failed: %v", err)
+            }
+            if _, err := NotifyCatalog(db, 0); err != nil {
+                log.Printf("Catalog zone NOTIFY failed: %v", err)
+            }
+        }()
+    }
+    return nil
+}
+
+// RebuildZonesConf перезаписывает zones.conf, ошибку пишет в лог
+func RebuildZonesConf(db *models.DB) {
+    if err := WriteZonesConf(db); err != nil {
+        log.Printf("zones.conf generation failed: %v", err)
+    }
+}
+
+// ZoneTransferStatus — состояние вторичной зоны по данным nsd-control zonestatus
+type ZoneTransferStatus struct {
+    State        string // ok, refreshing, expired
+    ServedSerial string // serial, который NSD отдаёт сейчас
+    CommitSerial string // последний полученный serial
+    Wait         string // время до следующей попытки
+    Error        string // ошибка получения статуса
+}
+
+// transferStatusReporter — бэкенд, который умеет показать состояние передачи зоны
+type transferStatusReporter interface {
+    TransferStatus(name string) ZoneTransferStatus
+}
+
+// GetZoneTransferStatus запрашивает у DNS сервера состояние передачи зоны
+func GetZoneTransferStatus(name string) ZoneTransferStatus {
+    reporter, ok := CurrentBackend().(transferStatusReporter)
+    if !ok {
+        return ZoneTransferStatus{Error: "состояние передачи зоны не поддерживается для " + CurrentBackend().Name()}
+    }
+    return reporter.TransferStatus(name)
+}
+
+// parseNSDZoneStatus разбирает вывод nsd-control zonestatus
+func parseNSDZoneStatus(out string) ZoneTransferStatus {
+    var status ZoneTransferStatus
+    for _, line := range strings.Split(out, "\n") {
+        key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+        if !ok {
+            continue
+        }
+        value = strings.Trim(strings.TrimSpace(value), `"`)
+        switch key {
+        case "state":
+            status.State = value
+        case "served-serial":
+            status.ServedSerial = value
+        case "commit-serial":
+            status.CommitSerial = value
+        case "wait":
+            status.Wait = value
+        }
+    }
+    return status
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+    "fmt"
+    "path"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+var policyActionNames = map[string]string{
+    models.ChangeCreate: "Создание",
+    models.ChangeUpdate: "Редактирование",
+    models.ChangeDelete: "Удаление",
+}
+
+// CheckRecordPolicy проверяет, может ли пользователь выполнить действие над записью.
+// Роли с CapWriteAllDomains не ограничены. Если для пользователя или его роли заданы политики,
+// действие должно подходить хотя бы под одну из них; иначе действуют глобальные
+// настройки security.allow_users_create_ns и security.allow_users_create_a.
+func CheckRecordPolicy(db *models.DB, userID int64, userRole, action string, domain *models.Domain, record *models.Record) error {
+    if models.RoleCan(userRole, models.CapWriteAllDomains) {
+        return nil
+    }
+
+    policies, err := models.GetApplicablePolicies(db, userID, userRole, domain.ID)
+    if err != nil {
+        return fmt.Errorf("Ошибка проверки политик: %v", err)
+    }
+
+    if len(policies) == 0 {
+        return checkGlobalRecordSettings(action, record.Type)
+    }
+
+    fqdn := recordFQDN(record.Name, domain.Name)
+    ttlRejected := ""
+    for _, p := range policies {
+        if !policyListMatches(p.Actions, action) || !policyListMatches(p.RecordTypes, record.Type) {
+            continue
+        }
+        if !policyNameMatches(p.NamePattern, record.Name, fqdn) {
+            continue
+        }
+        if action != models.ChangeDelete {
+            if p.MinTTL > 0 && record.TTL < p.MinTTL || p.MaxTTL > 0 && record.TTL > p.MaxTTL {
+                ttlRejected = fmt.Sprintf("TTL должен быть в пределах %d–%d", p.MinTTL, p.MaxTTL)
+                continue
+            }
+        }
+        return nil
+    }
+
+    if ttlRejected != "" {
+        return fmt.Errorf("%s %s записи %s запрещено политикой: %s",
+            policyActionNames[action], record.Type, fqdn, ttlRejected)
+    }
+    return fmt.Errorf("%s %s записи %s запрещено политикой доступа",
+        policyActionNames[action], record.Type, fqdn)
+}
+
+func checkGlobalRecordSettings(action, recordType string) error {
+    allowNS := viper.GetBool("security.allow_users_create_ns")
+    allowA := viper.GetBool("security.allow_users_create_a")
+
+    if recordType == "NS" && !allowNS || recordType == "A" && !allowA {
+        return fmt.Errorf("%s %s записей запрещено для пользователей", policyActionNames[action], recordType)
+    }
+    return nil
+}
+
+func policyListMatches(list, value string) bool {
+    for _, item := range strings.Split(list, ",") {
+        item = strings.TrimSpace(item)
+        if item == "*" || strings.EqualFold(item, value) {
+            return true
+        }
+    }
+    return false
+}
+
+// policyNameMatches сравнивает шаблон и с полным именем, и с именем относительно зоны,
+// чтобы работали и "*.dev.example.com", и "*.dev"
+func policyNameMatches(pattern, name, fqdn string) bool {
+    pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+    if pattern == "" || pattern == "*" {
+        return true
+    }
+    for _, candidate := range []string{fqdn, strings.ToLower(name)} {
+        if ok, _ := path.Match(pattern, candidate); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// recordFQDN приводит имя записи к полному имени без завершающей точки
+func recordFQDN(name, domain string) string {
+    name = strings.ToLower(strings.TrimSuffix(name, "."))
+    domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+    if name == "" || name == "@" || name == domain {
+        return domain
+    }
+    if strings.HasSuffix(name, "."+domain) {
+        return name
+    }
+    return name + "." + domain
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+    "fmt"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// GetEffectiveQuota возвращает квоту пользователя: личную, затем квоту роли,
+// затем значения по умолчанию из секции quotas конфигурации
+func GetEffectiveQuota(db *models.DB, userID int64, userRole string) (models.Quota, error) {
+    q, found, err := models.GetQuota(db, userID, userRole)
+    if err != nil {
+        return q, err
+    }
+    if !found {
+        q = models.Quota{
+            SubjectType:         "default",
+            MaxDomains:          viper.GetInt("quotas.max_domains"),
+            MaxRecordsPerDomain: viper.GetInt("quotas.max_records_per_domain"),
+            MaxTotalRecords:     viper.GetInt("quotas.max_total_records"),
+        }
+    }
+    return q, nil
+}
+
+func GetQuotaUsage(db *models.DB, userID int64, userRole string) (*models.QuotaUsage, error) {
+    limits, err := GetEffectiveQuota(db, userID, userRole)
+    if err != nil {
+        return nil, err
+    }
+
+    domains, total, err := models.GetQuotaUsage(db, userID)
+    if err != nil {
+        return nil, err
+    }
+
+    return &models.QuotaUsage{
+        Domains:      domains,
+        TotalRecords: total,
+        Limits:       limits,
+    }, nil
+}
+
+// SetRecordLimits заполняет лимит записей каждого домена. Лимит берётся из
+// квоты владельца домена, как и при создании записей.
+func SetRecordLimits(db *models.DB, domains []models.Domain) error {
+    limits := make(map[int64]int)
+    for i := range domains {
+        ownerID := domains[i].UserID
+        limit, ok := limits[ownerID]
+        if !ok {
+            ownerRole := ""
+            if owner, err := models.GetUserByID(db, ownerID); err != nil {
+                return err
+            } else if owner != nil {
+                ownerRole = string(owner.Role)
+            }
+            q, err := GetEffectiveQuota(db, ownerID, ownerRole)
+            if err != nil {
+                return err
+            }
+            limit = q.MaxRecordsPerDomain
+            limits[ownerID] = limit
+        }
+        domains[i].RecordLimit = limit
+    }
+    return nil
+}
+
+// DomainQuotaMessage формирует понятное сообщение о превышении квоты доменов
+func DomainQuotaMessage(q models.Quota) string {
+    return fmt.Sprintf("Превышена квота: можно создать не более %d доменов", q.MaxDomains)
+}
+
+// CreateRecordWithQuota создаёт запись с учётом квот владельца домена. Для
+// домена организации действует только лимит записей в домене: общий лимит
+// владельца относится к его личным доменам.
+func CreateRecordWithQuota(db *models.DB, record *models.Record) error {
+    domain, err := models.GetDomainByID(db, record.DomainID)
+    if err != nil {
+        return err
+    }
+    if domain == nil {
+        return fmt.Errorf("домен не найден")
+    }
+
+    ownerRole := ""
+    if owner, err := models.GetUserByID(db, domain.UserID); err != nil {
+        return err
+    } else if owner != nil {
+        ownerRole = string(owner.Role)
+    }
+
+    q, err := GetEffectiveQuota(db, domain.UserID, ownerRole)
+    if err != nil {
+        return err
+    }
+
+    if domain.OrgID != 0 {
+        q.MaxTotalRecords = 0
+    }
+
+    err = models.CreateRecordWithinQuota(db, record, q.MaxRecordsPerDomain, q.MaxTotalRecords)
+    if err != models.ErrQuotaExceeded {
+        return err
+    }
+
+    // Определяем, какой именно лимит исчерпан
+    count, cerr := models.CountDomainRecords(db, record.DomainID)
+    if cerr == nil && q.MaxRecordsPerDomain > 0 && count >= q.MaxRecordsPerDomain {
+        return fmt.Errorf("Превышена квота: в домене %s может быть не более %d записей",
+            domain.Name, q.MaxRecordsPerDomain)
+    }
+    return fmt.Errorf("Превышена квота: у владельца домена может быть не более %d записей во всех доменах",
+        q.MaxTotalRecords)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+    "strconv"
+    "testing"
+
+    "dns-manager/models"
+)
+
+func TestOrganizationDomainsOutsidePersonalQuota(t *testing.T) {
+    db := newTestDB(t)
+    if err := models.CreateUser(db, &models.User{Username: "alice", Role: models.RoleUser, Active: true}); err != nil {
+        t.Fatal(err)
+    }
+    alice, err := models.GetUserByUsername(db, "alice")
+    if err != nil || alice == nil {
+        t.Fatal(err)
+    }
+    if err := models.SetQuota(db, &models.Quota{SubjectType: models.PolicySubjectUser, Subject: strconv.FormatInt(alice.ID, 10),
+        MaxDomains: 1, MaxRecordsPerDomain: 2, MaxTotalRecords: 2}); err != nil {
+        t.Fatal(err)
+    }
+    orgID, err := models.CreateOrganization(db, "acme", alice.ID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    personalID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "personal.test", UserID: alice.ID, MaxDomains: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    orgDomainID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "org.test", UserID: alice.ID, OrgID: orgID, MaxDomains: 1})
+    if err != nil {
+        t.Fatalf("домен организации упёрся в личную квоту: %v", err)
+    }
+    if _, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "second.test", UserID: alice.ID, MaxDomains: 1}); err != models.ErrQuotaExceeded {
+        t.Errorf("второй личный домен: %v", err)
+    }
+
+    create := func(domainID int64, name string) error {
+        return CreateRecordWithQuota(db, &models.Record{DomainID: domainID, Type: "TXT", Name: name, Content: "x", TTL: 300})
+    }
+    for _, name := range []string{"a", "b"} {
+        if err := create(orgDomainID, name); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // Лимит записей в домене действует и для доменов организации
+    if err := create(orgDomainID, "c"); err == nil {
+        t.Error("лимит записей в домене организации не сработал")
+    }
+    // Записи домена организации не расходуют общий личный лимит
+    for _, name := range []string{"a", "b"} {
+        if err := create(personalID, name); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    usage, err := GetQuotaUsage(db, alice.ID, string(alice.Role))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if usage.Domains != 1 || usage.TotalRecords != 2 {
+        t.Errorf("использование квоты %d доменов, %d записей; ожидалось 1 и 2", usage.Domains, usage.TotalRecords)
+    }
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+
+    "dns-manager/models"
+)
+
+// Типы записей, значение которых — имя хоста
+var idnContentTypes = map[string]bool{"CNAME": true, "MX": true, "NS": true, "PTR": true}
+
+// ChangeVerb описывает выполненное над записью действие для сообщений
+func ChangeVerb(action string) string {
+    switch action {
+    case models.ChangeUpdate:
+        return "обновлена"
+    case models.ChangeDelete:
+        return "удалена"
+    }
+    return "создана"
+}
+
+// PrepareRecordName приводит имя записи к виду, в котором оно хранится:
+// Unicode метки переводятся в punycode, имя проверяется и исправляется
+// валидатором относительно домена.
+func PrepareRecordName(name, domainName string) (string, error) {
+    // Unicode имена хранятся и попадают в зону в виде punycode
+    name, err := ToASCIIName(name)
+    if err != nil {
+        return "", errors.New("Ошибка в имени: " + err.Error())
+    }
+    nameCheck := ValidateRecordName(name, domainName)
+    if !nameCheck.Valid {
+        return "", errors.New("Ошибка в имени: " + nameCheck.Message)
+    }
+    return nameCheck.Corrected, nil
+}
+
+// PrepareRecord проверяет имя и значение записи относительно домена
+// и подставляет исправленные валидатором значения.
+func PrepareRecord(record *models.Record, domainName string) error {
+    name, err := PrepareRecordName(record.Name, domainName)
+    if err != nil {
+        return err
+    }
+    record.Name = name
+    if idnContentTypes[record.Type] {
+        content, err := ToASCIIName(record.Content)
+        if err != nil {
+            return errors.New("Ошибка в значении: " + err.Error())
+        }
+        record.Content = content
+    }
+
+    // Валидатор рассчитан на одну строку до 255 байт, поэтому TXT записи
+    // разбираются и приводятся к формату хранения отдельно
+    if record.Type == "TXT" {
+        content, err := NormalizeTXT(record.Content)
+        if err != nil {
+            return errors.New("Ошибка в значении: " + err.Error())
+        }
+        record.Content = content
+        return nil
+    }
+
+    contentCheck := ValidateRecordContent(record.Type, record.Content, domainName)
+    if !contentCheck.Valid {
+        return errors.New("Ошибка в значении: " + contentCheck.Message)
+    }
+    record.Content = contentCheck.Corrected
+
+    return nil
+}
+
+// ProtectedRecordError — изменение попадает под правило защиты домена и
+// возможно только через заявку. Action и Record описывают это изменение.
+type ProtectedRecordError struct {
+    Action string
+    Record models.Record
+}
+
+func (e *ProtectedRecordError) Error() string {
+    return fmt.Sprintf("%s запись %s защищена, изменение возможно только через заявку", e.Record.Type, e.Record.Name)
+}
+
+// checkRecordProtection возвращает ProtectedRecordError, если запись защищена
+func checkRecordProtection(db *models.DB, action string, record *models.Record) error {
+    protected, err := models.IsRecordProtected(db, record.DomainID, record.Type, record.Name)
+    if err != nil {
+        return err
+    }
+    if protected {
+        return &ProtectedRecordError{Action: action, Record: *record}
+    }
+    return nil
+}
+
+// CheckRecordDelete не даёт удалить последний NS сервер домена
+func CheckRecordDelete(db *models.DB, record *models.Record) error {
+    if record.Type != "NS" {
+        return nil
+    }
+
+    nsCount, err := models.CountNSRecords(db, record.DomainID)
+    if err != nil {
+        return fmt.Errorf("Ошибка проверки NS записей: %v", err)
+    }
+    if nsCount <= 1 {
+        return errors.New("Нельзя удалить последний NS сервер")
+    }
+    return nil
+}
+
+// ApplyRecordChange применяет изменение записи, увеличивает serial домена
+// и перегенерирует зону. Запись должна быть заранее проверена через PrepareRecord.
+func ApplyRecordChange(db *models.DB, action string, record *models.Record) error {
+    domain, err := models.GetDomainByID(db, record.DomainID)
+    if err != nil {
+        return err
+    }
+    if err := CheckDomainEditable(domain); err != nil {
+        return err
+    }
+
+    switch action {
+    case models.ChangeCreate:
+        err = CreateRecordWithQuota(db, record)
+    case models.ChangeUpdate:
+        old, gerr := models.GetRecordByID(db, record.ID)
+        if gerr != nil {
+            return gerr
+        }
+        if err = models.UpdateRecord(db, record); err == nil && old != nil &&
+            (old.Name != record.Name || old.Content != record.Content || old.Type != record.Type) {
+            // Адрес или имя изменились — PTR на старую пару больше не верна
+            removePTR(db, old)
+        }
+    case models.ChangeDelete:
+        if err = CheckRecordDelete(db, record); err == nil {
+            err = models.DeleteRecord(db, record.ID)
+        }
+        if err == nil {
+            removePTR(db, record)
+        }
+    default:
+        return fmt.Errorf("неизвестное действие: %s", action)
+    }
+    if err != nil {
+        return err
+    }
+
+    models.IncrementDomainSerial(db, record.DomainID)
+    if err := PublishZone(db, record.DomainID); err != nil {
+        log.Printf("Zone generation failed for domain %d: %v", record.DomainID, err)
+    } else {
+        NotifySecondaries(db, record.DomainID)
+    }
+    return nil
+}
+
+// ExecuteRecordChange применяет отложенное изменение (заявку или задание
+// планировщика): заново проверяет его на текущем состоянии домена,
+// т.к. с момента создания запись могла измениться или исчезнуть.
+func ExecuteRecordChange(db *models.DB, action string, record models.Record) error {
+    domain, err := models.GetDomainByID(db, record.DomainID)
+    if err != nil {
+        return err
+    }
+    if domain == nil {
+        return errors.New("домен не найден")
+    }
+
+    if action != models.ChangeCreate {
+        existing, err := models.GetRecordByID(db, record.ID)
+        if err != nil {
+            return err
+        }
+        if existing == nil || existing.DomainID != record.DomainID {
+            return errors.New("запись уже удалена")
+        }
+        if action == models.ChangeDelete {
+            record = *existing
+        }
+    }
+
+    if action != models.ChangeDelete {
+        if err := PrepareRecord(&record, domain.Name); err != nil {
+            return err
+        }
+    }
+
+    return ApplyRecordChange(db, action, &record)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "dns-manager/models"
+)
+
+// RecordIssue — запись, которая не была добавлена, и причина
+type RecordIssue struct {
+    Record models.Record
+    Reason string
+}
+
+// RecordSetResult — итог добавления набора записей (шаблон, импорт зоны)
+type RecordSetResult struct {
+    Applied   []models.Record
+    Skipped   []RecordIssue // записи, которые нельзя добавить (нет IP, политика, защита)
+    Conflicts []RecordIssue // записи, противоречащие уже существующим в домене
+    Warnings  []string      // строки исходных данных, которые не удалось разобрать
+}
+
+// applyRecordSet проверяет и добавляет записи в домен, дополняя result.
+// Serial увеличивается и зона перегенерируется один раз в конце.
+func applyRecordSet(db *models.DB, userID int64, userRole string, domain *models.Domain,
+    records []models.Record, dryRun bool, result *RecordSetResult) error {
+
+    if err := CheckDomainEditable(domain); err != nil {
+        return err
+    }
+
+    existing, err := models.GetRecordsByDomainID(db, domain.ID)
+    if err != nil {
+        return err
+    }
+
+    applied := 0
+    for _, record := range records {
+        record.DomainID = domain.ID
+
+        if err := PrepareRecord(&record, domain.Name); err != nil {
+            result.Skipped = append(result.Skipped, RecordIssue{record, err.Error()})
+            continue
+        }
+        if err := CheckRecordPolicy(db, userID, userRole, models.ChangeCreate, domain, &record); err != nil {
+            result.Skipped = append(result.Skipped, RecordIssue{record, err.Error()})
+            continue
+        }
+        protected, err := models.IsRecordProtected(db, domain.ID, record.Type, record.Name)
+        if err != nil {
+            return err
+        }
+        if protected {
+            result.Skipped = append(result.Skipped, RecordIssue{record, "Запись защищена, добавьте её через заявку"})
+            continue
+        }
+        if reason := recordConflict(record, existing, domain.Name); reason != "" {
+            result.Conflicts = append(result.Conflicts, RecordIssue{record, reason})
+            continue
+        }
+
+        if !dryRun {
+            if err := CreateRecordWithQuota(db, &record); err != nil {
+                result.Skipped = append(result.Skipped, RecordIssue{record, err.Error()})
+                continue
+            }
+            applied++
+        }
+        // Следующие записи набора проверяются и против только что добавленных
+        existing = append(existing, record)
+        result.Applied = append(result.Applied, record)
+    }
+
+    if applied > 0 {
+        models.IncrementDomainSerial(db, domain.ID)
+        if err := PublishZone(db, domain.ID); err != nil {
+            log.Printf("Zone generation failed for domain %d: %v", domain.ID, err)
+        } else {
+            NotifySecondaries(db, domain.ID)
+        }
+    }
+    return nil
+}
+
+// recordConflict ищет среди существующих записей домена ту, с которой
+// конфликтует новая запись. Пустая строка — конфликта нет.
+func recordConflict(record models.Record, existing []models.Record, domainName string) string {
+    fqdn := recordFQDN(record.Name, domainName)
+    for _, e := range existing {
+        if recordFQDN(e.Name, domainName) != fqdn {
+            continue
+        }
+        switch {
+        case e.Type == record.Type && e.Content == record.Content:
+            return "Такая запись уже существует"
+        case e.Type == "CNAME" && record.Type != "CNAME":
+            return fmt.Sprintf("Имя %s уже занято CNAME записью → %s", e.Name, e.Content)
+        case record.Type == "CNAME":
+            return fmt.Sprintf("CNAME не может сосуществовать с %s записью %s", e.Type, e.Name)
+        case e.Type == "TXT" && record.Type == "TXT":
+            // Несколько SPF или DMARC записей на одном имени делают политику недействительной
+            if tag := txtVersionTag(record.Content); tag != "" && tag == txtVersionTag(e.Content) {
+                return fmt.Sprintf("На имени %s уже есть запись %s: %s", e.Name, tag, TXTValue(e.Content))
+            }
+        }
+    }
+    return ""
+}
+
+// txtVersionTag возвращает тег версии TXT записи (v=spf1, v=DMARC1 и т.п.)
+func txtVersionTag(content string) string {
+    content = strings.TrimSpace(TXTValue(content))
+    if !strings.HasPrefix(strings.ToLower(content), "v=") {
+        return ""
+    }
+    tag := strings.FieldsFunc(content, func(r rune) bool { return r == ' ' || r == ';' })[0]
+    return strings.ToLower(tag)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// ReverseZone — обратная зона, построенная по префиксу
+type ReverseZone struct {
+    Name       string // 2.0.192.in-addr.arpa
+    CIDR       string // префикс в каноническом виде: 192.0.2.0/24
+    ParentName string // для бесклассовой зоны (RFC 2317) — зона /24, где нужны CNAME
+}
+
+// ReverseZoneForCIDR строит имя обратной зоны. IPv4 префиксы /8, /16 и /24
+// дают обычную зону, /25–/31 — бесклассовую зону по RFC 2317 вида
+// 0-26.2.0.192.in-addr.arpa. IPv6 префикс должен быть кратен 4 битам.
+func ReverseZoneForCIDR(cidr string) (*ReverseZone, error) {
+    ip, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+    if err != nil {
+        return nil, fmt.Errorf("Некорректный префикс: %s", cidr)
+    }
+    if !ip.Equal(network.IP) {
+        return nil, fmt.Errorf("Укажите адрес сети: %s", network.String())
+    }
+    ones, _ := network.Mask.Size()
+
+    if v4 := network.IP.To4(); v4 != nil {
+        switch {
+        case ones >= 8 && ones <= 24 && ones%8 == 0:
+            labels := make([]string, 0, 4)
+            for i := ones/8 - 1; i >= 0; i-- {
+                labels = append(labels, fmt.Sprint(v4[i]))
+            }
+            return &ReverseZone{
+                Name: strings.Join(labels, ".") + ".in-addr.arpa",
+                CIDR: network.String(),
+            }, nil
+        case ones >= 25 && ones <= 31:
+            parent := fmt.Sprintf("%d.%d.%d.in-addr.arpa", v4[2], v4[1], v4[0])
+            return &ReverseZone{
+                Name:       fmt.Sprintf("%d-%d.%s", v4[3], ones, parent),
+                CIDR:       network.String(),
+                ParentName: parent,
+            }, nil
+        }
+        return nil, errors.New("Префикс IPv4 должен быть /8, /16, /24 или от /25 до /31 (RFC 2317)")
+    }
+
+    if ones < 4 || ones > 124 || ones%4 != 0 {
+        return nil, errors.New("Префикс IPv6 должен быть кратен 4 битам, от /4 до /124")
+    }
+    nibbles := ipv6Nibbles(network.IP)[:ones/4]
+    return &ReverseZone{
+        Name: strings.Join(reverseStrings(nibbles), ".") + ".ip6.arpa",
+        CIDR: network.String(),
+    }, nil
+}
+
+func ipv6Nibbles(ip net.IP) []string {
+    ip = ip.To16()
+    nibbles := make([]string, 0, 32)
+    for _, b := range ip {
+        nibbles = append(nibbles, fmt.Sprintf("%x", b>>4), fmt.Sprintf("%x", b&0x0f))
+    }
+    return nibbles
+}
+
+func reverseStrings(items []string) []string {
+    reversed := make([]string, len(items))
+    for i, item := range items {
+        reversed[len(items)-1-i] = item
+    }
+    return reversed
+}
+
+// ClasslessDelegation возвращает записи, которые нужно добавить в
+// родительскую зону /24, чтобы делегировать бесклассовую зону (RFC 2317):
+// NS записи метки зоны (0-26) и CNAME для каждого адреса префикса
+func ClasslessDelegation(zone *ReverseZone, nameServers []string) []models.Record {
+    if zone.ParentName == "" {
+        return nil
+    }
+    _, network, _ := net.ParseCIDR(zone.CIDR)
+    ones, bits := network.Mask.Size()
+    start := int(network.IP.To4()[3])
+    label := strings.TrimSuffix(zone.Name, "."+zone.ParentName)
+    ttl := viper.GetInt("default_ttl")
+
+    var records []models.Record
+    for _, ns := range nameServers {
+        records = append(records, models.Record{
+            Type:    "NS",
+            Name:    label,
+            Content: ns,
+            TTL:     ttl,
+        })
+    }
+    for i := 0; i < 1<<(bits-ones); i++ {
+        records = append(records, models.Record{
+            Type:    "CNAME",
+            Name:    fmt.Sprint(start + i),
+            Content: fmt.Sprintf("%d.%s.", start+i, zone.Name),
+            TTL:     ttl,
+        })
+    }
+    return records
+}
+
+// delegationNameServers возвращает серверы имён зоны: NS записи её вершины,
+// а если зоны или записей нет — серверы из dns.ns_servers
+func delegationNameServers(db *models.DB, zoneName string) ([]string, error) {
+    var servers []string
+    domain, err := models.GetDomainByName(db, zoneName)
+    if err != nil {
+        return nil, err
+    }
+    if domain != nil {
+        records, err := models.GetRecordsByDomainID(db, domain.ID)
+        if err != nil {
+            return nil, err
+        }
+        for _, record := range records {
+            if record.Type == "NS" && recordFQDN(record.Name, zoneName) == recordFQDN("@", zoneName) {
+                servers = append(servers, record.Content)
+            }
+        }
+    }
+    if len(servers) == 0 {
+        servers = viper.GetStringSlice("dns.ns_servers")
+    }
+    return servers, nil
+}
+
+// FindReverseZone ищет обслуживаемую панелью обратную зону с самым длинным
+// префиксом, в который входит адрес
+func FindReverseZone(db *models.DB, ip net.IP) (*models.Domain, error) {
+    zones, err := models.GetReverseZones(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var best *models.Domain
+    bestOnes := -1
+    for i := range zones {
+        _, network, err := net.ParseCIDR(zones[i].ReverseCIDR)
+        if err != nil || !network.Contains(ip) {
+            continue
+        }
+        if ones, _ := network.Mask.Size(); ones > bestOnes {
+            best, bestOnes = &zones[i], ones
+        }
+    }
+    return best, nil
+}
+
+// PTRName возвращает имя PTR записи адреса относительно обратной зоны
+func PTRName(ip net.IP, zone *models.Domain) (string, error) {
+    _, network, err := net.ParseCIDR(zone.ReverseCIDR)
+    if err != nil || !network.Contains(ip) {
+        return "", fmt.Errorf("адрес %s не входит в зону %s", ip, zone.Name)
+    }
+
+    var full string
+    if v4 := ip.To4(); v4 != nil {
+        // В бесклассовой зоне запись называется последним октетом адреса
+        if ones, _ := network.Mask.Size(); ones > 24 {
+            return fmt.Sprint(v4[3]), nil
+        }
+        full = fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+    } else {
+        full = strings.Join(reverseStrings(ipv6Nibbles(ip)), ".") + ".ip6.arpa"
+    }
+    return strings.TrimSuffix(full, "."+zone.Name), nil
+}
+
+// forwardPTR возвращает адрес и полное имя прямой записи A/AAAA
+func forwardPTR(db *models.DB, record *models.Record) (net.IP, string, error) {
+    if record.Type != "A" && record.Type != "AAAA" {
+        return nil, "", nil
+    }
+    ip := net.ParseIP(record.Content)
+    if ip == nil {
+        return nil, "", nil
+    }
+    domain, err := models.GetDomainByID(db, record.DomainID)
+    if err != nil || domain == nil {
+        return nil, "", err
+    }
+    return ip, recordFQDN(record.Name, domain.Name) + ".", nil
+}
+
+// SetPTR создаёт или обновляет PTR запись для прямой записи A/AAAA в
+// обслуживаемой панелью обратной зоне. Пользователь должен иметь право
+// на запись в обратную зону. Для защищённой PTR возвращается
+// ProtectedRecordError: изменение нужно отправить на согласование.
+func SetPTR(db *models.DB, userID int64, userRole string, record *models.Record) (string, error) {
+    ip, target, err := forwardPTR(db, record)
+    if err != nil {
+        return "", err
+    }
+    if ip == nil {
+        return "", errors.New("PTR создаётся только для A и AAAA записей")
+    }
+
+    zone, err := FindReverseZone(db, ip)
+    if err != nil {
+        return "", err
+    }
+    if zone == nil {
+        return "", fmt.Errorf("нет обратной зоны для адреса %s", ip)
+    }
+    ok, err := models.CanAccessDomain(db, userID, userRole, zone.ID, models.PermWrite)
+    if err != nil {
+        return "", err
+    }
+    if !ok {
+        return "", fmt.Errorf("нет прав на запись в обратную зону %s", zone.Name)
+    }
+
+    name, err := PTRName(ip, zone)
+    if err != nil {
+        return "", err
+    }
+    ptr := &models.Record{
+        DomainID: zone.ID,
+        Type:     "PTR",
+        Name:     name,
+        Content:  target,
+        TTL:      record.TTL,
+    }
+    if err := PrepareRecord(ptr, zone.Name); err != nil {
+        return "", err
+    }
+
+    existing, err := models.GetRecordsByDomainID(db, zone.ID)
+    if err != nil {
+        return "", err
+    }
+    action := models.ChangeCreate
+    for _, e := range existing {
+        if e.Type == "PTR" && strings.EqualFold(e.Name, ptr.Name) {
+            if sameHost(e.Content, ptr.Content) {
+                return fmt.Sprintf("PTR %s.%s уже указывает на %s", ptr.Name, zone.Name, target), nil
+            }
+            action, ptr.ID = models.ChangeUpdate, e.ID
+            break
+        }
+    }
+
+    if err := CheckRecordPolicy(db, userID, userRole, action, zone, ptr); err != nil {
+        return "", err
+    }
+    if err := checkRecordProtection(db, action, ptr); err != nil {
+        return "", err
+    }
+    if err := ApplyRecordChange(db, action, ptr); err != nil {
+        return "", err
+    }
+    return fmt.Sprintf("PTR %s.%s → %s %s", ptr.Name, zone.Name, target, ChangeVerb(action)), nil
+}
+
+// sameHost сравнивает имена хостов без учёта регистра и завершающей точки
+func sameHost(a, b string) bool {
+    return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// removePTR удаляет PTR запись, указывающую на удаляемую или изменяемую
+// прямую запись. Чужие PTR с тем же адресом не трогаются, защищённые
+// остаются на месте: их удаляют через заявку.
+func removePTR(db *models.DB, record *models.Record) {
+    ip, target, err := forwardPTR(db, record)
+    if err != nil || ip == nil {
+        return
+    }
+    zone, err := FindReverseZone(db, ip)
+    if err != nil || zone == nil {
+        return
+    }
+    name, err := PTRName(ip, zone)
+    if err != nil {
+        return
+    }
+
+    records, err := models.GetRecordsByDomainID(db, zone.ID)
+    if err != nil {
+        return
+    }
+    for _, e := range records {
+        if e.Type != "PTR" || !strings.EqualFold(e.Name, name) || !sameHost(e.Content, target) {
+            continue
+        }
+        if err := checkRecordProtection(db, models.ChangeDelete, &e); err != nil {
+            log.Printf("PTR %s.%s → %s left in place: %v", name, zone.Name, target, err)
+            return
+        }
+        if err := models.DeleteRecord(db, e.ID); err != nil {
+            log.Printf("PTR cleanup failed for %s: %v", target, err)
+            return
+        }
+        models.IncrementDomainSerial(db, zone.ID)
+        if err := PublishZone(db, zone.ID); err != nil {
+            log.Printf("Zone generation failed for domain %d: %v", zone.ID, err)
+        } else {
+            NotifySecondaries(db, zone.ID)
+        }
+        log.Printf("Removed PTR %s.%s → %s", name, zone.Name, target)
+        return
+    }
+}
+
+// ApplyClasslessDelegation добавляет NS и CNAME записи RFC 2317 в родительскую зону,
+// если она обслуживается панелью. Иначе возвращает записи, которые нужно
+// передать владельцу родительской зоны.
+func ApplyClasslessDelegation(db *models.DB, userID int64, userRole string, zone *ReverseZone) (*RecordSetResult, []models.Record, error) {
+    nameServers, err := delegationNameServers(db, zone.Name)
+    if err != nil {
+        return nil, nil, err
+    }
+    records := ClasslessDelegation(zone, nameServers)
+    if len(records) == 0 {
+        return nil, nil, nil
+    }
+
+    parent, err := models.GetDomainByName(db, zone.ParentName)
+    if err != nil {
+        return nil, nil, err
+    }
+    if parent == nil {
+        return nil, records, nil
+    }
+
+    result := &RecordSetResult{}
+    if err := applyRecordSet(db, userID, userRole, parent, records, false, result); err != nil {
+        return nil, nil, err
+    }
+    return result, nil, nil
+}
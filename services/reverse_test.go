@@ -0,0 +1,186 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "reflect"
+    "testing"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+func TestClasslessDelegationRecords(t *testing.T) {
+    viper.Set("default_ttl", 3600)
+    viper.Set("dns.ns_servers", []string{"ns1.example.net", "ns2.example.net"})
+    db := newTestDB(t)
+
+    zone, err := ReverseZoneForCIDR("192.0.2.64/26")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Зоны ещё нет: серверы берутся из dns.ns_servers
+    servers, err := delegationNameServers(db, zone.Name)
+    if err != nil || len(servers) != 2 || servers[0] != "ns1.example.net" {
+        t.Fatalf("серверы по умолчанию %v, %v", servers, err)
+    }
+
+    id, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: zone.Name, UserID: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, record := range []models.Record{
+        {DomainID: id, Type: "NS", Name: "@", Content: "ns.customer.test", TTL: 3600},
+        {DomainID: id, Type: "NS", Name: "sub", Content: "ns.other.test", TTL: 3600},
+    } {
+        if err := models.CreateRecord(db, &record); err != nil {
+            t.Fatal(err)
+        }
+    }
+    servers, err = delegationNameServers(db, zone.Name)
+    if err != nil || len(servers) != 1 || servers[0] != "ns.customer.test" {
+        t.Fatalf("серверы зоны %v, %v", servers, err)
+    }
+
+    records := ClasslessDelegation(zone, servers)
+    if len(records) != 1+64 {
+        t.Fatalf("записей %d, ожидалось 65", len(records))
+    }
+    if ns := records[0]; ns.Type != "NS" || ns.Name != "64-26" || ns.Content != "ns.customer.test" {
+        t.Errorf("NS делегирования %+v", ns)
+    }
+    for i, record := range records[1:] {
+        name := fmt.Sprint(64 + i)
+        if record.Type != "CNAME" || record.Name != name || record.Content != name+".64-26.2.0.192.in-addr.arpa." {
+            t.Fatalf("CNAME %d: %+v", i, record)
+        }
+    }
+
+    // Обычной зоне делегирование в /24 не нужно
+    full, _ := ReverseZoneForCIDR("192.0.2.0/24")
+    if records := ClasslessDelegation(full, servers); records != nil {
+        t.Errorf("для /24 возвращены записи %v", records)
+    }
+}
+
+func TestReverseZoneForCIDR(t *testing.T) {
+    cases := []struct{ cidr, name, parent string }{
+        {"10.0.0.0/8", "10.in-addr.arpa", ""},
+        {"172.16.0.0/16", "16.172.in-addr.arpa", ""},
+        {"192.0.2.0/24", "2.0.192.in-addr.arpa", ""},
+        {"192.0.2.64/26", "64-26.2.0.192.in-addr.arpa", "2.0.192.in-addr.arpa"},
+        {"192.0.2.128/31", "128-31.2.0.192.in-addr.arpa", "2.0.192.in-addr.arpa"},
+        {"2001:db8::/32", "8.b.d.0.1.0.0.2.ip6.arpa", ""},
+        {"2001:db8:1::/48", "1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", ""},
+    }
+    for _, c := range cases {
+        zone, err := ReverseZoneForCIDR(c.cidr)
+        if err != nil {
+            t.Errorf("%s: %v", c.cidr, err)
+            continue
+        }
+        if zone.Name != c.name || zone.ParentName != c.parent || zone.CIDR != c.cidr {
+            t.Errorf("%s: %+v", c.cidr, zone)
+        }
+    }
+    for _, cidr := range []string{"bogus", "192.0.2.1/24", "192.0.0.0/20", "192.0.2.0/32", "2001:db8::/33", "::/0"} {
+        if _, err := ReverseZoneForCIDR(cidr); err == nil {
+            t.Errorf("%s принят", cidr)
+        }
+    }
+}
+
+func TestPTRName(t *testing.T) {
+    cases := []struct{ zone, cidr, ip, name string }{
+        {"2.0.192.in-addr.arpa", "192.0.2.0/24", "192.0.2.10", "10"},
+        {"0.192.in-addr.arpa", "192.0.0.0/16", "192.0.2.10", "10.2"},
+        {"64-26.2.0.192.in-addr.arpa", "192.0.2.64/26", "192.0.2.70", "70"},
+        {"0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "2001:db8::/48", "2001:db8::1",
+            "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"},
+    }
+    for _, c := range cases {
+        name, err := PTRName(net.ParseIP(c.ip), &models.Domain{Name: c.zone, ReverseCIDR: c.cidr})
+        if err != nil || name != c.name {
+            t.Errorf("%s в %s: %q, %v; ожидалось %q", c.ip, c.zone, name, err, c.name)
+        }
+    }
+    if _, err := PTRName(net.ParseIP("192.0.2.10"), &models.Domain{Name: "64-26.2.0.192.in-addr.arpa", ReverseCIDR: "192.0.2.64/26"}); err == nil {
+        t.Error("адрес вне зоны принят")
+    }
+}
+
+func TestRemovePTRSharedZone(t *testing.T) {
+    dir := setupBackendConfig(t)
+    InitNSDManager(dir, dir+"/zones.conf")
+    useBackend(t, NewKnotBackend(&recordingRunner{}))
+    db := newTestDB(t)
+
+    if err := models.CreateUser(db, &models.User{Username: "alice", Role: models.RoleUser, Active: true}); err != nil {
+        t.Fatal(err)
+    }
+    alice, err := models.GetUserByUsername(db, "alice")
+    if err != nil || alice == nil {
+        t.Fatal(err)
+    }
+    forwardID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "example.test", UserID: alice.ID})
+    if err != nil {
+        t.Fatal(err)
+    }
+    zoneID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "2.0.192.in-addr.arpa", UserID: alice.ID,
+        ReverseCIDR: "192.0.2.0/24"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, ptr := range []models.Record{
+        {Name: "10", Content: "www.example.test."},
+        {Name: "10", Content: "other.example.net."},
+        {Name: "11", Content: "www.example.test."},
+        {Name: "12", Content: "api.example.test."},
+    } {
+        ptr.DomainID, ptr.Type, ptr.TTL = zoneID, "PTR", 300
+        if err := models.CreateRecord(db, &ptr); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := models.CreateProtectionRule(db, &models.ProtectionRule{DomainID: zoneID, RecordType: "PTR", Name: "12"}); err != nil {
+        t.Fatal(err)
+    }
+    ptrs := func() []string {
+        t.Helper()
+        records, err := models.GetRecordsByDomainID(db, zoneID)
+        if err != nil {
+            t.Fatal(err)
+        }
+        var list []string
+        for _, r := range records {
+            list = append(list, r.Name+" "+r.Content)
+        }
+        return list
+    }
+
+    // Удаляется только PTR адреса записи, указывающая на её имя
+    removePTR(db, &models.Record{DomainID: forwardID, Type: "A", Name: "www", Content: "192.0.2.10"})
+    want := []string{"10 other.example.net.", "11 www.example.test.", "12 api.example.test."}
+    if got := ptrs(); !reflect.DeepEqual(got, want) {
+        t.Errorf("PTR после удаления %q, ожидалось %q", got, want)
+    }
+
+    // Защищённая PTR остаётся на месте
+    removePTR(db, &models.Record{DomainID: forwardID, Type: "A", Name: "api", Content: "192.0.2.12"})
+    if got := ptrs(); !reflect.DeepEqual(got, want) {
+        t.Errorf("удалена защищённая PTR: %q", got)
+    }
+
+    // Изменение защищённой PTR уходит на согласование
+    _, err = SetPTR(db, alice.ID, string(alice.Role), &models.Record{DomainID: forwardID, Type: "A", Name: "new", Content: "192.0.2.12", TTL: 300})
+    var protectedErr *ProtectedRecordError
+    if !errors.As(err, &protectedErr) || protectedErr.Action != models.ChangeUpdate || protectedErr.Record.Content != "new.example.test." {
+        t.Errorf("SetPTR для защищённой записи: %v", err)
+    }
+    if got := ptrs(); !reflect.DeepEqual(got, want) {
+        t.Errorf("защищённая PTR изменена: %q", got)
+    }
+}
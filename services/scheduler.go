@@ -0,0 +1,157 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "dns-manager/models"
+)
+
+// StartScheduler запускает фоновое применение запланированных изменений записей.
+// Задания хранятся в БД, поэтому переживают перезапуск сервера.
+func StartScheduler(db *models.DB, interval time.Duration) {
+    if interval <= 0 {
+        interval = 30 * time.Second
+    }
+
+    if n, err := models.FailInterruptedScheduledChanges(db); err != nil {
+        log.Printf("Scheduler: cannot reset interrupted jobs: %v", err)
+    } else if n > 0 {
+        log.Printf("Scheduler: %d interrupted jobs marked as failed", n)
+    }
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+
+        runDueScheduledChanges(db)
+        for range ticker.C {
+            runDueScheduledChanges(db)
+        }
+    }()
+}
+
+func runDueScheduledChanges(db *models.DB) {
+    changes, err := models.GetDueScheduledChanges(db, time.Now())
+    if err != nil {
+        log.Printf("Scheduler: cannot load due jobs: %v", err)
+        return
+    }
+
+    for i := range changes {
+        runScheduledChange(db, &changes[i])
+    }
+}
+
+func runScheduledChange(db *models.DB, c *models.ScheduledChange) {
+    claimed, err := models.ClaimScheduledChange(db, c.ID)
+    if err != nil {
+        log.Printf("Scheduler: cannot claim job %d: %v", c.ID, err)
+        return
+    }
+    if !claimed {
+        return
+    }
+
+    status := models.ScheduleStatusDone
+    errText := ""
+    details := fmt.Sprintf("Выполнено запланированное изменение #%d (%s): %s %s → %s",
+        c.ID, c.Action, c.Type, c.Name, c.Content)
+
+    err = checkScheduledChange(db, c)
+    if err == nil {
+        err = ExecuteRecordChange(db, c.Action, c.Record())
+    }
+    if err != nil {
+        status = models.ScheduleStatusFailed
+        errText = err.Error()
+        details = fmt.Sprintf("Ошибка запланированного изменения #%d (%s %s): %v", c.ID, c.Type, c.Name, err)
+        log.Printf("Scheduler: job %d failed: %v", c.ID, err)
+    }
+
+    if err := models.FinishScheduledChange(db, c.ID, status, errText); err != nil {
+        log.Printf("Scheduler: cannot update job %d: %v", c.ID, err)
+    }
+
+    LogUserAction(db, c.CreatedBy, c.CreatedByName, "scheduled_"+c.Action+"_record", details, "scheduler")
+}
+
+// checkScheduledChange заново проверяет задание перед применением: с момента
+// создания у автора могли отобрать доступ к домену, а политики и правила
+// защиты — измениться
+func checkScheduledChange(db *models.DB, c *models.ScheduledChange) error {
+    creator, err := models.GetUserByID(db, c.CreatedBy)
+    if err != nil {
+        return err
+    }
+    if creator == nil {
+        return errors.New("автор задания удалён")
+    }
+    creatorRole := string(creator.Role)
+
+    ok, err := models.CanAccessDomain(db, creator.ID, creatorRole, c.DomainID, models.PermWrite)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return fmt.Errorf("у автора задания %s больше нет прав на изменение домена", creator.Username)
+    }
+
+    domain, err := models.GetDomainByID(db, c.DomainID)
+    if err != nil {
+        return err
+    }
+    if domain == nil {
+        return errors.New("домен не найден")
+    }
+
+    // Проверяются и текущая запись, и результат изменения
+    record := c.Record()
+    records := []*models.Record{&record}
+    if c.Action != models.ChangeCreate {
+        existing, err := models.GetRecordByID(db, c.RecordID)
+        if err != nil {
+            return err
+        }
+        if existing != nil {
+            records = append(records, existing)
+        }
+    }
+
+    protected := false
+    for _, r := range records {
+        if err := CheckRecordPolicy(db, creator.ID, creatorRole, c.Action, domain, r); err != nil {
+            return err
+        }
+        p, err := models.IsRecordProtected(db, domain.ID, r.Type, r.Name)
+        if err != nil {
+            return err
+        }
+        protected = protected || p
+    }
+    if !protected {
+        return nil
+    }
+
+    // Защищённую запись меняет задание согласующего или одобренное по заявке,
+    // если согласующий по-прежнему имеет это право
+    approver := creator
+    if c.ApprovedBy != 0 {
+        if approver, err = models.GetUserByID(db, c.ApprovedBy); err != nil {
+            return err
+        }
+        if approver == nil {
+            return errors.New("запись защищена, а согласовавший задание пользователь удалён")
+        }
+    }
+    ok, err = models.CanApproveChanges(db, approver.ID, string(approver.Role), domain.ID)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return fmt.Errorf("запись защищена, а у %s нет права согласования изменений домена", approver.Username)
+    }
+    return nil
+}
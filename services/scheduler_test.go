@@ -0,0 +1,89 @@
+package services
+
+import (
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+func TestScheduledChangeRevalidatedAtRunTime(t *testing.T) {
+    dir := setupBackendConfig(t)
+    InitNSDManager(dir, dir+"/zones.conf")
+    useBackend(t, NewKnotBackend(&recordingRunner{}))
+    viper.Set("security.allow_users_create_a", true)
+    db := newTestDB(t)
+
+    users := map[string]*models.User{}
+    for _, name := range []string{"alice", "bob", "eve"} {
+        if err := models.CreateUser(db, &models.User{Username: name, Role: models.RoleUser, Active: true}); err != nil {
+            t.Fatal(err)
+        }
+        user, err := models.GetUserByUsername(db, name)
+        if err != nil || user == nil {
+            t.Fatal(name, err)
+        }
+        users[name] = user
+    }
+    domainID, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "sched.test", UserID: users["alice"].ID})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := models.AddDomainApprover(db, domainID, users["bob"].ID); err != nil {
+        t.Fatal(err)
+    }
+    if err := models.CreateProtectionRule(db, &models.ProtectionRule{DomainID: domainID, RecordType: "A", Name: "api"}); err != nil {
+        t.Fatal(err)
+    }
+
+    // run создаёт задание на добавление A записи и сразу выполняет его
+    run := func(creator, approver, name string) *models.ScheduledChange {
+        t.Helper()
+        change := &models.ScheduledChange{
+            DomainID: domainID, Action: models.ChangeCreate, Type: "A", Name: name,
+            Content: "192.0.2.10", TTL: 300, RunAt: time.Now().Add(-time.Minute),
+            CreatedBy: users[creator].ID, CreatedByName: creator,
+        }
+        if approver != "" {
+            change.ApprovedBy, change.ApprovedByName = users[approver].ID, approver
+        }
+        if err := models.CreateScheduledChange(db, change); err != nil {
+            t.Fatal(err)
+        }
+        runScheduledChange(db, change)
+        done, err := models.GetScheduledChangeByID(db, change.ID)
+        if err != nil || done == nil {
+            t.Fatal(err)
+        }
+        return done
+    }
+    expect := func(c *models.ScheduledChange, status, errPart string) {
+        t.Helper()
+        if c.Status != status || !strings.Contains(c.Error, errPart) {
+            t.Errorf("задание %s: статус %s, ошибка %q; ожидалось %s, %q", c.Name, c.Status, c.Error, status, errPart)
+        }
+    }
+
+    expect(run("alice", "", "www"), models.ScheduleStatusDone, "")
+    // Доступ к домену проверяется на момент выполнения
+    expect(run("eve", "", "eve"), models.ScheduleStatusFailed, "нет прав на изменение домена")
+
+    // Защищённую запись меняет только задание, одобренное действующим согласующим
+    expect(run("alice", "", "api"), models.ScheduleStatusFailed, "нет права согласования")
+    expect(run("alice", "bob", "api"), models.ScheduleStatusDone, "")
+    if err := models.RemoveDomainApprover(db, domainID, users["bob"].ID); err != nil {
+        t.Fatal(err)
+    }
+    expect(run("alice", "bob", "api"), models.ScheduleStatusFailed, "нет права согласования")
+
+    // Политика, появившаяся после создания задания, тоже действует
+    policy := &models.RecordPolicy{SubjectType: models.PolicySubjectUser, Subject: strconv.FormatInt(users["alice"].ID, 10),
+        RecordTypes: "TXT", Actions: "*", NamePattern: "*"}
+    if err := models.CreateRecordPolicy(db, policy); err != nil {
+        t.Fatal(err)
+    }
+    expect(run("alice", "", "late"), models.ScheduleStatusFailed, "запрещено политикой")
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "strings"
+
+    "github.com/spf13/viper"
+)
+
+// Секреты в БД шифруются AES-256-GCM ключом security.encryption_key из конфига.
+// Формат: "v1:" + base64(nonce || ciphertext).
+const secretPrefix = "v1:"
+
+func secretCipher() (cipher.AEAD, error) {
+    key, err := base64.StdEncoding.DecodeString(viper.GetString("security.encryption_key"))
+    if err != nil || len(key) != 32 {
+        return nil, errors.New("не задан ключ шифрования security.encryption_key (32 байта в base64)")
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// EncryptSecret шифрует секрет для хранения в БД
+func EncryptSecret(plain []byte) (string, error) {
+    aead, err := secretCipher()
+    if err != nil {
+        return "", err
+    }
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := aead.Seal(nonce, nonce, plain, nil)
+    return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret расшифровывает секрет, сохранённый EncryptSecret
+func DecryptSecret(encrypted string) ([]byte, error) {
+    aead, err := secretCipher()
+    if err != nil {
+        return nil, err
+    }
+    if !strings.HasPrefix(encrypted, secretPrefix) {
+        return nil, errors.New("неизвестный формат зашифрованного секрета")
+    }
+    sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, secretPrefix))
+    if err != nil || len(sealed) < aead.NonceSize() {
+        return nil, errors.New("повреждённый зашифрованный секрет")
+    }
+    plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+    if err != nil {
+        return nil, errors.New("не удалось расшифровать секрет: неверный ключ шифрования")
+    }
+    return plain, nil
+}
+
+// GenerateEncryptionKey создаёт ключ для security.encryption_key
+func GenerateEncryptionKey() (string, error) {
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        return "", err
+    }
+    return base64.StdEncoding.EncodeToString(key), nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// Подстановки, допустимые в имени и значении записей шаблона
+const (
+    templateDomain = "{{domain}}"
+    templateIP     = "{{ip}}"
+)
+
+// expandTemplateRecord подставляет имя домена и IP в запись шаблона
+func expandTemplateRecord(rec models.TemplateRecord, domainID int64, domainName, ip string) models.Record {
+    replacer := strings.NewReplacer(templateDomain, domainName, templateIP, ip)
+
+    ttl := rec.TTL
+    if ttl == 0 {
+        ttl = viper.GetInt("default_ttl")
+    }
+    return models.Record{
+        DomainID: domainID,
+        Type:     strings.ToUpper(rec.Type),
+        Name:     replacer.Replace(rec.Name),
+        Content:  replacer.Replace(rec.Content),
+        Priority: rec.Priority,
+        TTL:      ttl,
+    }
+}
+
+func templateNeedsIP(rec models.TemplateRecord) bool {
+    return strings.Contains(rec.Name, templateIP) || strings.Contains(rec.Content, templateIP)
+}
+
+// ValidateTemplateRecords проверяет записи шаблона, подставляя пример домена и адреса
+func ValidateTemplateRecords(records []models.TemplateRecord) error {
+    if len(records) == 0 {
+        return errors.New("Шаблон не содержит записей")
+    }
+    for i, rec := range records {
+        switch strings.ToUpper(rec.Type) {
+        case "":
+            return fmt.Errorf("Запись %d: не указан тип", i+1)
+        case "SOA":
+            return fmt.Errorf("Запись %d: SOA создаётся автоматически и не может входить в шаблон", i+1)
+        }
+        if rec.TTL < 0 {
+            return fmt.Errorf("Запись %d: некорректный TTL", i+1)
+        }
+        record := expandTemplateRecord(rec, 0, "example.com", "192.0.2.1")
+        if err := PrepareRecord(&record, "example.com"); err != nil {
+            return fmt.Errorf("Запись %d (%s %s): %v", i+1, rec.Type, rec.Name, err)
+        }
+    }
+    return nil
+}
+
+// ApplyTemplate добавляет записи шаблона в домен. Записи, конфликтующие с уже
+// существующими, не добавляются и возвращаются в Conflicts. При dryRun домен
+// не изменяется, а результат показывает, что было бы добавлено.
+func ApplyTemplate(db *models.DB, userID int64, userRole string, domain *models.Domain,
+    template *models.RecordTemplate, ip string, dryRun bool) (*RecordSetResult, error) {
+
+    if ip != "" && !ValidateIP(ip) {
+        return nil, errors.New("Некорректный IP адрес")
+    }
+
+    result := &RecordSetResult{}
+    var records []models.Record
+    for _, rec := range template.Records {
+        record := expandTemplateRecord(rec, domain.ID, domain.Name, ip)
+        if ip == "" && templateNeedsIP(rec) {
+            result.Skipped = append(result.Skipped, RecordIssue{record, "Не указан IP адрес"})
+            continue
+        }
+        records = append(records, record)
+    }
+
+    if err := applyRecordSet(db, userID, userRole, domain, records, dryRun, result); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
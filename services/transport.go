@@ -0,0 +1,246 @@
+package services
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+// SyncTransport доставляет файлы на удалённый NSD сервер и перезагружает его
+type SyncTransport interface {
+    PutZone(name string, data []byte) error
+    RemoveZone(name string) error
+    PutConf(data []byte) error
+    Reload() error
+    // Status возвращает nil, если сервер доступен и NSD работает
+    Status() error
+}
+
+// NewSyncTransport создаёт транспорт для сервера. token — расшифрованный
+// токен агента, для ssh не используется.
+func NewSyncTransport(server *models.DNSServer, token string, runner CommandRunner) (SyncTransport, error) {
+    switch server.Transport {
+    case models.TransportSSH:
+        return &sshTransport{Runner: runner, Server: *server}, nil
+    case models.TransportHTTP:
+        return &httpTransport{
+            BaseURL: strings.TrimSuffix(server.Address, "/"),
+            Token:   token,
+            Client:  &http.Client{Timeout: time.Duration(viper.GetInt("distribution.timeout")) * time.Second},
+        }, nil
+    case models.TransportPull:
+        return nil, fmt.Errorf("сервер %s забирает зоны сам", server.Name)
+    }
+    return nil, fmt.Errorf("неизвестный способ доставки: %s", server.Transport)
+}
+
+// sshTransport копирует файлы через scp и выполняет команды через ssh.
+// Файл сначала копируется рядом с целевым и затем переименовывается,
+// чтобы NSD не прочитал его наполовину записанным.
+type sshTransport struct {
+    Runner CommandRunner
+    Server models.DNSServer
+}
+
+// shellQuote экранирует аргумент для удалённой оболочки
+func shellQuote(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var (
+    sshUserPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+    sshHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+)
+
+// ValidateSSHAddress проверяет адрес вида [user@]host[:port]. Адрес
+// передаётся ssh и scp аргументом, поэтому ничего похожего на опцию
+// в нём быть не должно.
+func ValidateSSHAddress(addr string) error {
+    invalid := fmt.Errorf("адрес должен иметь вид [user@]host[:port]: %s", addr)
+    host := addr
+    if i := strings.LastIndex(host, "@"); i >= 0 {
+        if !sshUserPattern.MatchString(host[:i]) {
+            return invalid
+        }
+        host = host[i+1:]
+    }
+    if h, port, err := net.SplitHostPort(host); err == nil {
+        n, err := strconv.Atoi(port)
+        if err != nil || n < 1 || n > 65535 {
+            return invalid
+        }
+        host = h
+    } else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+        host = host[1 : len(host)-1]
+    }
+    if net.ParseIP(host) == nil && !sshHostPattern.MatchString(host) {
+        return invalid
+    }
+    return nil
+}
+
+// target разбирает адрес [user@]host[:port]
+func (t *sshTransport) target() (string, string) {
+    addr, user := t.Server.Address, ""
+    if i := strings.LastIndex(addr, "@"); i >= 0 {
+        user, addr = addr[:i+1], addr[i+1:]
+    }
+    host, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        return user + strings.Trim(addr, "[]"), ""
+    }
+    return user + host, port
+}
+
+func (t *sshTransport) options(portFlag string) []string {
+    args := []string{"-o", "BatchMode=yes", "-o", fmt.Sprintf("ConnectTimeout=%d", viper.GetInt("distribution.timeout"))}
+    if key := viper.GetString("distribution.ssh_key"); key != "" {
+        args = append(args, "-i", key)
+    }
+    if _, port := t.target(); port != "" {
+        args = append(args, portFlag, port)
+    }
+    return args
+}
+
+func (t *sshTransport) ssh(command string) error {
+    if err := ValidateSSHAddress(t.Server.Address); err != nil {
+        return err
+    }
+    host, _ := t.target()
+    args := append(t.options("-p"), "--", host, command)
+    _, err := runBackendCommand(t.Runner, "ssh", args...)
+    return err
+}
+
+func (t *sshTransport) put(path string, data []byte) error {
+    if err := ValidateSSHAddress(t.Server.Address); err != nil {
+        return err
+    }
+    tmp, err := os.CreateTemp("", "dnsmgr-sync-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+
+    host, _ := t.target()
+    // scp с IPv6 адресом требует скобок
+    if strings.Contains(host, ":") {
+        if i := strings.LastIndex(host, "@"); i >= 0 {
+            host = host[:i+1] + "[" + host[i+1:] + "]"
+        } else {
+            host = "[" + host + "]"
+        }
+    }
+    args := append(t.options("-P"), "-q", "--", tmp.Name(), host+":"+path+".tmp")
+    if _, err := runBackendCommand(t.Runner, "scp", args...); err != nil {
+        return err
+    }
+    return t.ssh("mv -f " + shellQuote(path+".tmp") + " " + shellQuote(path))
+}
+
+func (t *sshTransport) PutZone(name string, data []byte) error {
+    return t.put(zoneFileIn(t.Server.ZoneDir, name), data)
+}
+
+func (t *sshTransport) RemoveZone(name string) error {
+    return t.ssh("rm -f " + shellQuote(zoneFileIn(t.Server.ZoneDir, name)))
+}
+
+func (t *sshTransport) PutConf(data []byte) error {
+    return t.put(t.Server.ConfPath, data)
+}
+
+func (t *sshTransport) Reload() error {
+    return t.ssh(viper.GetString("distribution.reload_command"))
+}
+
+func (t *sshTransport) Status() error {
+    return t.ssh(viper.GetString("distribution.status_command"))
+}
+
+// httpTransport отправляет файлы агенту на сервере (dns-manager agent
+// с настройкой listen):
+//
+//    PUT    /v1/zones/{name}  файл зоны
+//    DELETE /v1/zones/{name}
+//    PUT    /v1/zones.conf
+//    POST   /v1/reload
+//    GET    /v1/status
+//
+// Запросы подписываются токеном сервера в заголовке Authorization.
+type httpTransport struct {
+    BaseURL string
+    Token   string
+    Client  *http.Client
+}
+
+func (t *httpTransport) request(method, path string, body []byte) error {
+    var reader io.Reader
+    if body != nil {
+        reader = bytes.NewReader(body)
+    }
+    req, err := http.NewRequest(method, t.BaseURL+path, reader)
+    if err != nil {
+        return err
+    }
+    if t.Token != "" {
+        req.Header.Set("Authorization", "Bearer "+t.Token)
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+    }
+
+    resp, err := t.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        return fmt.Errorf("агент: %s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+    }
+    return nil
+}
+
+func (t *httpTransport) PutZone(name string, data []byte) error {
+    return t.request(http.MethodPut, "/v1/zones/"+url.PathEscape(name), data)
+}
+
+func (t *httpTransport) RemoveZone(name string) error {
+    return t.request(http.MethodDelete, "/v1/zones/"+url.PathEscape(name), nil)
+}
+
+func (t *httpTransport) PutConf(data []byte) error {
+    return t.request(http.MethodPut, "/v1/zones.conf", data)
+}
+
+func (t *httpTransport) Reload() error {
+    return t.request(http.MethodPost, "/v1/reload", nil)
+}
+
+func (t *httpTransport) Status() error {
+    if t.BaseURL == "" {
+        return errors.New("не задан адрес агента")
+    }
+    return t.request(http.MethodGet, "/v1/status", nil)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+    "strings"
+    "testing"
+
+    "dns-manager/models"
+    "github.com/spf13/viper"
+)
+
+func TestValidateSSHAddress(t *testing.T) {
+    for _, addr := range []string{
+        "ns2.example.net", "root@ns2.example.net", "deploy@ns2.example.net:2222",
+        "192.0.2.10", "192.0.2.10:22", "2001:db8::10", "[2001:db8::10]:2222", "user@[2001:db8::10]",
+    } {
+        if err := ValidateSSHAddress(addr); err != nil {
+            t.Errorf("%s: %v", addr, err)
+        }
+    }
+    for _, addr := range []string{
+        "", "-oProxyCommand=touch /tmp/x", "root@-oProxyCommand=x", "-root@host", "host:0", "host:ssh",
+        "host name", "ns2.example.net;id", "user name@host", "@host", "host:22:22", "[host]:22x",
+    } {
+        if err := ValidateSSHAddress(addr); err == nil {
+            t.Errorf("%q принят", addr)
+        }
+    }
+}
+
+func TestSSHTransportCommands(t *testing.T) {
+    viper.Set("distribution.timeout", 5)
+    viper.Set("distribution.ssh_key", "")
+    runner := &recordingRunner{}
+    transport := &sshTransport{Runner: runner, Server: models.DNSServer{
+        Name: "ns2", Address: "deploy@ns2.example.net:2222", ZoneDir: "/var/lib/nsd",
+    }}
+
+    if err := transport.RemoveZone("example.com"); err != nil {
+        t.Fatal(err)
+    }
+    expectCommands(t, runner,
+        "ssh -o BatchMode=yes -o ConnectTimeout=5 -p 2222 -- deploy@ns2.example.net rm -f '/var/lib/nsd/example.com.zone'")
+
+    if err := transport.PutZone("example.com", []byte("zone")); err != nil {
+        t.Fatal(err)
+    }
+    calls := runner.take()
+    if len(calls) != 2 || !strings.HasPrefix(calls[0], "scp -o BatchMode=yes -o ConnectTimeout=5 -P 2222 -q -- ") ||
+        !strings.HasSuffix(calls[0], " deploy@ns2.example.net:/var/lib/nsd/example.com.zone.tmp") {
+        t.Fatalf("команды копирования %q", calls)
+    }
+
+    // Адрес, похожий на опцию, не доходит до ssh и scp
+    transport.Server.Address = "-oProxyCommand=touch /tmp/pwned"
+    if err := transport.Reload(); err == nil {
+        t.Error("ssh запущен с опцией вместо адреса")
+    }
+    if err := transport.PutZone("example.com", []byte("zone")); err == nil {
+        t.Error("scp запущен с опцией вместо адреса")
+    }
+    expectCommands(t, runner)
+}
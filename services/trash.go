@@ -0,0 +1,61 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "dns-manager/models"
+
+    "github.com/spf13/viper"
+)
+
+// TrashRetention — срок хранения удалённых доменов. 0 — домены удаляются сразу.
+func TrashRetention() time.Duration {
+    return time.Duration(viper.GetInt("trash.retention_days")) * 24 * time.Hour
+}
+
+// StartTrashPurger периодически удаляет домены, срок хранения которых в корзине истёк
+func StartTrashPurger(db *models.DB, interval time.Duration) {
+    if interval <= 0 {
+        interval = time.Hour
+    }
+    if TrashRetention() <= 0 {
+        log.Printf("Trash: retention_days <= 0, deleted domains are removed at once and domains already in trash are not purged")
+    }
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+
+        purgeExpiredDomains(db)
+        for range ticker.C {
+            purgeExpiredDomains(db)
+        }
+    }()
+}
+
+// purgeExpiredDomains ничего не делает при нулевом сроке хранения: новые
+// домены в корзину не попадают, а оставшиеся удаляются только вручную
+func purgeExpiredDomains(db *models.DB) {
+    retention := TrashRetention()
+    if retention <= 0 {
+        return
+    }
+
+    domains, err := models.GetExpiredTrashedDomains(db, time.Now().Add(-retention))
+    if err != nil {
+        log.Printf("Trash: cannot load expired domains: %v", err)
+        return
+    }
+
+    for _, d := range domains {
+        if err := models.DeleteDomain(db, d.ID); err != nil {
+            log.Printf("Trash: cannot purge domain %s: %v", d.Name, err)
+            continue
+        }
+        log.Printf("Trash: domain %s purged", d.Name)
+        LogUserAction(db, d.UserID, d.OwnerName, "purge_domain",
+            fmt.Sprintf("Домен %s удалён из корзины по истечении срока хранения", d.Name), "trash")
+    }
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash"
+    "strings"
+    "time"
+
+    "dns-manager/models"
+)
+
+// tsigKey — TSIG ключ с расшифрованным секретом
+type tsigKey struct {
+    Name      string
+    Algorithm string // hmac-sha256 или hmac-sha512
+    Secret    []byte
+}
+
+const (
+    dnsTypeTSIG = 250
+    dnsClassANY = 255
+    tsigFudge   = 300
+)
+
+// tsigHash возвращает хеш-функцию HMAC для алгоритма TSIG
+func tsigHash(algorithm string) (func() hash.Hash, error) {
+    switch algorithm {
+    case "hmac-sha256":
+        return sha256.New, nil
+    case "hmac-sha512":
+        return sha512.New, nil
+    }
+    return nil, fmt.Errorf("неподдерживаемый алгоритм TSIG: %s", algorithm)
+}
+
+// TSIGAlgorithms — поддерживаемые алгоритмы TSIG
+var TSIGAlgorithms = []string{"hmac-sha256", "hmac-sha512"}
+
+// GenerateTSIGSecret создаёт секрет длиной в размер хеша алгоритма
+func GenerateTSIGSecret(algorithm string) ([]byte, error) {
+    newHash, err := tsigHash(algorithm)
+    if err != nil {
+        return nil, err
+    }
+    secret := make([]byte, newHash().Size())
+    if _, err := rand.Read(secret); err != nil {
+        return nil, err
+    }
+    return secret, nil
+}
+
+// CheckTSIGKeyName проверяет, что ключ с таким именем заведён. Пустое имя — без ключа.
+func CheckTSIGKeyName(db *models.DB, name string) error {
+    if name == "" {
+        return nil
+    }
+    if !ValidateTSIGKeyName(name) {
+        return errors.New("Некорректное имя TSIG ключа")
+    }
+    key, err := models.GetTSIGKeyByName(db, name)
+    if err != nil {
+        return err
+    }
+    if key == nil {
+        return fmt.Errorf("TSIG ключ %s не найден", name)
+    }
+    return nil
+}
+
+// lookupTSIGKey загружает TSIG ключ из БД и расшифровывает секрет
+func lookupTSIGKey(db *models.DB, name string) (*tsigKey, error) {
+    stored, err := models.GetTSIGKeySecret(db, name)
+    if err != nil {
+        return nil, err
+    }
+    if stored == nil {
+        return nil, fmt.Errorf("TSIG ключ %s не найден", name)
+    }
+    secret, err := DecryptSecret(stored.EncryptedSecret)
+    if err != nil {
+        return nil, err
+    }
+    return &tsigKey{Name: stored.Name, Algorithm: stored.Algorithm, Secret: secret}, nil
+}
+
+// appendWireName добавляет имя в каноническом формате DNS (нижний регистр, без сжатия)
+func appendWireName(b []byte, name string) []byte {
+    name = strings.TrimSuffix(strings.ToLower(name), ".")
+    if name != "" {
+        for _, label := range strings.Split(name, ".") {
+            b = append(b, byte(len(label)))
+            b = append(b, label...)
+        }
+    }
+    return append(b, 0)
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+    return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// signTSIG добавляет к сообщению запись TSIG (RFC 8945). Сообщение должно
+// быть собрано полностью: подпись покрывает все его байты.
+func signTSIG(msg []byte, key *tsigKey, now time.Time) ([]byte, error) {
+    newHash, err := tsigHash(key.Algorithm)
+    if err != nil {
+        return nil, err
+    }
+    if len(msg) < 12 {
+        return nil, fmt.Errorf("слишком короткое DNS сообщение")
+    }
+    signed := uint64(now.Unix())
+
+    // Переменные TSIG, которые входят в подпись вместе с сообщением
+    var vars []byte
+    vars = appendWireName(vars, key.Name)
+    vars = binary.BigEndian.AppendUint16(vars, dnsClassANY)
+    vars = binary.BigEndian.AppendUint32(vars, 0)
+    vars = appendWireName(vars, key.Algorithm)
+    vars = appendUint48(vars, signed)
+    vars = binary.BigEndian.AppendUint16(vars, tsigFudge)
+    vars = binary.BigEndian.AppendUint16(vars, 0) // error
+    vars = binary.BigEndian.AppendUint16(vars, 0) // other len
+
+    mac := hmac.New(newHash, key.Secret)
+    mac.Write(msg)
+    mac.Write(vars)
+    sum := mac.Sum(nil)
+
+    var rdata []byte
+    rdata = appendWireName(rdata, key.Algorithm)
+    rdata = appendUint48(rdata, signed)
+    rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+    rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+    rdata = append(rdata, sum...)
+    rdata = append(rdata, msg[0], msg[1]) // original ID
+    rdata = binary.BigEndian.AppendUint16(rdata, 0)
+    rdata = binary.BigEndian.AppendUint16(rdata, 0)
+
+    out := make([]byte, len(msg), len(msg)+len(rdata)+64)
+    copy(out, msg)
+    out = appendWireName(out, key.Name)
+    out = binary.BigEndian.AppendUint16(out, dnsTypeTSIG)
+    out = binary.BigEndian.AppendUint16(out, dnsClassANY)
+    out = binary.BigEndian.AppendUint32(out, 0)
+    out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+    out = append(out, rdata...)
+
+    // TSIG — последняя запись в разделе additional
+    binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+    return out, nil
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+)
+
+// Максимальная длина одной character-string в TXT записи (RFC 1035)
+const txtChunkSize = 255
+
+// Предел суммарной длины RDATA одной записи
+const txtMaxRDataSize = 65535
+
+// TXT записи хранятся в records.content в формате файла зоны: одна или несколько
+// строк в кавычках через пробел, с экранированием \" \\ и \DDD. В таком виде
+// значение без изменений попадает в файл зоны.
+
+// SplitTXT делит значение TXT записи на строки не длиннее 255 байт
+func SplitTXT(value string) []string {
+    var chunks []string
+    for len(value) > txtChunkSize {
+        chunks = append(chunks, value[:txtChunkSize])
+        value = value[txtChunkSize:]
+    }
+    return append(chunks, value)
+}
+
+// FormatTXT записывает строки TXT записи в виде "..." "...". Кавычки и обратная
+// косая черта экранируются, управляющие символы и байты вне ASCII — как \DDD.
+func FormatTXT(chunks []string) string {
+    quoted := make([]string, len(chunks))
+    for i, c := range chunks {
+        var b strings.Builder
+        b.WriteByte('"')
+        for j := 0; j < len(c); j++ {
+            switch ch := c[j]; {
+            case ch == '"' || ch == '\\':
+                b.WriteByte('\\')
+                b.WriteByte(ch)
+            case ch < 0x20 || ch >= 0x7f:
+                fmt.Fprintf(&b, "\\%03d", ch)
+            default:
+                b.WriteByte(ch)
+            }
+        }
+        b.WriteByte('"')
+        quoted[i] = b.String()
+    }
+    return strings.Join(quoted, " ")
+}
+
+// ParseTXT разбирает TXT запись в формате файла зоны на строки, раскрывая
+// экранирование. Строки могут быть в кавычках или без них.
+func ParseTXT(content string) ([]string, error) {
+    return parseTXTStrings(content, txtChunkSize)
+}
+
+// parseTXTStrings разбирает строки TXT записи. maxLen = 0 — без ограничения длины строки.
+func parseTXTStrings(content string, maxLen int) ([]string, error) {
+    var chunks []string
+    s := strings.TrimSpace(content)
+    for len(s) > 0 {
+        var b strings.Builder
+        quoted := s[0] == '"'
+        i := 0
+        if quoted {
+            i = 1
+        }
+        closed := false
+        for i < len(s) && !closed {
+            ch := s[i]
+            switch {
+            case ch == '\\':
+                if i+1 >= len(s) {
+                    return nil, errors.New("незавершённая escape-последовательность")
+                }
+                if !isDigit(s[i+1]) {
+                    b.WriteByte(s[i+1])
+                    i += 2
+                    continue
+                }
+                if i+3 >= len(s) || !isDigit(s[i+2]) || !isDigit(s[i+3]) {
+                    return nil, errors.New("escape-последовательность \\DDD должна содержать три цифры")
+                }
+                v, _ := strconv.Atoi(s[i+1 : i+4])
+                if v > 255 {
+                    return nil, fmt.Errorf("некорректный байт \\%s", s[i+1:i+4])
+                }
+                b.WriteByte(byte(v))
+                i += 4
+                continue
+            case quoted && ch == '"':
+                closed = true
+            case !quoted && (ch == ' ' || ch == '\t'):
+                closed = true
+                continue
+            case !quoted && ch == '"':
+                return nil, errors.New("кавычка внутри строки без кавычек")
+            default:
+                b.WriteByte(ch)
+            }
+            i++
+        }
+        if quoted && !closed {
+            return nil, errors.New("не закрыта кавычка")
+        }
+        if maxLen > 0 && b.Len() > maxLen {
+            return nil, fmt.Errorf("строка длиннее %d байт", maxLen)
+        }
+        chunks = append(chunks, b.String())
+
+        rest := s[i:]
+        s = strings.TrimLeft(rest, " \t")
+        if len(s) > 0 && len(s) == len(rest) {
+            return nil, errors.New("строки TXT записи должны разделяться пробелом")
+        }
+    }
+    if len(chunks) == 0 {
+        return []string{""}, nil
+    }
+    return chunks, nil
+}
+
+func isDigit(ch byte) bool {
+    return ch >= '0' && ch <= '9'
+}
+
+// NormalizeTXT приводит значение TXT записи из API к формату хранения.
+// Значение в кавычках разбирается как одна или несколько строк, любое другое
+// считается одной строкой произвольной длины. Строки длиннее 255 байт делятся.
+func NormalizeTXT(content string) (string, error) {
+    values := []string{content}
+    if strings.HasPrefix(strings.TrimSpace(content), `"`) {
+        parsed, err := parseTXTStrings(content, 0)
+        if err != nil {
+            return "", err
+        }
+        values = parsed
+    }
+
+    var chunks []string
+    size := 0
+    for _, v := range values {
+        for _, c := range SplitTXT(v) {
+            chunks = append(chunks, c)
+            size += len(c) + 1
+        }
+    }
+    if size > txtMaxRDataSize {
+        return "", fmt.Errorf("TXT запись длиннее %d байт", txtMaxRDataSize)
+    }
+    return FormatTXT(chunks), nil
+}
+
+// TXTValue склеивает строки TXT записи в одно значение, как его видят
+// получатели (SPF, DKIM и DMARC объединяют строки без разделителей)
+func TXTValue(content string) string {
+    if !strings.HasPrefix(strings.TrimSpace(content), `"`) {
+        return content
+    }
+    chunks, err := parseTXTStrings(content, 0)
+    if err != nil {
+        return content
+    }
+    return strings.Join(chunks, "")
+}
+
+// MigrateLegacyTXT переводит TXT записи, сохранённые без кавычек, в формат
+// хранения и заново публикует затронутые зоны. Такие значения всегда были
+// одной строкой, а читатели формата файла зоны (генератор зон, PowerDNS,
+// встроенный сервер) разбили бы их по пробелам. Повторный запуск ничего не
+// меняет: записи в кавычках не выбираются.
+func MigrateLegacyTXT(db *models.DB) (int, error) {
+    records, err := models.GetUnquotedTXTRecords(db)
+    if err != nil {
+        return 0, err
+    }
+
+    converted := 0
+    domains := make(map[int64]bool)
+    for _, record := range records {
+        content, err := NormalizeTXT(record.Content)
+        if err != nil {
+            log.Printf("TXT record %d: cannot convert %q: %v", record.ID, record.Content, err)
+            continue
+        }
+        if err := models.SetRecordContent(db, record.ID, content); err != nil {
+            return converted, err
+        }
+        converted++
+        domains[record.DomainID] = true
+    }
+
+    for domainID := range domains {
+        // Домены в корзине не обслуживаются, их зоны не публикуем
+        if domain, err := models.GetDomainByID(db, domainID); err != nil || domain == nil {
+            delete(domains, domainID)
+            continue
+        }
+        if err := models.IncrementDomainSerial(db, domainID); err != nil {
+            log.Printf("Domain %d: cannot increment serial after TXT conversion: %v", domainID, err)
+            continue
+        }
+        if err := PublishZone(db, domainID); err != nil {
+            log.Printf("Domain %d: cannot publish zone after TXT conversion: %v", domainID, err)
+        }
+    }
+    if len(domains) > 0 {
+        ReloadServer()
+    }
+    return converted, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+
+    "dns-manager/models"
+)
+
+func TestMigrateLegacyTXT(t *testing.T) {
+    dir := setupBackendConfig(t)
+    InitNSDManager(dir, dir+"/zones.conf")
+    runner := &recordingRunner{}
+    useBackend(t, NewKnotBackend(runner))
+    db := newTestDB(t)
+
+    id, err := models.CreateDomain(db, &models.DomainCreateOptions{Name: "legacy.test", UserID: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    legacy := &models.Record{DomainID: id, Type: "TXT", Name: "@", Content: "v=spf1 include:_spf.example.net ~all", TTL: 300}
+    quoted := &models.Record{DomainID: id, Type: "TXT", Name: "dkim", Content: `"v=DKIM1; k=rsa; " "p=MIGf"`, TTL: 300}
+    for _, record := range []*models.Record{legacy, quoted} {
+        if err := models.CreateRecord(db, record); err != nil {
+            t.Fatal(err)
+        }
+    }
+    before, _ := models.GetDomainByID(db, id)
+
+    n, err := MigrateLegacyTXT(db)
+    if err != nil || n != 1 {
+        t.Fatalf("преобразовано %d, ошибка %v", n, err)
+    }
+    records, err := models.GetRecordsByDomainID(db, id)
+    if err != nil {
+        t.Fatal(err)
+    }
+    contents := map[string]string{}
+    for _, record := range records {
+        if record.Type == "TXT" {
+            contents[record.Name] = record.Content
+        }
+    }
+    want := map[string]string{
+        "@":    `"v=spf1 include:_spf.example.net ~all"`,
+        "dkim": `"v=DKIM1; k=rsa; " "p=MIGf"`,
+    }
+    if !reflect.DeepEqual(contents, want) {
+        t.Errorf("значения после преобразования %q, ожидались %q", contents, want)
+    }
+    if chunks, err := ParseTXT(contents["@"]); err != nil || len(chunks) != 1 {
+        t.Errorf("SPF должен остаться одной строкой: %q %v", chunks, err)
+    }
+
+    // Зона опубликована заново с новым serial
+    after, _ := models.GetDomainByID(db, id)
+    if after.Serial == before.Serial {
+        t.Error("serial не увеличен")
+    }
+    if len(runner.take()) == 0 {
+        t.Error("зона не опубликована")
+    }
+
+    // Повторный запуск ничего не меняет
+    if n, err := MigrateLegacyTXT(db); err != nil || n != 0 {
+        t.Errorf("повторный запуск: %d, %v", n, err)
+    }
+    expectCommands(t, runner)
+}
+
+func TestTXTRoundTrip(t *testing.T) {
+    cases := []struct {
+        chunks    []string
+        formatted string
+    }{
+        {[]string{"v=spf1 -all"}, `"v=spf1 -all"`},
+        {[]string{`say "hi"`}, `"say \"hi\""`},
+        {[]string{`C:\dir\`}, `"C:\\dir\\"`},
+        {[]string{"tab\there", "\x00\xff"}, `"tab\009here" "\000\255"`},
+        {[]string{"привет"}, `"\208\191\209\128\208\184\208\178\208\181\209\130"`},
+        {[]string{""}, `""`},
+    }
+    for _, c := range cases {
+        formatted := FormatTXT(c.chunks)
+        if formatted != c.formatted {
+            t.Errorf("FormatTXT(%q) = %s, ожидалось %s", c.chunks, formatted, c.formatted)
+        }
+        parsed, err := ParseTXT(formatted)
+        if err != nil || !reflect.DeepEqual(parsed, c.chunks) {
+            t.Errorf("ParseTXT(%s) = %q, %v; ожидалось %q", formatted, parsed, err, c.chunks)
+        }
+    }
+
+    // \DDD и экранирование без кавычек
+    parsed, err := ParseTXT(`\065\066C plain a\ b`)
+    if err != nil || !reflect.DeepEqual(parsed, []string{"ABC", "plain", "a b"}) {
+        t.Errorf("строки без кавычек: %q, %v", parsed, err)
+    }
+    for _, bad := range []string{`"open`, `"a\"`, `"\25"`, `"\256"`, `"a""b"`, `a"b`, `x\`} {
+        if _, err := ParseTXT(bad); err == nil {
+            t.Errorf("%s разобрано без ошибки", bad)
+        }
+    }
+}
+
+func TestSplitTXT(t *testing.T) {
+    value := strings.Repeat("a", 255) + strings.Repeat("b", 255) + "c"
+    chunks := SplitTXT(value)
+    if len(chunks) != 3 || len(chunks[0]) != 255 || len(chunks[1]) != 255 || chunks[2] != "c" {
+        t.Fatalf("длины строк %d", len(chunks))
+    }
+    if got := SplitTXT(strings.Repeat("a", 255)); len(got) != 1 {
+        t.Errorf("255 байт разбиты на %d строк", len(got))
+    }
+
+    // Длинное значение сохраняется строками по 255 байт и склеивается обратно
+    content, err := NormalizeTXT(value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseTXT(content)
+    if err != nil || !reflect.DeepEqual(parsed, chunks) {
+        t.Errorf("ParseTXT после NormalizeTXT: %q, %v", parsed, err)
+    }
+    if TXTValue(content) != value {
+        t.Error("TXTValue не восстановил исходное значение")
+    }
+    if _, err := ParseTXT(`"` + strings.Repeat("a", 256) + `"`); err == nil {
+        t.Error("строка длиннее 255 байт принята")
+    }
+    if _, err := NormalizeTXT(strings.Repeat("a", 65536)); err == nil {
+        t.Error("запись длиннее 65535 байт принята")
+    }
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "dns-manager/models"
+)
+
+// ImportableTypes — типы записей, которые переносятся при импорте зоны.
+// SOA панель ведёт сама, поэтому она пропускается.
+var ImportableTypes = map[string]bool{
+    "A": true, "AAAA": true, "CNAME": true, "MX": true, "TXT": true, "NS": true, "PTR": true,
+}
+
+// zoneLine — логическая строка файла зоны (скобки объединяют несколько физических)
+type zoneLine struct {
+    num        int
+    tokens     []string
+    blankOwner bool // строка начинается с пробела: владелец как у предыдущей записи
+}
+
+// tokenizeZone делит текст зоны на логические строки. Строки в кавычках
+// сохраняются как есть, вместе с кавычками и экранированием.
+func tokenizeZone(text string) ([]zoneLine, error) {
+    var lines []zoneLine
+    cur := zoneLine{num: 1}
+    var tok strings.Builder
+    inTok, quoted, escaped := false, false, false
+    depth, lineNum, lineStart := 0, 1, true
+
+    flush := func() {
+        if inTok {
+            cur.tokens = append(cur.tokens, tok.String())
+            tok.Reset()
+            inTok = false
+        }
+    }
+
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        if c == '\n' {
+            lineNum++
+        }
+        if quoted || escaped {
+            tok.WriteByte(c)
+            switch {
+            case escaped:
+                escaped = false
+            case c == '\\':
+                escaped = true
+            case c == '"':
+                quoted = false
+            }
+            continue
+        }
+
+        if lineStart && depth == 0 && (c == ' ' || c == '\t') {
+            cur.blankOwner = true
+        }
+        lineStart = false
+
+        switch c {
+        case '\\':
+            tok.WriteByte(c)
+            inTok, escaped = true, true
+        case '"':
+            tok.WriteByte(c)
+            inTok, quoted = true, true
+        case ';':
+            for i+1 < len(text) && text[i+1] != '\n' {
+                i++
+            }
+        case '(':
+            flush()
+            depth++
+        case ')':
+            flush()
+            if depth == 0 {
+                return nil, fmt.Errorf("строка %d: лишняя закрывающая скобка", lineNum)
+            }
+            depth--
+        case ' ', '\t', '\r':
+            flush()
+        case '\n':
+            flush()
+            if depth == 0 {
+                if len(cur.tokens) > 0 {
+                    lines = append(lines, cur)
+                }
+                cur = zoneLine{num: lineNum}
+                lineStart = true
+            }
+        default:
+            tok.WriteByte(c)
+            inTok = true
+        }
+    }
+
+    if quoted {
+        return nil, errors.New("не закрыта кавычка в конце файла")
+    }
+    if depth > 0 {
+        return nil, errors.New("не закрыта скобка в конце файла")
+    }
+    flush()
+    if len(cur.tokens) > 0 {
+        lines = append(lines, cur)
+    }
+    return lines, nil
+}
+
+// parseZoneTTL разбирает TTL в секундах или с единицами (1h30m, 2d)
+func parseZoneTTL(s string) (int, bool) {
+    if s == "" || !isDigit(s[0]) {
+        return 0, false
+    }
+    if v, err := strconv.Atoi(s); err == nil {
+        return v, true
+    }
+
+    units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+    total, n := 0, -1
+    for i := 0; i < len(s); i++ {
+        c := s[i] | 0x20
+        if isDigit(s[i]) {
+            if n < 0 {
+                n = 0
+            }
+            n = n*10 + int(s[i]-'0')
+            continue
+        }
+        mult, ok := units[c]
+        if !ok || n < 0 {
+            return 0, false
+        }
+        total += n * mult
+        n = -1
+    }
+    if n >= 0 {
+        return 0, false
+    }
+    return total, true
+}
+
+// zoneAbsName приводит имя из файла зоны к полному имени без завершающей точки
+func zoneAbsName(name, origin string) string {
+    name = strings.ToLower(name)
+    switch {
+    case name == "@":
+        return origin
+    case strings.HasSuffix(name, "."):
+        return strings.TrimSuffix(name, ".")
+    default:
+        return name + "." + origin
+    }
+}
+
+// zoneTargetName переводит имя из данных записи (цель CNAME, NS, PTR, MX) в
+// форму хранения панели: имя с точкой — абсолютное, одна метка — имя внутри
+// домена. Относительные имена файла зоны дополняются текущим $ORIGIN.
+func zoneTargetName(target, origin, zone string) string {
+    abs := zoneAbsName(target, origin)
+    if label := strings.TrimSuffix(abs, "."+zone); label != abs && !strings.Contains(label, ".") {
+        return label
+    }
+    if !strings.Contains(abs, ".") {
+        // Абсолютное имя из одной метки без точки приняли бы за имя в домене
+        return abs + "."
+    }
+    return abs
+}
+
+// ParseZoneFile разбирает файл зоны в формате RFC 1035 и возвращает записи
+// с именами относительно домена. Директивы $ORIGIN и $TTL поддерживаются,
+// неподдерживаемые записи пропускаются с предупреждением.
+func ParseZoneFile(text, domainName string) ([]models.Record, []string, error) {
+    lines, err := tokenizeZone(text)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    zone := strings.ToLower(strings.TrimSuffix(domainName, "."))
+    origin := zone
+    defaultTTL := 0
+    owner := ""
+
+    var records []models.Record
+    var warnings []string
+    warn := func(line int, format string, args ...interface{}) {
+        warnings = append(warnings, fmt.Sprintf("Строка %d: ", line)+fmt.Sprintf(format, args...))
+    }
+
+    for _, line := range lines {
+        t := line.tokens
+
+        if strings.HasPrefix(t[0], "$") && !line.blankOwner {
+            switch strings.ToUpper(t[0]) {
+            case "$ORIGIN":
+                if len(t) < 2 {
+                    return nil, nil, fmt.Errorf("строка %d: $ORIGIN без имени", line.num)
+                }
+                origin = zoneAbsName(t[1], origin)
+            case "$TTL":
+                ttl, ok := 0, len(t) > 1
+                if ok {
+                    ttl, ok = parseZoneTTL(t[1])
+                }
+                if !ok {
+                    return nil, nil, fmt.Errorf("строка %d: некорректный $TTL", line.num)
+                }
+                defaultTTL = ttl
+            default:
+                warn(line.num, "директива %s не поддерживается", t[0])
+            }
+            continue
+        }
+
+        if !line.blankOwner {
+            owner = zoneAbsName(t[0], origin)
+            t = t[1:]
+        } else if owner == "" {
+            return nil, nil, fmt.Errorf("строка %d: не указано имя записи", line.num)
+        }
+
+        ttl, rrType := defaultTTL, ""
+        for len(t) > 0 && rrType == "" {
+            tok := t[0]
+            t = t[1:]
+            if v, ok := parseZoneTTL(tok); ok {
+                ttl = v
+            } else if upper := strings.ToUpper(tok); upper != "IN" && upper != "CH" && upper != "HS" {
+                rrType = upper
+            }
+        }
+        if rrType == "" {
+            return nil, nil, fmt.Errorf("строка %d: не указан тип записи", line.num)
+        }
+        if rrType == "SOA" {
+            continue
+        }
+        if !ImportableTypes[rrType] {
+            warn(line.num, "записи %s не поддерживаются", rrType)
+            continue
+        }
+
+        name := "@"
+        if owner != zone {
+            if !strings.HasSuffix(owner, "."+zone) {
+                warn(line.num, "имя %s вне зоны %s", owner, zone)
+                continue
+            }
+            name = strings.TrimSuffix(owner, "."+zone)
+        }
+
+        record := models.Record{Type: rrType, Name: name, TTL: ttl}
+        switch rrType {
+        case "TXT":
+            // Строки в кавычках передаются как есть, без кавычек — каждое слово отдельной строкой
+            chunks, err := ParseTXT(strings.Join(t, " "))
+            if err != nil {
+                warn(line.num, "некорректная TXT запись: %v", err)
+                continue
+            }
+            record.Content = FormatTXT(chunks)
+        case "MX":
+            if len(t) != 2 {
+                warn(line.num, "MX запись должна содержать приоритет и сервер")
+                continue
+            }
+            priority, err := strconv.Atoi(t[0])
+            if err != nil {
+                warn(line.num, "некорректный приоритет MX: %s", t[0])
+                continue
+            }
+            record.Priority = priority
+            record.Content = zoneTargetName(t[1], origin, zone)
+        default:
+            if len(t) != 1 {
+                warn(line.num, "запись %s должна содержать одно значение", rrType)
+                continue
+            }
+            record.Content = t[0]
+            if rrType == "CNAME" || rrType == "NS" || rrType == "PTR" {
+                record.Content = zoneTargetName(t[0], origin, zone)
+            }
+        }
+        records = append(records, record)
+    }
+    return records, warnings, nil
+}
+
+// ImportZone добавляет в домен записи из файла зоны. Уже существующие и
+// конфликтующие записи не добавляются и возвращаются в результате.
+func ImportZone(db *models.DB, userID int64, userRole string, domain *models.Domain,
+    text string, defaultTTL int, dryRun bool) (*RecordSetResult, error) {
+
+    records, warnings, err := ParseZoneFile(text, domain.Name)
+    if err != nil {
+        return nil, err
+    }
+    for i := range records {
+        if records[i].TTL == 0 {
+            records[i].TTL = defaultTTL
+        }
+    }
+
+    result := &RecordSetResult{Warnings: warnings}
+    if err := applyRecordSet(db, userID, userRole, domain, records, dryRun, result); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
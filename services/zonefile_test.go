@@ -0,0 +1,51 @@
+package services
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseZoneFileTargets(t *testing.T) {
+    text := `$TTL 300
+@        IN NS    ns1
+@        IN NS    ns2.example.net.
+@        IN MX    10 mail
+@        IN MX    20 @
+www      IN CNAME @
+api      IN CNAME web.sub
+ext      IN CNAME cdn.example.net.
+loc      IN CNAME localhost.
+$ORIGIN sub.example.com.
+app      IN CNAME web
+1        IN PTR   host
+`
+    records, warnings, err := ParseZoneFile(text, "example.com")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(warnings) != 0 {
+        t.Errorf("предупреждения %q", warnings)
+    }
+    got := make([]string, len(records))
+    for i, r := range records {
+        got[i] = r.Name + " " + r.Type + " " + r.Content
+    }
+    want := []string{
+        "@ NS ns1",
+        "@ NS ns2.example.net",
+        "@ MX mail",
+        "@ MX example.com",
+        "www CNAME example.com",
+        "api CNAME web.sub.example.com",
+        "ext CNAME cdn.example.net",
+        "loc CNAME localhost.",
+        "app.sub CNAME web.sub.example.com",
+        "1.sub PTR host.sub.example.com",
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("записи\n%q\nожидались\n%q", got, want)
+    }
+    if records[2].Priority != 10 || records[3].Priority != 20 {
+        t.Errorf("приоритеты MX %d и %d", records[2].Priority, records[3].Priority)
+    }
+}
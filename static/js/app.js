@@ -2,6 +2,11 @@ $(document).ready(function() {
     console.log('DNS Manager JS loaded');
     let currentDomainId = null;
 
+    // Права текущей роли передаёт страница в window.capabilities
+    function can(capability) {
+        return !!(window.capabilities && window.capabilities[capability]);
+    }
+
     // Авторизация
     $('#loginForm').submit(function(e) {
         e.preventDefault();
@@ -32,6 +37,25 @@ $(document).ready(function() {
         });
     });
 
+    // Возврат из режима работы от имени пользователя
+    $('#stopImpersonationBtn').click(function() {
+        $.ajax({
+            url: '/api/impersonate/stop',
+            method: 'POST',
+            xhrFields: { withCredentials: true },
+            success: function(resp) {
+                if (resp.success) {
+                    window.location.href = '/admin/users';
+                } else {
+                    alert(resp.message || 'Ошибка');
+                }
+            },
+            error: function(xhr) {
+                alert('Ошибка соединения: ' + xhr.statusText);
+            }
+        });
+    });
+
     // Выход (только один обработчик)
     $('#logoutBtn').click(function(e) {
         e.preventDefault();
@@ -87,12 +111,31 @@ $(document).ready(function() {
         });
     });
 
+    // Шаблоны записей для нового домена
+    $('#domainModal').on('show.bs.modal', function() {
+        const select = $('select[name="template_id"]');
+        $.getJSON('/api/templates', function(templates) {
+            select.find('option:not(:first)').remove();
+            (templates || []).forEach(function(t) {
+                const owner = t.OwnerID === 0 ? 'общий' : t.OwnerName;
+                select.append($('<option>').val(t.ID).text(t.Name + ' (' + owner + ', записей: ' + (t.Records || []).length + ')'));
+            });
+        });
+    });
+
     // Создание домена
+    // Для вторичной зоны нужны первичные серверы вместо шаблона
+    $('select[name="type"]').change(function() {
+        const secondary = $(this).val() === 'secondary';
+        $('#secondaryFields').toggle(secondary);
+        $('select[name="template_id"]').prop('disabled', secondary);
+    });
+
     $('#saveDomainBtn').click(function() {
         console.log('Save domain clicked');
         
         const domain = $('input[name="name"]').val();
-        const domainPattern = /^(?:(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,})$/;
+        const domainPattern = /^(?:(?:[\p{L}\p{N}](?:[\p{L}\p{N}-]{0,61}[\p{L}\p{N}])?\.)+(?:\p{L}{2,}|xn--[a-z0-9-]+))$/iu;
         
         if (!domainPattern.test(domain)) {
             alert('Некорректное имя домена');
@@ -101,7 +144,7 @@ $(document).ready(function() {
 
         let formData = {};
 
-        if (window.userRole === 'admin') {
+        if (can('write_all_domains')) {
             formData = {
                 name: domain,
                 soa_email: $('input[name="soa_email"]').val(),
@@ -121,6 +164,14 @@ $(document).ready(function() {
             };
         }
 
+        formData.template_id = parseInt($('select[name="template_id"]').val()) || 0;
+        if ($('select[name="type"]').val() === 'secondary') {
+            formData.type = 'secondary';
+            formData.primaries = $('input[name="primaries"]').val().split(',').map(s => s.trim()).filter(s => s);
+            formData.tsig_key = $('input[name="tsig_key"]').val().trim();
+            formData.template_id = 0;
+        }
+
         console.log('Sending data:', formData);
 
         $.ajax({
@@ -134,6 +185,9 @@ $(document).ready(function() {
                 console.log('Create domain response:', resp);
                 if (resp.success) {
                     $('#domainModal').modal('hide');
+                    if ((resp.conflicts && resp.conflicts.length) || (resp.skipped && resp.skipped.length)) {
+                        alert(resp.message);
+                    }
                     location.reload();
                 } else {
                     alert(resp.message || 'Ошибка создания домена');
@@ -154,7 +208,9 @@ $(document).ready(function() {
         let id = $(this).data('id');
         currentDomainId = id;
         
-        $('#addRecordBtn, #syncNSDBtn').show();
+        $('#syncNSDBtn').show();
+        // Записи вторичной зоны редактируются на первичном сервере
+        $('#addRecordBtn').toggle($(this).data('kind') !== 'secondary');
         $('#currentDomainTitle').html('<i class="bi bi-diagram-3 me-2"></i>' + $(this).find('.domain-name').text());
         
         $.ajax({
@@ -200,8 +256,9 @@ $(document).ready(function() {
         $('#recordDomainId').val(currentDomainId);
         $('#recordModalTitle').html('Добавить запись');
         $('#priorityField').hide();
+        $('#ptrField').hide();
         
-        if (window.userRole !== 'admin') {
+        if (!can('write_all_domains')) {
             $('#recordType option').show();
             if (!window.allowUsersCreateNS) {
                 $('#recordType option[value="NS"]').hide();
@@ -218,7 +275,7 @@ $(document).ready(function() {
     $(document).on('click', '.edit-record', function() {
         $('#recordId').val($(this).data('id'));
         $('#recordDomainId').val(currentDomainId);
-        $('#recordType').val($(this).data('type'));
+        $('#recordType').val($(this).data('type')).trigger('change');
         $('#recordName').val($(this).data('name'));
         $('#recordContent').val($(this).data('content'));
         $('#recordPriority').val($(this).data('priority'));
@@ -226,7 +283,7 @@ $(document).ready(function() {
         
         $('#recordModalTitle').html('Редактировать запись');
         
-        if (window.userRole !== 'admin') {
+        if (!can('write_all_domains')) {
             $('#recordType').prop('disabled', true);
         } else {
             $('#recordType').prop('disabled', false);
@@ -236,6 +293,15 @@ $(document).ready(function() {
     });
 
     // Сохранение записи
+    // PTR можно создать только для адресных записей
+    $('#recordType').change(function() {
+        const isAddress = $(this).val() === 'A' || $(this).val() === 'AAAA';
+        $('#ptrField').toggle(isAddress);
+        if (!isAddress) {
+            $('#recordPtr').prop('checked', false);
+        }
+    });
+
     $('#saveRecordBtn').click(function() {
         let method = $('#recordId').val() ? 'PUT' : 'POST';
         let url = $('#recordId').val() ? '/api/records/' + $('#recordId').val() : '/api/records';
@@ -250,14 +316,19 @@ $(document).ready(function() {
                 name: $('#recordName').val(),
                 content: $('#recordContent').val(),
                 priority: $('#recordPriority').val(),
-                ttl: $('#recordTtl').val()
+                ttl: $('#recordTtl').val(),
+                ptr: $('#recordPtr').is(':checked')
             }),
             contentType: 'application/json',
             xhrFields: { withCredentials: true },
             success: function(resp) {
                 if (resp.success) {
                     $('#recordModal').modal('hide');
+                    if (resp.ptr_error) {
+                        alert(resp.ptr_error);
+                    }
                     refreshRecords();
+                    refreshDomainUsage();
                 } else {
                     alert(resp.message || 'Ошибка сохранения');
                 }
@@ -280,6 +351,7 @@ $(document).ready(function() {
             success: function(resp) {
                 if (resp.success) {
                     refreshRecords();
+                    refreshDomainUsage();
                 } else {
                     alert(resp.message || 'Ошибка удаления');
                 }
@@ -338,6 +410,28 @@ $(document).ready(function() {
         });
     }
 
+    function usageText(used, limit) {
+        return limit > 0 ? used + ' / ' + limit : String(used);
+    }
+
+    // Обновляет число записей в списке доменов и квоту пользователя
+    function refreshDomainUsage() {
+        $.ajax({
+            url: '/api/domains',
+            method: 'GET',
+            xhrFields: { withCredentials: true },
+            success: function(resp) {
+                if (!resp.success) return;
+                (resp.domains || []).forEach(function(d) {
+                    $('.domain-usage[data-id="' + d.ID + '"] .usage-value').text(usageText(d.RecordCount, d.RecordLimit));
+                });
+                if (resp.quota) {
+                    $('#domainQuota').text(usageText(resp.quota.Domains, resp.quota.Limits.MaxDomains));
+                }
+            }
+        });
+    }
+
     function renderRecordsTable(records) {
         let html = '<div class="table-responsive"><table class="table table-hover"><thead><tr><th>Имя</th><th>TTL</th><th>Тип</th><th>Значение</th><th>Приоритет</th><th>Действия</th></tr></thead><tbody>';
         
@@ -348,7 +442,7 @@ $(document).ready(function() {
             else if (r.Type === 'MX') badgeClass = 'warning';
             
             html += '<tr>';
-            html += '<td>' + (r.Name || '@') + '</td>';
+            html += '<td>' + (r.UnicodeName || r.Name || '@') + (r.UnicodeName && r.UnicodeName !== r.Name ? ' <small class="text-muted">' + r.Name + '</small>' : '') + '</td>';
             html += '<td>' + r.TTL + '</td>';
             html += '<td><span class="badge bg-' + badgeClass + '">' + r.Type + '</span></td>';
             html += '<td>' + (r.Content || '') + '</td>';